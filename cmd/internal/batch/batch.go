@@ -0,0 +1,160 @@
+// Package batch has the pieces the commands share for working through lots of
+// diagrams at once: turning arguments into a list of files, and processing
+// them in parallel while still writing the results out in order.
+package batch
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultInclude is used when no -include globs are given.
+var DefaultInclude = Globs{"*.uml", "*.puml", "*.plantuml", "*.pu"}
+
+// Globs is a list of filepath.Match patterns that can be used as a repeatable
+// flag. Patterns without a slash are matched against file names, and patterns
+// with one against the path from the directory being searched.
+type Globs []string
+
+func (g *Globs) String() string {
+	if g == nil {
+		return ""
+	}
+
+	return strings.Join(*g, ",")
+}
+
+func (g *Globs) Set(s string) error {
+	if _, err := filepath.Match(s, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", s, err)
+	}
+
+	*g = append(*g, s)
+
+	return nil
+}
+
+// Match reports whether any of the patterns match a path, which should be
+// relative to the directory being searched.
+func (g Globs) Match(rel string) bool {
+	rel = filepath.ToSlash(rel)
+
+	for _, p := range g {
+		s := rel
+		if !strings.Contains(p, "/") {
+			s = rel[strings.LastIndex(rel, "/")+1:]
+		}
+
+		if ok, _ := filepath.Match(p, s); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Files turns a list of arguments into the files to process. Files named
+// directly, and "-" for stdin, are always kept, even if they don't exist, so
+// that the error shows up when they're read. Directories are searched for
+// files that match include and don't match exclude, and directories that
+// match exclude are skipped entirely.
+func Files(args []string, include, exclude Globs) ([]string, error) {
+	var files []string
+
+	for _, a := range args {
+		if fi, err := os.Stat(a); a == "-" || err != nil || !fi.IsDir() {
+			files = append(files, a)
+			continue
+		}
+
+		if err := filepath.WalkDir(a, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if p == a {
+				return nil
+			}
+
+			rel, err := filepath.Rel(a, p)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case exclude.Match(rel) && d.IsDir():
+				return filepath.SkipDir
+			case exclude.Match(rel), d.IsDir():
+			case include.Match(rel):
+				files = append(files, p)
+			}
+
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("Files: %w", err)
+		}
+	}
+
+	return files, nil
+}
+
+// Read reads a file, or stdin if the name is "-".
+func Read(name string) ([]byte, error) {
+	if name == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+
+	return ioutil.ReadFile(name)
+}
+
+type Result struct {
+	Name   string
+	Output []byte
+	Err    error
+}
+
+// Run reads each file and passes it to fn, using up to jobs goroutines at a
+// time. done is called with the results in the same order as files, no matter
+// which order they finish in, so output stays the same from run to run.
+func Run(files []string, jobs int, fn func(name string, src []byte) ([]byte, error), done func(r Result)) {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	results := make([]chan Result, len(files))
+	for i := range results {
+		results[i] = make(chan Result, 1)
+	}
+
+	work := make(chan int)
+	go func() {
+		for i := range files {
+			work <- i
+		}
+		close(work)
+	}()
+
+	for i := 0; i < jobs; i++ {
+		go func() {
+			for i := range work {
+				r := Result{Name: files[i]}
+
+				if src, err := Read(files[i]); err != nil {
+					r.Err = fmt.Errorf("error reading %s: %w", files[i], err)
+				} else {
+					r.Output, r.Err = fn(files[i], src)
+				}
+
+				results[i] <- r
+			}
+		}()
+	}
+
+	for _, c := range results {
+		done(<-c)
+	}
+}
@@ -0,0 +1,88 @@
+package batch
+
+import (
+  "errors"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+)
+
+func TestFiles(t *testing.T) {
+  a := assert.New(t)
+
+  dir, err := ioutil.TempDir("", "batch")
+  if !a.NoError(err) {
+    return
+  }
+  defer os.RemoveAll(dir)
+
+  for _, f := range []string{"a.uml", "b.txt", "sub/c.puml", "sub/gen/d.uml", "vendor/e.uml"} {
+    p := filepath.Join(dir, filepath.FromSlash(f))
+    a.NoError(os.MkdirAll(filepath.Dir(p), 0755))
+    a.NoError(ioutil.WriteFile(p, []byte("@startuml\n@enduml\n"), 0644))
+  }
+
+  files, err := Files([]string{dir, "-", "missing.uml"}, DefaultInclude, Globs{"vendor", "sub/gen"})
+  if a.NoError(err) {
+    a.Equal([]string{
+      filepath.Join(dir, "a.uml"),
+      filepath.Join(dir, "sub", "c.puml"),
+      "-",
+      "missing.uml",
+    }, files)
+  }
+
+  files, err = Files([]string{dir}, Globs{"*.txt"}, nil)
+  if a.NoError(err) {
+    a.Equal([]string{filepath.Join(dir, "b.txt")}, files)
+  }
+
+  var g Globs
+  a.Error(g.Set("[a"))
+  a.NoError(g.Set("*.uml"))
+  a.True(g.Match("x/y.uml"))
+  a.False(g.Match("x/y.puml"))
+}
+
+func TestRun(t *testing.T) {
+  a := assert.New(t)
+
+  dir, err := ioutil.TempDir("", "batch")
+  if !a.NoError(err) {
+    return
+  }
+  defer os.RemoveAll(dir)
+
+  var files []string
+  for _, s := range []string{"one", "two", "three", "four", "five"} {
+    p := filepath.Join(dir, s)
+    a.NoError(ioutil.WriteFile(p, []byte(s), 0644))
+    files = append(files, p)
+  }
+  files = append(files, filepath.Join(dir, "missing"))
+
+  var got []string
+  var failed []string
+
+  Run(files, 3, func(name string, src []byte) ([]byte, error) {
+    if string(src) == "three" {
+      return nil, errors.New("bad")
+    }
+
+    return []byte(strings.ToUpper(string(src))), nil
+  }, func(r Result) {
+    if r.Err != nil {
+      failed = append(failed, filepath.Base(r.Name))
+      return
+    }
+
+    got = append(got, string(r.Output))
+  })
+
+  a.Equal([]string{"ONE", "TWO", "FOUR", "FIVE"}, got)
+  a.Equal([]string{"three", "missing"}, failed)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"fknsrs.biz/p/plantuml/diff"
+	"fknsrs.biz/p/plantuml/parser"
+)
+
+var (
+	jsonOutput bool
+)
+
+func init() {
+	flag.BoolVar(&jsonOutput, "json", false, "print changes as JSON")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] old.puml new.puml\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+func readDocument(f string) *parser.DocumentNode {
+	src, err := ioutil.ReadFile(f)
+	if err != nil {
+		log.Printf("error reading %s: %s\n", f, err)
+		os.Exit(2)
+	}
+
+	doc, err := parser.ParseDocument(string(src))
+	if err != nil {
+		log.Printf("error parsing %s: %s\n", f, err)
+		os.Exit(2)
+	}
+
+	return doc
+}
+
+// like diff(1), umldiff exits with 1 when the documents differ and 2 when
+// something went wrong.
+func main() {
+	flag.Parse()
+
+	log.SetOutput(os.Stderr)
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	a, b := readDocument(flag.Arg(0)), readDocument(flag.Arg(1))
+
+	changes := diff.Diff(*a, *b)
+
+	if jsonOutput {
+		if changes == nil {
+			changes = []diff.Change{}
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(changes); err != nil {
+			log.Printf("error writing changes: %s\n", err)
+			os.Exit(2)
+		}
+	} else {
+		for _, c := range changes {
+			fmt.Println(c.String())
+		}
+	}
+
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+}
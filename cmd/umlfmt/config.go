@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"fknsrs.biz/p/plantuml/parser"
+)
+
+// configName is the file that umlfmt looks for in the directory of each file
+// it formats, and then each directory above that, to find its options.
+const configName = ".umlfmt.yaml"
+
+type config struct {
+	options parser.FormatOptions
+	err     error
+}
+
+var (
+	configsLock sync.Mutex
+	configs     = map[string]config{}
+)
+
+// findOptions finds the options for a file, or for stdin if the name is "-".
+func findOptions(name string) (parser.FormatOptions, error) {
+	dir := "."
+	if name != "-" {
+		dir = filepath.Dir(name)
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return parser.FormatOptions{}, err
+	}
+
+	c := lookupConfig(abs)
+
+	return c.options, c.err
+}
+
+func lookupConfig(dir string) config {
+	configsLock.Lock()
+	c, ok := configs[dir]
+	configsLock.Unlock()
+
+	if ok {
+		return c
+	}
+
+	p := filepath.Join(dir, configName)
+
+	switch _, err := os.Stat(p); {
+	case err == nil:
+		c.options, c.err = loadConfig(p)
+	case !os.IsNotExist(err):
+		c.err = err
+	case filepath.Dir(dir) != dir:
+		c = lookupConfig(filepath.Dir(dir))
+	}
+
+	configsLock.Lock()
+	configs[dir] = c
+	configsLock.Unlock()
+
+	return c
+}
+
+func loadConfig(p string) (parser.FormatOptions, error) {
+	var o parser.FormatOptions
+
+	f, err := os.Open(p)
+	if err != nil {
+		return o, err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+
+	if err := dec.Decode(&o); err != nil && !errors.Is(err, io.EOF) {
+		return o, fmt.Errorf("error reading %s: %w", p, err)
+	}
+
+	if err := o.Validate(); err != nil {
+		return o, fmt.Errorf("error reading %s: %w", p, err)
+	}
+
+	return o, nil
+}
@@ -4,65 +4,139 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"runtime"
+	"sync/atomic"
 
+	"github.com/pmezard/go-difflib/difflib"
+
+	"fknsrs.biz/p/plantuml/cmd/internal/batch"
 	"fknsrs.biz/p/plantuml/parser"
 )
 
 var (
-	list  bool
-	write bool
+	list    bool
+	write   bool
+	diff    bool
+	check   bool
+	jobs    int
+	include batch.Globs
+	exclude batch.Globs
 )
 
 func init() {
 	flag.BoolVar(&list, "l", false, "list files whose formatting differs from umlfmt's")
 	flag.BoolVar(&write, "w", false, "write result to (source) file instead of stdout")
+	flag.BoolVar(&diff, "d", false, "display diffs instead of rewriting files")
+	flag.BoolVar(&check, "check", false, "exit with 1 if any files' formatting differs from umlfmt's (prints nothing unless used with -l or -d)")
+	flag.IntVar(&jobs, "j", runtime.NumCPU(), "number of files to process at once")
+	flag.Var(&include, "include", "when searching directories, only process files that match this glob (can be repeated; default "+batch.DefaultInclude.String()+")")
+	flag.Var(&exclude, "exclude", "skip files and directories that match this glob (can be repeated)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [file or directory or -]...\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "\nformatting options are read from the closest %s to each file, looking upwards from its directory\n", configName)
+	}
 }
 
-func main() {
-	flag.Parse()
+// changed is set once any file's formatting differs, for -check.
+var changed int32
 
-	log.SetOutput(os.Stderr)
+func format(name string, src []byte) ([]byte, error) {
+	doc, err := parser.ParseDocument(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", name, err)
+	}
 
-	for _, f := range flag.Args() {
-		src, err := ioutil.ReadFile(f)
-		if err != nil {
-			log.Printf("error reading %s: %s\n", f, err)
-			continue
-		}
+	opts, err := findOptions(name)
+	if err != nil {
+		return nil, err
+	}
 
-		doc, err := parser.ParseDocument(string(src))
+	buf := bytes.NewBuffer(nil)
+	if err := parser.FormatDocumentWithOptions(*doc, buf, opts); err != nil {
+		return nil, fmt.Errorf("error formatting %s: %w", name, err)
+	}
+	res := buf.Bytes()
+
+	// without -w, -l, -d or -check, umlfmt prints what it was given, whether
+	// that changed or not.
+	if !list && !diff && !check && (!write || name == "-") {
+		return res, nil
+	}
+
+	if bytes.Equal(bytes.TrimSpace(src), bytes.TrimSpace(res)) {
+		return nil, nil
+	}
+
+	atomic.StoreInt32(&changed, 1)
+
+	var out []byte
+
+	if list {
+		out = append(out, name+"\n"...)
+	}
+
+	if diff {
+		d, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(src)),
+			B:        difflib.SplitLines(string(res)),
+			FromFile: name + ".orig",
+			ToFile:   name,
+			Context:  3,
+		})
 		if err != nil {
-			log.Printf("error parsing %s: %s\n", f, err)
-			continue
+			return nil, fmt.Errorf("error diffing %s: %w", name, err)
 		}
 
-		buf := bytes.NewBuffer(nil)
-		if err := parser.FormatDocument(*doc, buf); err != nil {
-			log.Printf("error formatting %s: %s\n", f, err)
-			continue
-		}
-		res := buf.Bytes()
+		out = append(out, fmt.Sprintf("diff %s.orig %s\n%s", name, name, d)...)
+	}
 
-		if bytes.Equal(bytes.TrimSpace(src), bytes.TrimSpace(res)) {
-			continue
+	if write && name != "-" {
+		if err := ioutil.WriteFile(name, res, 0644); err != nil {
+			return nil, fmt.Errorf("error writing %s: %w", name, err)
 		}
+	}
 
-		if list {
-			fmt.Println(f)
-			continue
-		}
+	return out, nil
+}
+
+// umlfmt exits with 2 if any files couldn't be read, parsed, formatted or
+// written, and with -check, 1 if any files weren't already formatted.
+func main() {
+	flag.Parse()
 
-		if write {
-			if err := ioutil.WriteFile(f, res, 0644); err != nil {
-				log.Printf("error writing %s: %s\n", f, err)
-				continue
-			}
-		} else {
-			io.Copy(os.Stdout, bytes.NewBuffer(res))
+	log.SetOutput(os.Stderr)
+
+	if len(include) == 0 {
+		include = batch.DefaultInclude
+	}
+
+	files, err := batch.Files(flag.Args(), include, exclude)
+	if err != nil {
+		log.Println(err)
+		os.Exit(2)
+	}
+
+	failed := false
+
+	batch.Run(files, jobs, format, func(r batch.Result) {
+		if r.Err != nil {
+			log.Println(r.Err)
+			failed = true
+			return
 		}
+
+		os.Stdout.Write(r.Output)
+	})
+
+	switch {
+	case failed:
+		os.Exit(2)
+	case check && atomic.LoadInt32(&changed) != 0:
+		os.Exit(1)
 	}
 }
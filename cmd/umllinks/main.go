@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fknsrs.biz/p/plantuml/parser"
+)
+
+var (
+	brokenOnly bool
+	noCheck    bool
+	root       string
+)
+
+func init() {
+	flag.BoolVar(&brokenOnly, "broken", false, "only list links that are broken")
+	flag.BoolVar(&noCheck, "n", false, "don't check relative links against the filesystem")
+	flag.StringVar(&root, "root", "", "directory that links starting with / are relative to (they aren't checked without it)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+// check looks for the target of a relative link, starting from the directory
+// the diagram is in, or from -root for links like `/docs/x` that start at the
+// top of the site. Absolute URLs, links within the same document, and links
+// from the top of the site when there's no -root, are assumed to be fine.
+func check(file, link string) error {
+	u, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return nil
+	}
+
+	var p string
+	switch {
+	case !strings.HasPrefix(u.Path, "/"):
+		p = filepath.Join(filepath.Dir(file), filepath.FromSlash(u.Path))
+	case root != "":
+		p = filepath.Join(root, filepath.FromSlash(u.Path))
+	default:
+		return nil
+	}
+
+	if _, err := os.Stat(p); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s doesn't exist", p)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// umllinks exits with 1 if any links are broken, and 2 if any files couldn't
+// be read.
+func main() {
+	flag.Parse()
+
+	log.SetOutput(os.Stderr)
+
+	broken, failed := false, false
+
+	for _, f := range flag.Args() {
+		src, err := ioutil.ReadFile(f)
+		if err != nil {
+			log.Printf("error reading %s: %s\n", f, err)
+			failed = true
+			continue
+		}
+
+		doc, err := parser.ParseDocument(string(src))
+		if err != nil {
+			log.Printf("error parsing %s: %s\n", f, err)
+			failed = true
+			continue
+		}
+
+		for _, l := range parser.FindLinks(*doc) {
+			status := ""
+			if !noCheck {
+				if err := check(f, l.URL); err != nil {
+					status = " (broken: " + err.Error() + ")"
+					broken = true
+				}
+			}
+
+			if brokenOnly && status == "" {
+				continue
+			}
+
+			label := ""
+			if l.Label != "" {
+				label = fmt.Sprintf(" %q", l.Label)
+			}
+
+			fmt.Printf("%s:%s: %s%s%s\n", f, l.SourceRange, l.URL, label, status)
+		}
+	}
+
+	switch {
+	case failed:
+		os.Exit(2)
+	case broken:
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,100 @@
+// umlmerge merges diagrams by their syntax tree rather than line by line. It
+// can be used as a git merge driver by adding this to .git/config:
+//
+//	[merge "plantuml"]
+//	  name = PlantUML diagram merge
+//	  driver = umlmerge %O %A %B
+//
+// and this to .gitattributes:
+//
+//	*.puml merge=plantuml
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"fknsrs.biz/p/plantuml/merge"
+	"fknsrs.biz/p/plantuml/parser"
+)
+
+var (
+	stdout bool
+	output string
+)
+
+func init() {
+	flag.BoolVar(&stdout, "p", false, "write result to stdout instead of the ours file")
+	flag.StringVar(&output, "o", "", "write result to this file instead of the ours file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] base ours theirs\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+func readDocument(f string) *parser.DocumentNode {
+	src, err := ioutil.ReadFile(f)
+	if err != nil {
+		log.Printf("error reading %s: %s\n", f, err)
+		os.Exit(2)
+	}
+
+	doc, err := parser.ParseDocument(string(src))
+	if err != nil {
+		log.Printf("error parsing %s: %s\n", f, err)
+		os.Exit(2)
+	}
+
+	return doc
+}
+
+// umlmerge exits with 1 when there are conflicts, and 2 when something went
+// wrong, in which case the ours file is left alone.
+func main() {
+	flag.Parse()
+
+	log.SetOutput(os.Stderr)
+
+	if flag.NArg() != 3 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	base, ours, theirs := readDocument(flag.Arg(0)), readDocument(flag.Arg(1)), readDocument(flag.Arg(2))
+
+	res := merge.Merge(*base, *ours, *theirs)
+
+	buf := bytes.NewBuffer(nil)
+	if err := res.Format(buf); err != nil {
+		log.Printf("error formatting result: %s\n", err)
+		os.Exit(2)
+	}
+
+	switch {
+	case stdout:
+		os.Stdout.Write(buf.Bytes())
+	default:
+		f := output
+		if f == "" {
+			f = flag.Arg(1)
+		}
+
+		if err := ioutil.WriteFile(f, buf.Bytes(), 0644); err != nil {
+			log.Printf("error writing %s: %s\n", f, err)
+			os.Exit(2)
+		}
+	}
+
+	for _, c := range res.Conflicts {
+		log.Println(c.String())
+	}
+
+	if len(res.Conflicts) > 0 {
+		os.Exit(1)
+	}
+}
@@ -1,34 +1,171 @@
 package main
 
 import (
+	"bytes"
 	"flag"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/davecgh/go-spew/spew"
 
+	"fknsrs.biz/p/plantuml/cmd/internal/batch"
 	"fknsrs.biz/p/plantuml/parser"
+	"fknsrs.biz/p/plantuml/render/ascii"
+	"fknsrs.biz/p/plantuml/render/svg"
 )
 
+var (
+	render    string
+	outputDir string
+	jobs      int
+	include   batch.Globs
+	exclude   batch.Globs
+)
+
+func init() {
+	flag.StringVar(&render, "render", "", "render diagrams instead of dumping the syntax tree (svg, ascii for plain text, txt for text with box drawing characters)")
+	flag.StringVar(&outputDir, "o", "", "write rendered diagrams to files in this directory instead of stdout, keeping the paths of files found in directories")
+	flag.IntVar(&jobs, "j", runtime.NumCPU(), "number of files to process at once")
+	flag.Var(&include, "include", "when searching directories, only process files that match this glob (can be repeated; default "+batch.DefaultInclude.String()+")")
+	flag.Var(&exclude, "exclude", "skip files and directories that match this glob (can be repeated)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [file or directory or -]...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+// umlparse exits with 2 if any files couldn't be read, parsed, rendered or
+// written.
 func main() {
 	flag.Parse()
 
 	log.SetOutput(os.Stderr)
 
-	for _, f := range flag.Args() {
-		src, err := ioutil.ReadFile(f)
-		if err != nil {
-			log.Printf("error reading %s: %s\n", f, err)
-			continue
+	var renderFunc func(doc parser.DocumentNode, wr io.Writer) error
+	extension := render
+
+	switch render {
+	case "", "svg":
+		renderFunc = svg.Render
+	case "ascii":
+		renderFunc = func(doc parser.DocumentNode, wr io.Writer) error { return ascii.Render(doc, wr, ascii.Plain) }
+		extension = "txt"
+	case "txt":
+		renderFunc = func(doc parser.DocumentNode, wr io.Writer) error { return ascii.Render(doc, wr, ascii.Unicode) }
+	default:
+		log.Fatalf("unknown renderer %q\n", render)
+	}
+
+	if len(include) == 0 {
+		include = batch.DefaultInclude
+	}
+
+	files, err := batch.Files(flag.Args(), include, exclude)
+	if err != nil {
+		log.Println(err)
+		os.Exit(2)
+	}
+
+	var outputs map[string]string
+	if outputDir != "" && render != "" {
+		if outputs, err = outputNames(flag.Args(), files, extension); err != nil {
+			log.Println(err)
+			os.Exit(2)
 		}
+	}
+
+	failed := false
 
+	batch.Run(files, jobs, func(f string, src []byte) ([]byte, error) {
 		doc, err := parser.ParseDocument(string(src))
 		if err != nil {
-			log.Printf("error parsing %s: %s\n", f, err)
-			continue
+			return nil, fmt.Errorf("error parsing %s: %w", f, err)
+		}
+
+		buf := bytes.NewBuffer(nil)
+
+		if render == "" {
+			spew.Fdump(buf, doc)
+			return buf.Bytes(), nil
+		}
+
+		if err := renderFunc(*doc, buf); err != nil {
+			return nil, fmt.Errorf("error rendering %s: %w", f, err)
 		}
 
-		spew.Dump(doc)
+		if outputDir == "" {
+			return buf.Bytes(), nil
+		}
+
+		name := filepath.Join(outputDir, outputs[f])
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return nil, fmt.Errorf("error writing %s: %w", name, err)
+		}
+		if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+			return nil, fmt.Errorf("error writing %s: %w", name, err)
+		}
+
+		return nil, nil
+	}, func(r batch.Result) {
+		if r.Err != nil {
+			log.Println(r.Err)
+			failed = true
+			return
+		}
+
+		os.Stdout.Write(r.Output)
+	})
+
+	if failed {
+		os.Exit(2)
 	}
 }
+
+// outputNames works out where each file's diagram goes in the output
+// directory. Files found by searching a directory keep their path from that
+// directory, and files named directly just keep their name. Two files that
+// would end up at the same place are an error, rather than one of them
+// quietly replacing the other.
+func outputNames(args, files []string, extension string) (map[string]string, error) {
+	var roots []string
+	for _, a := range args {
+		if fi, err := os.Stat(a); a != "-" && err == nil && fi.IsDir() {
+			roots = append(roots, a)
+		}
+	}
+
+	names := make(map[string]string)
+	sources := make(map[string]string)
+
+	for _, f := range files {
+		name := filepath.Base(f)
+		if f == "-" {
+			name = "stdin"
+		} else {
+			for _, r := range roots {
+				if rel, err := filepath.Rel(r, f); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+					name = rel
+					break
+				}
+			}
+		}
+
+		name = strings.TrimSuffix(name, filepath.Ext(name)) + "." + extension
+
+		if other, ok := sources[name]; ok {
+			return nil, fmt.Errorf("both %s and %s would be written to %s", other, f, filepath.Join(outputDir, name))
+		}
+
+		names[f] = name
+		sources[name] = f
+	}
+
+	return names, nil
+}
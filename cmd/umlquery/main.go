@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"fknsrs.biz/p/plantuml/parser"
+)
+
+var (
+	count bool
+)
+
+func init() {
+	flag.BoolVar(&count, "c", false, "only print the number of matching nodes in each file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] selector file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+// summary is the first line of a node's formatted source.
+func summary(n parser.Node) string {
+	buf := bytes.NewBuffer(nil)
+	parser.FormatNode(n, buf)
+
+	s := strings.TrimSpace(buf.String())
+	if i := strings.Index(s, "\n"); i != -1 {
+		s = strings.TrimSpace(s[0:i]) + " ..."
+	}
+
+	return s
+}
+
+// like grep, umlquery exits with 1 when nothing matched and 2 when something
+// went wrong.
+func main() {
+	flag.Parse()
+
+	log.SetOutput(os.Stderr)
+
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	sel, err := parser.CompileSelector(flag.Arg(0))
+	if err != nil {
+		log.Printf("error in selector: %s\n", err)
+		os.Exit(2)
+	}
+
+	matched, failed := false, false
+
+	for _, f := range flag.Args()[1:] {
+		src, err := ioutil.ReadFile(f)
+		if err != nil {
+			log.Printf("error reading %s: %s\n", f, err)
+			failed = true
+			continue
+		}
+
+		doc, err := parser.ParseDocument(string(src))
+		if err != nil {
+			log.Printf("error parsing %s: %s\n", f, err)
+			failed = true
+			continue
+		}
+
+		nodes := sel.Query(*doc)
+		if len(nodes) > 0 {
+			matched = true
+		}
+
+		if count {
+			fmt.Printf("%s: %d\n", f, len(nodes))
+			continue
+		}
+
+		for _, n := range nodes {
+			var r parser.SourceRange
+			if n, ok := n.(interface{ GetSourceRange() parser.SourceRange }); ok {
+				r = n.GetSourceRange()
+			}
+
+			fmt.Printf("%s:%s: %s: %s\n", f, r, n.NodeName(), summary(n))
+		}
+	}
+
+	switch {
+	case failed:
+		os.Exit(2)
+	case !matched:
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,118 @@
+// umlschema reads SQL migrations and writes an entity relationship diagram of
+// the schema they build. With -check, it compares the schema to a diagram
+// instead, so that documentation can be kept in step with the migrations.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"fknsrs.biz/p/plantuml/parser"
+	"fknsrs.biz/p/plantuml/schema"
+)
+
+var (
+	output string
+	check  string
+)
+
+func init() {
+	flag.StringVar(&output, "o", "", "write the diagram to this file instead of stdout")
+	flag.StringVar(&check, "check", "", "compare the schema to this diagram instead of writing one")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] migration.sql...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+// umlschema exits with 1 when -check finds differences, and 2 when something
+// went wrong. Migrations are read in the order they're given, or from stdin
+// if there aren't any.
+func main() {
+	flag.Parse()
+
+	log.SetOutput(os.Stderr)
+
+	var src []byte
+	if flag.NArg() == 0 {
+		d, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			log.Printf("error reading stdin: %s\n", err)
+			os.Exit(2)
+		}
+
+		src = d
+	}
+
+	for _, f := range flag.Args() {
+		d, err := ioutil.ReadFile(f)
+		if err != nil {
+			log.Printf("error reading %s: %s\n", f, err)
+			os.Exit(2)
+		}
+
+		// each file ends its last statement, even if it's missing a
+		// semicolon.
+		src = append(append(src, d...), ";\n"...)
+	}
+
+	s, err := schema.FromSQL(string(src))
+	if err != nil {
+		log.Printf("error reading migrations: %s\n", err)
+		os.Exit(2)
+	}
+
+	if check != "" {
+		d, err := ioutil.ReadFile(check)
+		if err != nil {
+			log.Printf("error reading %s: %s\n", check, err)
+			os.Exit(2)
+		}
+
+		doc, err := parser.ParseDocument(string(d))
+		if err != nil {
+			log.Printf("error parsing %s: %s\n", check, err)
+			os.Exit(2)
+		}
+
+		documented, err := schema.FromDiagram(*doc)
+		if err != nil {
+			log.Printf("error reading %s: %s\n", check, err)
+			os.Exit(2)
+		}
+
+		// the diagram is the old side, so that "-" means it has something
+		// the migrations don't.
+		changes := schema.Diff(documented, s)
+		for _, c := range changes {
+			fmt.Println(c.String())
+		}
+
+		if len(changes) > 0 {
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := parser.FormatDocument(s.Diagram(), buf); err != nil {
+		log.Printf("error formatting diagram: %s\n", err)
+		os.Exit(2)
+	}
+
+	if output == "" {
+		os.Stdout.Write(buf.Bytes())
+		return
+	}
+
+	if err := ioutil.WriteFile(output, buf.Bytes(), 0644); err != nil {
+		log.Printf("error writing %s: %s\n", output, err)
+		os.Exit(2)
+	}
+}
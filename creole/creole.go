@@ -0,0 +1,424 @@
+package creole
+
+import (
+	"regexp"
+	"strings"
+)
+
+type Kind int
+
+const (
+	Document Kind = iota
+	Paragraph
+	Heading
+	Rule
+	List
+	ListItem
+	Table
+	TableRow
+	TableCell
+	Text
+	LineBreak
+	Bold
+	Italic
+	Monospace
+	Strike
+	Underline
+	Waved
+	Colour
+	Background
+	Size
+	Font
+	Subscript
+	Superscript
+	Link
+	Icon
+	Image
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Document:
+		return "Document"
+	case Paragraph:
+		return "Paragraph"
+	case Heading:
+		return "Heading"
+	case Rule:
+		return "Rule"
+	case List:
+		return "List"
+	case ListItem:
+		return "ListItem"
+	case Table:
+		return "Table"
+	case TableRow:
+		return "TableRow"
+	case TableCell:
+		return "TableCell"
+	case Text:
+		return "Text"
+	case LineBreak:
+		return "LineBreak"
+	case Bold:
+		return "Bold"
+	case Italic:
+		return "Italic"
+	case Monospace:
+		return "Monospace"
+	case Strike:
+		return "Strike"
+	case Underline:
+		return "Underline"
+	case Waved:
+		return "Waved"
+	case Colour:
+		return "Colour"
+	case Background:
+		return "Background"
+	case Size:
+		return "Size"
+	case Font:
+		return "Font"
+	case Subscript:
+		return "Subscript"
+	case Superscript:
+		return "Superscript"
+	case Link:
+		return "Link"
+	case Icon:
+		return "Icon"
+	case Image:
+		return "Image"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Node is an element of rich text. Text nodes hold their text in Text, and
+// Value holds whatever else a node needs: the colour for Colour and
+// Background, the size for Size, the font for Font, the URL for Link and
+// Image, the name for Icon, the background colour for TableCell, and the
+// line style (one of "-", "=", "." or "_") for Rule.
+type Node struct {
+	Kind     Kind
+	Text     string
+	Value    string
+	Level    int
+	Ordered  bool
+	Header   bool
+	Children []Node
+}
+
+var (
+	headingPattern = regexp.MustCompile(`^(={1,4})\s+(.*?)\s*$`)
+	rulePattern    = regexp.MustCompile(`^(-{4,}|={4,}|\.{4,}|_{4,})$`)
+	titlePattern   = regexp.MustCompile(`^(--|==|\.\.|__)\s*(.+?)\s*(--|==|\.\.|__)$`)
+	listPattern    = regexp.MustCompile(`^(\*+|#+)\s+(.*)$`)
+	cellPattern    = regexp.MustCompile(`^<#([^>]+)>`)
+)
+
+// Parse turns creole markup into a tree, with a Document at the root. Both
+// real newlines and escaped `\n` sequences break lines. Markup that isn't
+// closed is kept as text.
+func Parse(s string) Node {
+	lines := strings.Split(strings.TrimRight(strings.Replace(s, "\\n", "\n", -1), "\n"), "\n")
+
+	doc := Node{Kind: Document}
+
+	for i := 0; i < len(lines); {
+		kind := classify(lines[i])
+
+		// lists, tables and paragraphs are made up of runs of lines.
+		j := i + 1
+		if kind == List || kind == Table || kind == Paragraph {
+			for j < len(lines) && classify(lines[j]) == kind {
+				j++
+			}
+		}
+
+		switch kind {
+		case List:
+			var items []listItem
+			for _, l := range lines[i:j] {
+				m := listPattern.FindStringSubmatch(strings.TrimSpace(l))
+				items = append(items, listItem{depth: len(m[1]), ordered: m[1][0] == '#', text: m[2]})
+			}
+
+			doc.Children = append(doc.Children, buildLists(items, 1)...)
+		case Table:
+			table := Node{Kind: Table}
+			for _, l := range lines[i:j] {
+				table.Children = append(table.Children, parseRow(strings.TrimSpace(l)))
+			}
+
+			doc.Children = append(doc.Children, table)
+		case Rule:
+			trimmed := strings.TrimSpace(lines[i])
+
+			n := Node{Kind: Rule, Value: trimmed[0:1]}
+			if m := titlePattern.FindStringSubmatch(trimmed); m != nil {
+				n.Children = parseInline(m[2])
+			}
+
+			doc.Children = append(doc.Children, n)
+		case Heading:
+			m := headingPattern.FindStringSubmatch(strings.TrimSpace(lines[i]))
+			doc.Children = append(doc.Children, Node{Kind: Heading, Level: len(m[1]), Children: parseInline(m[2])})
+		default:
+			paragraph := Node{Kind: Paragraph}
+			for k, l := range lines[i:j] {
+				if k > 0 {
+					paragraph.Children = append(paragraph.Children, Node{Kind: LineBreak})
+				}
+
+				paragraph.Children = append(paragraph.Children, parseInline(l)...)
+			}
+
+			doc.Children = append(doc.Children, paragraph)
+		}
+
+		i = j
+	}
+
+	return doc
+}
+
+// classify works out what kind of block a line belongs to.
+func classify(line string) Kind {
+	trimmed := strings.TrimSpace(line)
+
+	switch {
+	case listPattern.MatchString(trimmed):
+		return List
+	case strings.HasPrefix(trimmed, "|"):
+		return Table
+	case rulePattern.MatchString(trimmed):
+		return Rule
+	case titlePattern.MatchString(trimmed):
+		if m := titlePattern.FindStringSubmatch(trimmed); m[1] == m[3] {
+			return Rule
+		}
+	}
+
+	if headingPattern.MatchString(trimmed) {
+		return Heading
+	}
+
+	return Paragraph
+}
+
+type listItem struct {
+	depth   int
+	ordered bool
+	text    string
+}
+
+// buildLists nests list items under the item before them that's one level
+// shallower. An item that's too deep for where it is gets treated as if it
+// was at the right depth.
+func buildLists(items []listItem, depth int) []Node {
+	var lists []Node
+
+	for i := 0; i < len(items); {
+		if n := len(lists); n == 0 || lists[n-1].Ordered != items[i].ordered {
+			lists = append(lists, Node{Kind: List, Ordered: items[i].ordered, Level: depth})
+		}
+
+		j := i + 1
+		for j < len(items) && items[j].depth > depth {
+			j++
+		}
+
+		item := Node{Kind: ListItem, Children: parseInline(items[i].text)}
+		item.Children = append(item.Children, buildLists(items[i+1:j], depth+1)...)
+
+		list := &lists[len(lists)-1]
+		list.Children = append(list.Children, item)
+
+		i = j
+	}
+
+	return lists
+}
+
+func parseRow(s string) Node {
+	row := Node{Kind: TableRow}
+
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "|"), "|")
+
+	for _, cell := range strings.Split(s, "|") {
+		c := Node{Kind: TableCell}
+
+		if strings.HasPrefix(cell, "=") {
+			c.Header = true
+			cell = cell[1:]
+		}
+
+		cell = strings.TrimSpace(cell)
+		if m := cellPattern.FindStringSubmatch(cell); m != nil {
+			c.Value = m[1]
+			cell = strings.TrimSpace(cell[len(m[0]):])
+		}
+
+		c.Children = parseInline(cell)
+		row.Children = append(row.Children, c)
+	}
+
+	return row
+}
+
+var markers = []struct {
+	s    string
+	kind Kind
+}{
+	{"**", Bold},
+	{"//", Italic},
+	{`""`, Monospace},
+	{"--", Strike},
+	{"__", Underline},
+	{"~~", Waved},
+}
+
+var tags = map[string]Kind{
+	"b":      Bold,
+	"i":      Italic,
+	"u":      Underline,
+	"s":      Strike,
+	"strike": Strike,
+	"del":    Strike,
+	"w":      Waved,
+	"color":  Colour,
+	"back":   Background,
+	"size":   Size,
+	"font":   Font,
+	"sub":    Subscript,
+	"sup":    Superscript,
+}
+
+var (
+	openTagPattern = regexp.MustCompile(`^<(b|i|u|s|strike|del|w|sub|sup|(?:color|back|size|font)[: ]([^>]+))>`)
+	iconPattern    = regexp.MustCompile(`^<&([^>\s]+)>`)
+	imagePattern   = regexp.MustCompile(`^<img[: ]([^>]+)>`)
+	linkPattern    = regexp.MustCompile(`^\[\[([^\]\s{]+)(?:\{[^}]*\})?(?:\s+([^\]]*))?\]\]`)
+)
+
+// tagName is the name of a tag without its value, like `color` for
+// `color:red`.
+func tagName(s string) string {
+	if i := strings.IndexAny(s, ": "); i != -1 {
+		return s[0:i]
+	}
+
+	return s
+}
+
+func parseInline(s string) []Node {
+	nodes, _ := parseUntil(s, "")
+	return nodes
+}
+
+// parseUntil parses inline markup up to the first unescaped occurrence of
+// end, returning the nodes and whatever comes after end. If end is empty, or
+// never turns up, everything is consumed.
+func parseUntil(s, end string) ([]Node, string) {
+	var nodes []Node
+	var text strings.Builder
+
+	emit := func(n Node) {
+		if text.Len() > 0 {
+			nodes = append(nodes, Node{Kind: Text, Text: text.String()})
+			text.Reset()
+		}
+
+		nodes = append(nodes, n)
+	}
+
+outer:
+	for len(s) > 0 {
+		if end != "" && strings.HasPrefix(s, end) {
+			s = s[len(end):]
+			break
+		}
+
+		// a tilde escapes the markup after it.
+		if s[0] == '~' && len(s) > 1 && !strings.HasPrefix(s, "~~") {
+			text.WriteByte(s[1])
+			s = s[2:]
+			continue
+		}
+
+		for _, m := range markers {
+			if !strings.HasPrefix(s, m.s) || !strings.Contains(s[len(m.s):], m.s) {
+				continue
+			}
+
+			if m.kind == Monospace {
+				i := strings.Index(s[2:], m.s)
+				emit(Node{Kind: Monospace, Children: []Node{{Kind: Text, Text: s[2 : 2+i]}}})
+				s = s[2+i+2:]
+				continue outer
+			}
+
+			// `//` is also how URLs start, so it doesn't count straight after
+			// a colon.
+			if m.kind == Italic && text.Len() > 0 && strings.HasSuffix(text.String(), ":") {
+				continue
+			}
+
+			children, rest := parseUntil(s[len(m.s):], m.s)
+			emit(Node{Kind: m.kind, Children: children})
+			s = rest
+			continue outer
+		}
+
+		if s[0] == '<' {
+			if m := iconPattern.FindStringSubmatch(s); m != nil {
+				emit(Node{Kind: Icon, Value: m[1]})
+				s = s[len(m[0]):]
+				continue
+			}
+
+			if m := imagePattern.FindStringSubmatch(s); m != nil {
+				emit(Node{Kind: Image, Value: strings.TrimSpace(m[1])})
+				s = s[len(m[0]):]
+				continue
+			}
+
+			if m := openTagPattern.FindStringSubmatch(s); m != nil && strings.Contains(s[len(m[0]):], "</"+tagName(m[1])+">") {
+				name := tagName(m[1])
+
+				children, rest := parseUntil(s[len(m[0]):], "</"+name+">")
+				emit(Node{Kind: tags[name], Value: strings.TrimSpace(m[2]), Children: children})
+				s = rest
+				continue
+			}
+
+			if strings.HasPrefix(s, "<br>") || strings.HasPrefix(s, "<br/>") {
+				emit(Node{Kind: LineBreak})
+				s = s[strings.Index(s, ">")+1:]
+				continue
+			}
+		}
+
+		if m := linkPattern.FindStringSubmatch(s); m != nil {
+			n := Node{Kind: Link, Value: m[1]}
+			if m[2] != "" {
+				n.Children = parseInline(m[2])
+			}
+
+			emit(n)
+			s = s[len(m[0]):]
+			continue
+		}
+
+		text.WriteByte(s[0])
+		s = s[1:]
+	}
+
+	if text.Len() > 0 {
+		nodes = append(nodes, Node{Kind: Text, Text: text.String()})
+	}
+
+	return nodes, s
+}
@@ -0,0 +1,124 @@
+package creole
+
+import (
+  "bytes"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+)
+
+func text(s string) Node {
+  return Node{Kind: Text, Text: s}
+}
+
+func TestParseInline(t *testing.T) {
+  a := assert.New(t)
+
+  a.Equal(Node{Kind: Document, Children: []Node{
+    {Kind: Paragraph, Children: []Node{
+      text("a "),
+      {Kind: Bold, Children: []Node{text("b "), {Kind: Italic, Children: []Node{text("c")}}}},
+      text(" "),
+      {Kind: Monospace, Children: []Node{text("**d**")}},
+      {Kind: LineBreak},
+      {Kind: Colour, Value: "red", Children: []Node{text("e")}},
+      text(" "),
+      {Kind: Icon, Value: "star"},
+      text(" "),
+      {Kind: Link, Value: "http://example.com", Children: []Node{text("f g")}},
+      text(" **h"),
+    }},
+  }}, Parse(`a **b //c//** ""**d**""\n<color:red>e</color> <&star> [[http://example.com f g]] ~**h`))
+
+  // markup that isn't closed is kept as text.
+  a.Equal(Node{Kind: Document, Children: []Node{
+    {Kind: Paragraph, Children: []Node{
+      text("<b>a <color:red>b "),
+      {Kind: Bold, Children: []Node{text("c")}},
+      text(" **d"),
+    }},
+  }}, Parse(`<b>a <color:red>b **c** **d`))
+}
+
+func TestParseBlocks(t *testing.T) {
+  a := assert.New(t)
+
+  doc := Parse("== Title ==\n* a\n** b\n* c\n# d\n|= h |= i |\n| <#red> j | k |\n----\n= Heading\nl\nm")
+
+  a.Equal([]Kind{Rule, List, List, Table, Rule, Heading, Paragraph}, kinds(doc.Children))
+
+  a.Equal(Node{Kind: Rule, Value: "=", Children: []Node{text("Title")}}, doc.Children[0])
+
+  a.Equal(Node{Kind: List, Level: 1, Children: []Node{
+    {Kind: ListItem, Children: []Node{text("a"), {Kind: List, Level: 2, Children: []Node{{Kind: ListItem, Children: []Node{text("b")}}}}}},
+    {Kind: ListItem, Children: []Node{text("c")}},
+  }}, doc.Children[1])
+  a.True(doc.Children[2].Ordered)
+
+  a.Equal(Node{Kind: Table, Children: []Node{
+    {Kind: TableRow, Children: []Node{{Kind: TableCell, Header: true, Children: []Node{text("h")}}, {Kind: TableCell, Header: true, Children: []Node{text("i")}}}},
+    {Kind: TableRow, Children: []Node{{Kind: TableCell, Value: "red", Children: []Node{text("j")}}, {Kind: TableCell, Children: []Node{text("k")}}}},
+  }}, doc.Children[3])
+
+  a.Equal(1, doc.Children[5].Level)
+  a.Equal([]Kind{Text, LineBreak, Text}, kinds(doc.Children[6].Children))
+}
+
+func kinds(nodes []Node) []Kind {
+  var a []Kind
+  for _, n := range nodes {
+    a = append(a, n.Kind)
+  }
+  return a
+}
+
+const testMarkup = "= Title\nSome **bold** and <i>italic</i> text, see [[http://example.com/?a=1&b=2 the docs]]\n* one\n** two\n|= a |= b |\n| 1 | x|y |"
+
+func TestFormatText(t *testing.T) {
+  a := assert.New(t)
+
+  a.Equal("Title\nSome bold and italic text, see the docs\n- one\n  - two\na | b\n1 | x | y\n", PlainText(testMarkup)+"\n")
+  a.Equal("Retry\nthree times", PlainText(`**Retry**\n<size:9>three</size> times`))
+}
+
+func TestFormatHTML(t *testing.T) {
+  a := assert.New(t)
+
+  buf := bytes.NewBuffer(nil)
+  a.NoError(FormatHTML(Parse(testMarkup), buf))
+  a.Equal(`<h1>Title</h1><p>Some <strong>bold</strong> and <em>italic</em> text, see <a href="http://example.com/?a=1&amp;b=2">the docs</a></p><ul><li>one<ul><li>two</li></ul></li></ul><table><tr><th>a</th><th>b</th></tr><tr><td>1</td><td>x</td><td>y</td></tr></table>`, buf.String())
+
+  buf.Reset()
+  a.NoError(FormatHTML(Parse("<color:#f00>a < b</color>"), buf))
+  a.Equal(`<p><span style="color: #f00">a &lt; b</span></p>`, buf.String())
+
+  // only links that can't run anything are links.
+  buf.Reset()
+  a.NoError(FormatHTML(Parse("[[javascript:alert(1) a]] [[JavaScript:alert(1)]] [[mailto:a@example.com b]] [[/docs c]]"), buf))
+  a.Equal(`<p>a JavaScript:alert(1) <a href="mailto:a@example.com">b</a> <a href="/docs">c</a></p>`, buf.String())
+
+  // only values that are known to be safe go into styles.
+  buf.Reset()
+  a.NoError(FormatHTML(Parse("<color:red;background:url(x)>a</color><back:LightBlue>b</back><size:12>c</size><size:1;color:red>d</size><font:Courier New>e</font><font:x;position:fixed>f</font>"), buf))
+  a.Equal(`<p>a<span style="background-color: #ADD8E6">b</span><span style="font-size: 12px">c</span>d<span style="font-family: Courier New">e</span>f</p>`, buf.String())
+
+  buf.Reset()
+  a.NoError(FormatHTML(Parse("<img:javascript:alert(1)> <img:/logo.png>"), buf))
+  a.Equal(`<p>javascript:alert(1) <img src="/logo.png"></p>`, buf.String())
+
+  buf.Reset()
+  a.NoError(FormatMarkdown(Parse("[[javascript:alert(1) a]] [[https://example.com b]]"), buf))
+  a.Equal("a [b](https://example.com)\n", buf.String())
+}
+
+func TestFormatMarkdown(t *testing.T) {
+  a := assert.New(t)
+
+  buf := bytes.NewBuffer(nil)
+  a.NoError(FormatMarkdown(Parse(testMarkup), buf))
+  a.Equal("# Title\n\nSome **bold** and *italic* text, see [the docs](http://example.com/?a=1&b=2)\n\n- one\n  - two\n\n| a | b |  |\n| --- | --- | --- |\n| 1 | x | y |\n", buf.String())
+
+  buf.Reset()
+  a.NoError(FormatMarkdown(Parse("| a_b | c |\nline one\\nline ``two``"), buf))
+  a.Equal("|  |  |\n| --- | --- |\n| a\\_b | c |\n\nline one  \nline \\`\\`two\\`\\`\n", buf.String())
+}
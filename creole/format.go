@@ -0,0 +1,447 @@
+package creole
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"fknsrs.biz/p/plantuml/style"
+)
+
+// FormatText writes the text of a tree without any markup, for searching and
+// the like. List items are written with a leading "- " or "1. ", and table
+// cells are separated by " | ".
+func FormatText(n Node, wr io.Writer) error {
+	var b strings.Builder
+	formatText(n, &b, "")
+
+	if _, err := io.WriteString(wr, strings.TrimRight(b.String(), "\n")); err != nil {
+		return fmt.Errorf("FormatText: %w", err)
+	}
+
+	return nil
+}
+
+// PlainText is a shortcut for parsing some markup and getting its text back.
+func PlainText(s string) string {
+	var b strings.Builder
+	FormatText(Parse(s), &b)
+	return b.String()
+}
+
+func formatText(n Node, b *strings.Builder, indent string) {
+	switch n.Kind {
+	case Document:
+		for _, c := range n.Children {
+			formatText(c, b, indent)
+		}
+	case Paragraph, Heading:
+		formatTextInline(n.Children, b, indent)
+		b.WriteString("\n")
+	case Rule:
+		if len(n.Children) > 0 {
+			formatTextInline(n.Children, b, indent)
+			b.WriteString("\n")
+		}
+	case List:
+		for i, c := range n.Children {
+			if n.Ordered {
+				fmt.Fprintf(b, "%s%d. ", indent, i+1)
+			} else {
+				fmt.Fprintf(b, "%s- ", indent)
+			}
+
+			formatListItem(c, b, indent, formatText, formatTextInline)
+		}
+	case Table:
+		for _, row := range n.Children {
+			for i, cell := range row.Children {
+				if i > 0 {
+					b.WriteString(" | ")
+				}
+				formatTextInline(cell.Children, b, indent)
+			}
+			b.WriteString("\n")
+		}
+	default:
+		formatTextInline([]Node{n}, b, indent)
+	}
+}
+
+func formatTextInline(nodes []Node, b *strings.Builder, indent string) {
+	for _, n := range nodes {
+		switch n.Kind {
+		case Text:
+			b.WriteString(n.Text)
+		case LineBreak:
+			b.WriteString("\n" + indent)
+		case Icon, Image:
+		case Link:
+			if len(n.Children) == 0 {
+				b.WriteString(n.Value)
+			} else {
+				formatTextInline(n.Children, b, indent)
+			}
+		default:
+			formatTextInline(n.Children, b, indent)
+		}
+	}
+}
+
+// formatListItem writes the inline content of a list item and then any lists
+// nested inside it, one level further in.
+func formatListItem(n Node, b *strings.Builder, indent string, block func(Node, *strings.Builder, string), inline func([]Node, *strings.Builder, string)) {
+	var content, nested []Node
+	for _, c := range n.Children {
+		if c.Kind == List {
+			nested = append(nested, c)
+		} else {
+			content = append(content, c)
+		}
+	}
+
+	inline(content, b, indent+"  ")
+	b.WriteString("\n")
+
+	for _, c := range nested {
+		block(c, b, indent+"  ")
+	}
+}
+
+// FormatHTML writes a tree as an HTML fragment.
+func FormatHTML(n Node, wr io.Writer) error {
+	var b strings.Builder
+	formatHTML(n, &b)
+
+	if _, err := io.WriteString(wr, b.String()); err != nil {
+		return fmt.Errorf("FormatHTML: %w", err)
+	}
+
+	return nil
+}
+
+var htmlTags = map[Kind]string{
+	Paragraph:   "p",
+	List:        "ul",
+	ListItem:    "li",
+	Table:       "table",
+	TableRow:    "tr",
+	TableCell:   "td",
+	Bold:        "strong",
+	Italic:      "em",
+	Monospace:   "code",
+	Strike:      "del",
+	Underline:   "u",
+	Subscript:   "sub",
+	Superscript: "sup",
+}
+
+func formatHTML(n Node, b *strings.Builder) {
+	children := func() {
+		for _, c := range n.Children {
+			formatHTML(c, b)
+		}
+	}
+
+	switch n.Kind {
+	case Document:
+		children()
+	case Text:
+		b.WriteString(html.EscapeString(n.Text))
+	case LineBreak:
+		b.WriteString("<br>")
+	case Heading:
+		fmt.Fprintf(b, "<h%d>", n.Level)
+		children()
+		fmt.Fprintf(b, "</h%d>", n.Level)
+	case Rule:
+		if len(n.Children) > 0 {
+			b.WriteString(`<div class="separator">`)
+			children()
+			b.WriteString("</div>")
+		} else {
+			b.WriteString("<hr>")
+		}
+	case List:
+		tag := "ul"
+		if n.Ordered {
+			tag = "ol"
+		}
+
+		b.WriteString("<" + tag + ">")
+		children()
+		b.WriteString("</" + tag + ">")
+	case TableCell:
+		tag := "td"
+		if n.Header {
+			tag = "th"
+		}
+
+		b.WriteString("<" + tag)
+		if c, ok := cssColour(n.Value); ok {
+			fmt.Fprintf(b, ` style="background-color: %s"`, html.EscapeString(c))
+		}
+		b.WriteString(">")
+		children()
+		b.WriteString("</" + tag + ">")
+	case Waved, Colour, Background, Size, Font:
+		// values that can't be checked are left out, and only the text is
+		// kept, so that they can't add to the style.
+		var style string
+		switch n.Kind {
+		case Waved:
+			style = "text-decoration: underline wavy"
+		case Colour:
+			if c, ok := cssColour(n.Value); ok {
+				style = "color: " + c
+			}
+		case Background:
+			if c, ok := cssColour(n.Value); ok {
+				style = "background-color: " + c
+			}
+		case Size:
+			if sizePattern.MatchString(n.Value) {
+				style = "font-size: " + n.Value + "px"
+			}
+		case Font:
+			if fontPattern.MatchString(n.Value) {
+				style = "font-family: " + n.Value
+			}
+		}
+
+		if style == "" {
+			children()
+			break
+		}
+
+		fmt.Fprintf(b, `<span style="%s">`, html.EscapeString(style))
+		children()
+		b.WriteString("</span>")
+	case Link:
+		if !safeURL(n.Value) {
+			if len(n.Children) == 0 {
+				b.WriteString(html.EscapeString(n.Value))
+			}
+			children()
+			break
+		}
+
+		fmt.Fprintf(b, `<a href="%s">`, html.EscapeString(n.Value))
+		if len(n.Children) == 0 {
+			b.WriteString(html.EscapeString(n.Value))
+		}
+		children()
+		b.WriteString("</a>")
+	case Icon:
+		fmt.Fprintf(b, `<span class="icon icon-%s"></span>`, html.EscapeString(n.Value))
+	case Image:
+		if !safeURL(n.Value) {
+			b.WriteString(html.EscapeString(n.Value))
+			break
+		}
+
+		fmt.Fprintf(b, `<img src="%s">`, html.EscapeString(n.Value))
+	default:
+		tag := htmlTags[n.Kind]
+		b.WriteString("<" + tag + ">")
+		children()
+		b.WriteString("</" + tag + ">")
+	}
+}
+
+// safeURL reports whether a link can be followed without running anything,
+// which is the case for http, https and mailto URLs, and relative ones.
+// Anything else, like `javascript:`, is written as text instead.
+func safeURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	default:
+		return false
+	}
+}
+
+var (
+	// sizePattern matches font sizes, which are always plain numbers.
+	sizePattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+	// fontPattern matches font names like `Courier New` or `DejaVu-Sans`,
+	// which is all that can go into a style without being checked further.
+	fontPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*( [A-Za-z][A-Za-z0-9_-]*)*$`)
+)
+
+// cssColour turns PlantUML's `#ff0000` and `red` style colours into CSS. Hex
+// colours are sometimes written without the #. Anything that isn't a hex
+// colour or one of PlantUML's colour names isn't a colour.
+func cssColour(s string) (string, bool) {
+	s = strings.TrimPrefix(s, "#")
+
+	if len(s) == 3 || len(s) == 6 {
+		if strings.Trim(strings.ToLower(s), "0123456789abcdef") == "" {
+			return "#" + s, true
+		}
+	}
+
+	if c := style.NormaliseColour(s); strings.HasPrefix(c, "#") {
+		return c, true
+	}
+
+	return "", false
+}
+
+// FormatMarkdown writes a tree as Markdown. Markdown has no way to show
+// colours, sizes, fonts, underlines or icons, so those are left out and only
+// their text is kept.
+func FormatMarkdown(n Node, wr io.Writer) error {
+	var b strings.Builder
+	formatMarkdown(n, &b, "")
+
+	if _, err := io.WriteString(wr, strings.TrimRight(b.String(), "\n")+"\n"); err != nil {
+		return fmt.Errorf("FormatMarkdown: %w", err)
+	}
+
+	return nil
+}
+
+func formatMarkdown(n Node, b *strings.Builder, indent string) {
+	switch n.Kind {
+	case Document:
+		for i, c := range n.Children {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			formatMarkdown(c, b, indent)
+		}
+	case Paragraph:
+		formatMarkdownInline(n.Children, b, indent, false)
+		b.WriteString("\n")
+	case Heading:
+		b.WriteString(strings.Repeat("#", n.Level) + " ")
+		formatMarkdownInline(n.Children, b, indent, false)
+		b.WriteString("\n")
+	case Rule:
+		if len(n.Children) > 0 {
+			formatMarkdownInline(n.Children, b, indent, false)
+			b.WriteString("\n\n")
+		}
+		b.WriteString("---\n")
+	case List:
+		for i, c := range n.Children {
+			if n.Ordered {
+				fmt.Fprintf(b, "%s%d. ", indent, i+1)
+			} else {
+				fmt.Fprintf(b, "%s- ", indent)
+			}
+
+			formatListItem(c, b, indent, formatMarkdown, func(nodes []Node, b *strings.Builder, indent string) {
+				formatMarkdownInline(nodes, b, indent, false)
+			})
+		}
+	case Table:
+		columns := 0
+		for _, row := range n.Children {
+			if len(row.Children) > columns {
+				columns = len(row.Children)
+			}
+		}
+
+		rows := n.Children
+
+		// markdown tables always start with a header, so make an empty one if
+		// the first row isn't a header.
+		header := Node{Kind: TableRow, Children: make([]Node, columns)}
+		if len(rows) > 0 && len(rows[0].Children) > 0 && rows[0].Children[0].Header {
+			header, rows = rows[0], rows[1:]
+		}
+
+		writeRow := func(row Node) {
+			b.WriteString("|")
+			for i := 0; i < columns; i++ {
+				b.WriteString(" ")
+				if i < len(row.Children) {
+					formatMarkdownInline(row.Children[i].Children, b, indent, true)
+				}
+				b.WriteString(" |")
+			}
+			b.WriteString("\n")
+		}
+
+		writeRow(header)
+		b.WriteString("|" + strings.Repeat(" --- |", columns) + "\n")
+		for _, row := range rows {
+			writeRow(row)
+		}
+	default:
+		formatMarkdownInline([]Node{n}, b, indent, false)
+	}
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"*", `\*`,
+	"_", `\_`,
+	"`", "\\`",
+	"[", `\[`,
+	"]", `\]`,
+	"<", `\<`,
+	"~", `\~`,
+)
+
+func formatMarkdownInline(nodes []Node, b *strings.Builder, indent string, cell bool) {
+	for _, n := range nodes {
+		switch n.Kind {
+		case Text:
+			s := markdownEscaper.Replace(n.Text)
+			if cell {
+				s = strings.Replace(s, "|", `\|`, -1)
+			}
+			b.WriteString(s)
+		case LineBreak:
+			if cell {
+				b.WriteString("<br>")
+			} else {
+				b.WriteString("  \n" + indent)
+			}
+		case Bold, Italic, Strike:
+			marker := map[Kind]string{Bold: "**", Italic: "*", Strike: "~~"}[n.Kind]
+			b.WriteString(marker)
+			formatMarkdownInline(n.Children, b, indent, cell)
+			b.WriteString(marker)
+		case Monospace:
+			var text strings.Builder
+			formatTextInline(n.Children, &text, "")
+			if strings.Contains(text.String(), "`") {
+				b.WriteString("`` " + text.String() + " ``")
+			} else {
+				b.WriteString("`" + text.String() + "`")
+			}
+		case Link:
+			if !safeURL(n.Value) {
+				if len(n.Children) == 0 {
+					b.WriteString(markdownEscaper.Replace(n.Value))
+				}
+				formatMarkdownInline(n.Children, b, indent, cell)
+				break
+			}
+
+			b.WriteString("[")
+			if len(n.Children) == 0 {
+				b.WriteString(markdownEscaper.Replace(n.Value))
+			}
+			formatMarkdownInline(n.Children, b, indent, cell)
+			b.WriteString("](" + n.Value + ")")
+		case Image:
+			b.WriteString("![](" + n.Value + ")")
+		case Icon:
+		default:
+			formatMarkdownInline(n.Children, b, indent, cell)
+		}
+	}
+}
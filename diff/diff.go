@@ -0,0 +1,453 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"fknsrs.biz/p/plantuml/parser"
+)
+
+type Kind string
+
+const (
+	Added   Kind = "added"
+	Removed Kind = "removed"
+	Renamed Kind = "renamed"
+	Changed Kind = "changed"
+)
+
+type Element string
+
+const (
+	State      Element = "state"
+	Transition Element = "transition"
+	Action     Element = "action"
+	SkinParam  Element = "skinparam"
+)
+
+// Change is a single difference between two documents. Name identifies the
+// element in the old document, or the new one if it was added. For changes,
+// Field says which part of the element changed.
+type Change struct {
+	Kind      Kind    `json:"kind"`
+	Element   Element `json:"element"`
+	Name      string  `json:"name"`
+	Partition string  `json:"partition,omitempty"`
+	Field     string  `json:"field,omitempty"`
+	Old       string  `json:"old,omitempty"`
+	New       string  `json:"new,omitempty"`
+}
+
+func (c Change) String() string {
+	name := c.Name
+	if c.Element == Action {
+		name = fmt.Sprintf("%q", c.Name)
+		if c.Partition != "" {
+			name += fmt.Sprintf(" in partition %q", c.Partition)
+		}
+	}
+
+	switch c.Kind {
+	case Added:
+		if c.Element == SkinParam {
+			return fmt.Sprintf("+ %s %s %s", c.Element, name, c.New)
+		}
+		return fmt.Sprintf("+ %s %s", c.Element, name)
+	case Removed:
+		if c.Element == SkinParam {
+			return fmt.Sprintf("- %s %s %s", c.Element, name, c.Old)
+		}
+		return fmt.Sprintf("- %s %s", c.Element, name)
+	case Renamed:
+		return fmt.Sprintf("~ %s %s renamed to %s", c.Element, c.Old, c.New)
+	default:
+		return fmt.Sprintf("~ %s %s: %s changed from %q to %q", c.Element, name, c.Field, c.Old, c.New)
+	}
+}
+
+// Diff compares two documents by what they describe rather than how they're
+// written, so reformatting or reordering a diagram produces no changes.
+// Changes are grouped by element, in the order skinparams, states,
+// transitions and actions.
+func Diff(a, b parser.DocumentNode) []Change {
+	var changes []Change
+
+	changes = append(changes, diffSkinParams(a, b)...)
+
+	stateChanges, renames := diffStates(a, b)
+	changes = append(changes, stateChanges...)
+
+	changes = append(changes, diffTransitions(a, b, renames)...)
+	changes = append(changes, diffActions(a, b)...)
+
+	return changes
+}
+
+func diffSkinParams(a, b parser.DocumentNode) []Change {
+	type param struct{ key, name, value string }
+
+	collect := func(doc parser.DocumentNode) ([]param, map[string]string) {
+		var l []param
+		m := make(map[string]string)
+
+		for _, e := range doc.GetSkinParamNodes() {
+			key := strings.ToLower(e.Name) + e.Stereotype
+			if _, ok := m[key]; ok {
+				continue
+			}
+
+			m[key] = e.Value
+			l = append(l, param{key, e.Name + e.Stereotype, e.Value})
+		}
+
+		return l, m
+	}
+
+	al, am := collect(a)
+	bl, bm := collect(b)
+
+	var changes []Change
+
+	for _, e := range al {
+		v, ok := bm[e.key]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Kind: Removed, Element: SkinParam, Name: e.name, Old: e.value})
+		case v != e.value:
+			changes = append(changes, Change{Kind: Changed, Element: SkinParam, Name: e.name, Field: "value", Old: e.value, New: v})
+		}
+	}
+
+	for _, e := range bl {
+		if _, ok := am[e.key]; !ok {
+			changes = append(changes, Change{Kind: Added, Element: SkinParam, Name: e.name, New: e.value})
+		}
+	}
+
+	return changes
+}
+
+type state struct {
+	name, label, stereotype, text string
+	children                      []string
+}
+
+// signature describes everything about a state except its name, for spotting
+// states that have only been renamed. States that only have a name don't have
+// a signature, since they'd all look the same.
+func (s state) signature() string {
+	if s.label == s.name && s.stereotype == "" && s.text == "" && len(s.children) == 0 {
+		return ""
+	}
+
+	return strings.Join(append([]string{s.label, s.stereotype, s.text}, s.children...), "\x00")
+}
+
+// collectStates finds every state in a document, including ones that are
+// only mentioned by transitions, in the order they first appear.
+func collectStates(doc parser.DocumentNode) ([]string, map[string]state) {
+	var names []string
+	states := make(map[string]state)
+
+	add := func(s state) {
+		if _, ok := states[s.name]; !ok {
+			names = append(names, s.name)
+		}
+
+		states[s.name] = s
+	}
+
+	parser.Walk(doc, func(n parser.Node) error {
+		switch n := n.(type) {
+		case parser.StateNode:
+			s := state{name: n.Name, label: n.Label, stereotype: n.Stereotype, text: n.Text}
+			for _, e := range n.Children {
+				if c, ok := e.(parser.StateNode); ok {
+					s.children = append(s.children, c.Name)
+				} else if _, ok := e.(parser.SeparatorNode); ok {
+					s.children = append(s.children, "---")
+				}
+			}
+			add(s)
+		case parser.EdgeNode:
+			for _, e := range []string{n.Left, n.Right} {
+				if _, ok := states[e]; !ok && e != "[*]" {
+					add(state{name: e, label: e})
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return names, states
+}
+
+func diffStates(a, b parser.DocumentNode) ([]Change, map[string]string) {
+	an, am := collectStates(a)
+	bn, bm := collectStates(b)
+
+	var removed, added []string
+	for _, e := range an {
+		if _, ok := bm[e]; !ok {
+			removed = append(removed, e)
+		}
+	}
+	for _, e := range bn {
+		if _, ok := am[e]; !ok {
+			added = append(added, e)
+		}
+	}
+
+	at, bt := collectTransitions(a), collectTransitions(b)
+
+	// a state that was removed has been renamed if an added state either
+	// looks exactly the same, or has exactly the same transitions.
+	renames := make(map[string]string)
+	renamed := make(map[string]bool)
+	for _, from := range removed {
+		for _, to := range added {
+			if renamed[to] {
+				continue
+			}
+
+			if sig := am[from].signature(); (sig != "" && sig == bm[to].signature()) || sameTransitions(at, from, bt, to) {
+				renames[from] = to
+				renamed[to] = true
+				break
+			}
+		}
+	}
+
+	var changes []Change
+
+	for _, e := range an {
+		if to, ok := renames[e]; ok {
+			changes = append(changes, Change{Kind: Renamed, Element: State, Name: e, Old: e, New: to})
+			changes = append(changes, diffState(e, am[e], bm[to])...)
+		} else if s, ok := bm[e]; ok {
+			changes = append(changes, diffState(e, am[e], s)...)
+		} else {
+			changes = append(changes, Change{Kind: Removed, Element: State, Name: e})
+		}
+	}
+
+	for _, e := range added {
+		if !renamed[e] {
+			changes = append(changes, Change{Kind: Added, Element: State, Name: e})
+		}
+	}
+
+	return changes, renames
+}
+
+func diffState(name string, a, b state) []Change {
+	var changes []Change
+
+	// states that aren't declared get their name as a label, so this only
+	// counts as a change when one of the labels was written out.
+	if a.label != b.label && (a.label != a.name || b.label != b.name) {
+		changes = append(changes, Change{Kind: Changed, Element: State, Name: name, Field: "label", Old: a.label, New: b.label})
+	}
+	if a.stereotype != b.stereotype {
+		changes = append(changes, Change{Kind: Changed, Element: State, Name: name, Field: "stereotype", Old: a.stereotype, New: b.stereotype})
+	}
+	if a.text != b.text {
+		changes = append(changes, Change{Kind: Changed, Element: State, Name: name, Field: "text", Old: a.text, New: b.text})
+	}
+
+	return changes
+}
+
+type transition struct{ from, to, label string }
+
+func (t transition) String() string {
+	if t.label == "" {
+		return t.from + " --> " + t.to
+	}
+
+	return t.from + " --> " + t.to + " : " + t.label
+}
+
+func collectTransitions(doc parser.DocumentNode) []transition {
+	var l []transition
+
+	parser.Walk(doc, func(n parser.Node) error {
+		if e, ok := n.(parser.EdgeNode); ok {
+			l = append(l, transition{from: e.Left, to: e.Right, label: e.Text})
+		}
+
+		return nil
+	})
+
+	return l
+}
+
+func sameTransitions(a []transition, from string, b []transition, to string) bool {
+	rename := func(s string) string {
+		if s == from {
+			return to
+		}
+		return s
+	}
+
+	var l []transition
+	for _, e := range a {
+		if e.from == from || e.to == from {
+			l = append(l, transition{rename(e.from), rename(e.to), e.label})
+		}
+	}
+
+	var r []transition
+	for _, e := range b {
+		if e.from == to || e.to == to {
+			r = append(r, e)
+		}
+	}
+
+	if len(l) == 0 || len(l) != len(r) {
+		return false
+	}
+
+	for i := range l {
+		if l[i] != r[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// diffTransitions matches up transitions in passes: first ones that haven't
+// changed at all, then ones that have the same source and label but go
+// somewhere else, then ones between the same states with a new label. Anything
+// left over was added or removed.
+func diffTransitions(a, b parser.DocumentNode, renames map[string]string) []Change {
+	at, bt := collectTransitions(a), collectTransitions(b)
+
+	rename := func(s string) string {
+		if to, ok := renames[s]; ok {
+			return to
+		}
+		return s
+	}
+
+	renamed := make([]transition, len(at))
+	for i, e := range at {
+		renamed[i] = transition{rename(e.from), rename(e.to), e.label}
+	}
+
+	matchedA, matchedB := make([]bool, len(at)), make([]bool, len(bt))
+	changed := make(map[int]Change)
+
+	match := func(same func(x, y transition) bool, change func(x, y transition) Change) {
+		for i, x := range renamed {
+			if matchedA[i] {
+				continue
+			}
+
+			for j, y := range bt {
+				if matchedB[j] || !same(x, y) {
+					continue
+				}
+
+				matchedA[i], matchedB[j] = true, true
+				if change != nil {
+					changed[i] = change(x, y)
+				}
+				break
+			}
+		}
+	}
+
+	match(func(x, y transition) bool { return x == y }, nil)
+	match(func(x, y transition) bool { return x.from == y.from && x.label == y.label }, func(x, y transition) Change {
+		return Change{Field: "target", Old: x.to, New: y.to}
+	})
+	match(func(x, y transition) bool { return x.from == y.from && x.to == y.to }, func(x, y transition) Change {
+		return Change{Field: "label", Old: x.label, New: y.label}
+	})
+
+	var changes []Change
+
+	for i, e := range at {
+		if c, ok := changed[i]; ok {
+			c.Kind, c.Element, c.Name = Changed, Transition, e.String()
+			changes = append(changes, c)
+		} else if !matchedA[i] {
+			changes = append(changes, Change{Kind: Removed, Element: Transition, Name: e.String()})
+		}
+	}
+
+	for j, e := range bt {
+		if !matchedB[j] {
+			changes = append(changes, Change{Kind: Added, Element: Transition, Name: e.String()})
+		}
+	}
+
+	return changes
+}
+
+type action struct{ partition, content string }
+
+// collectActions finds every action in a document along with the label of
+// the innermost partition it's in.
+func collectActions(doc parser.DocumentNode) []action {
+	var l []action
+	var partitions []string
+
+	parser.Visit(doc, func(v parser.VisitType, depth int, n parser.Node) error {
+		switch n := n.(type) {
+		case parser.PartitionNode:
+			if v == parser.Enter {
+				partitions = append(partitions, n.Label)
+			} else {
+				partitions = partitions[0 : len(partitions)-1]
+			}
+		case parser.ActionNode:
+			if v == parser.Enter {
+				partition := ""
+				if len(partitions) > 0 {
+					partition = partitions[len(partitions)-1]
+				}
+
+				l = append(l, action{partition, n.Content})
+			}
+		}
+
+		return nil
+	})
+
+	return l
+}
+
+// diffActions compares the actions in each partition, ignoring their order.
+func diffActions(a, b parser.DocumentNode) []Change {
+	al, bl := collectActions(a), collectActions(b)
+
+	count := make(map[action]int)
+	for _, e := range bl {
+		count[e]++
+	}
+
+	var changes []Change
+
+	for _, e := range al {
+		if count[e] > 0 {
+			count[e]--
+			continue
+		}
+
+		changes = append(changes, Change{Kind: Removed, Element: Action, Name: e.content, Partition: e.partition})
+	}
+
+	// whatever is left in count is only in the new document.
+	for _, e := range bl {
+		if count[e] > 0 {
+			count[e]--
+			changes = append(changes, Change{Kind: Added, Element: Action, Name: e.content, Partition: e.partition})
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,116 @@
+package diff
+
+import (
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+
+  "fknsrs.biz/p/plantuml/parser"
+)
+
+func parse(t *testing.T, src string) parser.DocumentNode {
+  doc, err := parser.ParseDocument(src)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  return *doc
+}
+
+const oldDocument = `@startuml
+skinparam stateBackgroundColor red
+skinparam ArrowColor gray
+state "Hot" as Hot <<Warning>>
+state Idle : waiting
+[*] --> Idle
+Idle --> Hot : heat
+Hot --> Idle : cool
+Hot --> Done : stop
+partition Shipping {
+  :Pack;
+  :Ship;
+}
+:Bill;
+@enduml
+`
+
+const newDocument = `@startuml
+skinparam roundCorner 5
+skinparam state {
+  BackgroundColor blue
+}
+state "Hot" as Heated <<Warning>>
+state Idle : idle
+[*] --> Idle
+Idle --> Heated : warm
+Heated --> Idle : cool
+Heated --> Error : stop
+partition Shipping {
+  :Ship;
+  :Track;
+}
+:Bill;
+@enduml
+`
+
+func TestDiff(t *testing.T) {
+  a := assert.New(t)
+
+  a.Equal([]Change{
+    {Kind: Changed, Element: SkinParam, Name: "stateBackgroundColor", Field: "value", Old: "red", New: "blue"},
+    {Kind: Removed, Element: SkinParam, Name: "ArrowColor", Old: "gray"},
+    {Kind: Added, Element: SkinParam, Name: "roundCorner", New: "5"},
+    {Kind: Renamed, Element: State, Name: "Hot", Old: "Hot", New: "Heated"},
+    {Kind: Changed, Element: State, Name: "Idle", Field: "text", Old: "waiting", New: "idle"},
+    {Kind: Removed, Element: State, Name: "Done"},
+    {Kind: Added, Element: State, Name: "Error"},
+    {Kind: Changed, Element: Transition, Name: "Idle --> Hot : heat", Field: "label", Old: "heat", New: "warm"},
+    {Kind: Changed, Element: Transition, Name: "Hot --> Done : stop", Field: "target", Old: "Done", New: "Error"},
+    {Kind: Removed, Element: Action, Name: "Pack", Partition: "Shipping"},
+    {Kind: Added, Element: Action, Name: "Track", Partition: "Shipping"},
+  }, Diff(parse(t, oldDocument), parse(t, newDocument)))
+}
+
+func TestDiffReformatted(t *testing.T) {
+  a := assert.New(t)
+
+  a.Empty(Diff(parse(t, oldDocument), parse(t, `@startuml
+  skinparam   ArrowColor    gray
+  skinparam stateBackgroundColor red
+  state Idle : waiting
+  state "Hot" as Hot <<Warning>>
+  Hot --> Done : stop
+  [*] --> Idle
+  Hot -up-> Idle : cool
+  Idle -> Hot : heat
+  :Bill;
+  partition Shipping {
+    :Ship;
+    :Pack;
+  }
+@enduml
+`)))
+}
+
+func TestDiffRenamedByTransitions(t *testing.T) {
+  a := assert.New(t)
+
+  a.Equal([]Change{
+    {Kind: Renamed, Element: State, Name: "B", Old: "B", New: "C"},
+    {Kind: Added, Element: State, Name: "D"},
+    {Kind: Added, Element: Transition, Name: "A --> D"},
+  }, Diff(
+    parse(t, "@startuml\nA --> B : go\nB --> [*]\n@enduml\n"),
+    parse(t, "@startuml\nA --> C : go\nC --> [*]\nA --> D\n@enduml\n"),
+  ))
+}
+
+func TestChangeString(t *testing.T) {
+  a := assert.New(t)
+
+  a.Equal("+ state A", Change{Kind: Added, Element: State, Name: "A"}.String())
+  a.Equal("- skinparam ArrowColor gray", Change{Kind: Removed, Element: SkinParam, Name: "ArrowColor", Old: "gray"}.String())
+  a.Equal("~ state A renamed to B", Change{Kind: Renamed, Element: State, Name: "A", Old: "A", New: "B"}.String())
+  a.Equal(`~ transition A --> B : go: target changed from "B" to "C"`, Change{Kind: Changed, Element: Transition, Name: "A --> B : go", Field: "target", Old: "B", New: "C"}.String())
+  a.Equal(`+ action "Ship" in partition "Shipping"`, Change{Kind: Added, Element: Action, Name: "Ship", Partition: "Shipping"}.String())
+}
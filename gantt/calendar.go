@@ -0,0 +1,99 @@
+package gantt
+
+import (
+	"strings"
+	"time"
+)
+
+// calendar knows which days are open for work. Days of the week can be
+// closed, and single days can be closed or opened on top of that.
+type calendar struct {
+	weekdays [7]bool
+	days     map[time.Time]bool
+}
+
+func newCalendar() calendar {
+	return calendar{days: make(map[time.Time]bool)}
+}
+
+func (c *calendar) setWeekday(day string, closed bool) {
+	for i := time.Sunday; i <= time.Saturday; i++ {
+		if strings.EqualFold(i.String(), day) {
+			c.weekdays[i] = closed
+		}
+	}
+}
+
+func (c calendar) closedAllWeek() bool {
+	return c.openPerWeek() == 0
+}
+
+func (c calendar) openPerWeek() int {
+	var n int
+	for _, closed := range c.weekdays {
+		if !closed {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (c calendar) open(d time.Time) bool {
+	if closed, ok := c.days[d]; ok {
+		return !closed
+	}
+
+	return !c.weekdays[d.Weekday()]
+}
+
+// next is d if it's open, or the first open day after it.
+func (c calendar) next(d time.Time) time.Time {
+	for !c.open(d) {
+		d = d.AddDate(0, 0, 1)
+	}
+
+	return d
+}
+
+// prev is d if it's open, or the last open day before it.
+func (c calendar) prev(d time.Time) time.Time {
+	for !c.open(d) {
+		d = d.AddDate(0, 0, -1)
+	}
+
+	return d
+}
+
+// add moves n open days on from d, or back if n is negative. d is moved to
+// an open day first if it isn't one.
+func (c calendar) add(d time.Time, n int) time.Time {
+	step := 1
+	if n < 0 {
+		step, n = -1, -n
+		d = c.prev(d)
+	} else {
+		d = c.next(d)
+	}
+
+	for ; n > 0; n-- {
+		d = d.AddDate(0, 0, step)
+		for !c.open(d) {
+			d = d.AddDate(0, 0, step)
+		}
+	}
+
+	return d
+}
+
+// count is the number of open days from a to b, including both.
+func (c calendar) count(a, b time.Time) int {
+	var n int
+	for d := a; !d.After(b); d = d.AddDate(0, 0, 1) {
+		if c.open(d) {
+			n++
+		}
+	}
+
+	return n
+}
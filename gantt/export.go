@@ -0,0 +1,130 @@
+package gantt
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func formatDate(d time.Time) string {
+	if d.IsZero() {
+		return ""
+	}
+
+	return d.Format(dateLayout)
+}
+
+// WriteCSV writes a row for each task, after a header row. Resources are
+// written like `Alice;Bob:50%`, and problems are separated by semicolons.
+func (s *Schedule) WriteCSV(wr io.Writer) error {
+	w := csv.NewWriter(wr)
+
+	if err := w.Write([]string{"name", "alias", "start", "end", "days", "milestone", "completed", "resources", "problems"}); err != nil {
+		return fmt.Errorf("Schedule.WriteCSV: %w", err)
+	}
+
+	for _, t := range s.Tasks {
+		var resources []string
+		for _, r := range t.Resources {
+			if r.Percent != 0 {
+				resources = append(resources, fmt.Sprintf("%s:%d%%", r.Name, r.Percent))
+			} else {
+				resources = append(resources, r.Name)
+			}
+		}
+
+		if err := w.Write([]string{
+			t.Name,
+			t.Alias,
+			formatDate(t.Start),
+			formatDate(t.End),
+			strconv.Itoa(t.Days),
+			strconv.FormatBool(t.Milestone),
+			strconv.Itoa(t.Completed),
+			strings.Join(resources, ";"),
+			strings.Join(t.Problems, "; "),
+		}); err != nil {
+			return fmt.Errorf("Schedule.WriteCSV: %w", err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("Schedule.WriteCSV: %w", err)
+	}
+
+	return nil
+}
+
+// WriteICal writes an iCalendar file with an all day event for each task
+// that could be scheduled. The output only depends on the schedule, so the
+// events' timestamps are the day the project starts, and their ids come from
+// the order of the tasks.
+func (s *Schedule) WriteICal(wr io.Writer) error {
+	w := bufio.NewWriter(wr)
+
+	stamp := s.Start
+	for _, t := range s.Tasks {
+		if stamp.IsZero() || (!t.Start.IsZero() && t.Start.Before(stamp)) {
+			stamp = t.Start
+		}
+	}
+
+	line := func(s string) {
+		// lines are folded so that none is longer than 75 bytes, with the
+		// rest on lines that start with a space, which counts towards them.
+		for n := 75; len(s) > n; n = 74 {
+			i := n
+			for i > 1 && s[i]&0xc0 == 0x80 {
+				i--
+			}
+
+			w.WriteString(s[:i] + "\r\n ")
+			s = s[i:]
+		}
+
+		w.WriteString(s + "\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//fknsrs.biz//plantuml gantt//EN")
+
+	for i, t := range s.Tasks {
+		if t.Start.IsZero() {
+			continue
+		}
+
+		line("BEGIN:VEVENT")
+		line(fmt.Sprintf("UID:task-%d@plantuml.fknsrs.biz", i+1))
+		line("DTSTAMP:" + stamp.Format("20060102") + "T000000Z")
+		line("DTSTART;VALUE=DATE:" + t.Start.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + t.End.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY:" + icalText(t.Name))
+		if t.Milestone {
+			line("CATEGORIES:MILESTONE")
+		}
+		if len(t.Problems) > 0 {
+			line("DESCRIPTION:" + icalText(strings.Join(t.Problems, "\n")))
+		}
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("Schedule.WriteICal: %w", err)
+	}
+
+	return nil
+}
+
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+func icalText(s string) string {
+	return icalEscaper.Replace(s)
+}
@@ -0,0 +1,394 @@
+package gantt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fknsrs.biz/p/plantuml/parser"
+)
+
+const dateLayout = "2006-01-02"
+
+type Resource struct {
+	Name    string
+	Percent int
+}
+
+// Task is a task or milestone with its dates worked out. Start and End are
+// the first and last days worked on it, which are the same day for a
+// milestone, and Days is the number of open days between them, so it's 1 for
+// a milestone on an open day.
+type Task struct {
+	Name      string
+	Alias     string
+	Milestone bool
+	Start     time.Time
+	End       time.Time
+	Days      int
+	Completed int
+	Colour    string
+	Resources []Resource
+	// Problems says why the task can't be scheduled the way it's
+	// described, such as its dates disagreeing or it depending on a task
+	// that doesn't exist. Start and End are zero if its dates couldn't be
+	// worked out at all.
+	Problems []string
+}
+
+type Schedule struct {
+	// Start is when the project starts, which is zero if the chart doesn't
+	// say.
+	Start time.Time
+	Tasks []*Task
+
+	calendar calendar
+}
+
+// Task finds a task by its name or alias, or returns nil if there isn't one.
+func (s *Schedule) Task(name string) *Task {
+	for _, t := range s.Tasks {
+		if t.Name == name || (t.Alias != "" && t.Alias == name) {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// Impossible is the tasks that have problems, in the order they appear.
+func (s *Schedule) Impossible() []*Task {
+	var a []*Task
+	for _, t := range s.Tasks {
+		if len(t.Problems) > 0 {
+			a = append(a, t)
+		}
+	}
+
+	return a
+}
+
+// Open reports whether work happens on a day.
+func (s *Schedule) Open(day time.Time) bool {
+	return s.calendar.open(day)
+}
+
+// NewSchedule works out the dates of every task in a Gantt chart. Durations
+// count open days only, and a week is as many days as are open in a week.
+// A task that starts at another's end starts on the next open day after it.
+// Tasks that can't be scheduled are still returned, with their Problems set;
+// an error is only returned if the chart itself doesn't make sense, like a
+// date that doesn't exist.
+func NewSchedule(doc parser.DocumentNode) (*Schedule, error) {
+	if doc.Kind != parser.DocumentGantt {
+		return nil, fmt.Errorf("NewSchedule: expected a gantt document but got %s", doc.Kind)
+	}
+
+	b := builder{
+		s:     &Schedule{calendar: newCalendar()},
+		specs: make(map[*Task]*spec),
+		state: make(map[*Task]int),
+	}
+
+	if err := b.read(doc.Nodes); err != nil {
+		return nil, fmt.Errorf("NewSchedule: %w", err)
+	}
+
+	if b.s.calendar.closedAllWeek() {
+		return nil, fmt.Errorf("NewSchedule: every day of the week is closed")
+	}
+
+	for _, t := range b.s.Tasks {
+		b.resolve(t)
+	}
+
+	return b.s, nil
+}
+
+// spec is everything a chart says about when a task happens.
+type spec struct {
+	lasts   *parser.GanttClause
+	starts  *parser.GanttClause
+	ends    *parser.GanttClause
+	happens *parser.GanttClause
+}
+
+type builder struct {
+	s     *Schedule
+	specs map[*Task]*spec
+	// state is 1 while a task is being resolved and 2 once it's done, so
+	// that tasks that depend on themselves can be caught. path holds the
+	// tasks being resolved, so the way they depend on themselves can be
+	// shown.
+	state map[*Task]int
+	path  []*Task
+}
+
+func (b *builder) read(nodes []parser.Node) error {
+	var prev *Task
+
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case parser.GanttProjectNode:
+			d, err := parseDate(n.Start)
+			if err != nil {
+				return fmt.Errorf("%s: %w", n.SourceRange, err)
+			}
+
+			b.s.Start = d
+		case parser.GanttCalendarNode:
+			if n.Day != "" {
+				b.s.calendar.setWeekday(n.Day, n.Closed)
+				continue
+			}
+
+			from, err := parseDate(n.From)
+			if err != nil {
+				return fmt.Errorf("%s: %w", n.SourceRange, err)
+			}
+			to, err := parseDate(n.To)
+			if err != nil {
+				return fmt.Errorf("%s: %w", n.SourceRange, err)
+			}
+			if to.Before(from) {
+				return fmt.Errorf("%s: %s is before %s", n.SourceRange, n.To, n.From)
+			}
+
+			for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+				b.s.calendar.days[d] = n.Closed
+			}
+		case parser.GanttTaskNode:
+			t := b.s.Task(n.Name)
+			if t == nil && n.Alias != "" {
+				t = b.s.Task(n.Alias)
+			}
+			if t == nil {
+				t = &Task{Name: n.Name}
+				b.s.Tasks = append(b.s.Tasks, t)
+				b.specs[t] = &spec{}
+			}
+			if n.Alias != "" {
+				t.Alias = n.Alias
+			}
+
+			sp := b.specs[t]
+
+			for _, r := range n.Resources {
+				t.Resources = append(t.Resources, Resource{Name: r.Name, Percent: r.Percent})
+			}
+
+			if n.Then && prev != nil {
+				sp.starts = &parser.GanttClause{Kind: parser.GanttStarts, Task: prev.Name, Anchor: "end"}
+			}
+
+			for i := range n.Clauses {
+				c := &n.Clauses[i]
+
+				switch c.Kind {
+				case parser.GanttLasts:
+					sp.lasts = c
+				case parser.GanttStarts:
+					sp.starts = c
+				case parser.GanttEnds:
+					sp.ends = c
+				case parser.GanttHappens:
+					sp.happens = c
+					t.Milestone = true
+				case parser.GanttCompleted:
+					t.Completed = c.Percent
+				case parser.GanttColoured:
+					t.Colour = c.Colour
+				}
+
+				if c.Date != "" {
+					if _, err := parseDate(c.Date); err != nil {
+						return fmt.Errorf("%s: %w", n.SourceRange, err)
+					}
+				}
+			}
+
+			prev = t
+		}
+	}
+
+	return nil
+}
+
+func (b *builder) problem(t *Task, format string, a ...interface{}) {
+	t.Problems = append(t.Problems, fmt.Sprintf(format, a...))
+}
+
+// resolve works out a task's dates, along with those of any tasks it
+// depends on. It reports whether the dates could be worked out.
+func (b *builder) resolve(t *Task) bool {
+	switch b.state[t] {
+	case 1:
+		b.problem(t, "depends on itself%s", b.cycle(t))
+		return false
+	case 2:
+		return !t.Start.IsZero()
+	}
+
+	b.state[t] = 1
+	b.path = append(b.path, t)
+	defer func() {
+		b.state[t] = 2
+		b.path = b.path[:len(b.path)-1]
+	}()
+
+	sp := b.specs[t]
+	c := b.s.calendar
+
+	if t.Milestone {
+		d, ok := b.point(t, sp.happens)
+		if !ok {
+			return false
+		}
+
+		t.Start, t.End = d, d
+		t.Days = c.count(d, d)
+
+		return true
+	}
+
+	var days int
+	if sp.lasts != nil {
+		days = sp.lasts.Amount
+		if sp.lasts.Unit == "week" {
+			days *= c.openPerWeek()
+		}
+
+		if days < 1 {
+			b.problem(t, "lasts %d %ss", sp.lasts.Amount, sp.lasts.Unit)
+			return false
+		}
+	}
+
+	start, hasStart := time.Time{}, sp.starts != nil
+	if hasStart {
+		var ok bool
+		if start, ok = b.point(t, sp.starts); !ok {
+			return false
+		}
+	}
+
+	end, hasEnd := time.Time{}, sp.ends != nil
+	if hasEnd {
+		var ok bool
+		if end, ok = b.point(t, sp.ends); !ok {
+			return false
+		}
+	}
+
+	switch {
+	case hasStart && days > 0:
+		t.Start, t.End = start, c.add(start, days-1)
+
+		if hasEnd && !end.Equal(t.End) {
+			b.problem(t, "ends %s, but lasting %d days from %s it would end %s", end.Format(dateLayout), days, start.Format(dateLayout), t.End.Format(dateLayout))
+		}
+	case hasEnd && days > 0:
+		t.Start, t.End = c.add(end, -(days-1)), end
+	case hasStart && hasEnd:
+		t.Start, t.End = start, end
+	case days > 0:
+		if b.s.Start.IsZero() {
+			b.problem(t, "doesn't say when it starts, and neither does the project")
+			return false
+		}
+
+		t.Start = c.next(b.s.Start)
+		t.End = c.add(t.Start, days-1)
+	default:
+		b.problem(t, "doesn't say how long it lasts")
+		return false
+	}
+
+	if t.End.Before(t.Start) {
+		b.problem(t, "ends %s, before it starts %s", t.End.Format(dateLayout), t.Start.Format(dateLayout))
+	}
+
+	t.Days = c.count(t.Start, t.End)
+
+	return true
+}
+
+// cycle describes how a task that's being resolved depends on itself, like
+// `: [A] -> [B] -> [A]`, or nothing if it depends on itself directly.
+func (b *builder) cycle(t *Task) string {
+	i := len(b.path) - 1
+	for i > 0 && b.path[i] != t {
+		i--
+	}
+
+	if i == len(b.path)-1 {
+		return ""
+	}
+
+	var names []string
+	for _, p := range append(b.path[i:len(b.path):len(b.path)], t) {
+		names = append(names, "["+p.Name+"]")
+	}
+
+	return ": " + strings.Join(names, " -> ")
+}
+
+// point works out the day a starts, ends or happens clause is talking about.
+func (b *builder) point(t *Task, cl *parser.GanttClause) (time.Time, bool) {
+	c := b.s.calendar
+
+	if cl.Date != "" {
+		d, _ := parseDate(cl.Date)
+
+		switch cl.Kind {
+		case parser.GanttStarts:
+			return c.next(d), true
+		case parser.GanttEnds:
+			return c.prev(d), true
+		default:
+			return d, true
+		}
+	}
+
+	dep := b.s.Task(cl.Task)
+	if dep == nil {
+		b.problem(t, "depends on [%s], which doesn't exist", cl.Task)
+		return time.Time{}, false
+	}
+
+	if !b.resolve(dep) {
+		b.problem(t, "depends on [%s], which can't be scheduled", dep.Name)
+		return time.Time{}, false
+	}
+	if len(dep.Problems) > 0 {
+		b.problem(t, "depends on [%s], which has problems", dep.Name)
+	}
+
+	var d time.Time
+
+	switch {
+	case cl.Kind == parser.GanttHappens && cl.Anchor == "end":
+		d = dep.End
+	case cl.Kind == parser.GanttHappens:
+		d = dep.Start
+	case cl.Kind == parser.GanttStarts && cl.Anchor == "end":
+		d = c.next(dep.End.AddDate(0, 0, 1))
+	case cl.Kind == parser.GanttStarts:
+		d = dep.Start
+	case cl.Anchor == "end":
+		d = dep.End
+	default:
+		d = c.prev(dep.Start.AddDate(0, 0, -1))
+	}
+
+	return c.add(d, cl.Offset), true
+}
+
+func parseDate(s string) (time.Time, error) {
+	d, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", s)
+	}
+
+	return d, nil
+}
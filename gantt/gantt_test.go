@@ -0,0 +1,191 @@
+package gantt
+
+import (
+  "bytes"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/stretchr/testify/assert"
+
+  "fknsrs.biz/p/plantuml/parser"
+)
+
+func schedule(t *testing.T, src string) *Schedule {
+  doc, err := parser.ParseDocument(src)
+  if !assert.NoError(t, err) {
+    return nil
+  }
+
+  s, err := NewSchedule(*doc)
+  if !assert.NoError(t, err) {
+    return nil
+  }
+
+  return s
+}
+
+func date(s string) time.Time {
+  d, _ := time.Parse(dateLayout, s)
+  return d
+}
+
+func TestNewSchedule(t *testing.T) {
+  a := assert.New(t)
+
+  s := schedule(t, `@startgantt
+Project starts 2020-07-01
+saturday are closed
+sunday are closed
+2020-07-14 is closed
+[Design] as [D] lasts 10 days
+[Test] lasts 5 days and starts at [D]'s end
+then [Report] lasts 1 week
+[Review] starts 2 days after [Test]'s end and ends 2020-07-31
+[Backfill] lasts 3 days and ends at [Test]'s start
+[Done] happens at [Report]'s end
+@endgantt
+`)
+  if s == nil {
+    return
+  }
+
+  for _, e := range []struct {
+    name, start, end string
+    days             int
+  }{
+    {"Design", "2020-07-01", "2020-07-15", 10},
+    {"Test", "2020-07-16", "2020-07-22", 5},
+    {"Report", "2020-07-23", "2020-07-29", 5},
+    {"Review", "2020-07-27", "2020-07-31", 5},
+    {"Backfill", "2020-07-10", "2020-07-15", 3},
+    {"Done", "2020-07-29", "2020-07-29", 1},
+  } {
+    task := s.Task(e.name)
+    if a.NotNil(task, e.name) {
+      a.Equal(date(e.start), task.Start, e.name)
+      a.Equal(date(e.end), task.End, e.name)
+      a.Equal(e.days, task.Days, e.name)
+      a.Empty(task.Problems, e.name)
+    }
+  }
+
+  a.Same(s.Task("Design"), s.Task("D"))
+  a.True(s.Task("Done").Milestone)
+  a.False(s.Open(date("2020-07-14")))
+  a.Empty(s.Impossible())
+}
+
+func TestNewScheduleProblems(t *testing.T) {
+  a := assert.New(t)
+
+  s := schedule(t, `@startgantt
+Project starts 2020-07-01
+[A] lasts 2 days and starts at [B]'s end
+[B] lasts 2 days and starts at [A]'s end
+[C] lasts 2 days and starts at [Missing]'s end
+[D] starts 2020-07-10 and ends 2020-07-05
+[E] lasts 5 days and starts 2020-07-01 and ends 2020-07-02
+[F] starts at [D]'s end and lasts 1 day
+[G] starts 2020-07-01
+[H] lasts 2 days and starts at [H]'s end
+@endgantt
+`)
+  if s == nil {
+    return
+  }
+
+  var names []string
+  for _, t := range s.Impossible() {
+    names = append(names, t.Name)
+  }
+  a.Equal([]string{"A", "B", "C", "D", "E", "F", "G", "H"}, names)
+
+  a.Contains(s.Task("A").Problems, "depends on itself: [A] -> [B] -> [A]")
+  a.Equal([]string{"depends on [Missing], which doesn't exist"}, s.Task("C").Problems)
+  a.Equal([]string{"ends 2020-07-05, before it starts 2020-07-10"}, s.Task("D").Problems)
+  a.Equal([]string{"ends 2020-07-02, but lasting 5 days from 2020-07-01 it would end 2020-07-05"}, s.Task("E").Problems)
+  a.Equal([]string{"depends on [D], which has problems"}, s.Task("F").Problems)
+  a.Equal([]string{"doesn't say how long it lasts"}, s.Task("G").Problems)
+  a.True(s.Task("G").Start.IsZero())
+  a.Equal([]string{"depends on itself", "depends on [H], which can't be scheduled"}, s.Task("H").Problems)
+}
+
+func TestNewScheduleErrors(t *testing.T) {
+  for _, src := range []string{
+    "@startuml\nstate A\n@enduml\n",
+    "@startgantt\nProject starts 2020-13-01\n@endgantt\n",
+    "@startgantt\n[A] starts 2020-02-30\n@endgantt\n",
+    "@startgantt\n2020-07-05 to 2020-07-01 are closed\n@endgantt\n",
+    "@startgantt\nmonday are closed\ntuesday are closed\nwednesday are closed\nthursday are closed\nfriday are closed\nsaturday are closed\nsunday are closed\n@endgantt\n",
+  } {
+    doc, err := parser.ParseDocument(src)
+    if !assert.NoError(t, err, src) {
+      continue
+    }
+
+    _, err = NewSchedule(*doc)
+    assert.Error(t, err, src)
+  }
+}
+
+func TestExport(t *testing.T) {
+  a := assert.New(t)
+
+  s := schedule(t, `@startgantt
+Project starts 2020-07-01
+[Design, phase 1] on {Alice:50%} {Bob} lasts 2 days and is 40% completed
+[Ship] happens at [Design, phase 1]'s end
+[Broken] lasts 1 day and starts at [Nothing]'s end
+@endgantt
+`)
+  if s == nil {
+    return
+  }
+
+  buf := bytes.NewBuffer(nil)
+  a.NoError(s.WriteCSV(buf))
+  a.Equal(`name,alias,start,end,days,milestone,completed,resources,problems
+"Design, phase 1",,2020-07-01,2020-07-02,2,false,40,Alice:50%;Bob,
+Ship,,2020-07-02,2020-07-02,1,true,0,,
+Broken,,,,0,false,0,,"depends on [Nothing], which doesn't exist"
+`, buf.String())
+
+  buf.Reset()
+  a.NoError(s.WriteICal(buf))
+  a.Equal(strings.Join([]string{
+    "BEGIN:VCALENDAR",
+    "VERSION:2.0",
+    "PRODID:-//fknsrs.biz//plantuml gantt//EN",
+    "BEGIN:VEVENT",
+    "UID:task-1@plantuml.fknsrs.biz",
+    "DTSTAMP:20200701T000000Z",
+    "DTSTART;VALUE=DATE:20200701",
+    "DTEND;VALUE=DATE:20200703",
+    `SUMMARY:Design\, phase 1`,
+    "END:VEVENT",
+    "BEGIN:VEVENT",
+    "UID:task-2@plantuml.fknsrs.biz",
+    "DTSTAMP:20200701T000000Z",
+    "DTSTART;VALUE=DATE:20200702",
+    "DTEND;VALUE=DATE:20200703",
+    "SUMMARY:Ship",
+    "CATEGORIES:MILESTONE",
+    "END:VEVENT",
+    "END:VCALENDAR",
+    "",
+  }, "\r\n"), buf.String())
+
+  // long lines are folded with none longer than 75 bytes, spaces included,
+  // and come back the same when they're unfolded.
+  name := strings.Repeat("ö", 30) + strings.Repeat("long name ", 20)
+  long := &Schedule{Tasks: []*Task{{Name: name, Start: date("2020-07-01"), End: date("2020-07-01")}}}
+
+  buf.Reset()
+  a.NoError(long.WriteICal(buf))
+
+  for _, l := range strings.Split(buf.String(), "\r\n") {
+    a.True(len(l) <= 75, l)
+  }
+  a.Contains(strings.ReplaceAll(buf.String(), "\r\n ", ""), "SUMMARY:"+name+"\r\n")
+}
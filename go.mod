@@ -1,8 +1,10 @@
 module fknsrs.biz/p/plantuml
 
-go 1.14
+go 1.16
 
 require (
 	github.com/davecgh/go-spew v1.1.1
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/stretchr/testify v1.6.1
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
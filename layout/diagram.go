@@ -0,0 +1,270 @@
+package layout
+
+import (
+	"fmt"
+
+	"fknsrs.biz/p/plantuml/parser"
+)
+
+const (
+	InitialState = "[*]"
+	FinalState   = "[*]final"
+)
+
+// Sizer tells the graph builders how big things will be once drawn. NodeSize
+// is called with leaf nodes, and with composite states and partitions to get
+// the size of their header.
+type Sizer interface {
+	NodeSize(n parser.Node) (float64, float64)
+	TextSize(s string) (float64, float64)
+}
+
+// StateGraph builds a graph from the states and transitions in a document.
+// Composite states become clusters, with a nested cluster for each region when
+// they're split up with `---`. Pseudo-states are given the ids InitialState
+// and FinalState, and states that are only mentioned by transitions are added
+// at the top level.
+func StateGraph(doc parser.DocumentNode, sizer Sizer, padding float64) Graph {
+	var g Graph
+
+	known := make(map[string]bool)
+
+	var addState func(n parser.StateNode, cluster string)
+	addState = func(n parser.StateNode, cluster string) {
+		known[n.Name] = true
+
+		if len(n.Children) == 0 {
+			w, h := sizer.NodeSize(n)
+			g.Nodes = append(g.Nodes, Node{ID: n.Name, Cluster: cluster, Width: w, Height: h, Source: n})
+			return
+		}
+
+		w, h := sizer.NodeSize(n)
+		g.Clusters = append(g.Clusters, Cluster{ID: n.Name, Parent: cluster, Padding: padding, HeaderWidth: w, HeaderHeight: h, Source: n})
+
+		var regions [][]parser.StateNode
+		current := []parser.StateNode{}
+		for _, e := range n.Children {
+			switch e := e.(type) {
+			case parser.StateNode:
+				current = append(current, e)
+			case parser.SeparatorNode:
+				regions = append(regions, current)
+				current = []parser.StateNode{}
+			}
+		}
+		regions = append(regions, current)
+
+		if len(regions) == 1 {
+			for _, e := range regions[0] {
+				addState(e, n.Name)
+			}
+			return
+		}
+
+		// regions are stacked on top of each other, which hidden edges
+		// between them take care of.
+		for i, region := range regions {
+			id := fmt.Sprintf("%s/region%d", n.Name, i+1)
+			g.Clusters = append(g.Clusters, Cluster{ID: id, Parent: n.Name})
+
+			if i > 0 {
+				g.Edges = append(g.Edges, Edge{From: fmt.Sprintf("%s/region%d", n.Name, i), To: id, Hidden: true})
+			}
+
+			for _, e := range region {
+				addState(e, id)
+			}
+		}
+	}
+
+	var edges []parser.EdgeNode
+	for _, n := range doc.Nodes {
+		switch n := n.(type) {
+		case parser.StateNode:
+			addState(n, "")
+		case parser.EdgeNode:
+			edges = append(edges, n)
+		}
+	}
+
+	for _, e := range edges {
+		from, to := e.Left, e.Right
+		if from == "[*]" {
+			from = InitialState
+		}
+		if to == "[*]" {
+			to = FinalState
+		}
+
+		for _, id := range []string{from, to} {
+			if known[id] {
+				continue
+			}
+			known[id] = true
+
+			n := parser.StateNode{Name: id, Label: id}
+			if id == InitialState || id == FinalState {
+				n = parser.StateNode{Name: "[*]"}
+			}
+
+			w, h := sizer.NodeSize(n)
+			g.Nodes = append(g.Nodes, Node{ID: id, Width: w, Height: h, Source: n})
+		}
+
+		edge := Edge{From: from, To: to, Hint: ParseHint(e.Direction), Label: e.Text, Source: e}
+		if e.Text != "" {
+			edge.LabelWidth, edge.LabelHeight = sizer.TextSize(e.Text)
+		}
+
+		g.Edges = append(g.Edges, edge)
+	}
+
+	return g
+}
+
+// ActivityGraph builds a graph from the control flow of an activity diagram.
+// Partitions become clusters. Each decision or fork gets a node for where it
+// splits, with the IfNode or ForkNode as its source, and a node where the
+// branches come back together, whose source is an empty IfNode or ForkNode.
+func ActivityGraph(doc parser.DocumentNode, sizer Sizer, padding float64) Graph {
+	b := activityBuilder{sizer: sizer, padding: padding}
+
+	b.statements(doc.Nodes, "", nil)
+
+	return b.g
+}
+
+// exit is a loose end of the flow, waiting to be joined to whatever comes
+// next.
+type exit struct {
+	from  string
+	label string
+}
+
+type activityBuilder struct {
+	g       Graph
+	sizer   Sizer
+	padding float64
+	count   int
+}
+
+func (b *activityBuilder) node(n parser.Node, cluster string) string {
+	b.count++
+	id := fmt.Sprintf("n%d", b.count)
+
+	w, h := b.sizer.NodeSize(n)
+	b.g.Nodes = append(b.g.Nodes, Node{ID: id, Cluster: cluster, Width: w, Height: h, Source: n})
+
+	return id
+}
+
+func (b *activityBuilder) connect(exits []exit, to string) {
+	for _, e := range exits {
+		edge := Edge{From: e.from, To: to, Label: e.label}
+		if e.label != "" {
+			edge.LabelWidth, edge.LabelHeight = b.sizer.TextSize(e.label)
+		}
+
+		b.g.Edges = append(b.g.Edges, edge)
+	}
+}
+
+func (b *activityBuilder) statements(nodes []parser.Node, cluster string, exits []exit) []exit {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case parser.StartNode, parser.ActionNode:
+			id := b.node(n, cluster)
+			b.connect(exits, id)
+			exits = []exit{{from: id}}
+		case parser.EndNode:
+			id := b.node(n, cluster)
+			b.connect(exits, id)
+			exits = nil
+		case parser.PartitionNode:
+			b.count++
+			id := fmt.Sprintf("p%d", b.count)
+
+			w, h := b.sizer.NodeSize(n)
+			b.g.Clusters = append(b.g.Clusters, Cluster{ID: id, Parent: cluster, Padding: b.padding, HeaderWidth: w, HeaderHeight: h, Source: n})
+
+			exits = b.statements(n.Children, id, exits)
+		case parser.IfNode:
+			exits = b.decision(n, cluster, exits)
+		case parser.ForkNode:
+			exits = b.fork(n, cluster, exits)
+		}
+	}
+
+	return exits
+}
+
+func (b *activityBuilder) decision(n parser.IfNode, cluster string, exits []exit) []exit {
+	split := b.node(n, cluster)
+	b.connect(exits, split)
+
+	var out []exit
+
+	out = append(out, b.statements(n.Statements, cluster, []exit{{from: split, label: contentOf(n.Value)}})...)
+
+	hasElse := false
+	for e := n.Else; e != nil; {
+		elseNode, ok := e.(parser.ElseNode)
+		if !ok {
+			break
+		}
+
+		label := contentOf(elseNode.Value)
+		if elseNode.Condition != nil {
+			label = contentOf(elseNode.Condition) + ": " + label
+		} else {
+			hasElse = true
+		}
+
+		out = append(out, b.statements(elseNode.Statements, cluster, []exit{{from: split, label: label}})...)
+
+		e = elseNode.Else
+	}
+
+	if !hasElse {
+		out = append(out, exit{from: split})
+	}
+
+	merge := b.node(parser.IfNode{}, cluster)
+	b.connect(out, merge)
+
+	return []exit{{from: merge}}
+}
+
+func (b *activityBuilder) fork(n parser.ForkNode, cluster string, exits []exit) []exit {
+	split := b.node(n, cluster)
+	b.connect(exits, split)
+
+	var out []exit
+
+	out = append(out, b.statements(n.Statements, cluster, []exit{{from: split}})...)
+
+	for e := n.ForkAgain; e != nil; {
+		forkNode, ok := e.(parser.ForkNode)
+		if !ok {
+			break
+		}
+
+		out = append(out, b.statements(forkNode.Statements, cluster, []exit{{from: split}})...)
+
+		e = forkNode.ForkAgain
+	}
+
+	join := b.node(parser.ForkNode{}, cluster)
+	b.connect(out, join)
+
+	return []exit{{from: join}}
+}
+
+func contentOf(n parser.Node) string {
+	if p, ok := n.(parser.ParenthesisNode); ok {
+		return p.Content
+	}
+
+	return ""
+}
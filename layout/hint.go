@@ -0,0 +1,112 @@
+package layout
+
+import (
+	"strings"
+)
+
+// Hint is the direction an edge asks to be drawn in. None means the edge just
+// follows the flow of the diagram to the next rank, and Across means it stays
+// on the same rank, which is what PlantUML does for short arrows such as `->`.
+type Hint int
+
+const (
+	None Hint = iota
+	Up
+	Down
+	Left
+	Right
+	Across
+)
+
+func (h Hint) String() string {
+	switch h {
+	case None:
+		return "none"
+	case Up:
+		return "up"
+	case Down:
+		return "down"
+	case Left:
+		return "left"
+	case Right:
+		return "right"
+	case Across:
+		return "across"
+	default:
+		return "unknown"
+	}
+}
+
+// sameRank reports whether the hint places both ends of an edge on the same
+// rank.
+func (h Hint) sameRank() bool {
+	return h == Left || h == Right || h == Across
+}
+
+// transpose maps a hint into the coordinate space used when laying out a
+// left-to-right graph as if it were top-to-bottom.
+func (h Hint) transpose() Hint {
+	switch h {
+	case Up:
+		return Left
+	case Down:
+		return Right
+	case Left:
+		return Up
+	case Right:
+		return Down
+	default:
+		return h
+	}
+}
+
+// ParseHint extracts the direction hint from an arrow such as `-->`,
+// `-up->`, `-[#red]l->` or `->`.
+func ParseHint(arrow string) Hint {
+	var b strings.Builder
+
+	// styles are written in the middle of the arrow, as in `-[#red]->`, so
+	// they split one dash into two.
+	styled := false
+
+	depth := 0
+	for _, c := range arrow {
+		switch {
+		case c == '[':
+			styled = true
+			depth++
+		case c == ']':
+			if depth > 0 {
+				depth--
+			}
+		case depth > 0:
+		default:
+			b.WriteRune(c)
+		}
+	}
+
+	s := strings.ToLower(b.String())
+
+	word := strings.TrimFunc(s, func(c rune) bool { return c < 'a' || c > 'z' })
+	switch word {
+	case "u", "up":
+		return Up
+	case "d", "do", "down":
+		return Down
+	case "l", "le", "left":
+		return Left
+	case "r", "ri", "right":
+		return Right
+	}
+
+	length := strings.Count(s, "-") + strings.Count(s, ".")
+	if styled {
+		length--
+	}
+
+	if length == 1 {
+		return Across
+	}
+
+	return None
+}
@@ -0,0 +1,449 @@
+package layout
+
+import (
+	"fmt"
+	"math"
+
+	"fknsrs.biz/p/plantuml/parser"
+)
+
+type Point struct{ X, Y float64 }
+
+type Rect struct{ X, Y, Width, Height float64 }
+
+func (r Rect) Centre() Point {
+	return Point{r.X + r.Width/2, r.Y + r.Height/2}
+}
+
+// Clip finds where a line from the centre of the rectangle towards a point
+// crosses its boundary.
+func (r Rect) Clip(towards Point) Point {
+	c := r.Centre()
+
+	dx, dy := towards.X-c.X, towards.Y-c.Y
+	if dx == 0 && dy == 0 {
+		return c
+	}
+
+	t := math.Inf(1)
+	if dx != 0 {
+		t = math.Min(t, (r.Width/2)/math.Abs(dx))
+	}
+	if dy != 0 {
+		t = math.Min(t, (r.Height/2)/math.Abs(dy))
+	}
+
+	return Point{c.X + dx*t, c.Y + dy*t}
+}
+
+func (r Rect) translate(dx, dy float64) Rect {
+	return Rect{r.X + dx, r.Y + dy, r.Width, r.Height}
+}
+
+type Direction int
+
+const (
+	TopToBottom Direction = iota
+	LeftToRight
+)
+
+type Graph struct {
+	Direction Direction
+	Nodes     []Node
+	Edges     []Edge
+	Clusters  []Cluster
+}
+
+type Node struct {
+	ID      string
+	Cluster string
+	Width   float64
+	Height  float64
+	Source  parser.Node
+}
+
+type Edge struct {
+	From        string
+	To          string
+	Hint        Hint
+	Label       string
+	LabelWidth  float64
+	LabelHeight float64
+	// Hidden edges influence placement but aren't routed.
+	Hidden bool
+	Source parser.Node
+}
+
+// Cluster groups nodes (and other clusters) into a box, such as a composite
+// state or a partition. Edges can use clusters as endpoints.
+type Cluster struct {
+	ID           string
+	Parent       string
+	Padding      float64
+	HeaderWidth  float64
+	HeaderHeight float64
+	Source       parser.Node
+}
+
+// Options controls the spacing of a layout. LoopSize, LabelSpacing and
+// ParallelSpacing use their value from DefaultOptions when they're zero, and
+// are turned off when they're negative.
+type Options struct {
+	NodeSpacing float64
+	RankSpacing float64
+	// LoopSize is how far self loops stick out from the side of a node. When
+	// it's turned off, self loops take up no room and aren't routed.
+	LoopSize float64
+	// LabelSpacing is the gap between an edge and its label.
+	LabelSpacing float64
+	// ParallelSpacing is the gap between edges that run side by side between
+	// the same two nodes in a rank.
+	ParallelSpacing float64
+}
+
+var DefaultOptions = Options{NodeSpacing: 30, RankSpacing: 40, LoopSize: 20, LabelSpacing: 4, ParallelSpacing: 12}
+
+// withDefaults fills in the options that were left as zero, and sets the ones
+// that were turned off to zero, so that the layout can use them as they are.
+func (o Options) withDefaults() Options {
+	for _, f := range []struct{ v, def *float64 }{
+		{&o.LoopSize, &DefaultOptions.LoopSize},
+		{&o.LabelSpacing, &DefaultOptions.LabelSpacing},
+		{&o.ParallelSpacing, &DefaultOptions.ParallelSpacing},
+	} {
+		switch {
+		case *f.v == 0:
+			*f.v = *f.def
+		case *f.v < 0:
+			*f.v = 0
+		}
+	}
+
+	return o
+}
+
+type PlacedNode struct {
+	Node
+	Rect Rect
+}
+
+type PlacedCluster struct {
+	Cluster
+	Rect Rect
+}
+
+type PlacedEdge struct {
+	Edge
+	Points []Point
+	// LabelPosition is the top left corner of the label.
+	LabelPosition Point
+}
+
+type Geometry struct {
+	Width    float64
+	Height   float64
+	Nodes    []PlacedNode
+	Clusters []PlacedCluster
+	Edges    []PlacedEdge
+}
+
+func (g *Geometry) Node(id string) *PlacedNode {
+	for i := range g.Nodes {
+		if g.Nodes[i].ID == id {
+			return &g.Nodes[i]
+		}
+	}
+
+	return nil
+}
+
+func (g *Geometry) Cluster(id string) *PlacedCluster {
+	for i := range g.Clusters {
+		if g.Clusters[i].ID == id {
+			return &g.Clusters[i]
+		}
+	}
+
+	return nil
+}
+
+// item is anything that gets placed inside a cluster (or at the top level):
+// either a node or a nested cluster.
+type item struct {
+	id        string
+	isCluster bool
+	parent    string
+	w, h      float64
+	// contentWidth is the width of the level inside a cluster.
+	contentWidth float64
+	// rect is relative to the parent's content area until the final pass.
+	rect     Rect
+	children []*item
+	cluster  *Cluster
+}
+
+// Layout computes positions for every node and cluster in a graph, and routes
+// for every visible edge. Clusters are laid out from the inside out: the
+// contents of each cluster are arranged as their own layered graph, then the
+// cluster is treated as a single large node by its parent.
+func Layout(g Graph, opts Options) (*Geometry, error) {
+	opts = opts.withDefaults()
+
+	original := g
+	if g.Direction == LeftToRight {
+		g = transposeGraph(g)
+	}
+
+	items := make(map[string]*item)
+	root := &item{isCluster: true}
+
+	for i := range g.Clusters {
+		c := &g.Clusters[i]
+		if _, ok := items[c.ID]; ok || c.ID == "" {
+			return nil, fmt.Errorf("Layout: duplicate or empty cluster id %q", c.ID)
+		}
+
+		items[c.ID] = &item{id: c.ID, isCluster: true, parent: c.Parent, cluster: c}
+	}
+
+	for _, n := range g.Nodes {
+		if _, ok := items[n.ID]; ok || n.ID == "" {
+			return nil, fmt.Errorf("Layout: duplicate or empty node id %q", n.ID)
+		}
+
+		items[n.ID] = &item{id: n.ID, parent: n.Cluster, w: n.Width, h: n.Height}
+	}
+
+	var order []*item
+	for _, c := range g.Clusters {
+		order = append(order, items[c.ID])
+	}
+	for _, n := range g.Nodes {
+		order = append(order, items[n.ID])
+	}
+
+	for _, it := range order {
+		parent := root
+		if it.parent != "" {
+			p, ok := items[it.parent]
+			if !ok || !p.isCluster {
+				return nil, fmt.Errorf("Layout: %q has unknown parent cluster %q", it.id, it.parent)
+			}
+			parent = p
+		}
+
+		parent.children = append(parent.children, it)
+	}
+
+	for _, it := range order {
+		seen := make(map[string]bool)
+		for p := it.parent; p != ""; p = items[p].parent {
+			if seen[p] {
+				return nil, fmt.Errorf("Layout: cluster %q contains itself", p)
+			}
+			seen[p] = true
+		}
+	}
+
+	chain := func(id string) []*item {
+		var a []*item
+		for it := items[id]; it != nil; it = items[it.parent] {
+			a = append([]*item{it}, a...)
+			if it.parent == "" {
+				break
+			}
+		}
+		return a
+	}
+
+	levelEdges := make(map[*item][]levelEdge)
+	var nested []int
+
+	for i, e := range g.Edges {
+		if items[e.From] == nil || items[e.To] == nil {
+			return nil, fmt.Errorf("Layout: edge %d refers to unknown node (%q -> %q)", i, e.From, e.To)
+		}
+
+		from, to := chain(e.From), chain(e.To)
+
+		k := 0
+		for k < len(from) && k < len(to) && from[k] == to[k] {
+			k++
+		}
+
+		if e.From != e.To && (k == len(from) || k == len(to)) {
+			nested = append(nested, i)
+			continue
+		}
+
+		level := root
+		if k > 0 {
+			level = from[k-1]
+		}
+
+		if e.From == e.To {
+			level = root
+			if items[e.From].parent != "" {
+				level = items[items[e.From].parent]
+			}
+			levelEdges[level] = append(levelEdges[level], levelEdge{index: i, from: items[e.From], to: items[e.To], edge: e})
+			continue
+		}
+
+		levelEdges[level] = append(levelEdges[level], levelEdge{index: i, from: from[k], to: to[k], edge: e})
+	}
+
+	routes := make([]*route, len(g.Edges))
+
+	var measure func(it *item)
+	measure = func(it *item) {
+		for _, c := range it.children {
+			if c.isCluster {
+				measure(c)
+			}
+		}
+
+		w, h := layoutLevel(it.children, levelEdges[it], routes, opts)
+		it.contentWidth = w
+
+		if it == root {
+			it.w, it.h = w, h
+			return
+		}
+
+		c := it.cluster
+		it.w = math.Max(w, c.HeaderWidth) + c.Padding*2
+		it.h = h + c.HeaderHeight + c.Padding*2
+	}
+	measure(root)
+
+	var place func(it *item, x, y float64)
+	place = func(it *item, x, y float64) {
+		it.rect = it.rect.translate(x, y)
+
+		cx, cy := it.rect.X, it.rect.Y
+		if it.cluster != nil {
+			cx += it.cluster.Padding
+			cy += it.cluster.Padding + it.cluster.HeaderHeight
+			// centre the content if the header made the cluster wider
+			cx += (it.rect.Width - it.cluster.Padding*2 - it.contentWidth) / 2
+		}
+
+		for _, e := range levelEdges[it] {
+			if r := routes[e.index]; r != nil {
+				for j := range r.points {
+					r.points[j].X += cx
+					r.points[j].Y += cy
+				}
+				r.label.X += cx
+				r.label.Y += cy
+			}
+		}
+
+		for _, c := range it.children {
+			place(c, cx, cy)
+		}
+	}
+	root.rect = Rect{0, 0, root.w, root.h}
+	place(root, 0, 0)
+
+	geometry := Geometry{Width: root.w, Height: root.h}
+
+	for _, c := range original.Clusters {
+		geometry.Clusters = append(geometry.Clusters, PlacedCluster{Cluster: c, Rect: items[c.ID].rect})
+	}
+	for _, n := range original.Nodes {
+		geometry.Nodes = append(geometry.Nodes, PlacedNode{Node: n, Rect: items[n.ID].rect})
+	}
+
+	for _, i := range nested {
+		e := g.Edges[i]
+		a, b := items[e.From].rect, items[e.To].rect
+		routes[i] = &route{points: []Point{a.Clip(b.Centre()), b.Clip(a.Centre())}}
+		routes[i].label = midpoint(routes[i].points)
+	}
+
+	for i, e := range g.Edges {
+		if e.Hidden {
+			continue
+		}
+
+		r := routes[i]
+		if r == nil {
+			continue
+		}
+
+		points := r.points
+
+		// edges into or out of nested nodes were routed between the
+		// outermost clusters that contain them, so reattach the ends to the
+		// real nodes.
+		if len(points) >= 2 && e.From != e.To {
+			from, to := items[e.From].rect, items[e.To].rect
+			points[0] = from.Clip(points[1])
+			points[len(points)-1] = to.Clip(points[len(points)-2])
+		}
+
+		geometry.Edges = append(geometry.Edges, PlacedEdge{Edge: original.Edges[i], Points: points, LabelPosition: r.label})
+	}
+
+	if g.Direction == LeftToRight {
+		transposeGeometry(&geometry)
+	}
+
+	return &geometry, nil
+}
+
+func midpoint(points []Point) Point {
+	if len(points) == 0 {
+		return Point{}
+	}
+
+	a, b := points[(len(points)-1)/2], points[len(points)/2]
+
+	return Point{(a.X + b.X) / 2, (a.Y + b.Y) / 2}
+}
+
+func transposeGraph(g Graph) Graph {
+	t := Graph{Direction: g.Direction}
+
+	for _, n := range g.Nodes {
+		n.Width, n.Height = n.Height, n.Width
+		t.Nodes = append(t.Nodes, n)
+	}
+
+	for _, e := range g.Edges {
+		e.Hint = e.Hint.transpose()
+		e.LabelWidth, e.LabelHeight = e.LabelHeight, e.LabelWidth
+		t.Edges = append(t.Edges, e)
+	}
+
+	for _, c := range g.Clusters {
+		c.HeaderWidth, c.HeaderHeight = c.HeaderHeight, c.HeaderWidth
+		t.Clusters = append(t.Clusters, c)
+	}
+
+	return t
+}
+
+func transposeGeometry(g *Geometry) {
+	g.Width, g.Height = g.Height, g.Width
+
+	flip := func(r Rect) Rect { return Rect{r.Y, r.X, r.Height, r.Width} }
+
+	for i := range g.Nodes {
+		g.Nodes[i].Rect = flip(g.Nodes[i].Rect)
+	}
+
+	for i := range g.Clusters {
+		g.Clusters[i].Rect = flip(g.Clusters[i].Rect)
+	}
+
+	for i := range g.Edges {
+		e := &g.Edges[i]
+		for j := range e.Points {
+			e.Points[j] = Point{e.Points[j].Y, e.Points[j].X}
+		}
+		e.LabelPosition = Point{e.LabelPosition.Y, e.LabelPosition.X}
+	}
+}
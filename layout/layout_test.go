@@ -0,0 +1,296 @@
+package layout
+
+import (
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+
+  "fknsrs.biz/p/plantuml/parser"
+)
+
+func box(id, cluster string) Node {
+  return Node{ID: id, Cluster: cluster, Width: 40, Height: 20}
+}
+
+func overlaps(a, b Rect) bool {
+  return a.X < b.X+b.Width && b.X < a.X+a.Width && a.Y < b.Y+b.Height && b.Y < a.Y+a.Height
+}
+
+func contains(outer, inner Rect) bool {
+  return inner.X >= outer.X && inner.Y >= outer.Y && inner.X+inner.Width <= outer.X+outer.Width && inner.Y+inner.Height <= outer.Y+outer.Height
+}
+
+func TestLayoutChain(t *testing.T) {
+  a := assert.New(t)
+
+  g, err := Layout(Graph{
+    Nodes: []Node{box("A", ""), box("B", ""), box("C", "")},
+    Edges: []Edge{{From: "A", To: "B"}, {From: "B", To: "C"}},
+  }, DefaultOptions)
+  a.NoError(err)
+
+  na, nb, nc := g.Node("A"), g.Node("B"), g.Node("C")
+  a.True(na.Rect.Y < nb.Rect.Y && nb.Rect.Y < nc.Rect.Y)
+  a.Equal(na.Rect.Centre().X, nb.Rect.Centre().X)
+  a.Equal(nb.Rect.Centre().X, nc.Rect.Centre().X)
+
+  a.Equal(40.0, g.Width)
+  a.Equal(20*3+DefaultOptions.RankSpacing*2, g.Height)
+
+  a.Len(g.Edges, 2)
+  a.Equal(Point{20, 20}, g.Edges[0].Points[0])
+  a.Equal(Point{20, 20 + DefaultOptions.RankSpacing}, g.Edges[0].Points[len(g.Edges[0].Points)-1])
+}
+
+func TestLayoutCycle(t *testing.T) {
+  a := assert.New(t)
+
+  g, err := Layout(Graph{
+    Nodes: []Node{box("A", ""), box("B", ""), box("C", "")},
+    Edges: []Edge{{From: "A", To: "B"}, {From: "B", To: "C"}, {From: "C", To: "A"}, {From: "B", To: "B"}},
+  }, DefaultOptions)
+  a.NoError(err)
+
+  a.True(g.Node("A").Rect.Y < g.Node("B").Rect.Y)
+  a.True(g.Node("B").Rect.Y < g.Node("C").Rect.Y)
+
+  a.Len(g.Edges, 4)
+
+  // the edge that closes the cycle still goes from C to A
+  back := g.Edges[2].Points
+  a.True(back[0].Y < g.Node("C").Rect.Y+1)
+  a.True(back[len(back)-1].Y > g.Node("A").Rect.Y)
+
+  // self loops hang off the right hand side
+  loop := g.Edges[3].Points
+  a.Len(loop, 4)
+  a.Equal(g.Node("B").Rect.X+40, loop[0].X)
+}
+
+func TestLayoutHints(t *testing.T) {
+  a := assert.New(t)
+
+  g, err := Layout(Graph{
+    Nodes: []Node{box("A", ""), box("B", ""), box("C", ""), box("D", ""), box("E", "")},
+    Edges: []Edge{
+      {From: "A", To: "B", Hint: Right},
+      {From: "A", To: "C", Hint: Left},
+      {From: "A", To: "D", Hint: Up},
+      {From: "A", To: "E", Hint: Down},
+    },
+  }, DefaultOptions)
+  a.NoError(err)
+
+  na := g.Node("A")
+  a.Equal(na.Rect.Y, g.Node("B").Rect.Y)
+  a.Equal(na.Rect.Y, g.Node("C").Rect.Y)
+  a.True(g.Node("B").Rect.X > na.Rect.X)
+  a.True(g.Node("C").Rect.X < na.Rect.X)
+  a.True(g.Node("D").Rect.Y < na.Rect.Y)
+  a.True(g.Node("E").Rect.Y > na.Rect.Y)
+
+  for _, n := range g.Nodes {
+    for _, m := range g.Nodes {
+      if n.ID != m.ID {
+        a.False(overlaps(n.Rect, m.Rect), "%s overlaps %s", n.ID, m.ID)
+      }
+    }
+  }
+}
+
+func TestLayoutCrossings(t *testing.T) {
+  a := assert.New(t)
+
+  g, err := Layout(Graph{
+    Nodes: []Node{box("A", ""), box("B", ""), box("C", ""), box("D", "")},
+    Edges: []Edge{{From: "A", To: "D"}, {From: "B", To: "C"}},
+  }, DefaultOptions)
+  a.NoError(err)
+
+  a.True(g.Node("A").Rect.X < g.Node("B").Rect.X)
+  a.True(g.Node("D").Rect.X < g.Node("C").Rect.X)
+}
+
+func TestLayoutLabels(t *testing.T) {
+  a := assert.New(t)
+
+  g, err := Layout(Graph{
+    Nodes: []Node{box("A", ""), box("B", "")},
+    Edges: []Edge{{From: "A", To: "B", Label: "go", LabelWidth: 30, LabelHeight: 15}},
+  }, DefaultOptions)
+  a.NoError(err)
+
+  label := Rect{g.Edges[0].LabelPosition.X, g.Edges[0].LabelPosition.Y, 30, 15}
+  a.False(overlaps(label, g.Node("A").Rect))
+  a.False(overlaps(label, g.Node("B").Rect))
+  a.True(contains(Rect{0, 0, g.Width, g.Height}, label))
+
+  // options left as zero get their defaults.
+  loops := Graph{
+    Nodes: []Node{box("A", ""), box("B", "")},
+    Edges: []Edge{{From: "A", To: "A", Label: "again", LabelWidth: 30, LabelHeight: 15}, {From: "A", To: "B"}},
+  }
+
+  want, err := Layout(loops, DefaultOptions)
+  a.NoError(err)
+  got, err := Layout(loops, Options{NodeSpacing: DefaultOptions.NodeSpacing, RankSpacing: DefaultOptions.RankSpacing})
+  a.NoError(err)
+  a.Equal(want, got)
+
+  // and negative ones are turned off.
+  got, err = Layout(loops, Options{NodeSpacing: DefaultOptions.NodeSpacing, RankSpacing: DefaultOptions.RankSpacing, LoopSize: -1})
+  a.NoError(err)
+  if a.Len(got.Edges, 1) {
+    a.Equal("B", got.Edges[0].To)
+  }
+  a.Equal(box("A", "").Width, got.Node("A").Rect.Width)
+  a.True(got.Width < want.Width)
+}
+
+func TestLayoutClusters(t *testing.T) {
+  a := assert.New(t)
+
+  g, err := Layout(Graph{
+    Nodes: []Node{box("A", ""), box("B", "outer"), box("C", "inner"), box("D", "inner")},
+    Edges: []Edge{{From: "A", To: "B"}, {From: "B", To: "C"}, {From: "C", To: "D"}, {From: "A", To: "inner"}},
+    Clusters: []Cluster{
+      {ID: "outer", Padding: 5, HeaderWidth: 200, HeaderHeight: 10},
+      {ID: "inner", Parent: "outer", Padding: 5},
+    },
+  }, DefaultOptions)
+  a.NoError(err)
+
+  outer, inner := g.Cluster("outer"), g.Cluster("inner")
+  a.True(contains(outer.Rect, g.Node("B").Rect))
+  a.True(contains(outer.Rect, inner.Rect))
+  a.True(contains(inner.Rect, g.Node("C").Rect))
+  a.True(contains(inner.Rect, g.Node("D").Rect))
+  a.False(contains(outer.Rect, g.Node("A").Rect))
+  a.True(outer.Rect.Width >= 210)
+
+  // edges to nodes inside clusters end at the node itself
+  e := g.Edges[1].Points
+  a.Equal(g.Node("C").Rect.Y, e[len(e)-1].Y)
+}
+
+func TestLayoutLeftToRight(t *testing.T) {
+  a := assert.New(t)
+
+  g, err := Layout(Graph{
+    Direction: LeftToRight,
+    Nodes:     []Node{{ID: "A", Width: 60, Height: 20}, box("B", ""), box("C", "")},
+    Edges:     []Edge{{From: "A", To: "B"}, {From: "B", To: "C", Hint: Across}},
+  }, DefaultOptions)
+  a.NoError(err)
+
+  na, nb, nc := g.Node("A"), g.Node("B"), g.Node("C")
+  a.Equal(60.0, na.Rect.Width)
+  a.Equal(20.0, na.Rect.Height)
+  a.True(nb.Rect.X > na.Rect.X+na.Rect.Width)
+  a.Equal(nb.Rect.X, nc.Rect.X)
+  a.True(nc.Rect.Y > nb.Rect.Y)
+  a.Equal(Hint(Across), g.Edges[1].Hint)
+}
+
+func TestLayoutErrors(t *testing.T) {
+  a := assert.New(t)
+
+  _, err := Layout(Graph{Nodes: []Node{box("A", "")}, Edges: []Edge{{From: "A", To: "B"}}}, DefaultOptions)
+  a.Error(err)
+
+  _, err = Layout(Graph{Nodes: []Node{box("A", "X")}}, DefaultOptions)
+  a.Error(err)
+
+  _, err = Layout(Graph{Nodes: []Node{box("A", ""), box("A", "")}}, DefaultOptions)
+  a.Error(err)
+
+  _, err = Layout(Graph{Clusters: []Cluster{{ID: "X", Parent: "Y"}, {ID: "Y", Parent: "X"}}}, DefaultOptions)
+  a.Error(err)
+
+  g, err := Layout(Graph{}, DefaultOptions)
+  a.NoError(err)
+  a.Equal(0.0, g.Width)
+}
+
+func TestParseHint(t *testing.T) {
+  a := assert.New(t)
+
+  for arrow, hint := range map[string]Hint{
+    "-->":         None,
+    "->":          Across,
+    "-up->":       Up,
+    "-u->":        Up,
+    "-down->":     Down,
+    "-do->":       Down,
+    "-left->":     Left,
+    "-l->":        Left,
+    "-right->":    Right,
+    "-[#red]->":   Across,
+    "-[#red]-->":  None,
+    "-[dotted]r->": Right,
+    "..>":         None,
+  } {
+    a.Equal(hint, ParseHint(arrow), arrow)
+  }
+}
+
+type testSizer struct{}
+
+func (testSizer) NodeSize(n parser.Node) (float64, float64) { return 40, 20 }
+func (testSizer) TextSize(s string) (float64, float64)      { return float64(len(s)) * 8, 15 }
+
+func TestStateGraph(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := parser.ParseDocument("@startuml\nstate A {\n  state A1\n  ---\n  state A2\n}\n[*] --> A\nA -right-> B : go\nB --> [*]\n@enduml\n")
+  a.NoError(err)
+
+  g := StateGraph(*doc, testSizer{}, 5)
+
+  var nodes, clusters []string
+  for _, n := range g.Nodes {
+    nodes = append(nodes, n.ID+"@"+n.Cluster)
+  }
+  for _, c := range g.Clusters {
+    clusters = append(clusters, c.ID+"@"+c.Parent)
+  }
+
+  a.Equal([]string{"A1@A/region1", "A2@A/region2", InitialState + "@", "B@", FinalState + "@"}, nodes)
+  a.Equal([]string{"A@", "A/region1@A", "A/region2@A"}, clusters)
+
+  a.Len(g.Edges, 4)
+  a.True(g.Edges[0].Hidden)
+  a.Equal(Edge{From: "A", To: "B", Hint: Right, Label: "go", LabelWidth: 16, LabelHeight: 15, Source: g.Edges[2].Source}, g.Edges[2])
+
+  geometry, err := Layout(g, DefaultOptions)
+  a.NoError(err)
+  a.True(geometry.Cluster("A/region1").Rect.Y < geometry.Cluster("A/region2").Rect.Y)
+  a.Len(geometry.Edges, 3)
+}
+
+func TestActivityGraph(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := parser.ParseDocument("@startuml\nstart\npartition P {\n  if (ok?) then (yes)\n    :A;\n  else (no)\n    :B;\n  endif\n}\nend\n@enduml\n")
+  a.NoError(err)
+
+  g := ActivityGraph(*doc, testSizer{}, 5)
+
+  a.Len(g.Clusters, 1)
+  a.Len(g.Nodes, 6)
+
+  var labels []string
+  for _, e := range g.Edges {
+    labels = append(labels, e.From+">"+e.To+":"+e.Label)
+  }
+  a.Equal([]string{"n1>n3:", "n3>n4:yes", "n3>n5:no", "n4>n6:", "n5>n6:", "n6>n7:"}, labels)
+
+  for _, n := range g.Nodes[1:5] {
+    a.Equal(g.Clusters[0].ID, n.Cluster)
+  }
+
+  geometry, err := Layout(g, DefaultOptions)
+  a.NoError(err)
+  a.True(contains(geometry.Clusters[0].Rect, geometry.Node("n4").Rect))
+  a.False(contains(geometry.Clusters[0].Rect, geometry.Node("n7").Rect))
+}
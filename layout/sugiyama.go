@@ -0,0 +1,621 @@
+package layout
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	sweeps     = 24
+	alignments = 8
+)
+
+type levelEdge struct {
+	index    int
+	from, to *item
+	edge     Edge
+}
+
+type route struct {
+	points []Point
+	label  Point
+}
+
+// vertex is a node in the proper layered graph: either a real item or a dummy
+// standing in for an edge where it crosses a rank.
+type vertex struct {
+	item        *item
+	left, right float64
+	h           float64
+	rank        int
+	pos         int
+	x, y        float64
+	up, down    []*vertex
+}
+
+type rankEdge struct {
+	from, to int
+	le       levelEdge
+}
+
+// layoutLevel arranges a set of sibling items using the usual layered
+// approach: break cycles, assign ranks, order each rank to reduce crossings,
+// then assign coordinates. Item rects and edge routes are written relative to
+// the top left of the level.
+func layoutLevel(items []*item, edges []levelEdge, routes []*route, opts Options) (float64, float64) {
+	if len(items) == 0 {
+		return 0, 0
+	}
+
+	index := make(map[*item]int)
+	for i, it := range items {
+		index[it] = i
+	}
+
+	// nodes joined by left/right edges share a rank, so union them into
+	// groups and rank the groups instead.
+	group := make([]int, len(items))
+	for i := range group {
+		group[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if group[i] != i {
+			group[i] = find(group[i])
+		}
+		return group[i]
+	}
+
+	var constraints [][2]*item
+	for _, e := range edges {
+		if e.from == e.to || !e.edge.Hint.sameRank() {
+			continue
+		}
+
+		group[find(index[e.from])] = find(index[e.to])
+
+		if e.edge.Hint == Left {
+			constraints = append(constraints, [2]*item{e.to, e.from})
+		} else {
+			constraints = append(constraints, [2]*item{e.from, e.to})
+		}
+	}
+
+	var rankEdges []rankEdge
+	var sameRank []levelEdge
+	var selfLoops []levelEdge
+
+	for _, e := range edges {
+		switch {
+		case e.from == e.to:
+			if opts.LoopSize > 0 {
+				selfLoops = append(selfLoops, e)
+			}
+		case find(index[e.from]) == find(index[e.to]):
+			sameRank = append(sameRank, e)
+		case e.edge.Hint == Up:
+			rankEdges = append(rankEdges, rankEdge{from: find(index[e.to]), to: find(index[e.from]), le: e})
+		default:
+			rankEdges = append(rankEdges, rankEdge{from: find(index[e.from]), to: find(index[e.to]), le: e})
+		}
+	}
+
+	breakCycles(len(items), rankEdges)
+
+	ranks := assignRanks(len(items), rankEdges)
+
+	labelled := false
+	for _, e := range rankEdges {
+		if e.le.edge.LabelWidth > 0 || e.le.edge.LabelHeight > 0 {
+			labelled = true
+		}
+	}
+
+	// labels get ranks of their own, so leave a gap between every rank
+	// that they can go in.
+	scale := 1
+	if labelled {
+		scale = 2
+	}
+
+	selfLoopExtra := make(map[*item]float64)
+	for _, e := range selfLoops {
+		if w := opts.LoopSize + opts.LabelSpacing + e.edge.LabelWidth; w > selfLoopExtra[e.from] {
+			selfLoopExtra[e.from] = w
+		}
+	}
+
+	vertices := make([]*vertex, len(items))
+	maxRank := 0
+	for i, it := range items {
+		vertices[i] = &vertex{
+			item:  it,
+			left:  it.w / 2,
+			right: it.w/2 + selfLoopExtra[it],
+			h:     it.h,
+			rank:  ranks[find(i)] * scale,
+		}
+		if selfLoopExtra[it] > 0 {
+			vertices[i].h = math.Max(it.h, opts.LoopSize)
+		}
+		if vertices[i].rank > maxRank {
+			maxRank = vertices[i].rank
+		}
+	}
+
+	chains := make([][]*vertex, len(rankEdges))
+	labels := make([]*vertex, len(rankEdges))
+
+	for k, e := range rankEdges {
+		from, to := vertices[index[e.le.from]], vertices[index[e.le.to]]
+		if from.rank > to.rank {
+			from, to = to, from
+		}
+
+		chain := []*vertex{from}
+		mid := (from.rank + to.rank) / 2
+
+		for r := from.rank + 1; r < to.rank; r++ {
+			d := &vertex{rank: r}
+			if r == mid && (e.le.edge.LabelWidth > 0 || e.le.edge.LabelHeight > 0) {
+				d.right = e.le.edge.LabelWidth + opts.LabelSpacing
+				d.h = e.le.edge.LabelHeight
+				labels[k] = d
+			}
+			chain = append(chain, d)
+			vertices = append(vertices, d)
+		}
+
+		chain = append(chain, to)
+
+		for j := 1; j < len(chain); j++ {
+			chain[j-1].down = append(chain[j-1].down, chain[j])
+			chain[j].up = append(chain[j].up, chain[j-1])
+		}
+
+		chains[k] = chain
+	}
+
+	layers := make([][]*vertex, maxRank+1)
+	for _, v := range vertices {
+		v.pos = len(layers[v.rank])
+		layers[v.rank] = append(layers[v.rank], v)
+	}
+
+	lookup := make(map[*item]*vertex)
+	for _, v := range vertices {
+		if v.item != nil {
+			lookup[v.item] = v
+		}
+	}
+
+	var orderConstraints [][2]*vertex
+	for _, c := range constraints {
+		orderConstraints = append(orderConstraints, [2]*vertex{lookup[c[0]], lookup[c[1]]})
+	}
+
+	orderLayers(layers, orderConstraints)
+
+	width, height := assignCoordinates(layers, opts, labelled)
+
+	for _, v := range vertices {
+		if v.item == nil {
+			continue
+		}
+
+		v.item.rect = Rect{v.x - v.item.w/2, v.y - v.item.h/2, v.item.w, v.item.h}
+	}
+
+	for k, e := range rankEdges {
+		chain := chains[k]
+
+		var points []Point
+		for _, v := range chain {
+			points = append(points, Point{v.x, v.y})
+		}
+
+		first, last := chain[0].item.rect, chain[len(chain)-1].item.rect
+		points[0] = first.Clip(points[1])
+		points[len(points)-1] = last.Clip(points[len(points)-2])
+
+		// chains always run down the ranks, so flip them back if the
+		// edge really points upwards.
+		if e.le.from != chain[0].item {
+			for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+				points[i], points[j] = points[j], points[i]
+			}
+		}
+
+		r := &route{points: points, label: midpoint(points)}
+		if d := labels[k]; d != nil {
+			r.label = Point{d.x + opts.LabelSpacing, d.y - d.h/2}
+		}
+
+		routes[e.le.index] = r
+	}
+
+	// edges between the same pair of nodes on a rank are spread out
+	// vertically so they don't sit on top of each other.
+	parallel := make(map[[2]*item][]levelEdge)
+	for _, e := range sameRank {
+		k := [2]*item{e.from, e.to}
+		if index[e.from] > index[e.to] {
+			k = [2]*item{e.to, e.from}
+		}
+		parallel[k] = append(parallel[k], e)
+	}
+
+	for _, e := range sameRank {
+		k := [2]*item{e.from, e.to}
+		if index[e.from] > index[e.to] {
+			k = [2]*item{e.to, e.from}
+		}
+
+		var i int
+		for i = range parallel[k] {
+			if parallel[k][i].index == e.index {
+				break
+			}
+		}
+
+		offset := (float64(i) - float64(len(parallel[k])-1)/2) * opts.ParallelSpacing
+
+		a, b := e.from.rect, e.to.rect
+		ac, bc := a.Centre(), b.Centre()
+		ac.Y += offset
+		bc.Y += offset
+
+		points := []Point{a.Clip(Point{bc.X, ac.Y}), b.Clip(Point{ac.X, bc.Y})}
+		points[0].Y, points[1].Y = ac.Y, bc.Y
+		mid := midpoint(points)
+
+		label := Point{mid.X - e.edge.LabelWidth/2, mid.Y - e.edge.LabelHeight - opts.LabelSpacing}
+		if offset > 0 {
+			label.Y = mid.Y + opts.LabelSpacing
+		}
+
+		routes[e.index] = &route{points: points, label: label}
+	}
+
+	for _, e := range selfLoops {
+		r := e.from.rect
+		x, y := r.X+r.Width, r.Y+r.Height/2
+
+		routes[e.index] = &route{
+			points: []Point{
+				{x, y - opts.LoopSize/2},
+				{x + opts.LoopSize, y - opts.LoopSize/2},
+				{x + opts.LoopSize, y + opts.LoopSize/2},
+				{x, y + opts.LoopSize/2},
+			},
+			label: Point{x + opts.LoopSize + opts.LabelSpacing, y - e.edge.LabelHeight/2},
+		}
+	}
+
+	return width, height
+}
+
+// breakCycles reverses edges until the graph is acyclic. A depth first search
+// is started from every source in turn and any edge that leads back to a node
+// on the current path is reversed.
+func breakCycles(n int, edges []rankEdge) {
+	out := make([][]int, n)
+	in := make([]int, n)
+	for k, e := range edges {
+		out[e.from] = append(out[e.from], k)
+		in[e.to]++
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make([]int, n)
+
+	var visit func(i int)
+	visit = func(i int) {
+		state[i] = visiting
+		for _, k := range out[i] {
+			e := &edges[k]
+			switch state[e.to] {
+			case visiting:
+				e.from, e.to = e.to, e.from
+			case unvisited:
+				visit(e.to)
+			}
+		}
+		state[i] = visited
+	}
+
+	for i := 0; i < n; i++ {
+		if in[i] == 0 && state[i] == unvisited {
+			visit(i)
+		}
+	}
+	for i := 0; i < n; i++ {
+		if state[i] == unvisited {
+			visit(i)
+		}
+	}
+}
+
+// assignRanks gives every node the length of the longest path leading to it,
+// then pulls sources down so they sit just above their nearest successor.
+func assignRanks(n int, edges []rankEdge) []int {
+	out := make([][]int, n)
+	in := make([]int, n)
+	for _, e := range edges {
+		if e.from == e.to {
+			continue
+		}
+		out[e.from] = append(out[e.from], e.to)
+		in[e.to]++
+	}
+
+	sources := make([]bool, n)
+
+	var queue, order []int
+	for i := 0; i < n; i++ {
+		if in[i] == 0 {
+			sources[i] = true
+			queue = append(queue, i)
+		}
+	}
+
+	ranks := make([]int, n)
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		order = append(order, i)
+
+		for _, j := range out[i] {
+			if ranks[i]+1 > ranks[j] {
+				ranks[j] = ranks[i] + 1
+			}
+			if in[j]--; in[j] == 0 {
+				queue = append(queue, j)
+			}
+		}
+	}
+
+	for k := len(order) - 1; k >= 0; k-- {
+		i := order[k]
+		if !sources[i] || len(out[i]) == 0 {
+			continue
+		}
+
+		lowest := math.MaxInt32
+		for _, j := range out[i] {
+			if ranks[j] < lowest {
+				lowest = ranks[j]
+			}
+		}
+
+		ranks[i] = lowest - 1
+	}
+
+	return ranks
+}
+
+// orderLayers reduces crossings with the barycenter heuristic, sweeping down
+// and up the ranks and keeping the best ordering seen.
+func orderLayers(layers [][]*vertex, constraints [][2]*vertex) {
+	best := snapshot(layers)
+	bestCrossings := countCrossings(layers)
+
+	for i := 0; i < sweeps && bestCrossings > 0; i++ {
+		if i%2 == 0 {
+			for r := 1; r < len(layers); r++ {
+				sortLayer(layers[r], func(v *vertex) []*vertex { return v.up }, constraints)
+			}
+		} else {
+			for r := len(layers) - 2; r >= 0; r-- {
+				sortLayer(layers[r], func(v *vertex) []*vertex { return v.down }, constraints)
+			}
+		}
+
+		if c := countCrossings(layers); c < bestCrossings {
+			best, bestCrossings = snapshot(layers), c
+		}
+	}
+
+	for r, layer := range best {
+		copy(layers[r], layer)
+	}
+
+	for _, layer := range layers {
+		applyConstraints(layer, constraints)
+	}
+}
+
+func snapshot(layers [][]*vertex) [][]*vertex {
+	a := make([][]*vertex, len(layers))
+	for i, layer := range layers {
+		a[i] = append([]*vertex{}, layer...)
+	}
+	return a
+}
+
+func sortLayer(layer []*vertex, neighbours func(v *vertex) []*vertex, constraints [][2]*vertex) {
+	keys := make(map[*vertex]float64)
+	for _, v := range layer {
+		a := neighbours(v)
+		if len(a) == 0 {
+			keys[v] = float64(v.pos)
+			continue
+		}
+
+		var sum float64
+		for _, u := range a {
+			sum += float64(u.pos)
+		}
+		keys[v] = sum / float64(len(a))
+	}
+
+	sort.SliceStable(layer, func(i, j int) bool { return keys[layer[i]] < keys[layer[j]] })
+
+	applyConstraints(layer, constraints)
+}
+
+// applyConstraints moves nodes so that every left/right hint between two nodes
+// in the layer is satisfied.
+func applyConstraints(layer []*vertex, constraints [][2]*vertex) {
+	for i, v := range layer {
+		v.pos = i
+	}
+
+	for pass := 0; pass < len(layer); pass++ {
+		changed := false
+
+		for _, c := range constraints {
+			a, b := c[0], c[1]
+			if !inLayer(layer, a) || !inLayer(layer, b) || a.pos < b.pos {
+				continue
+			}
+
+			copy(layer[b.pos+1:a.pos+1], layer[b.pos:a.pos])
+			layer[b.pos] = a
+			for i, v := range layer {
+				v.pos = i
+			}
+			changed = true
+		}
+
+		if !changed {
+			break
+		}
+	}
+}
+
+func inLayer(layer []*vertex, v *vertex) bool {
+	return v.pos < len(layer) && layer[v.pos] == v
+}
+
+func countCrossings(layers [][]*vertex) int {
+	var total int
+
+	for _, layer := range layers {
+		var segments [][2]int
+		for _, v := range layer {
+			for _, u := range v.down {
+				segments = append(segments, [2]int{v.pos, u.pos})
+			}
+		}
+
+		for i := range segments {
+			for j := i + 1; j < len(segments); j++ {
+				a, b := segments[i], segments[j]
+				if (a[0]-b[0])*(a[1]-b[1]) < 0 {
+					total++
+				}
+			}
+		}
+	}
+
+	return total
+}
+
+// assignCoordinates packs each rank from the left, then repeatedly moves
+// nodes towards the average position of their neighbours while keeping them
+// apart, which straightens out long edges.
+func assignCoordinates(layers [][]*vertex, opts Options, labelled bool) (float64, float64) {
+	separation := func(a, b *vertex) float64 {
+		if a.item == nil || b.item == nil {
+			return a.right + b.left + opts.NodeSpacing/2
+		}
+		return a.right + b.left + opts.NodeSpacing
+	}
+
+	for _, layer := range layers {
+		for i, v := range layer {
+			v.x = v.left
+			if i > 0 {
+				v.x = layer[i-1].x + separation(layer[i-1], v)
+			}
+		}
+	}
+
+	place := func(layer []*vertex, neighbours func(v *vertex) []*vertex) {
+		if len(layer) == 0 {
+			return
+		}
+
+		desired := make([]float64, len(layer))
+		for i, v := range layer {
+			desired[i] = v.x
+			if a := neighbours(v); len(a) > 0 {
+				var sum float64
+				for _, u := range a {
+					sum += u.x
+				}
+				desired[i] = sum / float64(len(a))
+			}
+		}
+
+		lo := make([]float64, len(layer))
+		hi := make([]float64, len(layer))
+
+		for i := range layer {
+			lo[i] = desired[i]
+			if i > 0 && lo[i-1]+separation(layer[i-1], layer[i]) > lo[i] {
+				lo[i] = lo[i-1] + separation(layer[i-1], layer[i])
+			}
+		}
+
+		for i := len(layer) - 1; i >= 0; i-- {
+			hi[i] = desired[i]
+			if i < len(layer)-1 && hi[i+1]-separation(layer[i], layer[i+1]) < hi[i] {
+				hi[i] = hi[i+1] - separation(layer[i], layer[i+1])
+			}
+		}
+
+		for i, v := range layer {
+			v.x = (lo[i] + hi[i]) / 2
+		}
+	}
+
+	for i := 0; i < alignments; i++ {
+		for r := 1; r < len(layers); r++ {
+			place(layers[r], func(v *vertex) []*vertex { return v.up })
+		}
+		for r := len(layers) - 2; r >= 0; r-- {
+			place(layers[r], func(v *vertex) []*vertex { return v.down })
+		}
+	}
+
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	for _, layer := range layers {
+		for _, v := range layer {
+			minX = math.Min(minX, v.x-v.left)
+			maxX = math.Max(maxX, v.x+v.right)
+		}
+	}
+
+	gap := opts.RankSpacing
+	if labelled {
+		gap /= 2
+	}
+
+	var y float64
+	for r, layer := range layers {
+		var h float64
+		for _, v := range layer {
+			h = math.Max(h, v.h)
+		}
+
+		if r > 0 {
+			y += gap
+		}
+
+		for _, v := range layer {
+			v.x -= minX
+			v.y = y + h/2
+		}
+
+		y += h
+	}
+
+	return maxX - minX, y
+}
@@ -0,0 +1,347 @@
+package merge
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"fknsrs.biz/p/plantuml/parser"
+)
+
+// Conflict is a node that was changed in different ways on both sides. Any of
+// Base, Ours or Theirs can be nil, if the node didn't exist there.
+type Conflict struct {
+	Path   string
+	Base   parser.Node
+	Ours   parser.Node
+	Theirs parser.Node
+
+	// entry is set for conflicts inside a skinparam block, which are written
+	// without the keyword.
+	entry bool
+}
+
+func (c Conflict) String() string {
+	return "conflict in " + c.Path
+}
+
+type Result struct {
+	Document  parser.DocumentNode
+	Conflicts []Conflict
+
+	// placeholders maps the names of the stand-in nodes left in Document to
+	// the conflicts they stand for.
+	placeholders map[string]int
+	// inSkinParam is set while the children of a skinparam block are being
+	// merged.
+	inSkinParam bool
+}
+
+// Merge combines the changes made to base in ours and theirs. States, edges
+// and skinparams are matched up by name rather than position, so changes to
+// different nodes never conflict, and the children of composite states and
+// skinparam blocks are merged one by one. Other nodes are matched by their
+// content, so they can be added and removed but not changed.
+//
+// Where a node conflicts, Document holds a stand-in for it, which Format
+// writes out as a conflict section. If both sides change the kind of
+// document in different ways, that's a conflict with the path "document",
+// and Document keeps the kind ours has.
+func Merge(base, ours, theirs parser.DocumentNode) Result {
+	r := Result{placeholders: make(map[string]int)}
+
+	r.Document.Kind = ours.Kind
+	switch {
+	case ours.Kind == theirs.Kind, base.Kind == theirs.Kind:
+	case base.Kind == ours.Kind:
+		r.Document.Kind = theirs.Kind
+	default:
+		r.Conflicts = append(r.Conflicts, Conflict{
+			Path:   "document",
+			Base:   parser.DocumentNode{Kind: base.Kind},
+			Ours:   parser.DocumentNode{Kind: ours.Kind},
+			Theirs: parser.DocumentNode{Kind: theirs.Kind},
+		})
+	}
+
+	r.Document.Nodes = r.mergeNodes("", base.Nodes, ours.Nodes, theirs.Nodes)
+
+	return r
+}
+
+type entry struct {
+	key  string
+	node parser.Node
+}
+
+// keyNodes gives each node a name that identifies it across versions of a
+// document. Edges between the same pair of states are told apart by the order
+// they're in.
+func keyNodes(nodes []parser.Node) []entry {
+	seen := make(map[string]int)
+
+	var l []entry
+	for _, n := range nodes {
+		var key string
+		switch n := n.(type) {
+		case parser.StateNode:
+			key = "state " + n.Name
+		case parser.EdgeNode:
+			key = "edge " + n.Left + " --> " + n.Right
+		case parser.SkinParamNode:
+			key = "skinparam " + strings.ToLower(n.Name) + n.Stereotype
+		case parser.CommentNode:
+			continue
+		default:
+			key = n.NodeName() + " " + format(n)
+		}
+
+		seen[key]++
+		if n := seen[key]; n > 1 {
+			key = fmt.Sprintf("%s #%d", key, n)
+		}
+
+		l = append(l, entry{key, n})
+	}
+
+	return l
+}
+
+func format(n parser.Node) string {
+	if n == nil {
+		return ""
+	}
+
+	buf := bytes.NewBuffer(nil)
+	parser.FormatNode(n, buf)
+
+	return buf.String()
+}
+
+func same(a, b parser.Node) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return format(a) == format(b)
+}
+
+func index(l []entry) map[string]parser.Node {
+	m := make(map[string]parser.Node)
+	for _, e := range l {
+		m[e.key] = e.node
+	}
+
+	return m
+}
+
+func (r *Result) mergeNodes(path string, base, ours, theirs []parser.Node) []parser.Node {
+	bl, ol, tl := keyNodes(base), keyNodes(ours), keyNodes(theirs)
+	bm, om, tm := index(bl), index(ol), index(tl)
+
+	// nodes come out in the order ours has them, with anything that's only in
+	// theirs slotted in after whatever precedes it there.
+	var order []string
+	for _, e := range ol {
+		order = append(order, e.key)
+	}
+
+	anchor := -1
+	for _, e := range tl {
+		if i := indexOf(order, e.key); i != -1 {
+			anchor = i
+			continue
+		}
+
+		order = append(order[0:anchor+1], append([]string{e.key}, order[anchor+1:]...)...)
+		anchor++
+	}
+
+	var out []parser.Node
+	for _, key := range order {
+		if n := r.mergeNode(strings.TrimPrefix(path+" / "+key, " / "), bm[key], om[key], tm[key]); n != nil {
+			out = append(out, n)
+		}
+	}
+
+	return out
+}
+
+func indexOf(l []string, s string) int {
+	for i, e := range l {
+		if e == s {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (r *Result) mergeNode(path string, b, o, t parser.Node) parser.Node {
+	switch {
+	case same(o, t):
+		return o
+	case same(b, o):
+		return t
+	case same(b, t):
+		return o
+	}
+
+	switch o := o.(type) {
+	case parser.StateNode:
+		if b, ok := b.(parser.StateNode); ok {
+			if t, ok := t.(parser.StateNode); ok {
+				if n, ok := r.mergeStateNode(path, b, o, t); ok {
+					return n
+				}
+			}
+		}
+	case parser.SkinParamNode:
+		if b, ok := b.(parser.SkinParamNode); ok {
+			if t, ok := t.(parser.SkinParamNode); ok {
+				if n, ok := r.mergeSkinParamNode(path, b, o, t); ok {
+					return n
+				}
+			}
+		}
+	}
+
+	return r.conflict(path, b, o, t)
+}
+
+func mergeString(b, o, t string) (string, bool) {
+	switch {
+	case o == t, b == o:
+		return t, true
+	case b == t:
+		return o, true
+	default:
+		return "", false
+	}
+}
+
+func (r *Result) mergeStateNode(path string, b, o, t parser.StateNode) (parser.Node, bool) {
+	n := o
+
+	var ok [3]bool
+	n.Label, ok[0] = mergeString(b.Label, o.Label, t.Label)
+	n.Stereotype, ok[1] = mergeString(b.Stereotype, o.Stereotype, t.Stereotype)
+	n.Text, ok[2] = mergeString(b.Text, o.Text, t.Text)
+	if !ok[0] || !ok[1] || !ok[2] {
+		return nil, false
+	}
+
+	n.Children = r.mergeNodes(path, b.Children, o.Children, t.Children)
+
+	return n, true
+}
+
+func (r *Result) mergeSkinParamNode(path string, b, o, t parser.SkinParamNode) (parser.Node, bool) {
+	n := o
+
+	var ok bool
+	if n.Value, ok = mergeString(b.Value, o.Value, t.Value); !ok {
+		return nil, false
+	}
+
+	inSkinParam := r.inSkinParam
+	r.inSkinParam = true
+	n.Children = r.mergeNodes(path, b.Children, o.Children, t.Children)
+	r.inSkinParam = inSkinParam
+
+	return n, true
+}
+
+// conflict records a conflict and returns a node of the same type to hold its
+// place in the document.
+func (r *Result) conflict(path string, b, o, t parser.Node) parser.Node {
+	name := fmt.Sprintf("\x00conflict%d\x00", len(r.Conflicts))
+
+	r.placeholders[name] = len(r.Conflicts)
+	r.Conflicts = append(r.Conflicts, Conflict{Path: path, Base: b, Ours: o, Theirs: t, entry: r.inSkinParam})
+
+	n := o
+	if n == nil {
+		n = t
+	}
+
+	switch n.(type) {
+	case parser.EdgeNode:
+		return parser.EdgeNode{Left: name}
+	case parser.SkinParamNode:
+		return parser.SkinParamNode{Name: name}
+	default:
+		return parser.StateNode{Name: name, Label: name}
+	}
+}
+
+// formatSide writes one side of a conflict, the way it's written where the
+// conflict is.
+func (c Conflict) formatSide(n parser.Node) string {
+	if n, ok := n.(parser.SkinParamNode); ok && c.entry {
+		buf := bytes.NewBuffer(nil)
+		parser.FormatSkinParamEntry(n, buf)
+
+		return buf.String()
+	}
+
+	return format(n)
+}
+
+// Format writes the merged document in the same form as FormatDocument, with
+// a git style conflict section in place of each conflicting node. A conflict
+// over the kind of document has sections in place of the start and end tags.
+func (r Result) Format(wr io.Writer) error {
+	buf := bytes.NewBuffer(nil)
+	if err := parser.FormatDocument(r.Document, buf); err != nil {
+		return fmt.Errorf("Result.Format: %w", err)
+	}
+
+	var kind *Conflict
+	for i, c := range r.Conflicts {
+		if _, ok := c.Ours.(parser.DocumentNode); ok {
+			kind = &r.Conflicts[i]
+		}
+	}
+
+	s := bufio.NewScanner(buf)
+	for first := true; s.Scan(); first = false {
+		line := s.Text()
+
+		if i := strings.Index(line, "\x00"); i != -1 {
+			j := strings.Index(line[i+1:], "\x00")
+			c := r.Conflicts[r.placeholders[line[i:i+j+2]]]
+			indent := line[0 : len(line)-len(strings.TrimLeft(line, " "))]
+
+			line = "<<<<<<< ours\n" + indentLines(c.formatSide(c.Ours), indent) + "=======\n" + indentLines(c.formatSide(c.Theirs), indent) + ">>>>>>> theirs"
+		}
+
+		if kind != nil && (first || line == "@end"+r.Document.Kind.String()) {
+			tag := "@start"
+			if !first {
+				tag = "@end"
+			}
+
+			line = "<<<<<<< ours\n" + tag + kind.Ours.(parser.DocumentNode).Kind.String() + "\n=======\n" + tag + kind.Theirs.(parser.DocumentNode).Kind.String() + "\n>>>>>>> theirs"
+		}
+
+		if _, err := fmt.Fprintln(wr, line); err != nil {
+			return fmt.Errorf("Result.Format: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func indentLines(s, indent string) string {
+	var b strings.Builder
+	for _, l := range strings.SplitAfter(s, "\n") {
+		if l != "" {
+			b.WriteString(indent + l)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,294 @@
+package merge
+
+import (
+  "bytes"
+  "strings"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+
+  "fknsrs.biz/p/plantuml/parser"
+)
+
+func parse(t *testing.T, src string) parser.DocumentNode {
+  doc, err := parser.ParseDocument(src)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  return *doc
+}
+
+func formatResult(t *testing.T, r Result) string {
+  buf := bytes.NewBuffer(nil)
+  assert.NoError(t, r.Format(buf))
+  return buf.String()
+}
+
+const base = `@startuml
+skinparam ArrowColor gray
+skinparam state {
+  BackgroundColor red
+  BorderColor black
+}
+state Outer {
+  state A
+  state B : b
+}
+[*] --> Outer
+A --> B : go
+B --> C
+@enduml
+`
+
+func TestMerge(t *testing.T) {
+  a := assert.New(t)
+
+  r := Merge(parse(t, base), parse(t, `@startuml
+skinparam ArrowColor blue
+skinparam state {
+  BackgroundColor green
+  BorderColor black
+}
+state Outer {
+  state A : from ours
+  state B : b
+  state D
+}
+[*] --> Outer
+A --> B : go
+B --> C
+@enduml
+`), parse(t, `@startuml
+skinparam ArrowColor gray
+skinparam state {
+  BackgroundColor red
+  BorderColor white
+}
+state Outer {
+  state A
+  state B : b2
+}
+[*] --> Outer
+A --> B : go
+C --> [*]
+@enduml
+`))
+
+  a.Empty(r.Conflicts)
+  a.Equal(`@startuml
+
+skinparam ArrowColor blue
+skinparam state {
+  BackgroundColor green
+  BorderColor white
+}
+
+state Outer {
+  state A : from ours
+  state B : b2
+  state D
+}
+
+[*] --> Outer
+A --> B : go
+C --> [*]
+
+@enduml
+`, formatResult(t, r))
+}
+
+func TestMergeConflict(t *testing.T) {
+  a := assert.New(t)
+
+  r := Merge(parse(t, base), parse(t, `@startuml
+skinparam ArrowColor gray
+skinparam state {
+  BackgroundColor red
+  BorderColor black
+}
+state Outer {
+  state A
+  state B : ours
+}
+[*] --> Outer
+A --> B : go now
+B --> C
+@enduml
+`), parse(t, `@startuml
+skinparam ArrowColor gray
+skinparam state {
+  BackgroundColor red
+  BorderColor black
+}
+state Outer {
+  state A
+  state B : theirs
+}
+[*] --> Outer
+A --> B : go later
+@enduml
+`))
+
+  if a.Len(r.Conflicts, 2) {
+    a.Equal("state Outer / state B", r.Conflicts[0].Path)
+    a.Equal("edge A --> B", r.Conflicts[1].Path)
+    a.Equal("b", r.Conflicts[0].Base.(parser.StateNode).Text)
+  }
+
+  a.Equal(`@startuml
+
+skinparam ArrowColor gray
+skinparam state {
+  BackgroundColor red
+  BorderColor black
+}
+
+state Outer {
+  state A
+<<<<<<< ours
+  state B : ours
+=======
+  state B : theirs
+>>>>>>> theirs
+}
+
+[*] --> Outer
+<<<<<<< ours
+A --> B : go now
+=======
+A --> B : go later
+>>>>>>> theirs
+
+@enduml
+`, formatResult(t, r))
+}
+
+func TestMergeDeleteModified(t *testing.T) {
+  a := assert.New(t)
+
+  r := Merge(
+    parse(t, "@startuml\nstate A : a\nstate B\n@enduml\n"),
+    parse(t, "@startuml\nstate B\n@enduml\n"),
+    parse(t, "@startuml\nstate A : changed\nstate B\n@enduml\n"),
+  )
+
+  if a.Len(r.Conflicts, 1) {
+    a.Nil(r.Conflicts[0].Ours)
+    a.NotNil(r.Conflicts[0].Theirs)
+  }
+
+  a.Equal("@startuml\n\n<<<<<<< ours\n=======\nstate A : changed\n>>>>>>> theirs\nstate B\n\n@enduml\n", formatResult(t, r))
+}
+
+func TestMergeKind(t *testing.T) {
+  a := assert.New(t)
+
+  r := Merge(
+    parse(t, "@startmindmap\n* root\n** a\n@endmindmap\n"),
+    parse(t, "@startmindmap\n* root\n** a\n** b\n@endmindmap\n"),
+    parse(t, "@startmindmap\n* root\n** a\n@endmindmap\n"),
+  )
+
+  a.Empty(r.Conflicts)
+  a.Equal(parser.DocumentMindMap, r.Document.Kind)
+  a.Equal("@startmindmap\n\n* root\n** a\n** b\n\n@endmindmap\n", formatResult(t, r))
+
+  r = Merge(
+    parse(t, "@startuml\nstate A\n@enduml\n"),
+    parse(t, "@startuml\nstate A\n@enduml\n"),
+    parse(t, "@startchen\nentity A\n@endchen\n"),
+  )
+
+  a.Equal(parser.DocumentChen, r.Document.Kind)
+
+  r = Merge(
+    parse(t, "@startjson\n{}\n@endjson\n"),
+    parse(t, "@startyaml\na: 1\n@endyaml\n"),
+    parse(t, "@startuml\nstate A\n@enduml\n"),
+  )
+
+  if a.Len(r.Conflicts, 1) {
+    a.Equal("document", r.Conflicts[0].Path)
+    a.Equal(parser.DocumentYAML, r.Conflicts[0].Ours.(parser.DocumentNode).Kind)
+  }
+  a.Equal(parser.DocumentYAML, r.Document.Kind)
+}
+
+// resolve picks one side of every conflict section in merged output.
+func resolve(s string, ours bool) string {
+  var b strings.Builder
+
+  keep := true
+  for _, l := range strings.SplitAfter(s, "\n") {
+    switch strings.TrimSpace(l) {
+    case "<<<<<<< ours":
+      keep = ours
+    case "=======":
+      keep = !ours
+    case ">>>>>>> theirs":
+      keep = true
+    default:
+      if keep {
+        b.WriteString(l)
+      }
+    }
+  }
+
+  return b.String()
+}
+
+func TestMergeFormatParses(t *testing.T) {
+  a := assert.New(t)
+
+  r := Merge(
+    parse(t, "@startuml\nskinparam state {\n  BackgroundColor red\n  Arrow {\n    Color gray\n  }\n}\n@enduml\n"),
+    parse(t, "@startuml\nskinparam state {\n  BackgroundColor green\n  Arrow {\n    Color blue\n  }\n}\n@enduml\n"),
+    parse(t, "@startuml\nskinparam state {\n  BackgroundColor white\n  Arrow {\n    Color black\n  }\n}\n@enduml\n"),
+  )
+
+  a.Len(r.Conflicts, 2)
+
+  out := formatResult(t, r)
+  a.Equal(`@startuml
+
+skinparam state {
+<<<<<<< ours
+  BackgroundColor green
+=======
+  BackgroundColor white
+>>>>>>> theirs
+  Arrow {
+<<<<<<< ours
+    Color blue
+=======
+    Color black
+>>>>>>> theirs
+  }
+}
+
+@enduml
+`, out)
+
+  for ours, want := range map[bool]string{true: "green", false: "white"} {
+    doc, err := parser.ParseDocument(resolve(out, ours))
+    if a.NoError(err) {
+      a.Equal(want, doc.Nodes[0].(parser.SkinParamNode).Children[0].(parser.SkinParamNode).Value)
+    }
+  }
+
+  r = Merge(
+    parse(t, "@startjson\n{}\n@endjson\n"),
+    parse(t, "@startuml\nstate A\n@enduml\n"),
+    parse(t, "@startchen\nentity A\n@endchen\n"),
+  )
+
+  out = formatResult(t, r)
+  a.Contains(out, "<<<<<<< ours\n@startuml\n=======\n@startchen\n>>>>>>> theirs\n")
+  a.Contains(out, "<<<<<<< ours\n@enduml\n=======\n@endchen\n>>>>>>> theirs\n")
+
+  doc, err := parser.ParseDocument(resolve(out, false))
+  if a.NoError(err) {
+    a.Equal(parser.DocumentChen, doc.Kind)
+  }
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -84,8 +85,42 @@ type Node interface {
 	NodeName() string
 }
 
+// DocumentKind is the kind of diagram a document holds, which comes from the
+// tag it starts with, like `@startuml` or `@startgantt`.
+type DocumentKind int
+
+const (
+	DocumentUML DocumentKind = iota
+	DocumentGantt
+	DocumentMindMap
+	DocumentWBS
+	DocumentJSON
+	DocumentYAML
+	DocumentChen
+)
+
+var documentKindNames = []string{
+	DocumentUML:     "uml",
+	DocumentGantt:   "gantt",
+	DocumentMindMap: "mindmap",
+	DocumentWBS:     "wbs",
+	DocumentJSON:    "json",
+	DocumentYAML:    "yaml",
+	DocumentChen:    "chen",
+}
+
+// String is the name of the kind as it's written in its tags, like "uml".
+func (k DocumentKind) String() string {
+	if k < 0 || int(k) >= len(documentKindNames) {
+		return fmt.Sprintf("INVALID<%d>", int(k))
+	}
+
+	return documentKindNames[k]
+}
+
 type DocumentNode struct {
 	BaseNode
+	Kind  DocumentKind
 	Nodes []Node
 }
 
@@ -139,8 +174,8 @@ func (d DocumentNode) FindInitialState() *StateNode {
 	})
 }
 
-func (d DocumentNode) GetSkinParams(name string) []string {
-	var a []string
+func (d DocumentNode) GetSkinParamNodes() []SkinParamNode {
+	var a []SkinParamNode
 
 	for _, node := range d.Nodes {
 		skinParamNode, ok := node.(SkinParamNode)
@@ -148,7 +183,19 @@ func (d DocumentNode) GetSkinParams(name string) []string {
 			continue
 		}
 
-		if skinParamNode.Name == name {
+		a = append(a, skinParamNode.Flatten()...)
+	}
+
+	return a
+}
+
+func (d DocumentNode) GetSkinParams(name string) []string {
+	name, stereotype := SplitStereotype(name)
+
+	var a []string
+
+	for _, skinParamNode := range d.GetSkinParamNodes() {
+		if strings.EqualFold(skinParamNode.Name, name) && skinParamNode.Stereotype == stereotype {
 			a = append(a, skinParamNode.Value)
 		}
 	}
@@ -164,6 +211,50 @@ func (d DocumentNode) GetSkinParam(name string) string {
 	return ""
 }
 
+// ResolvedHighlight is a highlight in a JSON or YAML document, along with the
+// value it points at.
+type ResolvedHighlight struct {
+	Highlight DataHighlightNode
+	Value     interface{}
+}
+
+// ResolveHighlights looks up the path of every highlight in the document's
+// data. It returns an error for the first one that doesn't point at
+// anything.
+func (d DocumentNode) ResolveHighlights() ([]ResolvedHighlight, error) {
+	var data DataNode
+	for _, n := range d.Nodes {
+		if n, ok := n.(DataNode); ok {
+			data = n
+		}
+	}
+
+	var a []ResolvedHighlight
+	for _, n := range d.Nodes {
+		h, ok := n.(DataHighlightNode)
+		if !ok {
+			continue
+		}
+
+		v, ok := data.Lookup(h.Path)
+		if !ok {
+			return nil, fmt.Errorf("DocumentNode.ResolveHighlights: %s: %s doesn't match anything", h.SourceRange, formatDataPath(h.Path))
+		}
+
+		a = append(a, ResolvedHighlight{Highlight: h, Value: v})
+	}
+
+	return a, nil
+}
+
+type ThemeNode struct {
+	BaseNode
+	Name string
+	From string
+}
+
+func (ThemeNode) NodeName() string { return "ThemeNode" }
+
 type CommentNode struct {
 	BaseNode
 	Content string
@@ -177,6 +268,7 @@ type StateNode struct {
 	Label      string
 	Stereotype string
 	Text       string
+	Links      []Link
 	Children   []Node
 }
 
@@ -225,24 +317,786 @@ func (n StateNode) getChildrenWithPrefix(prefix string) []StateNode {
 	return a
 }
 
+// EndpointKind is the way one end of an edge was written. In use case
+// diagrams, actors and use cases can be declared just by using them.
+type EndpointKind int
+
+const (
+	EndpointName EndpointKind = iota
+	// EndpointActor is written `:Name:`.
+	EndpointActor
+	// EndpointUseCase is written `(Name)`.
+	EndpointUseCase
+	// EndpointComponent is written `[Name]`.
+	EndpointComponent
+	// EndpointInterface is written `() Name`.
+	EndpointInterface
+)
+
 type EdgeNode struct {
 	BaseNode
 	Left      string
 	Right     string
+	LeftKind  EndpointKind
+	RightKind EndpointKind
 	Direction string
 	Text      string
+	Links     []Link
 }
 
 func (EdgeNode) NodeName() string { return "EdgeNode" }
 
-type SkinParamNode struct {
+type Relationship string
+
+const (
+	Association    Relationship = "association"
+	Dependency     Relationship = "dependency"
+	Generalisation Relationship = "generalisation"
+	Include        Relationship = "include"
+	Extend         Relationship = "extend"
+	// Provides is a lollipop, `-()`, with the interface on the right.
+	Provides Relationship = "provides"
+	// Requires is a socket, `)-`, with the interface on the left.
+	Requires Relationship = "requires"
+)
+
+// Relationship works out what an edge means from its arrow and label. Edges
+// labelled `include` or `extend`, with or without the `<<>>`, are includes
+// and extends; arrows with a `|>` or `<|` head are generalisations, pointing
+// at the more general side; other dotted arrows are dependencies; and
+// everything else is an association. Lollipop and socket connectors are
+// provides and requires.
+func (n EdgeNode) Relationship() Relationship {
+	switch label := strings.ToLower(strings.Trim(strings.TrimSpace(n.Text), "<>")); {
+	case label == "include":
+		return Include
+	case label == "extend":
+		return Extend
+	case strings.HasSuffix(n.Direction, "()") || strings.HasSuffix(n.Direction, "("):
+		return Provides
+	case strings.HasPrefix(n.Direction, ")"):
+		return Requires
+	case strings.Contains(n.Direction, "|>") || strings.Contains(n.Direction, "<|"):
+		return Generalisation
+	case strings.Contains(n.Direction, "."):
+		return Dependency
+	default:
+		return Association
+	}
+}
+
+// Cardinality is how many rows can be at one end of a relationship in an
+// entity relationship diagram.
+type Cardinality string
+
+const (
+	ZeroOrOne  Cardinality = "zero-or-one"
+	ExactlyOne Cardinality = "exactly-one"
+	ZeroOrMore Cardinality = "zero-or-more"
+	OneOrMore  Cardinality = "one-or-more"
+)
+
+var (
+	leftCardinalities = map[string]Cardinality{
+		"|o": ZeroOrOne,
+		"||": ExactlyOne,
+		"}o": ZeroOrMore,
+		"}|": OneOrMore,
+	}
+	rightCardinalities = map[string]Cardinality{
+		"o|": ZeroOrOne,
+		"||": ExactlyOne,
+		"o{": ZeroOrMore,
+		"|{": OneOrMore,
+	}
+)
+
+// Cardinalities reads the crow's feet at each end of an edge's arrow, like
+// `|o--o{`. An end without one, or an edge that isn't from an entity
+// relationship diagram, gives an empty cardinality.
+func (n EdgeNode) Cardinalities() (left, right Cardinality) {
+	if len(n.Direction) >= 2 {
+		left = leftCardinalities[n.Direction[:2]]
+		right = rightCardinalities[n.Direction[len(n.Direction)-2:]]
+	}
+
+	return left, right
+}
+
+// ActorNode is an actor in a use case diagram, declared with `actor Name`,
+// `actor "Label" as Name` or `:Label: as Name`.
+type ActorNode struct {
+	BaseNode
+	Name       string
+	Label      string
+	Stereotype string
+}
+
+func (ActorNode) NodeName() string { return "ActorNode" }
+
+// UseCaseNode is a use case, declared with `usecase Name`,
+// `usecase (Label) as Name` or `(Label) as Name`.
+type UseCaseNode struct {
+	BaseNode
+	Name       string
+	Label      string
+	Stereotype string
+}
+
+func (UseCaseNode) NodeName() string { return "UseCaseNode" }
+
+// RectangleNode is a box around part of a diagram, usually the boundary of a
+// system in a use case diagram.
+type RectangleNode struct {
+	BaseNode
+	Name       string
+	Label      string
+	Stereotype string
+	Children   []Node
+}
+
+func (RectangleNode) NodeName() string { return "RectangleNode" }
+
+func (n RectangleNode) Walk(fn func(n Node) error) error {
+	for i := range n.Children {
+		if err := fn(n.Children[i]); err != nil {
+			return fmt.Errorf("RectangleNode.Walk: could not walk Children[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// ComponentNode is a component, declared with `component Name` or
+// `[Label] as Name`. Components can contain ports and other elements.
+type ComponentNode struct {
+	BaseNode
+	Name       string
+	Label      string
+	Stereotype string
+	Children   []Node
+}
+
+func (ComponentNode) NodeName() string { return "ComponentNode" }
+
+func (n ComponentNode) Walk(fn func(n Node) error) error {
+	for i := range n.Children {
+		if err := fn(n.Children[i]); err != nil {
+			return fmt.Errorf("ComponentNode.Walk: could not walk Children[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// InterfaceNode is an interface, declared with `interface Name` or
+// `() Name`.
+type InterfaceNode struct {
+	BaseNode
+	Name       string
+	Label      string
+	Stereotype string
+}
+
+func (InterfaceNode) NodeName() string { return "InterfaceNode" }
+
+// PortNode is a port on the edge of a component, declared with `port`,
+// `portin` or `portout`. Direction is "in", "out" or empty.
+type PortNode struct {
+	BaseNode
+	Direction  string
+	Name       string
+	Label      string
+	Stereotype string
+}
+
+func (PortNode) NodeName() string { return "PortNode" }
+
+// ContainerKinds are the keywords that declare a ContainerNode.
+var ContainerKinds = []string{"node", "cloud", "database", "artifact", "frame", "folder", "package"}
+
+// ContainerNode is one of the elements of a deployment diagram that can hold
+// other elements, like `node`, `cloud` or `package`. Kind is the keyword it
+// was declared with, in lower case.
+type ContainerNode struct {
+	BaseNode
+	Kind       string
+	Name       string
+	Label      string
+	Stereotype string
+	Children   []Node
+}
+
+func (ContainerNode) NodeName() string { return "ContainerNode" }
+
+func (n ContainerNode) Walk(fn func(n Node) error) error {
+	for i := range n.Children {
+		if err := fn(n.Children[i]); err != nil {
+			return fmt.Errorf("ContainerNode.Walk: could not walk Children[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// ObjectNode is an object, declared with `object Name` and optionally a
+// body of fields like `name = value`.
+type ObjectNode struct {
+	BaseNode
+	Name       string
+	Label      string
+	Stereotype string
+	Fields     []FieldNode
+}
+
+func (ObjectNode) NodeName() string { return "ObjectNode" }
+
+func (n ObjectNode) Walk(fn func(n Node) error) error {
+	for i := range n.Fields {
+		if err := fn(n.Fields[i]); err != nil {
+			return fmt.Errorf("ObjectNode.Walk: could not walk Fields[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// FieldNode is one line of an object's body. Value is left as it's written,
+// including any quotes, and is empty if the field doesn't have one.
+type FieldNode struct {
 	BaseNode
 	Name  string
 	Value string
 }
 
+func (FieldNode) NodeName() string { return "FieldNode" }
+
+// EntityNode is an entity in an entity relationship diagram, declared with
+// `entity Name` and optionally a body of columns, or a relationship in a Chen
+// diagram, which is declared the same way with `relationship`. Children holds
+// ColumnNodes and EntitySeparatorNodes.
+type EntityNode struct {
+	BaseNode
+	Kind       string
+	Name       string
+	Label      string
+	Stereotype string
+	Children   []Node
+}
+
+func (EntityNode) NodeName() string { return "EntityNode" }
+
+func (n EntityNode) Walk(fn func(n Node) error) error {
+	for i := range n.Children {
+		if err := fn(n.Children[i]); err != nil {
+			return fmt.Errorf("EntityNode.Walk: could not walk Children[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// Columns is the entity's columns, without the separators between them.
+func (n EntityNode) Columns() []ColumnNode {
+	var a []ColumnNode
+	for _, c := range n.Children {
+		if c, ok := c.(ColumnNode); ok {
+			a = append(a, c)
+		}
+	}
+
+	return a
+}
+
+// ColumnNode is a line of an entity's body, like `*user_id : number <<FK>>`.
+// Mandatory is set by the `*`, and Key is set for the columns before the
+// first separator, which make up the entity's key. In a Chen diagram,
+// composite attributes like `Name { First Last }` have Children.
+type ColumnNode struct {
+	BaseNode
+	Name       string
+	Type       string
+	Stereotype string
+	Mandatory  bool
+	Key        bool
+	Children   []ColumnNode
+}
+
+func (ColumnNode) NodeName() string { return "ColumnNode" }
+
+func (n ColumnNode) Walk(fn func(n Node) error) error {
+	for i := range n.Children {
+		if err := fn(n.Children[i]); err != nil {
+			return fmt.Errorf("ColumnNode.Walk: could not walk Children[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// EntitySeparatorNode is a line like `--`, `..`, `==` or `__` between the
+// columns of an entity. Line is the whole line, since it can have a title in
+// it, like `-- audit --`.
+type EntitySeparatorNode struct {
+	BaseNode
+	Line string
+}
+
+func (EntitySeparatorNode) NodeName() string { return "EntitySeparatorNode" }
+
+// MapNode is a map, declared with `map Name { key => value }`.
+type MapNode struct {
+	BaseNode
+	Name       string
+	Label      string
+	Stereotype string
+	Entries    []MapEntryNode
+}
+
+func (MapNode) NodeName() string { return "MapNode" }
+
+func (n MapNode) Walk(fn func(n Node) error) error {
+	for i := range n.Entries {
+		if err := fn(n.Entries[i]); err != nil {
+			return fmt.Errorf("MapNode.Walk: could not walk Entries[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// MapEntryNode is one entry in a map. Entries are either `key => value`, or
+// `key *-> Other`, which links the entry to another object or map; Link is
+// the name of that instead of there being a Value.
+type MapEntryNode struct {
+	BaseNode
+	Key   string
+	Value string
+	Link  string
+}
+
+func (MapEntryNode) NodeName() string { return "MapEntryNode" }
+
+// SplitMember splits the end of an edge that points at a field or map
+// entry, like `Map::Key`, into the name of the object or map and the name
+// of the member. member is empty if the edge points at the whole thing.
+func SplitMember(endpoint string) (name, member string) {
+	if i := strings.Index(endpoint, "::"); i != -1 {
+		return endpoint[:i], endpoint[i+2:]
+	}
+
+	return endpoint, ""
+}
+
+// TimingKinds are the keywords that declare a TimingParticipantNode.
+var TimingKinds = []string{"robust", "concise", "clock", "binary"}
+
+// TimingParticipantNode is a participant in a timing diagram, like
+// `robust "Web Browser" as WB`. Clocks can also have
+// `with period 50 pulse 15 offset 10`, which sets the numbers that go with
+// them.
+type TimingParticipantNode struct {
+	BaseNode
+	Kind       string
+	Name       string
+	Label      string
+	Stereotype string
+	Period     int
+	Pulse      int
+	Offset     int
+}
+
+func (TimingParticipantNode) NodeName() string { return "TimingParticipantNode" }
+
+// TickNode is a time tick, like `@100` or `@+50`, and the lines that follow
+// it up to the next one. A tick can also be written with the name of a
+// participant, as in `@WB`, in which case Participant is set instead of Time
+// and the state changes in it start with their time, like `+50 is Busy`.
+type TickNode struct {
+	BaseNode
+	Time        string
+	Participant string
+	Children    []Node
+}
+
+func (TickNode) NodeName() string { return "TickNode" }
+
+func (n TickNode) Walk(fn func(n Node) error) error {
+	for i := range n.Children {
+		if err := fn(n.Children[i]); err != nil {
+			return fmt.Errorf("TickNode.Walk: could not walk Children[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// StateChangeNode is `Participant is State`, or `Time is State` inside a
+// participant's tick, where Time is set as well.
+type StateChangeNode struct {
+	BaseNode
+	Participant string
+	Time        string
+	State       string
+}
+
+func (StateChangeNode) NodeName() string { return "StateChangeNode" }
+
+// HighlightNode is `highlight 200 to 450 #Gold : Caption`.
+type HighlightNode struct {
+	BaseNode
+	From   string
+	To     string
+	Colour string
+	Text   string
+}
+
+func (HighlightNode) NodeName() string { return "HighlightNode" }
+
+// ConstraintNode is a time constraint, like `WB@0 <-> @50 : {50 ms lag}`.
+// Participant is empty if the constraint is drawn on the time axis, and Text
+// doesn't include the braces.
+type ConstraintNode struct {
+	BaseNode
+	Participant string
+	From        string
+	To          string
+	Text        string
+}
+
+func (ConstraintNode) NodeName() string { return "ConstraintNode" }
+
+// GanttTaskNode is a line about a task in a Gantt chart, like
+// `[Build] on {Alice:50%} lasts 5 days and starts at [Design]'s end`. A task
+// can be talked about over any number of lines, and the ones with a
+// `happens` clause are milestones. Then is set if the line starts with
+// `then`, which makes the task start when the one on the line before ends.
+type GanttTaskNode struct {
+	BaseNode
+	Name      string
+	Alias     string
+	Then      bool
+	Resources []GanttResource
+	Clauses   []GanttClause
+}
+
+func (GanttTaskNode) NodeName() string { return "GanttTaskNode" }
+
+// GanttResource is someone working on a task, written `{Alice}` or
+// `{Alice:50%}`. Percent is zero if it isn't given.
+type GanttResource struct {
+	Name    string
+	Percent int
+}
+
+type GanttClauseKind string
+
+const (
+	// GanttLasts is `lasts 5 days` or `requires 2 weeks`, which sets Amount
+	// and Unit.
+	GanttLasts GanttClauseKind = "lasts"
+	// GanttStarts, GanttEnds and GanttHappens are `starts 2020-07-01`,
+	// `starts at [Other]'s end` or `starts 2 days after [Other]'s end`,
+	// which set Date, or Task, Anchor and Offset.
+	GanttStarts  GanttClauseKind = "starts"
+	GanttEnds    GanttClauseKind = "ends"
+	GanttHappens GanttClauseKind = "happens"
+	// GanttCompleted is `is 40% completed`, which sets Percent.
+	GanttCompleted GanttClauseKind = "completed"
+	// GanttColoured is `is coloured in Lavender/LightBlue`, which sets
+	// Colour.
+	GanttColoured GanttClauseKind = "coloured"
+)
+
+// GanttClause is one thing said about a task. Which fields are set depends
+// on the kind. Anchor is "start" or "end", and Offset is the number of days
+// after the anchor, or before it if it's negative.
+type GanttClause struct {
+	Kind    GanttClauseKind
+	Amount  int
+	Unit    string
+	Date    string
+	Task    string
+	Anchor  string
+	Offset  int
+	Percent int
+	Colour  string
+}
+
+// GanttProjectNode is `Project starts 2020-07-01`.
+type GanttProjectNode struct {
+	BaseNode
+	Start string
+}
+
+func (GanttProjectNode) NodeName() string { return "GanttProjectNode" }
+
+// GanttCalendarNode opens or closes days, like `saturday are closed`,
+// `2020-07-14 is closed` or `2020-07-14 to 2020-07-16 are open`. Either Day
+// is set to a day of the week, in lower case, or From and To are dates, which
+// are the same for a single day.
+type GanttCalendarNode struct {
+	BaseNode
+	Day    string
+	From   string
+	To     string
+	Closed bool
+}
+
+func (GanttCalendarNode) NodeName() string { return "GanttCalendarNode" }
+
+// BranchNode is a line of a mind map or work breakdown structure, like
+// `**[#red]_ Text`, along with the lines under it. Depth is the number of
+// times Marker is repeated, and Children holds the lines after it that are
+// deeper, up to the next one that isn't.
+//
+// Side is where the branch is drawn, which is "left" or "right" if it's
+// written with `-` or `+`, or with `<` or `>` (which Direction holds), or
+// comes after `left side`. Otherwise it's the same as its parent, or empty
+// for the root. Multiline is set if the text is written as a box, like
+// `:Text;`, which it has to be if the text goes over more than one line.
+type BranchNode struct {
+	BaseNode
+	Depth     int
+	Marker    string
+	Direction string
+	Side      string
+	Colour    string
+	Boxless   bool
+	Multiline bool
+	Text      string
+	Children  []Node
+}
+
+func (BranchNode) NodeName() string { return "BranchNode" }
+
+func (n BranchNode) Walk(fn func(n Node) error) error {
+	for i := range n.Children {
+		if err := fn(n.Children[i]); err != nil {
+			return fmt.Errorf("BranchNode.Walk: could not walk Children[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// SideNode is `left side` or `right side`, which puts the branches after it
+// on that side of the root.
+type SideNode struct {
+	BaseNode
+	Side string
+}
+
+func (SideNode) NodeName() string { return "SideNode" }
+
+// DataNode is the data in a JSON or YAML document. Raw is the text as it was
+// written, and Value is what it decodes to: maps with string keys, slices,
+// strings, numbers, booleans and nil. JSON numbers are float64s, like with
+// encoding/json, and YAML ones are ints or float64s.
+type DataNode struct {
+	BaseNode
+	Raw   string
+	Value interface{}
+}
+
+func (DataNode) NodeName() string { return "DataNode" }
+
+// Lookup finds the value at the end of a path through the data, where each
+// element is a key of a map or the index of an element of a list.
+func (n DataNode) Lookup(path []string) (interface{}, bool) {
+	v := n.Value
+
+	for _, k := range path {
+		switch c := v.(type) {
+		case map[string]interface{}:
+			e, ok := c[k]
+			if !ok {
+				return nil, false
+			}
+			v = e
+		case []interface{}:
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, false
+			}
+			v = c[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+// DataHighlightNode is a `#highlight "address" / "city"` line in a JSON or
+// YAML document, with an optional stereotype naming the style to use.
+type DataHighlightNode struct {
+	BaseNode
+	Path       []string
+	Stereotype string
+}
+
+func (DataHighlightNode) NodeName() string { return "DataHighlightNode" }
+
+// DirectionNode is `left to right direction` or `top to bottom direction`.
+type DirectionNode struct {
+	BaseNode
+	Direction string
+}
+
+func (DirectionNode) NodeName() string { return "DirectionNode" }
+
+// Link is a `[[url]]`, `[[url label]]` or `[[url{tooltip} label]]` link in
+// the text of a node.
+type Link struct {
+	SourceRange SourceRange
+	URL         string
+	Tooltip     string
+	Label       string
+}
+
+// FindLinks collects the links from a node and everything inside it.
+func FindLinks(n Node) []Link {
+	var a []Link
+
+	Walk(n, func(n Node) error {
+		switch n := n.(type) {
+		case StateNode:
+			a = append(a, n.Links...)
+		case EdgeNode:
+			a = append(a, n.Links...)
+		case NoteNode:
+			a = append(a, n.Links...)
+		case ActionNode:
+			a = append(a, n.Links...)
+		}
+
+		return nil
+	})
+
+	return a
+}
+
+// FindEdges finds every edge in a tree, including ones nested inside
+// containers, in the order they appear.
+func FindEdges(n Node) []EdgeNode {
+	var a []EdgeNode
+
+	Walk(n, func(n Node) error {
+		if e, ok := n.(EdgeNode); ok {
+			a = append(a, e)
+		}
+
+		return nil
+	})
+
+	return a
+}
+
+type SkinParamNode struct {
+	BaseNode
+	Name       string
+	Stereotype string
+	Value      string
+	Children   []Node
+}
+
 func (SkinParamNode) NodeName() string { return "SkinParamNode" }
 
+func (n SkinParamNode) Walk(fn func(n Node) error) error {
+	for i := range n.Children {
+		if err := fn(n.Children[i]); err != nil {
+			return fmt.Errorf("SkinParamNode.Walk: could not walk Children[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// Flatten resolves a skinparam block into the equivalent list of single-line
+// skinparams, so `skinparam state { BackgroundColor red }` becomes
+// `skinparam stateBackgroundColor red`.
+func (n SkinParamNode) Flatten() []SkinParamNode {
+	if len(n.Children) == 0 {
+		return []SkinParamNode{n}
+	}
+
+	var a []SkinParamNode
+
+	for _, c := range n.Children {
+		childNode, ok := c.(SkinParamNode)
+		if !ok {
+			continue
+		}
+
+		for _, e := range childNode.Flatten() {
+			e.Name = n.Name + e.Name
+			if e.Stereotype == "" {
+				e.Stereotype = n.Stereotype
+			}
+
+			a = append(a, e)
+		}
+	}
+
+	return a
+}
+
+// SplitStereotype separates a trailing stereotype from a name, turning
+// `stateBackgroundColor<<Warning>>` into `stateBackgroundColor` and
+// `<<Warning>>`.
+func SplitStereotype(s string) (string, string) {
+	i := strings.Index(s, "<<")
+	if i == -1 || !strings.HasSuffix(s, ">>") {
+		return s, ""
+	}
+
+	return s[0:i], s[i:]
+}
+
+type StyleNode struct {
+	BaseNode
+	Children []Node
+}
+
+func (StyleNode) NodeName() string { return "StyleNode" }
+
+func (n StyleNode) Walk(fn func(n Node) error) error {
+	for i := range n.Children {
+		if err := fn(n.Children[i]); err != nil {
+			return fmt.Errorf("StyleNode.Walk: could not walk Children[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+type StyleRuleNode struct {
+	BaseNode
+	Selector string
+	Children []Node
+}
+
+func (StyleRuleNode) NodeName() string { return "StyleRuleNode" }
+
+func (n StyleRuleNode) Walk(fn func(n Node) error) error {
+	for i := range n.Children {
+		if err := fn(n.Children[i]); err != nil {
+			return fmt.Errorf("StyleRuleNode.Walk: could not walk Children[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+type StylePropertyNode struct {
+	BaseNode
+	Name  string
+	Value string
+}
+
+func (StylePropertyNode) NodeName() string { return "StylePropertyNode" }
+
 type SeparatorNode struct {
 	BaseNode
 }
@@ -254,6 +1108,7 @@ type NoteNode struct {
 	Floating bool
 	Position string
 	Content  string
+	Links    []Link
 }
 
 func (NoteNode) NodeName() string { return "NoteNode" }
@@ -388,6 +1243,7 @@ type ActionNode struct {
 	BaseNode
 	Colour  string
 	Content string
+	Links   []Link
 }
 
 func (ActionNode) NodeName() string { return "ActionNode" }
@@ -0,0 +1,199 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// highlightWordPattern splits up the rest of a `#highlight` line into quoted
+// keys, slashes, stereotypes and bare keys.
+var highlightWordPattern = regexp.MustCompile(`"[^"]*"|<<[^>]*>>|/|[^\s/"]+`)
+
+// formatDataPath writes a path the way it's written after `#highlight`.
+func formatDataPath(path []string) string {
+	a := make([]string, len(path))
+	for i, k := range path {
+		a[i] = quoted(k)
+	}
+
+	return strings.Join(a, " / ")
+}
+
+// isHighlight reports whether tk starts a `#highlight` line.
+func isHighlight(s *scanner, tk *token) bool {
+	return tk.typ == tokenTypeHash && len(s.d)-tk.pos[0] >= len("#highlight") && strings.EqualFold(string(s.d[tk.pos[0]:tk.pos[0]+len("#highlight")]), "#highlight")
+}
+
+// getNodeToken gets the token that starts the next top level node. In a YAML
+// document, a line that starts with `'` is data, like `'quoted key': 1`,
+// rather than a comment, so it's returned as a token instead of being
+// skipped. JSON can't start with `'`, so it's still a comment there.
+func getNodeToken(s *scanner) *token {
+	if s.k == DocumentYAML && !s.eof() && s.peek() == '\'' {
+		p := s.pos()
+		return &token{pos: [2]int{p, p}, typ: tokenTypeTerm, str: "'"}
+	}
+
+	return getToken(s, nil)
+}
+
+// parseDataDocumentNode parses a top level node of a JSON or YAML document.
+// Highlights come first, then the data, which runs up to the end tag. Styles
+// are parsed like they are anywhere else.
+func parseDataDocumentNode(s *scanner, tk *token) (Node, bool, error) {
+	if isKeyword(tk, "<style>") {
+		return nil, false, nil
+	}
+
+	s.moveTo(tk)
+
+	if isHighlight(s, tk) {
+		node, err := parseDataHighlightNode(s)
+		if err != nil {
+			return nil, true, err
+		}
+
+		return *node, true, nil
+	}
+
+	node, err := parseDataNode(s)
+	if err != nil {
+		return nil, true, err
+	}
+
+	return *node, true, nil
+}
+
+func parseDataHighlightNode(s *scanner) (*DataHighlightNode, error) {
+	s.savePos()
+
+	var node DataHighlightNode
+
+	p := s.pos()
+	line, _ := readToTerminator(s, '\n', false)
+	line = strings.TrimRight(line, " \t\r")
+
+	node.SetSourceRange(s.sr([2]int{p, p + len(line) - 1}))
+	s.trackRange(node.SourceRange)
+
+	words := highlightWordPattern.FindAllString(line[len("#highlight"):], -1)
+
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+
+		switch {
+		case strings.HasPrefix(w, "<<"):
+			if i != len(words)-1 {
+				return nil, s.rerr(fmt.Errorf("parseDataHighlightNode: expected stereotype to be at the end of the line"))
+			}
+			node.Stereotype = w[2 : len(w)-2]
+		case w == "/":
+			return nil, s.rerr(fmt.Errorf("parseDataHighlightNode: expected key before `/'"))
+		default:
+			node.Path = append(node.Path, strings.Trim(w, `"`))
+
+			if i+1 < len(words) && words[i+1] == "/" {
+				if i += 1; i == len(words)-1 {
+					return nil, s.rerr(fmt.Errorf("parseDataHighlightNode: expected key after `/'"))
+				}
+			} else if i+1 < len(words) && !strings.HasPrefix(words[i+1], "<<") {
+				return nil, s.rerr(fmt.Errorf("parseDataHighlightNode: expected `/' between keys"))
+			}
+		}
+	}
+
+	if len(node.Path) == 0 {
+		return nil, s.rerr(fmt.Errorf("parseDataHighlightNode: expected a path like \"key\" / \"subkey\""))
+	}
+
+	s.discardPos()
+
+	return &node, nil
+}
+
+// parseDataNode reads everything up to the end tag and decodes it as JSON or
+// YAML, depending on the kind of document.
+func parseDataNode(s *scanner) (*DataNode, error) {
+	s.savePos()
+
+	var node DataNode
+
+	// YAML cares about indentation, so the data starts at the start of the
+	// line rather than at its first token.
+	first := s.pos()
+	start := bytes.LastIndexByte(s.d[:first], '\n') + 1
+	end := start
+
+	for {
+		q := s.pos()
+
+		line, ok := readToTerminator(s, '\n', true)
+		if !ok {
+			return nil, s.rerr(fmt.Errorf("parseDataNode: unexpected eof; expected @end%s", s.k))
+		}
+
+		if strings.EqualFold(strings.TrimSpace(line), "@end"+s.k.String()) {
+			s.p = q
+			break
+		}
+
+		end = s.pos()
+	}
+
+	node.Raw = strings.TrimRight(string(s.d[start:end]), " \t\r\n")
+
+	node.SetSourceRange(s.sr([2]int{first, start + len(node.Raw) - 1}))
+	s.trackRange(node.SourceRange)
+
+	switch s.k {
+	case DocumentJSON:
+		if err := json.Unmarshal([]byte(node.Raw), &node.Value); err != nil {
+			var syntaxError *json.SyntaxError
+			if errors.As(err, &syntaxError) && syntaxError.Offset > 0 {
+				s.p = start + int(syntaxError.Offset) - 1
+			}
+
+			return nil, s.rerr(fmt.Errorf("parseDataNode: %w", err))
+		}
+	case DocumentYAML:
+		if err := yaml.Unmarshal([]byte(node.Raw), &node.Value); err != nil {
+			return nil, s.rerr(fmt.Errorf("parseDataNode: %w", err))
+		}
+
+		node.Value = stringKeys(node.Value)
+	}
+
+	s.discardPos()
+
+	return &node, nil
+}
+
+// stringKeys turns any maps in YAML data with keys that aren't strings, like
+// `1: one`, into maps with string keys, so that all data looks the same.
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = stringKeys(e)
+		}
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = stringKeys(e)
+		}
+
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = stringKeys(e)
+		}
+	}
+
+	return v
+}
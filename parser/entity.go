@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// chenArrowPattern matches the edges of Chen diagrams, which have the
+	// cardinality in the middle, like `-N-`, `=1=` or `-(0,N)-`.
+	chenArrowPattern = regexp.MustCompile(`^(-+|=+)([1NM]|\(\d+,[\dNM]+\))(-+|=+)$`)
+	columnPattern    = regexp.MustCompile(`^(\*)?\s*(.*?)\s*(?::\s*(.*?))?\s*(<<.*>>)?$`)
+)
+
+func isEntitySeparator(line string) bool {
+	return len(line) >= 2 && strings.ContainsRune("-.=_", rune(line[0])) && line[1] == line[0]
+}
+
+func parseEntityNode(s *scanner, keyword string) (*EntityNode, error) {
+	s.savePos()
+
+	var node EntityNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	d, err := parseDeclaration(s, keyword, EndpointName)
+	if err != nil {
+		return nil, s.rerr(fmt.Errorf("parseEntityNode: %w", err))
+	}
+
+	node.Kind = strings.ToLower(keyword)
+	node.Name, node.Label, node.Stereotype = d.name, d.label, d.stereotype
+
+	if !d.block {
+		return &node, nil
+	}
+
+	children, err := parseColumns(s)
+	if err != nil {
+		return nil, s.rerr(fmt.Errorf("parseEntityNode: %w", err))
+	}
+	node.Children = children
+
+	// the columns before the first separator are the key.
+	for i, c := range node.Children {
+		if _, ok := c.(EntitySeparatorNode); ok {
+			for j := 0; j < i; j++ {
+				if c, ok := node.Children[j].(ColumnNode); ok {
+					c.Key = true
+					node.Children[j] = c
+				}
+			}
+
+			break
+		}
+	}
+
+	return &node, nil
+}
+
+// parseColumns parses the lines of an entity's body up to its closing brace.
+func parseColumns(s *scanner) ([]Node, error) {
+	var children []Node
+
+	err := parseLines(s, func(line string, r SourceRange) error {
+		if isEntitySeparator(line) {
+			children = append(children, EntitySeparatorNode{BaseNode: BaseNode{SourceRange: r}, Line: line})
+			return nil
+		}
+
+		if strings.HasSuffix(line, "{") {
+			column := ColumnNode{Name: strings.TrimSpace(strings.TrimSuffix(line, "{"))}
+			if strings.HasPrefix(column.Name, "*") {
+				column.Mandatory = true
+				column.Name = strings.TrimSpace(column.Name[1:])
+			}
+
+			s.pushTrackedRange()
+			s.trackRange(r)
+			nested, err := parseColumns(s)
+			column.SetSourceRange(s.popTrackedRange())
+			if err != nil {
+				return err
+			}
+
+			for _, c := range nested {
+				c, ok := c.(ColumnNode)
+				if !ok {
+					return fmt.Errorf("composite attribute %q can't have separators", column.Name)
+				}
+
+				column.Children = append(column.Children, c)
+			}
+
+			children = append(children, column)
+
+			return nil
+		}
+
+		m := columnPattern.FindStringSubmatch(line)
+		if m == nil || m[2] == "" {
+			return fmt.Errorf("expected column like `*name : type' but got %q", line)
+		}
+
+		children = append(children, ColumnNode{
+			BaseNode:   BaseNode{SourceRange: r},
+			Name:       m[2],
+			Type:       m[3],
+			Stereotype: m[4],
+			Mandatory:  m[1] != "",
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return children, nil
+}
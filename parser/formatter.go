@@ -4,187 +4,795 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"unicode"
 )
 
+// BlankLines decides where the formatter puts blank lines between nodes.
+type BlankLines string
+
+const (
+	// BlankLinesByType puts a blank line wherever the type of node changes.
+	BlankLinesByType BlankLines = "type"
+	BlankLinesAlways BlankLines = "always"
+	BlankLinesNone   BlankLines = "none"
+)
+
+// Quotes decides which labels the formatter puts quotes around.
+type Quotes string
+
+const (
+	QuotesAlways Quotes = "always"
+	// QuotesNeeded leaves out the quotes for labels that are a single word.
+	QuotesNeeded Quotes = "needed"
+)
+
+type KeywordCase string
+
+const (
+	KeywordsLower KeywordCase = "lower"
+	KeywordsUpper KeywordCase = "upper"
+)
+
+// StateLabels decides which way around states, actors, use cases and
+// rectangles with labels are written.
+type StateLabels string
+
+const (
+	// StateLabelsFirst writes `state "Label" as Name`.
+	StateLabelsFirst StateLabels = "label-first"
+	// StateNamesFirst writes `state Name as "Label"`. The label is always
+	// quoted, since that's how it's told apart from the name.
+	StateNamesFirst StateLabels = "name-first"
+)
+
+// FormatOptions changes the way FormatDocumentWithOptions writes a document.
+// The zero value gives the same result as FormatDocument.
+type FormatOptions struct {
+	// Indent is the number of spaces to indent by, or two if it's zero.
+	Indent int `yaml:"indent"`
+	// Tabs indents by one tab instead of with spaces.
+	Tabs        bool        `yaml:"tabs"`
+	BlankLines  BlankLines  `yaml:"blank_lines"`
+	Quotes      Quotes      `yaml:"quotes"`
+	Keywords    KeywordCase `yaml:"keywords"`
+	StateLabels StateLabels `yaml:"state_labels"`
+	// AlignEdgeLabels lines up the labels of edges that come one after the
+	// other.
+	AlignEdgeLabels bool `yaml:"align_edge_labels"`
+	// MaxWidth wraps the lines of notes that would be longer than this, as
+	// long as it's more than zero.
+	MaxWidth int `yaml:"max_width"`
+}
+
+// Validate checks that the options all have values the formatter knows about.
+func (o FormatOptions) Validate() error {
+	switch o.BlankLines {
+	case "", BlankLinesByType, BlankLinesAlways, BlankLinesNone:
+	default:
+		return fmt.Errorf("FormatOptions.Validate: unknown blank_lines %q", o.BlankLines)
+	}
+
+	switch o.Quotes {
+	case "", QuotesAlways, QuotesNeeded:
+	default:
+		return fmt.Errorf("FormatOptions.Validate: unknown quotes %q", o.Quotes)
+	}
+
+	switch o.Keywords {
+	case "", KeywordsLower, KeywordsUpper:
+	default:
+		return fmt.Errorf("FormatOptions.Validate: unknown keywords %q", o.Keywords)
+	}
+
+	switch o.StateLabels {
+	case "", StateLabelsFirst, StateNamesFirst:
+	default:
+		return fmt.Errorf("FormatOptions.Validate: unknown state_labels %q", o.StateLabels)
+	}
+
+	if o.Indent < 0 || o.MaxWidth < 0 {
+		return fmt.Errorf("FormatOptions.Validate: indent and max_width can't be negative")
+	}
+
+	return nil
+}
+
 func FormatDocument(d DocumentNode, wr io.Writer) error {
-	return formatNode(d, wr, "")
+	if err := (FormatOptions{}).format(d, wr); err != nil {
+		return fmt.Errorf("FormatDocument: %w", err)
+	}
+
+	return nil
+}
+
+func FormatDocumentWithOptions(d DocumentNode, wr io.Writer, o FormatOptions) error {
+	if err := o.Validate(); err != nil {
+		return fmt.Errorf("FormatDocumentWithOptions: %w", err)
+	}
+
+	if err := o.format(d, wr); err != nil {
+		return fmt.Errorf("FormatDocumentWithOptions: %w", err)
+	}
+
+	return nil
+}
+
+// FormatNode writes a single node the same way FormatDocument would, without
+// any indentation.
+func FormatNode(n Node, wr io.Writer) error {
+	if err := (FormatOptions{}).format(n, wr); err != nil {
+		return fmt.Errorf("FormatNode: %w", err)
+	}
+
+	return nil
+}
+
+// FormatSkinParamEntry writes a skinparam the way it's written inside a
+// `skinparam` block, without the keyword in front of it.
+func FormatSkinParamEntry(n SkinParamNode, wr io.Writer) error {
+	w := newFormatWriter(wr, (FormatOptions{}).step())
+	formatSkinParamEntry(n, w)
+
+	if w.err != nil {
+		return fmt.Errorf("FormatSkinParamEntry: %w", w.err)
+	}
+
+	return nil
+}
+
+func (o FormatOptions) format(n Node, wr io.Writer) error {
+	w := newFormatWriter(wr, o.step())
+	o.formatNode(n, w)
+	return w.err
+}
+
+// step is one level of indentation.
+func (o FormatOptions) step() string {
+	switch {
+	case o.Tabs:
+		return "\t"
+	case o.Indent > 0:
+		return strings.Repeat(" ", o.Indent)
+	default:
+		return "  "
+	}
+}
+
+func (o FormatOptions) keyword(s string) string {
+	if o.Keywords == KeywordsUpper {
+		return strings.ToUpper(s)
+	}
+
+	return s
+}
+
+func (o FormatOptions) quote(s string) string {
+	if o.Quotes == QuotesNeeded && isWord(s) {
+		return s
+	}
+
+	return quoted(s)
+}
+
+// quoted puts double quotes around a string. PlantUML doesn't have escapes
+// in quoted strings, so something like `\n` has to be left as it is.
+func quoted(s string) string {
+	return `"` + s + `"`
+}
+
+func isWord(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return false
+		}
+	}
+
+	return s != ""
+}
+
+func (o FormatOptions) blankLine(a, b Node) bool {
+	if _, ok := a.(SeparatorNode); ok {
+		return false
+	}
+	if _, ok := b.(SeparatorNode); ok {
+		return false
+	}
+	if _, ok := a.(SideNode); ok {
+		return false
+	}
+	if _, ok := b.(SideNode); ok {
+		return false
+	}
+
+	switch o.BlankLines {
+	case BlankLinesAlways:
+		return true
+	case BlankLinesNone:
+		return false
+	}
+
+	// each tick is a section of its own, even though they're all ticks.
+	if _, ok := b.(TickNode); ok {
+		return true
+	}
+
+	return fmt.Sprintf("%T", a) != fmt.Sprintf("%T", b)
+}
+
+// formatNodes writes a list of nodes with blank lines between them, and
+// lines up the labels of edges if that's turned on.
+func (o FormatOptions) formatNodes(nodes []Node, w *formatWriter) {
+	widths := make([]int, len(nodes))
+	if o.AlignEdgeLabels {
+		for i := 0; i < len(nodes); i++ {
+			j, width := i, 0
+			for ; j < len(nodes); j++ {
+				e, ok := nodes[j].(EdgeNode)
+				if !ok {
+					break
+				}
+				if w := len(edgeArrow(e)); e.Text != "" && w > width {
+					width = w
+				}
+			}
+
+			for ; i < j; i++ {
+				widths[i] = width
+			}
+		}
+	}
+
+	for i, c := range nodes {
+		if i > 0 && o.blankLine(nodes[i-1], c) {
+			w.printf("\n")
+		}
+
+		if e, ok := c.(EdgeNode); ok {
+			formatEdge(e, w, widths[i])
+		} else {
+			o.formatNode(c, w)
+		}
+	}
+}
+
+// formatBlock writes nodes one level further in.
+func (o FormatOptions) formatBlock(nodes []Node, w *formatWriter) {
+	w.Indent()
+	o.formatNodes(nodes, w)
+	w.Outdent()
+}
+
+func edgeArrow(n EdgeNode) string {
+	return fmt.Sprintf("%s %s %s", endpoint(n.Left, n.LeftKind), n.Direction, endpoint(n.Right, n.RightKind))
+}
+
+func endpoint(name string, kind EndpointKind) string {
+	switch kind {
+	case EndpointActor:
+		return ":" + name + ":"
+	case EndpointUseCase:
+		return "(" + name + ")"
+	case EndpointComponent:
+		return "[" + name + "]"
+	case EndpointInterface:
+		return "() " + plainName(name)
+	default:
+		return plainName(name)
+	}
+}
+
+// plainName quotes a name if it wouldn't be read back as one term, which
+// happens when it was declared as something like `:Some Actor:` or
+// `[Some Component]`.
+func plainName(s string) string {
+	if strings.ContainsAny(s, " \t") {
+		return quoted(s)
+	}
+
+	return s
+}
+
+// formatDeclaration writes the start of an actor, use case, component or
+// anything else declared the same way.
+func (o FormatOptions) formatDeclaration(w *formatWriter, keyword, name, label, stereotype string) {
+	switch {
+	case name == "" && label == "":
+		w.printf("%s", o.keyword(keyword))
+	case name == label:
+		w.printf("%s %s", o.keyword(keyword), plainName(name))
+	case o.StateLabels == StateNamesFirst:
+		w.printf("%s %s %s %s", o.keyword(keyword), plainName(name), o.keyword("as"), quoted(label))
+	default:
+		w.printf("%s %s %s %s", o.keyword(keyword), o.quote(label), o.keyword("as"), plainName(name))
+	}
+
+	if stereotype != "" {
+		w.printf(" %s", stereotype)
+	}
 }
 
-func formatNode(n Node, wr io.Writer, indent string) error {
+// formatBody finishes a declaration with its children in braces, if it has
+// any.
+func (o FormatOptions) formatBody(children []Node, w *formatWriter) {
+	if len(children) > 0 {
+		w.printf(" {\n")
+		o.formatBlock(children, w)
+		w.printf("}\n")
+	} else {
+		w.printf("\n")
+	}
+}
+
+// formatEdge writes an edge with its arrow padded out to width, so that the
+// labels of a run of edges line up.
+func formatEdge(n EdgeNode, w *formatWriter, width int) {
+	arrow := edgeArrow(n)
+
+	w.printf("%s", arrow)
+	if n.Text != "" {
+		if len(arrow) < width {
+			w.printf("%s", strings.Repeat(" ", width-len(arrow)))
+		}
+		w.printf(" : %s", n.Text)
+	}
+	w.printf("\n")
+}
+
+// wrap splits a line of text at spaces so that each piece is no wider than
+// width, keeping the line's indentation. Words that are too long on their
+// own are left whole.
+func wrap(line string, width int) []string {
+	text := strings.TrimLeft(line, " \t")
+	lead := line[:len(line)-len(text)]
+
+	var lines []string
+	current := ""
+	for _, w := range strings.Fields(text) {
+		if current != "" && len(lead)+len(current)+1+len(w) > width {
+			lines = append(lines, lead+current)
+			current = ""
+		}
+		if current != "" {
+			current += " "
+		}
+		current += w
+	}
+
+	return append(lines, lead+current)
+}
+
+func (o FormatOptions) formatNode(n Node, w *formatWriter) {
 	switch n := n.(type) {
 	case SkinParamNode:
-		fmt.Fprintf(wr, "%sskinparam %s %s\n", indent, n.Name, n.Value)
+		w.printf("%s ", o.keyword("skinparam"))
+		formatSkinParamEntry(n, w)
+	case ThemeNode:
+		w.printf("!theme %s", n.Name)
+		if n.From != "" {
+			w.printf(" %s %s", o.keyword("from"), n.From)
+		}
+		w.printf("\n")
+	case StyleNode:
+		w.printf("<style>\n")
+		for _, c := range n.Children {
+			o.formatNode(c, w)
+		}
+		w.printf("</style>\n")
+	case StyleRuleNode:
+		w.printf("%s {\n", n.Selector)
+		w.Indent()
+		for _, c := range n.Children {
+			o.formatNode(c, w)
+		}
+		w.Outdent()
+		w.printf("}\n")
+	case StylePropertyNode:
+		w.printf("%s %s\n", n.Name, n.Value)
 	case DocumentNode:
-		fmt.Fprintf(wr, "%s@startuml\n\n", indent)
+		w.printf("@start%s\n\n", n.Kind)
+		o.formatNodes(n.Nodes, w)
+		w.printf("\n@end%s\n", n.Kind)
+	case CommentNode:
+	case StateNode:
+		switch {
+		case n.Name == n.Label:
+			w.printf("%s %s", o.keyword("state"), n.Name)
+		case o.StateLabels == StateNamesFirst:
+			w.printf("%s %s %s %s", o.keyword("state"), n.Name, o.keyword("as"), quoted(n.Label))
+		default:
+			w.printf("%s %s %s %s", o.keyword("state"), o.quote(n.Label), o.keyword("as"), n.Name)
+		}
 
-		var lastType string
-		for _, c := range n.Nodes {
-			t := fmt.Sprintf("%T", c)
-			if t != lastType && lastType != "" {
-				fmt.Fprintf(wr, "\n")
+		if n.Stereotype != "" {
+			w.printf(" %s", n.Stereotype)
+		}
+
+		if len(n.Children) > 0 {
+			w.printf(" {\n")
+			o.formatBlock(n.Children, w)
+			w.printf("}\n")
+		} else {
+			if n.Text != "" {
+				w.printf(" : %s", n.Text)
 			}
-			lastType = t
-			formatNode(c, wr, indent)
+
+			w.printf("\n")
 		}
+	case EdgeNode:
+		formatEdge(n, w, 0)
+	case ActorNode:
+		o.formatDeclaration(w, "actor", n.Name, n.Label, n.Stereotype)
+		w.printf("\n")
+	case UseCaseNode:
+		o.formatDeclaration(w, "usecase", n.Name, n.Label, n.Stereotype)
+		w.printf("\n")
+	case RectangleNode:
+		o.formatDeclaration(w, "rectangle", n.Name, n.Label, n.Stereotype)
+		o.formatBody(n.Children, w)
+	case ComponentNode:
+		o.formatDeclaration(w, "component", n.Name, n.Label, n.Stereotype)
+		o.formatBody(n.Children, w)
+	case InterfaceNode:
+		o.formatDeclaration(w, "interface", n.Name, n.Label, n.Stereotype)
+		w.printf("\n")
+	case PortNode:
+		o.formatDeclaration(w, "port"+n.Direction, n.Name, n.Label, n.Stereotype)
+		w.printf("\n")
+	case ObjectNode:
+		o.formatDeclaration(w, "object", n.Name, n.Label, n.Stereotype)
 
-		fmt.Fprintf(wr, "\n%s@enduml\n", indent)
-	case CommentNode:
-	case StateNode:
-		if n.Name == n.Label {
-			fmt.Fprintf(wr, "%sstate %s", indent, n.Name)
+		if len(n.Fields) > 0 {
+			w.printf(" {\n")
+			w.Indent()
+			for _, f := range n.Fields {
+				o.formatNode(f, w)
+			}
+			w.Outdent()
+			w.printf("}\n")
+		} else {
+			w.printf("\n")
+		}
+	case FieldNode:
+		if n.Value != "" {
+			w.printf("%s = %s\n", n.Name, n.Value)
 		} else {
-			fmt.Fprintf(wr, "%sstate %q as %s", indent, n.Label, n.Name)
+			w.printf("%s\n", n.Name)
 		}
+	case EntityNode:
+		o.formatDeclaration(w, n.Kind, n.Name, n.Label, n.Stereotype)
 
 		if len(n.Children) > 0 {
-			fmt.Fprintf(wr, " {\n")
+			w.printf(" {\n")
+			w.Indent()
+			for _, c := range n.Children {
+				o.formatNode(c, w)
+			}
+			w.Outdent()
+			w.printf("}\n")
+		} else {
+			w.printf("\n")
+		}
+	case ColumnNode:
+		if n.Mandatory {
+			w.printf("*")
+		}
+		w.printf("%s", n.Name)
 
-			var lastType string
+		if len(n.Children) > 0 {
+			w.printf(" {\n")
+			w.Indent()
 			for _, c := range n.Children {
-				t := fmt.Sprintf("%T", c)
-				if t != lastType && lastType != "" && t != "parser.SeparatorNode" && lastType != "parser.SeparatorNode" {
-					fmt.Fprintf(wr, "\n")
-				}
-				lastType = t
-				formatNode(c, wr, indent+"  ")
+				o.formatNode(c, w)
+			}
+			w.Outdent()
+			w.printf("}\n")
+			break
+		}
+
+		if n.Type != "" {
+			w.printf(" : %s", n.Type)
+		}
+		if n.Stereotype != "" {
+			w.printf(" %s", n.Stereotype)
+		}
+		w.printf("\n")
+	case EntitySeparatorNode:
+		w.printf("%s\n", n.Line)
+	case MapNode:
+		o.formatDeclaration(w, "map", n.Name, n.Label, n.Stereotype)
+
+		if len(n.Entries) > 0 {
+			w.printf(" {\n")
+			w.Indent()
+			for _, e := range n.Entries {
+				o.formatNode(e, w)
 			}
-			fmt.Fprintf(wr, "%s}\n", indent)
+			w.Outdent()
+			w.printf("}\n")
 		} else {
-			if n.Text != "" {
-				fmt.Fprintf(wr, " : %s", n.Text)
+			w.printf("\n")
+		}
+	case MapEntryNode:
+		if n.Link != "" {
+			w.printf("%s *-> %s\n", n.Key, n.Link)
+		} else {
+			w.printf("%s => %s\n", n.Key, n.Value)
+		}
+	case TimingParticipantNode:
+		o.formatDeclaration(w, n.Kind, n.Name, n.Label, n.Stereotype)
+
+		if n.Period != 0 || n.Pulse != 0 || n.Offset != 0 {
+			w.printf(" %s", o.keyword("with"))
+			if n.Period != 0 {
+				w.printf(" %s %d", o.keyword("period"), n.Period)
+			}
+			if n.Pulse != 0 {
+				w.printf(" %s %d", o.keyword("pulse"), n.Pulse)
+			}
+			if n.Offset != 0 {
+				w.printf(" %s %d", o.keyword("offset"), n.Offset)
 			}
+		}
 
-			fmt.Fprintf(wr, "\n")
+		w.printf("\n")
+	case TickNode:
+		if n.Participant != "" {
+			w.printf("@%s\n", n.Participant)
+		} else {
+			w.printf("@%s\n", n.Time)
 		}
-	case EdgeNode:
-		fmt.Fprintf(wr, "%s%s %s %s", indent, n.Left, n.Direction, n.Right)
+
+		o.formatNodes(n.Children, w)
+	case StateChangeNode:
+		subject := n.Participant
+		if n.Time != "" {
+			subject = n.Time
+		}
+
+		w.printf("%s %s %s\n", subject, o.keyword("is"), plainName(n.State))
+	case HighlightNode:
+		w.printf("%s %s %s %s", o.keyword("highlight"), n.From, o.keyword("to"), n.To)
+		if n.Colour != "" {
+			w.printf(" #%s", n.Colour)
+		}
+		if n.Text != "" {
+			w.printf(" : %s", n.Text)
+		}
+		w.printf("\n")
+	case ConstraintNode:
+		w.printf("%s@%s <-> @%s", n.Participant, n.From, n.To)
 		if n.Text != "" {
-			fmt.Fprintf(wr, " : %s", n.Text)
+			w.printf(" : {%s}", n.Text)
+		}
+		w.printf("\n")
+	case GanttTaskNode:
+		if n.Then {
+			w.printf("%s ", o.keyword("then"))
+		}
+		w.printf("[%s]", n.Name)
+		if n.Alias != "" {
+			w.printf(" %s [%s]", o.keyword("as"), n.Alias)
+		}
+		if len(n.Resources) > 0 {
+			w.printf(" %s", o.keyword("on"))
+			for _, r := range n.Resources {
+				if r.Percent != 0 {
+					w.printf(" {%s:%d%%}", r.Name, r.Percent)
+				} else {
+					w.printf(" {%s}", r.Name)
+				}
+			}
+		}
+		for i, c := range n.Clauses {
+			if i > 0 {
+				w.printf(" %s", o.keyword("and"))
+			}
+			w.printf(" ")
+			o.formatGanttClause(c, w)
+		}
+		w.printf("\n")
+	case GanttProjectNode:
+		w.printf("%s %s\n", o.keyword("Project starts"), n.Start)
+	case GanttCalendarNode:
+		state := "open"
+		if n.Closed {
+			state = "closed"
+		}
+
+		switch {
+		case n.Day != "":
+			w.printf("%s %s %s\n", n.Day, o.keyword("are"), o.keyword(state))
+		case n.From == n.To:
+			w.printf("%s %s %s\n", n.From, o.keyword("is"), o.keyword(state))
+		default:
+			w.printf("%s %s %s %s %s\n", n.From, o.keyword("to"), n.To, o.keyword("are"), o.keyword(state))
+		}
+	case BranchNode:
+		w.printf("%s", strings.Repeat(n.Marker, n.Depth))
+		if n.Colour != "" {
+			w.printf("[#%s]", n.Colour)
+		}
+		if n.Boxless {
+			w.printf("_")
+		}
+		w.printf("%s", n.Direction)
+
+		if n.Multiline || strings.Contains(n.Text, "\n") {
+			w.printf(":")
+			w.raw(n.Text)
+			w.printf(";\n")
+		} else if n.Text != "" {
+			w.printf(" %s\n", n.Text)
+		} else {
+			w.printf("\n")
+		}
+
+		o.formatNodes(n.Children, w)
+	case SideNode:
+		w.printf("%s %s\n", o.keyword(n.Side), o.keyword("side"))
+	case DataHighlightNode:
+		w.printf("#%s %s", o.keyword("highlight"), formatDataPath(n.Path))
+		if n.Stereotype != "" {
+			w.printf(" <<%s>>", n.Stereotype)
 		}
-		fmt.Fprintf(wr, "\n")
+		w.printf("\n")
+	case DataNode:
+		w.raw(n.Raw)
+		w.printf("\n")
+	case ContainerNode:
+		o.formatDeclaration(w, n.Kind, n.Name, n.Label, n.Stereotype)
+		o.formatBody(n.Children, w)
+	case DirectionNode:
+		w.printf("%s\n", o.keyword(n.Direction+" direction"))
 	case SeparatorNode:
-		fmt.Fprintf(wr, "%s---\n", indent)
+		w.printf("---\n")
 	case NoteNode:
-		fmt.Fprintf(wr, "%s", indent)
 		if n.Floating {
-			fmt.Fprintf(wr, "floating ")
+			w.printf("%s ", o.keyword("floating"))
 		}
-		fmt.Fprintf(wr, "note")
+		w.printf("%s", o.keyword("note"))
 		if n.Position != "" {
-			fmt.Fprintf(wr, " %s", n.Position)
+			w.printf(" %s", n.Position)
 		}
-		fmt.Fprintf(wr, "\n")
+		w.printf("\n")
 		for _, l := range strings.Split(n.Content, "\n") {
-			fmt.Fprintf(wr, "%s%s\n", indent, l)
+			if width := o.MaxWidth - len(w.prefix); o.MaxWidth > 0 && len(l) > width {
+				for _, s := range wrap(l, width) {
+					w.printf("%s\n", s)
+				}
+			} else {
+				w.printf("%s\n", l)
+			}
 		}
-		fmt.Fprintf(wr, "%sendnote\n", indent)
+		w.printf("%s\n", o.keyword("endnote"))
 	case PartitionNode:
-		fmt.Fprintf(wr, "%spartition %q", indent, n.Label)
+		w.printf("%s %s", o.keyword("partition"), o.quote(n.Label))
 
 		if len(n.Children) > 0 {
-			fmt.Fprintf(wr, " {\n")
-
-			var lastType string
-			for _, c := range n.Children {
-				t := fmt.Sprintf("%T", c)
-				if t != lastType && lastType != "" {
-					fmt.Fprintf(wr, "\n")
-				}
-				lastType = t
-				formatNode(c, wr, indent+"  ")
-			}
-			fmt.Fprintf(wr, "%s}\n", indent)
+			w.printf(" {\n")
+			o.formatBlock(n.Children, w)
+			w.printf("}\n")
 		} else {
-			fmt.Fprintf(wr, " {}\n")
+			w.printf(" {}\n")
 		}
 	case IfNode:
-		fmt.Fprintf(wr, "%sif", indent)
+		w.printf("%s", o.keyword("if"))
 		if n.Condition != nil {
-			fmt.Fprintf(wr, " ")
-			formatNode(n.Condition, wr, indent)
+			w.printf(" ")
+			o.formatNode(n.Condition, w)
 		}
-		fmt.Fprintf(wr, " then")
+		w.printf(" %s", o.keyword("then"))
 		if n.Value != nil {
-			fmt.Fprintf(wr, " ")
-			formatNode(n.Value, wr, indent)
-		}
-		fmt.Fprintf(wr, "\n")
-		var lastType string
-		for _, c := range n.Statements {
-			t := fmt.Sprintf("%T", c)
-			if t != lastType && lastType != "" {
-				fmt.Fprintf(wr, "\n")
-			}
-			lastType = t
-			formatNode(c, wr, indent+"  ")
+			w.printf(" ")
+			o.formatNode(n.Value, w)
 		}
+		w.printf("\n")
+		o.formatBlock(n.Statements, w)
 		if n.Else != nil {
-			formatNode(n.Else, wr, indent)
+			o.formatNode(n.Else, w)
 		} else {
-			fmt.Fprintf(wr, "%sendif\n", indent)
+			w.printf("%s\n", o.keyword("endif"))
 		}
 	case ElseNode:
-		fmt.Fprintf(wr, "%selse", indent)
+		w.printf("%s", o.keyword("else"))
 		if n.Condition != nil {
-			fmt.Fprintf(wr, " if ")
-			formatNode(n.Condition, wr, indent)
-			fmt.Fprintf(wr, " then")
+			w.printf(" %s ", o.keyword("if"))
+			o.formatNode(n.Condition, w)
+			w.printf(" %s", o.keyword("then"))
 		}
 		if n.Value != nil {
-			fmt.Fprintf(wr, " ")
-			formatNode(n.Value, wr, indent)
-		}
-		fmt.Fprintf(wr, "\n")
-		var lastType string
-		for _, c := range n.Statements {
-			t := fmt.Sprintf("%T", c)
-			if t != lastType && lastType != "" {
-				fmt.Fprintf(wr, "\n")
-			}
-			lastType = t
-			formatNode(c, wr, indent+"  ")
+			w.printf(" ")
+			o.formatNode(n.Value, w)
 		}
+		w.printf("\n")
+		o.formatBlock(n.Statements, w)
 		if n.Else != nil {
-			formatNode(n.Else, wr, indent)
+			o.formatNode(n.Else, w)
 		} else {
-			fmt.Fprintf(wr, "%sendif\n", indent)
+			w.printf("%s\n", o.keyword("endif"))
 		}
 	case ForkNode:
 		if n.IsAgain {
-			fmt.Fprintf(wr, "%sforkagain", indent)
+			w.printf("%s\n", o.keyword("forkagain"))
 		} else {
-			fmt.Fprintf(wr, "%sfork", indent)
-		}
-		fmt.Fprintf(wr, "\n")
-		var lastType string
-		for _, c := range n.Statements {
-			t := fmt.Sprintf("%T", c)
-			if t != lastType && lastType != "" {
-				fmt.Fprintf(wr, "\n")
-			}
-			lastType = t
-			formatNode(c, wr, indent+"  ")
+			w.printf("%s\n", o.keyword("fork"))
 		}
+		o.formatBlock(n.Statements, w)
 		if n.ForkAgain != nil {
-			formatNode(n.ForkAgain, wr, indent)
+			o.formatNode(n.ForkAgain, w)
 		} else {
-			fmt.Fprintf(wr, "%sendfork\n", indent)
+			w.printf("%s\n", o.keyword("endfork"))
 		}
 	case ParenthesisNode:
-		fmt.Fprintf(wr, "("+n.Content+")")
+		w.printf("(%s)", n.Content)
 	case StartNode:
-		fmt.Fprintf(wr, "%sstart\n", indent)
+		w.printf("%s\n", o.keyword("start"))
 	case EndNode:
-		fmt.Fprintf(wr, "%send\n", indent)
+		w.printf("%s\n", o.keyword("end"))
 	case ActionNode:
 		if n.Colour != "" {
-			fmt.Fprintf(wr, "%s#%s:%s;\n", indent, n.Colour, n.Content)
-		} else {
-			fmt.Fprintf(wr, "%s:%s;\n", indent, n.Content)
+			w.printf("#%s", n.Colour)
 		}
+		w.printf(":")
+		w.raw(n.Content)
+		w.printf(";\n")
 	default:
-		fmt.Fprintf(wr, "UNRECOGNISED NODE TYPE: %T\n", n)
+		w.printf("UNRECOGNISED NODE TYPE: %T\n", n)
 	}
+}
 
-	return nil
+func (o FormatOptions) formatGanttClause(c GanttClause, w *formatWriter) {
+	switch c.Kind {
+	case GanttLasts:
+		unit := c.Unit
+		if c.Amount != 1 {
+			unit += "s"
+		}
+
+		w.printf("%s %d %s", o.keyword("lasts"), c.Amount, o.keyword(unit))
+	case GanttStarts, GanttEnds, GanttHappens:
+		w.printf("%s", o.keyword(string(c.Kind)))
+
+		switch {
+		case c.Date != "":
+			w.printf(" %s", c.Date)
+		case c.Offset != 0:
+			days, direction := c.Offset, "after"
+			if days < 0 {
+				days, direction = -days, "before"
+			}
+
+			unit := "days"
+			if days == 1 {
+				unit = "day"
+			}
+
+			w.printf(" %d %s %s [%s]'s %s", days, o.keyword(unit), o.keyword(direction), c.Task, o.keyword(c.Anchor))
+		default:
+			w.printf(" %s [%s]'s %s", o.keyword("at"), c.Task, o.keyword(c.Anchor))
+		}
+	case GanttCompleted:
+		w.printf("%s %d%% %s", o.keyword("is"), c.Percent, o.keyword("completed"))
+	case GanttColoured:
+		w.printf("%s %s", o.keyword("is colored in"), c.Colour)
+	}
+}
+
+func formatSkinParamEntry(n SkinParamNode, w *formatWriter) {
+	w.printf("%s%s", n.Name, n.Stereotype)
+
+	if len(n.Children) == 0 {
+		w.printf(" %s\n", n.Value)
+		return
+	}
+
+	w.printf(" {\n")
+	w.Indent()
+	for _, c := range n.Children {
+		if c, ok := c.(SkinParamNode); ok {
+			formatSkinParamEntry(c, w)
+		}
+	}
+	w.Outdent()
+	w.printf("}\n")
 }
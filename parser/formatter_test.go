@@ -2,6 +2,7 @@ package parser
 
 import (
   "bytes"
+  "errors"
   "io/ioutil"
   "testing"
 
@@ -16,6 +17,18 @@ func TestFormatDocument(t *testing.T) {
     {"simple", readTestFile("simple-code-1-input.uml"), readTestFile("simple-code-1-formatted.uml")},
     {"complex", readTestFile("complex-code-1-input.uml"), readTestFile("complex-code-1-formatted.uml")},
     {"complex2", readTestFile("complex-code-2-input.uml"), readTestFile("complex-code-2-formatted.uml")},
+    {"skinparam", readTestFile("skinparam-1-input.uml"), readTestFile("skinparam-1-formatted.uml")},
+    {"usecase", readTestFile("usecase-1-input.uml"), readTestFile("usecase-1-formatted.uml")},
+    {"component", readTestFile("component-1-input.uml"), readTestFile("component-1-formatted.uml")},
+    {"object", readTestFile("object-1-input.uml"), readTestFile("object-1-formatted.uml")},
+    {"timing", readTestFile("timing-1-input.uml"), readTestFile("timing-1-formatted.uml")},
+    {"gantt", readTestFile("gantt-1-input.uml"), readTestFile("gantt-1-formatted.uml")},
+    {"mindmap", readTestFile("mindmap-1-input.uml"), readTestFile("mindmap-1-formatted.uml")},
+    {"wbs", readTestFile("wbs-1-input.uml"), readTestFile("wbs-1-formatted.uml")},
+    {"json", readTestFile("json-1-input.uml"), readTestFile("json-1-formatted.uml")},
+    {"yaml", readTestFile("yaml-1-input.uml"), readTestFile("yaml-1-formatted.uml")},
+    {"er", readTestFile("er-1-input.uml"), readTestFile("er-1-formatted.uml")},
+    {"chen", readTestFile("chen-1-input.uml"), readTestFile("chen-1-formatted.uml")},
   } {
     t.Run(e.name, func(t *testing.T) {
       a := assert.New(t)
@@ -42,3 +55,91 @@ func BenchmarkFormatDocument(b *testing.B) {
     FormatDocument(*doc, ioutil.Discard)
   }
 }
+
+func TestFormatDocumentWithOptions(t *testing.T) {
+  const input = `@startuml
+state "Waiting" as W
+state "Long Name" as L
+state Outer {
+  state Inner {
+    state Deep
+  }
+  ---
+  state Other
+}
+W --> L : go
+Longer --> W : back
+W --> W
+partition Work {
+  :a;
+  if (x) then (yes)
+    :b;
+  endif
+}
+note left
+  one two three four five six
+endnote
+@enduml
+`
+
+  for _, e := range []struct {
+    name   string
+    opts   FormatOptions
+    output string
+  }{
+    {"tabs", FormatOptions{Tabs: true, BlankLines: BlankLinesNone}, "@startuml\n\nstate \"Waiting\" as W\nstate \"Long Name\" as L\nstate Outer {\n\tstate Inner {\n\t\tstate Deep\n\t}\n\t---\n\tstate Other\n}\nW --> L : go\nLonger --> W : back\nW --> W\npartition \"Work\" {\n\t:a;\n\tif (x) then (yes)\n\t\t:b;\n\tendif\n}\nnote left\n  one two three four five six\nendnote\n\n@enduml\n"},
+    {"everything", FormatOptions{Indent: 4, BlankLines: BlankLinesAlways, Quotes: QuotesNeeded, Keywords: KeywordsUpper, StateLabels: StateNamesFirst, AlignEdgeLabels: true, MaxWidth: 12}, "@startuml\n\nSTATE W AS \"Waiting\"\n\nSTATE L AS \"Long Name\"\n\nSTATE Outer {\n    STATE Inner {\n        STATE Deep\n    }\n    ---\n    STATE Other\n}\n\nW --> L      : go\n\nLonger --> W : back\n\nW --> W\n\nPARTITION Work {\n    :a;\n\n    IF (x) THEN (yes)\n        :b;\n    ENDIF\n}\n\nNOTE left\n  one two\n  three four\n  five six\nENDNOTE\n\n@enduml\n"},
+  } {
+    t.Run(e.name, func(t *testing.T) {
+      a := assert.New(t)
+
+      doc, err := ParseDocument(input)
+      if !a.NoError(err) {
+        return
+      }
+
+      buf := bytes.NewBuffer(nil)
+      if a.NoError(FormatDocumentWithOptions(*doc, buf, e.opts)) {
+        a.Equal(e.output, buf.String())
+      }
+
+      // the result has to parse, and come out the same if it's formatted
+      // again.
+      again, err := ParseDocument(buf.String())
+      if a.NoError(err) {
+        var x bytes.Buffer
+        a.NoError(FormatDocumentWithOptions(*again, &x, e.opts))
+        a.Equal(buf.String(), x.String())
+      }
+    })
+  }
+
+  a := assert.New(t)
+  a.Error(FormatDocumentWithOptions(DocumentNode{}, ioutil.Discard, FormatOptions{Quotes: "single"}))
+}
+
+type failingWriter struct{ n int }
+
+func (w *failingWriter) Write(d []byte) (int, error) {
+  if w.n -= len(d); w.n < 0 {
+    return 0, errors.New("disk full")
+  }
+
+  return len(d), nil
+}
+
+func TestFormatDocumentErrors(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := ParseDocument(string(readTestFile("complex-code-1-input.uml")))
+  if !a.NoError(err) {
+    return
+  }
+
+  for _, n := range []int{0, 10, 100, 500} {
+    err := FormatDocument(*doc, &failingWriter{n: n})
+    a.EqualError(err, "FormatDocument: disk full")
+  }
+
+  a.NoError(FormatDocument(*doc, &failingWriter{n: 1 << 20}))
+}
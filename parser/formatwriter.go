@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// formatWriter is what the formatter writes through, in place of
+// IndentWriter, which is still exported for anyone else using it. Unlike
+// IndentWriter it doesn't look at braces; the formatter says when to indent,
+// and whatever's written keeps its own whitespace, with the indentation put
+// in front of each line that isn't blank. It holds on to the first error it
+// gets, so that formatting code can write without checking every call.
+type formatWriter struct {
+	wr     io.Writer
+	step   string
+	prefix string
+	inLine bool
+	err    error
+}
+
+func newFormatWriter(wr io.Writer, step string) *formatWriter {
+	return &formatWriter{wr: wr, step: step}
+}
+
+func (w *formatWriter) Indent() { w.prefix += w.step }
+
+func (w *formatWriter) Outdent() { w.prefix = strings.TrimSuffix(w.prefix, w.step) }
+
+func (w *formatWriter) Write(d []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	var consumed int
+
+	for len(d) > 0 {
+		line := d
+		if i := bytes.IndexByte(d, '\n'); i != -1 {
+			line = d[:i+1]
+		}
+
+		if !w.inLine && line[0] != '\n' {
+			if _, err := io.WriteString(w.wr, w.prefix); err != nil {
+				w.err = err
+				return consumed, err
+			}
+		}
+
+		n, err := w.wr.Write(line)
+		consumed += n
+		if err != nil {
+			w.err = err
+			return consumed, err
+		}
+
+		w.inLine = line[len(line)-1] != '\n'
+		d = d[len(line):]
+	}
+
+	return consumed, nil
+}
+
+func (w *formatWriter) printf(format string, a ...interface{}) {
+	fmt.Fprintf(w, format, a...)
+}
+
+// raw writes text that already has whatever indentation it needs on each
+// line, like the content of a multi-line action.
+func (w *formatWriter) raw(s string) {
+	prefix := w.prefix
+	w.prefix = ""
+	io.WriteString(w, s)
+	w.prefix = prefix
+}
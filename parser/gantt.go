@@ -0,0 +1,343 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ganttWordPattern splits a line of a Gantt chart up, keeping task names
+	// like `[Task]` or `[Task]'s` and resources like `{Alice:50%}` whole.
+	ganttWordPattern     = regexp.MustCompile(`\[[^\]]*\](?:'s)?|\{[^}]*\}|\S+`)
+	ganttTaskPattern     = regexp.MustCompile(`^\[([^\]]*)\]$`)
+	ganttAnchorPattern   = regexp.MustCompile(`^\[([^\]]*)\]'s$`)
+	ganttResourcePattern = regexp.MustCompile(`^\{([^}:]*)(?::\s*(\d+)%)?\}$`)
+	ganttDatePattern     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	ganttPercentPattern  = regexp.MustCompile(`^(\d+)%$`)
+)
+
+var ganttWeekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// ganttWords is a line of a Gantt chart being read a word at a time.
+type ganttWords struct {
+	a []string
+	i int
+}
+
+func (w *ganttWords) peek() string {
+	if w.i >= len(w.a) {
+		return ""
+	}
+
+	return w.a[w.i]
+}
+
+func (w *ganttWords) next() string {
+	s := w.peek()
+	if w.i < len(w.a) {
+		w.i++
+	}
+
+	return s
+}
+
+// is reads the next word if it's one of the keywords.
+func (w *ganttWords) is(keywords ...string) bool {
+	for _, k := range keywords {
+		if strings.EqualFold(w.peek(), k) {
+			w.i++
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *ganttWords) expect(keywords ...string) error {
+	if !w.is(keywords...) {
+		return fmt.Errorf("expected `%s' but got %q", strings.Join(keywords, "' or `"), w.peek())
+	}
+
+	return nil
+}
+
+func (w *ganttWords) number() (int, error) {
+	s := w.next()
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("expected a number but got %q", s)
+	}
+
+	return n, nil
+}
+
+func (w *ganttWords) date() (string, error) {
+	s := w.next()
+	if !ganttDatePattern.MatchString(s) {
+		return "", fmt.Errorf("expected a date like 2020-07-01 but got %q", s)
+	}
+
+	return s, nil
+}
+
+// parseGanttNode parses a line of a Gantt chart, which is always a node of
+// its own.
+func parseGanttNode(s *scanner, tk *token) (Node, error) {
+	s.moveTo(tk)
+	s.savePos()
+
+	p := s.pos()
+	line, _ := readToTerminator(s, '\n', false)
+	line = strings.TrimRight(line, " \t\r")
+
+	r := s.sr([2]int{p, p + len(line) - 1})
+	s.trackRange(r)
+
+	w := &ganttWords{a: ganttWordPattern.FindAllString(line, -1)}
+
+	var node Node
+	var err error
+
+	switch first := w.peek(); {
+	case strings.HasPrefix(first, "["), strings.EqualFold(first, "then"):
+		var n *GanttTaskNode
+		if n, err = parseGanttTask(w); n != nil {
+			n.SourceRange = r
+			node = *n
+		}
+	case strings.EqualFold(first, "project"):
+		var n *GanttProjectNode
+		if n, err = parseGanttProject(w); n != nil {
+			n.SourceRange = r
+			node = *n
+		}
+	default:
+		var n *GanttCalendarNode
+		if n, err = parseGanttCalendar(w); n != nil {
+			n.SourceRange = r
+			node = *n
+		}
+	}
+
+	if err == nil && w.peek() != "" {
+		err = fmt.Errorf("unexpected %q", w.peek())
+	}
+
+	if err != nil {
+		return nil, s.rerr(fmt.Errorf("parseGanttNode: %w", err))
+	}
+
+	return node, nil
+}
+
+func parseGanttTask(w *ganttWords) (*GanttTaskNode, error) {
+	var node GanttTaskNode
+
+	node.Then = w.is("then")
+
+	m := ganttTaskPattern.FindStringSubmatch(w.next())
+	if m == nil {
+		return nil, fmt.Errorf("expected task name")
+	}
+	node.Name = m[1]
+
+	if w.is("as") {
+		if m = ganttTaskPattern.FindStringSubmatch(w.next()); m == nil {
+			return nil, fmt.Errorf("expected task alias")
+		}
+		node.Alias = m[1]
+	}
+
+	if w.is("on") {
+		for strings.HasPrefix(w.peek(), "{") {
+			m := ganttResourcePattern.FindStringSubmatch(w.next())
+			if m == nil {
+				return nil, fmt.Errorf("expected resource like {Alice} or {Alice:50%%}")
+			}
+
+			r := GanttResource{Name: strings.TrimSpace(m[1])}
+			if m[2] != "" {
+				r.Percent, _ = strconv.Atoi(m[2])
+			}
+
+			node.Resources = append(node.Resources, r)
+		}
+
+		if len(node.Resources) == 0 {
+			return nil, fmt.Errorf("expected resource after `on'")
+		}
+	}
+
+	for {
+		c, err := parseGanttClause(w)
+		if err != nil {
+			return nil, err
+		}
+
+		node.Clauses = append(node.Clauses, *c)
+
+		if !w.is("and") {
+			break
+		}
+	}
+
+	return &node, nil
+}
+
+func parseGanttClause(w *ganttWords) (*GanttClause, error) {
+	var c GanttClause
+
+	switch verb := strings.ToLower(w.next()); verb {
+	case "lasts", "requires":
+		c.Kind = GanttLasts
+
+		n, err := w.number()
+		if err != nil {
+			return nil, err
+		}
+		c.Amount = n
+
+		switch {
+		case w.is("day", "days"):
+			c.Unit = "day"
+		case w.is("week", "weeks"):
+			c.Unit = "week"
+		default:
+			return nil, fmt.Errorf("expected `days' or `weeks' but got %q", w.peek())
+		}
+	case "starts", "ends", "happens":
+		c.Kind = GanttClauseKind(verb)
+
+		w.is("at", "on")
+
+		if ganttDatePattern.MatchString(w.peek()) {
+			c.Date = w.next()
+			break
+		}
+
+		if _, err := strconv.Atoi(w.peek()); err == nil {
+			n, _ := w.number()
+			if err := w.expect("day", "days"); err != nil {
+				return nil, err
+			}
+
+			switch {
+			case w.is("after"):
+				c.Offset = n
+			case w.is("before"):
+				c.Offset = -n
+			default:
+				return nil, fmt.Errorf("expected `after' or `before' but got %q", w.peek())
+			}
+		}
+
+		m := ganttAnchorPattern.FindStringSubmatch(w.next())
+		if m == nil {
+			return nil, fmt.Errorf("expected a date or something like [Task]'s end")
+		}
+		c.Task = m[1]
+
+		switch {
+		case w.is("start"):
+			c.Anchor = "start"
+		case w.is("end"):
+			c.Anchor = "end"
+		default:
+			return nil, fmt.Errorf("expected `start' or `end' but got %q", w.peek())
+		}
+	case "is":
+		if m := ganttPercentPattern.FindStringSubmatch(w.peek()); m != nil {
+			w.next()
+
+			c.Kind = GanttCompleted
+			c.Percent, _ = strconv.Atoi(m[1])
+
+			if err := w.expect("completed", "complete"); err != nil {
+				return nil, err
+			}
+
+			break
+		}
+
+		if err := w.expect("colored", "coloured"); err != nil {
+			return nil, err
+		}
+		if err := w.expect("in"); err != nil {
+			return nil, err
+		}
+
+		c.Kind = GanttColoured
+		if c.Colour = w.next(); c.Colour == "" {
+			return nil, fmt.Errorf("expected colour")
+		}
+	default:
+		return nil, fmt.Errorf("expected `lasts', `starts', `ends', `happens' or `is' but got %q", verb)
+	}
+
+	return &c, nil
+}
+
+func parseGanttProject(w *ganttWords) (*GanttProjectNode, error) {
+	var node GanttProjectNode
+
+	w.next()
+
+	if err := w.expect("starts"); err != nil {
+		return nil, err
+	}
+
+	w.is("at", "on", "the")
+
+	d, err := w.date()
+	if err != nil {
+		return nil, err
+	}
+	node.Start = d
+
+	return &node, nil
+}
+
+func parseGanttCalendar(w *ganttWords) (*GanttCalendarNode, error) {
+	var node GanttCalendarNode
+
+	if ganttDatePattern.MatchString(w.peek()) {
+		node.From = w.next()
+		node.To = node.From
+
+		if w.is("to") {
+			d, err := w.date()
+			if err != nil {
+				return nil, err
+			}
+			node.To = d
+		}
+	} else {
+		day := strings.ToLower(w.next())
+		for _, d := range ganttWeekdays {
+			if d == day {
+				node.Day = d
+			}
+		}
+
+		if node.Day == "" {
+			return nil, fmt.Errorf("unhandled line starting with %q", day)
+		}
+	}
+
+	if err := w.expect("is", "are"); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case w.is("closed"):
+		node.Closed = true
+	case w.is("open", "opened"):
+	default:
+		return nil, fmt.Errorf("expected `closed' or `open' but got %q", w.peek())
+	}
+
+	return &node, nil
+}
@@ -17,6 +17,10 @@ type Indenter interface {
 	Outdent()
 }
 
+// IndentWriter indents what's written through it by following the braces in
+// it. The formatter doesn't use it any more, since it writes through a
+// formatWriter that's told when to indent, but it's kept for code outside
+// this package that does.
 type IndentWriter struct {
 	io.Writer
 	state  indentWriterState
@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"sort"
+)
+
+// LineIndex maps between byte offsets and line and column numbers without
+// having to scan the source each time.
+type LineIndex struct {
+	// starts holds the offset of the first byte of each line.
+	starts []int
+}
+
+// NewLineIndex finds where each line of d starts.
+func NewLineIndex(d []byte) *LineIndex {
+	x := &LineIndex{starts: []int{0}}
+
+	for i, b := range d {
+		if b == '\n' {
+			x.starts = append(x.starts, i+1)
+		}
+	}
+
+	return x
+}
+
+// Position gives the line and column for an offset, counting from 1, the
+// same way GetLineAndColumnForOffset does.
+func (x *LineIndex) Position(p int) SourcePosition {
+	// the line is the last one that starts at or before p; a newline belongs
+	// to the line it ends.
+	l := sort.Search(len(x.starts), func(i int) bool { return x.starts[i] > p }) - 1
+	if l < 0 {
+		l = 0
+	}
+
+	return SourcePosition{Offset: p, Line: l + 1, Column: p - x.starts[l] + 1}
+}
+
+// Offset gives the offset for a line and column, counting from 1.
+func (x *LineIndex) Offset(line, column int) int {
+	if line < 1 {
+		return column - 1
+	}
+
+	if line > len(x.starts) {
+		line = len(x.starts)
+	}
+
+	return x.starts[line-1] + column - 1
+}
+
+// Lines is the number of lines in the source.
+func (x *LineIndex) Lines() int {
+	return len(x.starts)
+}
+
+// Update changes the index to match the source after an edit, looking only at
+// the new text. Lines before the edit stay as they are, and the ones after it
+// are moved by the bytes and lines that the edit added or took away.
+func (x *LineIndex) Update(edit TextEdit) {
+	delta := len(edit.Text) - (edit.End - edit.Start)
+
+	// a line starts inside the replaced text if the newline before it was
+	// part of it.
+	lo := sort.Search(len(x.starts), func(i int) bool { return x.starts[i] > edit.Start })
+	hi := sort.Search(len(x.starts), func(i int) bool { return x.starts[i] > edit.End })
+
+	var added []int
+	for i := 0; i < len(edit.Text); i++ {
+		if edit.Text[i] == '\n' {
+			added = append(added, edit.Start+i+1)
+		}
+	}
+
+	starts := make([]int, 0, lo+len(added)+len(x.starts)-hi)
+	starts = append(starts, x.starts[:lo]...)
+	starts = append(starts, added...)
+	for _, p := range x.starts[hi:] {
+		starts = append(starts, p+delta)
+	}
+
+	x.starts = starts
+}
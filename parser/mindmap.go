@@ -0,0 +1,239 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// branchPattern matches the start of a line of a mind map or work breakdown
+// structure: the depth markers, then any colour, `_`, `<` or `>`.
+var branchPattern = regexp.MustCompile(`^([*+\-#]+)((?:\[#[^\]\n]*\]|[_<>])*)`)
+
+var branchSuffixPattern = regexp.MustCompile(`\[#[^\]]*\]|.`)
+
+// branchDepth finds out whether d starts with a branch, and how deep it is.
+// The markers all have to be the same, and be followed by a space, a box or
+// the end of the line.
+func branchDepth(d []byte) (int, bool) {
+	m := branchPattern.FindSubmatch(d)
+	if m == nil {
+		return 0, false
+	}
+
+	if strings.Trim(string(m[1]), string(m[1][:1])) != "" {
+		return 0, false
+	}
+
+	if len(d) > len(m[0]) {
+		switch d[len(m[0])] {
+		case ' ', '\t', '\r', '\n', ':':
+		default:
+			return 0, false
+		}
+	}
+
+	return len(m[1]), true
+}
+
+// isSide reports whether the line at the scanner's position is `left side`
+// or `right side`.
+func isSide(s *scanner) (string, bool) {
+	s.savePos()
+	defer s.restorePos()
+
+	sideToken := getToken(s, nil)
+	if !isKeyword(sideToken, "left") && !isKeyword(sideToken, "right") {
+		return "", false
+	}
+
+	if !isKeyword(getToken(s, nil), "side") {
+		return "", false
+	}
+
+	if endToken := getToken(s, nil); endToken != nil && endToken.typ != tokenTypeLineEnd {
+		return "", false
+	}
+
+	return strings.ToLower(sideToken.str), true
+}
+
+// parseTreeNode parses a top level line of a mind map or work breakdown
+// structure, if it's a branch or a side. Anything else is parsed like any
+// other diagram, so that things like styles still work.
+func parseTreeNode(s *scanner, tk *token) (Node, bool, error) {
+	s.moveTo(tk)
+
+	if _, ok := branchDepth(s.d[s.p:]); ok {
+		branchNode, err := parseBranchNode(s, "")
+		if err != nil {
+			return nil, true, err
+		}
+
+		return *branchNode, true, nil
+	}
+
+	if _, ok := isSide(s); ok {
+		sideNode, err := parseSideNode(s)
+		if err != nil {
+			return nil, true, err
+		}
+
+		return *sideNode, true, nil
+	}
+
+	return nil, false, nil
+}
+
+func parseSideNode(s *scanner) (*SideNode, error) {
+	s.savePos()
+
+	var node SideNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	sideToken := getToken(s, nil)
+	if !isKeyword(sideToken, "left") && !isKeyword(sideToken, "right") {
+		return nil, s.rerr(fmt.Errorf("parseSideNode: expected `left' or `right'"))
+	}
+	s.trackTokenRange(sideToken)
+	node.Side = strings.ToLower(sideToken.str)
+
+	if tk := getToken(s, nil); !isKeyword(tk, "side") {
+		return nil, s.rerr(fmt.Errorf("parseSideNode: expected `side'"))
+	} else {
+		s.trackTokenRange(tk)
+	}
+
+	return &node, nil
+}
+
+// parseBranchNode parses a branch and everything under it. side is the side
+// of its parent, which it's on too unless it says otherwise.
+func parseBranchNode(s *scanner, side string) (*BranchNode, error) {
+	s.savePos()
+
+	var node BranchNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	p := s.pos()
+
+	depth, ok := branchDepth(s.d[p:])
+	if !ok {
+		return nil, s.rerr(fmt.Errorf("parseBranchNode: expected depth markers like `**'"))
+	}
+
+	m := branchPattern.FindSubmatch(s.d[p:])
+	s.move(len(m[0]))
+
+	node.Depth = depth
+	node.Marker = string(m[1][:1])
+
+	for _, a := range branchSuffixPattern.FindAllString(string(m[2]), -1) {
+		switch a {
+		case "_":
+			node.Boxless = true
+		case "<", ">":
+			node.Direction = a
+		default:
+			node.Colour = a[2 : len(a)-1]
+		}
+	}
+
+	switch {
+	case node.Marker == "+", node.Direction == ">":
+		node.Side = "right"
+	case node.Marker == "-", node.Direction == "<":
+		node.Side = "left"
+	default:
+		node.Side = side
+	}
+
+	s.ws()
+
+	if !s.eof() && s.peek() == ':' {
+		s.move(1)
+
+		content, _ := readToTerminator(s, ';', true)
+		if s.d[s.p-1] != ';' {
+			return nil, s.rerr(fmt.Errorf("parseBranchNode: unexpected eof; expected `;' to close the box"))
+		}
+
+		node.Multiline = true
+		node.Text = content
+
+		s.trackRange(s.sr([2]int{p, s.p - 1}))
+	} else {
+		q := s.pos()
+
+		text, _ := readToTerminator(s, '\n', false)
+		text = strings.TrimRight(text, " \t\r")
+
+		node.Text = text
+
+		if text != "" {
+			s.trackRange(s.sr([2]int{p, q + len(text) - 1}))
+		} else {
+			s.trackRange(s.sr([2]int{p, p + len(m[0]) - 1}))
+		}
+	}
+
+	childSide := node.Side
+
+	for !s.eof() {
+		s.savePos()
+		s.wsnl()
+
+		if s.eof() {
+			s.restorePos()
+			break
+		}
+
+		if s.peek() == '\'' {
+			s.discardPos()
+			readToTerminator(s, '\n', false)
+			continue
+		}
+
+		if d, ok := branchDepth(s.d[s.p:]); ok && d > node.Depth {
+			s.discardPos()
+
+			child, err := parseBranchNode(s, childSide)
+			if err != nil {
+				return nil, err
+			}
+
+			node.Children = append(node.Children, *child)
+
+			continue
+		}
+
+		// sides are about the branches of the root, so they go to the
+		// root however deep the branch before them is.
+		if side, ok := isSide(s); ok && node.Depth == 1 {
+			s.discardPos()
+
+			sideNode, err := parseSideNode(s)
+			if err != nil {
+				return nil, err
+			}
+
+			node.Children = append(node.Children, *sideNode)
+			childSide = side
+
+			continue
+		}
+
+		s.restorePos()
+		break
+	}
+
+	return &node, nil
+}
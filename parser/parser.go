@@ -1,8 +1,12 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
 )
 
 type tokenType int
@@ -114,7 +118,7 @@ func getToken(s *scanner, opts *options) *token {
 				d = append(d, c)
 			}
 
-			return &token{pos: [2]int{p, p + len(d) - 1}, typ: tokenTypeTrailing, str: string(d)}
+			return &token{pos: [2]int{p, s.p - 1}, typ: tokenTypeTrailing, str: string(d)}
 		} else {
 			p := s.p
 			s.move(1)
@@ -191,28 +195,289 @@ func parseSkinParamNode(s *scanner) (*SkinParamNode, error) {
 	}()
 
 	termToken := getToken(s, nil)
-	if termToken.str != "skinparam" {
+	if !isKeyword(termToken, "skinparam") {
 		return nil, s.rerr(fmt.Errorf("expected skinparam term token"))
 	}
 	s.trackTokenRange(termToken)
 
+	if err := parseSkinParamEntry(s, &node); err != nil {
+		return nil, s.rerr(fmt.Errorf("parseSkinParamNode: %w", err))
+	}
+
+	return &node, nil
+}
+
+func parseSkinParamEntry(s *scanner, node *SkinParamNode) error {
 	nameToken := getToken(s, nil)
-	if nameToken.typ != tokenTypeTerm {
-		return nil, s.rerr(fmt.Errorf("expected term token"))
+	if nameToken == nil || nameToken.typ != tokenTypeTerm {
+		return fmt.Errorf("expected term token")
+	}
+	s.trackTokenRange(nameToken)
+
+	name := nameToken.str
+
+	isBlock := strings.HasSuffix(name, "{")
+	if isBlock {
+		name = strings.TrimSuffix(name, "{")
+	}
+
+	node.Name, node.Stereotype = SplitStereotype(name)
+
+	if !isBlock {
+		s.ws()
+
+		if !s.eof() && s.peek() == '<' {
+			stereotypeToken := getToken(s, nil)
+			if !isStereotype(stereotypeToken.str) {
+				return fmt.Errorf("expected stereotype; got %q", stereotypeToken.str)
+			}
+			s.trackTokenRange(stereotypeToken)
+			node.Stereotype = stereotypeToken.str
+
+			s.ws()
+		}
+
+		if !s.eof() && s.peek() == '{' {
+			p := s.pos()
+			s.move(1)
+			s.trackRange(s.sr([2]int{p, p}))
+			isBlock = true
+		}
+	}
+
+	if isBlock {
+		return parseSkinParamBlock(s, node)
+	}
+
+	p := s.pos()
+	value, ok := readToTerminator(s, '\n', false)
+	if !ok || strings.TrimSpace(value) == "" {
+		return fmt.Errorf("expected value")
+	}
+	s.trackRange(s.sr([2]int{p, p + len(strings.TrimRight(value, " \t\r")) - 1}))
+
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+		value = value[1 : len(value)-1]
+	}
+	node.Value = value
+
+	return nil
+}
+
+func parseSkinParamBlock(s *scanner, node *SkinParamNode) error {
+	for !s.eof() {
+		s.wsnl()
+
+		tk := getToken(s, nil)
+		if tk == nil {
+			break
+		}
+
+		switch {
+		case tk.typ == tokenTypeLineEnd:
+			continue
+		case tk.str == "}":
+			s.trackTokenRange(tk)
+			return nil
+		default:
+			s.moveTo(tk)
+
+			var childNode SkinParamNode
+
+			s.pushTrackedRange()
+			err := parseSkinParamEntry(s, &childNode)
+			childNode.SetSourceRange(s.popTrackedRange())
+			if err != nil {
+				return err
+			}
+
+			node.Children = append(node.Children, childNode)
+		}
+	}
+
+	return fmt.Errorf("expected closing brace")
+}
+
+func parseThemeNode(s *scanner) (*ThemeNode, error) {
+	s.savePos()
+
+	var node ThemeNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	themeToken := getToken(s, nil)
+	if !isKeyword(themeToken, "!theme") {
+		return nil, s.rerr(fmt.Errorf("parseThemeNode: expected `!theme'"))
+	}
+	s.trackTokenRange(themeToken)
+
+	nameToken := getToken(s, nil)
+	if nameToken == nil || nameToken.typ != tokenTypeTerm {
+		return nil, s.rerr(fmt.Errorf("parseThemeNode: expected term token"))
 	}
 	s.trackTokenRange(nameToken)
 	node.Name = nameToken.str
 
-	valueToken := getToken(s, nil)
-	if valueToken.typ != tokenTypeTerm {
-		return nil, s.rerr(fmt.Errorf("expected term token"))
+	if fromToken := getToken(s, nil); fromToken != nil {
+		if !isKeyword(fromToken, "from") {
+			s.moveTo(fromToken)
+			return &node, nil
+		}
+		s.trackTokenRange(fromToken)
+
+		sourceToken := getToken(s, nil)
+		if sourceToken == nil || sourceToken.typ != tokenTypeTerm {
+			return nil, s.rerr(fmt.Errorf("parseThemeNode: expected term token after `from'"))
+		}
+		s.trackTokenRange(sourceToken)
+		node.From = sourceToken.str
+	}
+
+	return &node, nil
+}
+
+func parseStyleNode(s *scanner) (*StyleNode, error) {
+	s.savePos()
+
+	var node StyleNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	styleToken := getToken(s, nil)
+	if !isKeyword(styleToken, "<style>") {
+		return nil, s.rerr(fmt.Errorf("parseStyleNode: expected `<style>'"))
+	}
+	s.trackTokenRange(styleToken)
+
+	children, err := parseStyleBody(s, true)
+	if err != nil {
+		return nil, s.rerr(fmt.Errorf("parseStyleNode: %w", err))
 	}
-	s.trackTokenRange(valueToken)
-	node.Value = valueToken.str
+	node.Children = children
 
 	return &node, nil
 }
 
+func parseStyleBody(s *scanner, topLevel bool) ([]Node, error) {
+	var children []Node
+
+	for !s.eof() {
+		s.wsnl()
+
+		if s.eof() {
+			break
+		}
+
+		p := s.pos()
+
+		switch s.peek() {
+		case '}':
+			if topLevel {
+				return nil, fmt.Errorf("unexpected closing brace")
+			}
+
+			s.move(1)
+			s.trackRange(s.sr([2]int{p, p}))
+
+			return children, nil
+		case ';':
+			s.move(1)
+			continue
+		}
+
+		if bytes.HasPrefix(s.d[s.p:], []byte("</style>")) {
+			if !topLevel {
+				return nil, fmt.Errorf("expected closing brace before `</style>'")
+			}
+
+			s.move(len("</style>"))
+			s.trackRange(s.sr([2]int{p, s.pos() - 1}))
+
+			return children, nil
+		}
+
+		var d []byte
+		for !s.eof() {
+			c := s.peek()
+			if c == '{' || c == '}' || c == ';' || c == '\n' {
+				break
+			}
+			s.move(1)
+
+			d = append(d, c)
+		}
+
+		text := strings.TrimSpace(string(d))
+
+		if !s.eof() && s.peek() == '{' {
+			s.move(1)
+
+			var ruleNode StyleRuleNode
+			ruleNode.Selector = strings.Join(getWords(text), " ")
+
+			s.pushTrackedRange()
+			s.trackRange(s.sr([2]int{p, s.pos() - 1}))
+			ruleChildren, err := parseStyleBody(s, false)
+			ruleNode.SetSourceRange(s.popTrackedRange())
+			if err != nil {
+				return nil, err
+			}
+			ruleNode.Children = ruleChildren
+
+			children = append(children, ruleNode)
+
+			continue
+		}
+
+		if text == "" {
+			continue
+		}
+
+		var propertyNode StylePropertyNode
+
+		if i := strings.IndexAny(text, " \t"); i != -1 {
+			propertyNode.Name = text[0:i]
+			propertyNode.Value = strings.TrimSpace(text[i:])
+		} else {
+			propertyNode.Name = text
+		}
+
+		r := s.sr([2]int{p, p + len(strings.TrimRight(string(d), " \t\r")) - 1})
+		s.trackRange(r)
+		propertyNode.SetSourceRange(r)
+
+		children = append(children, propertyNode)
+	}
+
+	return nil, fmt.Errorf("expected `</style>'")
+}
+
+// isKeyword compares a token to a keyword, ignoring case like PlantUML does.
+func isKeyword(tk *token, keyword string) bool {
+	return tk != nil && strings.EqualFold(tk.str, keyword)
+}
+
+// arrowPattern matches arrows like `-->`, `.>`, `-up->`, `-UP->`, `-[#red]->`,
+// `-down[#red]->`, `<|--`, `--`, `-`, the lollipop and socket connectors
+// `-()` and `)-`, and crow's feet like `|o--o{`. Directions can be shortened
+// the same way layout.ParseHint reads them.
+var arrowPattern = regexp.MustCompile(`^(<\|?|\*|o|\+|#|\)|\|o|\|\||\}o|\}\|)?[-.]+(\[[^\]]*\][-.]*)?((?i:up|down|left|right|do|le|ri|u|d|l|r)(\[[^\]]*\])?[-.]+)?(\|?>|\*|o|\+|#|\(\)|\(|o\||\|\||o\{|\|\{)?$`)
+
+func isArrow(s string) bool {
+	return arrowPattern.MatchString(s) || chenArrowPattern.MatchString(s)
+}
+
+func isStereotype(s string) bool {
+	return len(s) > 4 && strings.HasPrefix(s, "<<") && strings.HasSuffix(s, ">>")
+}
+
 func parseStateNode(s *scanner) (*StateNode, error) {
 	s.savePos()
 
@@ -224,7 +489,7 @@ func parseStateNode(s *scanner) (*StateNode, error) {
 	}()
 
 	stateToken := getToken(s, nil)
-	if stateToken.str != "state" {
+	if !isKeyword(stateToken, "state") {
 		return nil, s.rerr(fmt.Errorf("expected `state'"))
 	}
 	s.trackTokenRange(stateToken)
@@ -238,9 +503,11 @@ func parseStateNode(s *scanner) (*StateNode, error) {
 	node.Name = nameAndLabelToken.str
 	node.Label = nameAndLabelToken.str
 
+	labelToken := nameAndLabelToken
+
 	asOrBraceOrEndToken := getToken(s, &options{parseTrailing: true})
 
-	if asOrBraceOrEndToken.str == "as" {
+	if isKeyword(asOrBraceOrEndToken, "as") {
 		s.trackTokenRange(asOrBraceOrEndToken)
 
 		nameToken := getToken(s, nil)
@@ -251,18 +518,35 @@ func parseStateNode(s *scanner) (*StateNode, error) {
 
 		node.Name = nameToken.str
 
-		if stereotypeToken := getToken(s, &options{parseTrailing: true}); stereotypeToken.str == "<<sdlreceive>>" {
-			s.trackTokenRange(stereotypeToken)
-			node.Stereotype = stereotypeToken.str
-			asOrBraceOrEndToken = getToken(s, &options{parseTrailing: true})
-		} else {
-			asOrBraceOrEndToken = stereotypeToken
+		// `state Name as "Label"` is the same as `state "Label" as Name`.
+		if s.d[nameToken.pos[0]] == '"' && s.d[nameAndLabelToken.pos[0]] != '"' {
+			node.Name, node.Label = nameAndLabelToken.str, nameToken.str
+			labelToken = nameToken
 		}
+
+		asOrBraceOrEndToken = getToken(s, &options{parseTrailing: true})
+	}
+
+	labelStart := labelToken.pos[0]
+	if s.d[labelStart] == '"' {
+		labelStart++
+	}
+	node.Links = findLinks(s, node.Label, labelStart)
+
+	if asOrBraceOrEndToken != nil && isStereotype(asOrBraceOrEndToken.str) {
+		s.trackTokenRange(asOrBraceOrEndToken)
+		node.Stereotype = asOrBraceOrEndToken.str
+		asOrBraceOrEndToken = getToken(s, &options{parseTrailing: true})
+	}
+
+	if asOrBraceOrEndToken == nil {
+		return nil, s.rerr(fmt.Errorf("unexpected eof"))
 	}
 
 	if asOrBraceOrEndToken.typ == tokenTypeTrailing {
 		s.trackTokenRange(asOrBraceOrEndToken)
 		node.Text = asOrBraceOrEndToken.str
+		node.Links = append(node.Links, findLinks(s, node.Text, trailingStart(asOrBraceOrEndToken))...)
 		asOrBraceOrEndToken = getToken(s, nil)
 	}
 
@@ -271,85 +555,912 @@ func parseStateNode(s *scanner) (*StateNode, error) {
 		return &node, nil
 	}
 
-	if asOrBraceOrEndToken.str != "{" {
-		return nil, s.rerr(fmt.Errorf("expected line end or opening brace"))
-	}
+	if asOrBraceOrEndToken.str != "{" {
+		return nil, s.rerr(fmt.Errorf("expected line end or opening brace"))
+	}
+
+	for !s.eof() {
+		s.wsnl()
+
+		tk := getToken(s, nil)
+		if tk == nil {
+			break
+		}
+
+		switch {
+		case tk.str == "}":
+			s.trackTokenRange(tk)
+			return &node, nil
+		case tk.str == "---":
+			s.trackTokenRange(tk)
+			node.Children = append(node.Children, SeparatorNode{})
+		case isKeyword(tk, "state"):
+			s.moveTo(tk)
+
+			stateNode, err := parseStateNode(s)
+			if err != nil {
+				return nil, s.rerr(fmt.Errorf("parseStateNode: %w", err))
+			}
+
+			if stateNode != nil {
+				node.Children = append(node.Children, *stateNode)
+			}
+		default:
+			return nil, s.rerr(fmt.Errorf("parseStateNode: unhandled token typ=%s", tk.typ))
+		}
+	}
+
+	return &node, nil
+}
+
+// getEndpoint gets one end of an edge, which can be an actor written as
+// `:Name:`, a use case written as `(Name)`, a component written as `[Name]`
+// or an interface written as `() Name`, as well as a plain term. Those have
+// to be closed on the same line, otherwise nil is returned. `[*]` and `(*)`
+// are left as plain terms, since they're the start and end of state and
+// activity diagrams.
+func getEndpoint(s *scanner) (*token, EndpointKind) {
+	s.ws()
+
+	if s.eof() {
+		return nil, EndpointName
+	}
+
+	var kind EndpointKind
+	var end byte
+
+	switch s.peek() {
+	case ':':
+		kind, end = EndpointActor, ':'
+	case '(':
+		kind, end = EndpointUseCase, ')'
+	case '[':
+		kind, end = EndpointComponent, ']'
+	default:
+		return getToken(s, nil), EndpointName
+	}
+
+	p := s.p
+
+	if bytes.HasPrefix(s.d[p:], []byte("()")) {
+		s.move(2)
+
+		name := getToken(s, nil)
+		if name == nil || name.typ != tokenTypeTerm {
+			return nil, EndpointInterface
+		}
+
+		return &token{pos: [2]int{p, name.pos[1]}, typ: tokenTypeTerm, str: name.str}, EndpointInterface
+	}
+
+	if bytes.HasPrefix(s.d[p+1:], []byte{'*', end}) {
+		return getToken(s, nil), EndpointName
+	}
+
+	i := bytes.IndexAny(s.d[p+1:], string([]byte{end, '\n'}))
+	if i == -1 || s.d[p+1+i] != end || i == 0 {
+		return nil, kind
+	}
+
+	s.p = p + i + 2
+
+	return &token{pos: [2]int{p, p + i + 1}, typ: tokenTypeTerm, str: strings.TrimSpace(string(s.d[p+1 : p+1+i]))}, kind
+}
+
+func parseEdgeNode(s *scanner) (*EdgeNode, error) {
+	s.savePos()
+
+	var node EdgeNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	leftToken, leftKind := getEndpoint(s)
+	if leftToken == nil || leftToken.typ != tokenTypeTerm {
+		return nil, s.rerr(fmt.Errorf("expected term token"))
+	}
+	s.trackTokenRange(leftToken)
+	node.Left = leftToken.str
+	node.LeftKind = leftKind
+
+	arrowToken := getToken(s, nil)
+	if arrowToken == nil || arrowToken.typ != tokenTypeTerm {
+		return nil, s.rerr(fmt.Errorf("expected term token"))
+	}
+	if !isArrow(arrowToken.str) {
+		return nil, s.rerr(fmt.Errorf("expected second term to be an arrow"))
+	}
+	s.trackTokenRange(arrowToken)
+	node.Direction = arrowToken.str
+
+	rightToken, rightKind := getEndpoint(s)
+	if rightToken == nil || rightToken.typ != tokenTypeTerm {
+		return nil, s.rerr(fmt.Errorf("expected term token"))
+	}
+	s.trackTokenRange(rightToken)
+	node.Right = rightToken.str
+	node.RightKind = rightKind
+
+	if trailingToken := getToken(s, &options{parseTrailing: true}); trailingToken != nil {
+		if trailingToken.typ != tokenTypeTrailing {
+			s.moveTo(trailingToken)
+		} else {
+			s.trackTokenRange(trailingToken)
+			node.Text = trailingToken.str
+			node.Links = findLinks(s, node.Text, trailingStart(trailingToken))
+		}
+	}
+
+	return &node, nil
+}
+
+// declaration is what's common to declaring actors, use cases and rectangles.
+type declaration struct {
+	name       string
+	label      string
+	stereotype string
+	block      bool
+	// with is the terms after `with`, which only clocks have.
+	with []*token
+}
+
+// parseDeclaration parses `keyword Name`, `keyword "Label" as Name` or
+// `keyword Name as "Label"`, then an optional stereotype, and then either the
+// end of the line or an opening brace. If shorthand isn't EndpointName, the
+// keyword can be left off when the first name is written that way, as in
+// `:Label: as Name`.
+func parseDeclaration(s *scanner, keyword string, shorthand EndpointKind) (*declaration, error) {
+	var d declaration
+
+	first, kind := getEndpoint(s)
+	if first == nil {
+		return nil, fmt.Errorf("expected `%s'", keyword)
+	}
+
+	if kind == EndpointName || kind != shorthand {
+		if !isKeyword(first, keyword) {
+			return nil, fmt.Errorf("expected `%s'", keyword)
+		}
+		s.trackTokenRange(first)
+
+		if first, kind = getEndpoint(s); first == nil || first.typ != tokenTypeTerm {
+			return nil, fmt.Errorf("expected name")
+		}
+
+		// containers like `cloud {` don't need a name.
+		if first.str == "{" && kind == EndpointName && s.d[first.pos[0]] != '"' {
+			s.trackTokenRange(first)
+			d.block = true
+			return &d, nil
+		}
+	}
+	s.trackTokenRange(first)
+
+	d.name = first.str
+	d.label = first.str
+
+	// a name is a label if it's quoted, or written as `:Label:` or `(Label)`.
+	isLabel := func(tk *token, kind EndpointKind) bool {
+		return kind != EndpointName || s.d[tk.pos[0]] == '"'
+	}
+
+	next := getToken(s, nil)
+
+	if isKeyword(next, "as") {
+		s.trackTokenRange(next)
+
+		second, secondKind := getEndpoint(s)
+		if second == nil || second.typ != tokenTypeTerm {
+			return nil, fmt.Errorf("expected name")
+		}
+		s.trackTokenRange(second)
+
+		d.name = second.str
+
+		if isLabel(second, secondKind) && !isLabel(first, kind) {
+			d.name, d.label = first.str, second.str
+		}
+
+		next = getToken(s, nil)
+	}
+
+	if next != nil && isStereotype(next.str) {
+		s.trackTokenRange(next)
+		d.stereotype = next.str
+		next = getToken(s, nil)
+	}
+
+	if keyword == "clock" && isKeyword(next, "with") {
+		s.trackTokenRange(next)
+
+		for next = getToken(s, nil); next != nil && next.typ == tokenTypeTerm; next = getToken(s, nil) {
+			s.trackTokenRange(next)
+			d.with = append(d.with, next)
+		}
+	}
+
+	switch {
+	case next == nil, next.typ == tokenTypeLineEnd:
+	case next.str == "{":
+		s.trackTokenRange(next)
+		d.block = true
+	default:
+		return nil, fmt.Errorf("unexpected token %s", next)
+	}
+
+	return &d, nil
+}
+
+func parseActorNode(s *scanner) (*ActorNode, error) {
+	s.savePos()
+
+	var node ActorNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	d, err := parseDeclaration(s, "actor", EndpointActor)
+	if err != nil {
+		return nil, s.rerr(fmt.Errorf("parseActorNode: %w", err))
+	}
+	if d.block {
+		return nil, s.rerr(fmt.Errorf("parseActorNode: actors can't have a body"))
+	}
+
+	node.Name, node.Label, node.Stereotype = d.name, d.label, d.stereotype
+
+	return &node, nil
+}
+
+func parseUseCaseNode(s *scanner) (*UseCaseNode, error) {
+	s.savePos()
+
+	var node UseCaseNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	d, err := parseDeclaration(s, "usecase", EndpointUseCase)
+	if err != nil {
+		return nil, s.rerr(fmt.Errorf("parseUseCaseNode: %w", err))
+	}
+	if d.block {
+		return nil, s.rerr(fmt.Errorf("parseUseCaseNode: use cases can't have a body"))
+	}
+
+	node.Name, node.Label, node.Stereotype = d.name, d.label, d.stereotype
+
+	return &node, nil
+}
+
+func parseRectangleNode(s *scanner) (*RectangleNode, error) {
+	s.savePos()
+
+	var node RectangleNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	d, err := parseDeclaration(s, "rectangle", EndpointName)
+	if err != nil {
+		return nil, s.rerr(fmt.Errorf("parseRectangleNode: %w", err))
+	}
+
+	node.Name, node.Label, node.Stereotype = d.name, d.label, d.stereotype
+
+	if d.block {
+		if node.Children, err = parseBody(s); err != nil {
+			return nil, s.rerr(fmt.Errorf("parseRectangleNode: %w", err))
+		}
+	}
+
+	return &node, nil
+}
+
+func parseComponentNode(s *scanner) (*ComponentNode, error) {
+	s.savePos()
+
+	var node ComponentNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	d, err := parseDeclaration(s, "component", EndpointComponent)
+	if err != nil {
+		return nil, s.rerr(fmt.Errorf("parseComponentNode: %w", err))
+	}
+
+	node.Name, node.Label, node.Stereotype = d.name, d.label, d.stereotype
+
+	if d.block {
+		if node.Children, err = parseBody(s); err != nil {
+			return nil, s.rerr(fmt.Errorf("parseComponentNode: %w", err))
+		}
+	}
+
+	return &node, nil
+}
+
+func parseInterfaceNode(s *scanner) (*InterfaceNode, error) {
+	s.savePos()
+
+	var node InterfaceNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	d, err := parseDeclaration(s, "interface", EndpointInterface)
+	if err != nil {
+		return nil, s.rerr(fmt.Errorf("parseInterfaceNode: %w", err))
+	}
+	if d.block {
+		return nil, s.rerr(fmt.Errorf("parseInterfaceNode: interfaces can't have a body"))
+	}
+
+	node.Name, node.Label, node.Stereotype = d.name, d.label, d.stereotype
+
+	return &node, nil
+}
+
+func parsePortNode(s *scanner, keyword string) (*PortNode, error) {
+	s.savePos()
+
+	var node PortNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	d, err := parseDeclaration(s, keyword, EndpointName)
+	if err != nil {
+		return nil, s.rerr(fmt.Errorf("parsePortNode: %w", err))
+	}
+	if d.block {
+		return nil, s.rerr(fmt.Errorf("parsePortNode: ports can't have a body"))
+	}
+
+	node.Direction = strings.TrimPrefix(strings.ToLower(keyword), "port")
+	node.Name, node.Label, node.Stereotype = d.name, d.label, d.stereotype
+
+	return &node, nil
+}
+
+func isContainerKind(tk *token) bool {
+	for _, k := range ContainerKinds {
+		if isKeyword(tk, k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseContainerNode(s *scanner, keyword string) (*ContainerNode, error) {
+	s.savePos()
+
+	var node ContainerNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	d, err := parseDeclaration(s, keyword, EndpointName)
+	if err != nil {
+		return nil, s.rerr(fmt.Errorf("parseContainerNode: %w", err))
+	}
+
+	node.Kind = strings.ToLower(keyword)
+	node.Name, node.Label, node.Stereotype = d.name, d.label, d.stereotype
+
+	if d.block {
+		if node.Children, err = parseBody(s); err != nil {
+			return nil, s.rerr(fmt.Errorf("parseContainerNode: %w", err))
+		}
+	}
+
+	return &node, nil
+}
+
+func parseObjectNode(s *scanner) (*ObjectNode, error) {
+	s.savePos()
+
+	var node ObjectNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	d, err := parseDeclaration(s, "object", EndpointName)
+	if err != nil {
+		return nil, s.rerr(fmt.Errorf("parseObjectNode: %w", err))
+	}
+
+	node.Name, node.Label, node.Stereotype = d.name, d.label, d.stereotype
+
+	if !d.block {
+		return &node, nil
+	}
+
+	if err := parseLines(s, func(line string, r SourceRange) error {
+		field := FieldNode{BaseNode: BaseNode{SourceRange: r}, Name: line}
+
+		if i := strings.Index(line, "="); i != -1 {
+			field.Name = strings.TrimSpace(line[:i])
+			field.Value = strings.TrimSpace(line[i+1:])
+		}
+
+		node.Fields = append(node.Fields, field)
+
+		return nil
+	}); err != nil {
+		return nil, s.rerr(fmt.Errorf("parseObjectNode: %w", err))
+	}
+
+	return &node, nil
+}
+
+var mapLinkPattern = regexp.MustCompile(`^(.*?)\s*\*-+>\s*(.*)$`)
+
+func parseMapNode(s *scanner) (*MapNode, error) {
+	s.savePos()
+
+	var node MapNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	d, err := parseDeclaration(s, "map", EndpointName)
+	if err != nil {
+		return nil, s.rerr(fmt.Errorf("parseMapNode: %w", err))
+	}
+
+	node.Name, node.Label, node.Stereotype = d.name, d.label, d.stereotype
+
+	if !d.block {
+		return &node, nil
+	}
+
+	if err := parseLines(s, func(line string, r SourceRange) error {
+		entry := MapEntryNode{BaseNode: BaseNode{SourceRange: r}}
+
+		if m := mapLinkPattern.FindStringSubmatch(line); m != nil {
+			entry.Key, entry.Link = m[1], m[2]
+		} else if i := strings.Index(line, "=>"); i != -1 {
+			entry.Key = strings.TrimSpace(line[:i])
+			entry.Value = strings.TrimSpace(line[i+2:])
+		} else {
+			return fmt.Errorf("expected `=>' or `*->' in map entry %q", line)
+		}
+
+		node.Entries = append(node.Entries, entry)
+
+		return nil
+	}); err != nil {
+		return nil, s.rerr(fmt.Errorf("parseMapNode: %w", err))
+	}
+
+	return &node, nil
+}
+
+func isTimingKind(tk *token) bool {
+	for _, k := range TimingKinds {
+		if isKeyword(tk, k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseTimingParticipantNode(s *scanner, keyword string) (*TimingParticipantNode, error) {
+	s.savePos()
+
+	var node TimingParticipantNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	node.Kind = strings.ToLower(keyword)
+
+	d, err := parseDeclaration(s, node.Kind, EndpointName)
+	if err != nil {
+		return nil, s.rerr(fmt.Errorf("parseTimingParticipantNode: %w", err))
+	}
+	if d.block {
+		return nil, s.rerr(fmt.Errorf("parseTimingParticipantNode: participants can't have a body"))
+	}
+
+	node.Name, node.Label, node.Stereotype = d.name, d.label, d.stereotype
+
+	if len(d.with)%2 != 0 {
+		return nil, s.rerr(fmt.Errorf("parseTimingParticipantNode: expected a number after %q", d.with[len(d.with)-1].str))
+	}
+
+	for i := 0; i < len(d.with); i += 2 {
+		v, err := strconv.Atoi(d.with[i+1].str)
+		if err != nil {
+			return nil, s.rerr(fmt.Errorf("parseTimingParticipantNode: expected a number after %q: %w", d.with[i].str, err))
+		}
+
+		switch strings.ToLower(d.with[i].str) {
+		case "period":
+			node.Period = v
+		case "pulse":
+			node.Pulse = v
+		case "offset":
+			node.Offset = v
+		default:
+			return nil, s.rerr(fmt.Errorf("parseTimingParticipantNode: expected period, pulse or offset but got %q", d.with[i].str))
+		}
+	}
+
+	return &node, nil
+}
+
+// isTick reports whether a token starts a time tick, which is `@` followed by
+// a time or a participant name. Constraints start with `@` too, so the token
+// after it has to be checked as well.
+func isTick(tk, next *token) bool {
+	return tk != nil && tk.typ == tokenTypeTerm && len(tk.str) > 1 && tk.str[0] == '@' && !isKeyword(tk, "@enduml") && !isConstraint(tk, next)
+}
+
+func isConstraint(tk, next *token) bool {
+	return tk != nil && strings.Contains(tk.str, "@") && next != nil && next.str == "<->"
+}
+
+func parseTickNode(s *scanner) (*TickNode, error) {
+	s.savePos()
+
+	var node TickNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	tickToken := getToken(s, nil)
+	if tickToken == nil || len(tickToken.str) < 2 || tickToken.str[0] != '@' {
+		return nil, s.rerr(fmt.Errorf("parseTickNode: expected time tick"))
+	}
+	s.trackTokenRange(tickToken)
+
+	if r := []rune(tickToken.str[1:]); unicode.IsLetter(r[0]) || r[0] == '_' {
+		node.Participant = tickToken.str[1:]
+	} else {
+		node.Time = tickToken.str[1:]
+	}
+
+	for !s.eof() {
+		s.wsnl()
+
+		tk := getToken(s, nil)
+		if tk == nil {
+			break
+		}
+
+		s.savePos()
+		next := getToken(s, nil)
+		s.restorePos()
+
+		// the tick goes until the next one, or the end of the document.
+		if isTick(tk, next) || isEnd(s, tk) {
+			s.moveTo(tk)
+			break
+		}
+
+		var child Node
+		var err error
+
+		if node.Participant != "" && isKeyword(next, "is") {
+			s.moveTo(tk)
+
+			var stateChangeNode *StateChangeNode
+			if stateChangeNode, err = parseStateChangeNode(s, node.Participant); stateChangeNode != nil {
+				child = *stateChangeNode
+			}
+		} else {
+			child, err = parseNode(s, tk)
+		}
+
+		if err != nil {
+			return nil, s.rerr(fmt.Errorf("parseTickNode: %w", err))
+		}
+
+		if child != nil {
+			node.Children = append(node.Children, child)
+		}
+	}
+
+	return &node, nil
+}
+
+// parseStateChangeNode parses `Participant is State`, or `Time is State` if
+// participant is set because it's in that participant's tick.
+func parseStateChangeNode(s *scanner, participant string) (*StateChangeNode, error) {
+	s.savePos()
+
+	var node StateChangeNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	subjectToken := getToken(s, nil)
+	if subjectToken == nil || subjectToken.typ != tokenTypeTerm {
+		return nil, s.rerr(fmt.Errorf("parseStateChangeNode: expected term token"))
+	}
+	s.trackTokenRange(subjectToken)
+
+	if participant != "" {
+		node.Participant = participant
+		node.Time = subjectToken.str
+	} else {
+		node.Participant = subjectToken.str
+	}
+
+	isToken := getToken(s, nil)
+	if !isKeyword(isToken, "is") {
+		return nil, s.rerr(fmt.Errorf("parseStateChangeNode: expected `is'"))
+	}
+	s.trackTokenRange(isToken)
+
+	stateToken := getToken(s, nil)
+	if stateToken == nil || stateToken.typ != tokenTypeTerm {
+		return nil, s.rerr(fmt.Errorf("parseStateChangeNode: expected state"))
+	}
+	s.trackTokenRange(stateToken)
+	node.State = stateToken.str
+
+	if endToken := getToken(s, nil); endToken != nil && endToken.typ != tokenTypeLineEnd {
+		return nil, s.rerr(fmt.Errorf("parseStateChangeNode: expected line end but got %s", endToken))
+	}
+
+	return &node, nil
+}
+
+var highlightPattern = regexp.MustCompile(`^\s*(?:#(\S+))?\s*(?::\s*(.*?))?\s*$`)
+
+func parseHighlightNode(s *scanner) (*HighlightNode, error) {
+	s.savePos()
+
+	var node HighlightNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	highlightToken := getToken(s, nil)
+	if !isKeyword(highlightToken, "highlight") {
+		return nil, s.rerr(fmt.Errorf("parseHighlightNode: expected `highlight'"))
+	}
+	s.trackTokenRange(highlightToken)
+
+	fromToken := getToken(s, nil)
+	if fromToken == nil || fromToken.typ != tokenTypeTerm {
+		return nil, s.rerr(fmt.Errorf("parseHighlightNode: expected start time"))
+	}
+	s.trackTokenRange(fromToken)
+	node.From = strings.TrimPrefix(fromToken.str, "@")
+
+	toToken := getToken(s, nil)
+	if !isKeyword(toToken, "to") {
+		return nil, s.rerr(fmt.Errorf("parseHighlightNode: expected `to'"))
+	}
+	s.trackTokenRange(toToken)
+
+	if toToken = getToken(s, nil); toToken == nil || toToken.typ != tokenTypeTerm {
+		return nil, s.rerr(fmt.Errorf("parseHighlightNode: expected end time"))
+	}
+	s.trackTokenRange(toToken)
+	node.To = strings.TrimPrefix(toToken.str, "@")
+
+	p := s.pos()
+	rest, _ := readToTerminator(s, '\n', false)
+
+	m := highlightPattern.FindStringSubmatch(rest)
+	if m == nil {
+		return nil, s.rerr(fmt.Errorf("parseHighlightNode: expected colour or caption but got %q", strings.TrimSpace(rest)))
+	}
+	if t := strings.TrimRight(rest, " \t\r"); strings.TrimSpace(t) != "" {
+		s.trackRange(s.sr([2]int{p, p + len(t) - 1}))
+	}
+
+	node.Colour, node.Text = m[1], m[2]
+
+	return &node, nil
+}
+
+func parseConstraintNode(s *scanner) (*ConstraintNode, error) {
+	s.savePos()
+
+	var node ConstraintNode
+
+	s.pushTrackedRange()
+	defer func() {
+		node.SetSourceRange(s.popTrackedRange())
+	}()
+
+	fromToken := getToken(s, nil)
+	if fromToken == nil || fromToken.typ != tokenTypeTerm || !strings.Contains(fromToken.str, "@") {
+		return nil, s.rerr(fmt.Errorf("parseConstraintNode: expected time"))
+	}
+	s.trackTokenRange(fromToken)
+
+	i := strings.Index(fromToken.str, "@")
+	node.Participant, node.From = fromToken.str[:i], fromToken.str[i+1:]
+
+	arrowToken := getToken(s, nil)
+	if arrowToken == nil || arrowToken.str != "<->" {
+		return nil, s.rerr(fmt.Errorf("parseConstraintNode: expected `<->'"))
+	}
+	s.trackTokenRange(arrowToken)
+
+	toToken := getToken(s, nil)
+	if toToken == nil || toToken.typ != tokenTypeTerm || !strings.HasPrefix(toToken.str, "@") {
+		return nil, s.rerr(fmt.Errorf("parseConstraintNode: expected time"))
+	}
+	s.trackTokenRange(toToken)
+	node.To = toToken.str[1:]
+
+	if trailingToken := getToken(s, &options{parseTrailing: true}); trailingToken != nil {
+		if trailingToken.typ != tokenTypeTrailing {
+			s.moveTo(trailingToken)
+		} else {
+			s.trackTokenRange(trailingToken)
+			node.Text = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(trailingToken.str), "{"), "}")
+		}
+	}
+
+	return &node, nil
+}
+
+// parseLines reads the lines of a body that isn't made of nodes, up to a line
+// with just a closing brace, calling fn with each one that isn't blank or a
+// comment, trimmed, along with its range.
+func parseLines(s *scanner, fn func(line string, r SourceRange) error) error {
+	for !s.eof() {
+		s.wsnl()
+		if s.eof() {
+			break
+		}
+
+		p := s.pos()
+		line, _ := readToTerminator(s, '\n', false)
+		line = strings.TrimRight(line, " \t\r")
+
+		if strings.HasPrefix(line, "'") {
+			continue
+		}
+
+		r := s.sr([2]int{p, p + len(line) - 1})
+		s.trackRange(r)
+
+		if line == "}" {
+			return nil
+		}
+
+		if err := fn(line, r); err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("unexpected eof; expected closing brace")
+}
+
+// parseBody parses the nodes inside a declaration's braces, up to and
+// including the closing brace.
+func parseBody(s *scanner) ([]Node, error) {
+	var nodes []Node
 
 	for !s.eof() {
 		s.wsnl()
 
 		tk := getToken(s, nil)
+		if tk == nil {
+			break
+		}
 
-		switch tk.str {
-		case "}":
-			s.trackTokenRange(tk)
-			return &node, nil
-		case "---":
+		if tk.str == "}" {
 			s.trackTokenRange(tk)
-			node.Children = append(node.Children, SeparatorNode{})
-		case "state":
-			s.moveTo(tk)
+			return nodes, nil
+		}
 
-			stateNode, err := parseStateNode(s)
-			if err != nil {
-				return nil, s.rerr(fmt.Errorf("parseStateNode: %w", err))
-			}
+		node, err := parseNode(s, tk)
+		if err != nil {
+			return nil, err
+		}
 
-			if stateNode != nil {
-				node.Children = append(node.Children, *stateNode)
-			}
-		default:
-			return nil, s.rerr(fmt.Errorf("parseStateNode: unhandled token typ=%s", tk.typ))
+		if node != nil {
+			nodes = append(nodes, node)
 		}
 	}
 
-	return &node, nil
+	return nil, fmt.Errorf("unexpected eof; expected closing brace")
 }
 
-func parseEdgeNode(s *scanner) (*EdgeNode, error) {
+func parseDirectionNode(s *scanner) (*DirectionNode, error) {
 	s.savePos()
 
-	var node EdgeNode
+	var node DirectionNode
 
 	s.pushTrackedRange()
 	defer func() {
 		node.SetSourceRange(s.popTrackedRange())
 	}()
 
-	leftToken := getToken(s, nil)
-	if leftToken == nil || leftToken.typ != tokenTypeTerm {
-		return nil, s.rerr(fmt.Errorf("expected term token"))
-	}
-	s.trackTokenRange(leftToken)
-	node.Left = leftToken.str
+	var words []string
+	for {
+		tk := getToken(s, nil)
+		if tk == nil || tk.typ == tokenTypeLineEnd {
+			break
+		}
+		s.trackTokenRange(tk)
 
-	arrowToken := getToken(s, nil)
-	if arrowToken == nil || arrowToken.typ != tokenTypeTerm {
-		return nil, s.rerr(fmt.Errorf("expected term token"))
+		words = append(words, strings.ToLower(tk.str))
 	}
-	if !strings.HasPrefix(arrowToken.str, "-") || !strings.HasSuffix(arrowToken.str, ">") {
-		return nil, s.rerr(fmt.Errorf("expected second term to be an arrow"))
+
+	switch line := strings.Join(words, " "); line {
+	case "left to right direction", "top to bottom direction":
+		node.Direction = strings.TrimSuffix(line, " direction")
+	default:
+		return nil, s.rerr(fmt.Errorf("parseDirectionNode: expected `left to right direction' or `top to bottom direction'"))
 	}
-	s.trackTokenRange(arrowToken)
-	node.Direction = arrowToken.str
 
-	rightToken := getToken(s, nil)
-	if rightToken == nil || rightToken.typ != tokenTypeTerm {
-		return nil, s.rerr(fmt.Errorf("expected term token"))
+	return &node, nil
+}
+
+// trailingStart finds where the text of a trailing token starts, since the
+// token itself starts at the colon.
+func trailingStart(tk *token) int {
+	return tk.pos[1] + 1 - len(tk.str)
+}
+
+var linkPattern = regexp.MustCompile(`\[\[\s*([^\]\s{]*)\s*(?:\{([^}]*)\})?\s*([^\]]*?)\s*\]\]`)
+
+// findLinks finds the links in some text that starts at the given offset in
+// the source.
+func findLinks(s *scanner, text string, start int) []Link {
+	var a []Link
+
+	for _, m := range linkPattern.FindAllStringSubmatchIndex(text, -1) {
+		a = append(a, Link{
+			SourceRange: s.sr([2]int{start + m[0], start + m[1] - 1}),
+			URL:         text[m[2]:m[3]],
+			Tooltip:     submatch(text, m, 2),
+			Label:       submatch(text, m, 3),
+		})
 	}
-	s.trackTokenRange(rightToken)
-	node.Right = rightToken.str
 
-	if trailingToken := getToken(s, &options{parseTrailing: true}); trailingToken != nil {
-		if trailingToken.typ != tokenTypeTrailing {
-			s.moveTo(trailingToken)
-		} else {
-			s.trackTokenRange(trailingToken)
-			node.Text = trailingToken.str
-		}
+	return a
+}
+
+func submatch(s string, m []int, i int) string {
+	if m[i*2] == -1 {
+		return ""
 	}
 
-	return &node, nil
+	return s[m[i*2]:m[i*2+1]]
 }
 
 func getWords(s string) []string {
@@ -382,12 +1493,12 @@ func parseNoteNode(s *scanner) (*NoteNode, error) {
 
 	words := getWords(firstLine)
 
-	if words[0] == "floating" {
+	if strings.EqualFold(words[0], "floating") {
 		node.Floating = true
 		words = words[1:]
 	}
 
-	if words[0] != "note" {
+	if !strings.EqualFold(words[0], "note") {
 		return nil, s.rerr(fmt.Errorf("expected `note'; got %s", words[0]))
 	}
 
@@ -395,6 +1506,8 @@ func parseNoteNode(s *scanner) (*NoteNode, error) {
 		node.Position = words[1]
 	}
 
+	contentStart := s.pos()
+
 	var lines []string
 
 	for {
@@ -403,8 +1516,9 @@ func parseNoteNode(s *scanner) (*NoteNode, error) {
 			break
 		}
 
-		if strings.TrimSpace(line) == "endnote" {
+		if strings.EqualFold(strings.TrimSpace(line), "endnote") {
 			node.Content = strings.Join(lines, "\n")
+			node.Links = findLinks(s, node.Content, contentStart)
 			return &node, nil
 		}
 
@@ -424,7 +1538,7 @@ func parsePartitionNode(s *scanner) (*PartitionNode, error) {
 		node.SetSourceRange(s.popTrackedRange())
 	}()
 
-	if tk := getToken(s, nil); tk == nil || tk.str != "partition" {
+	if tk := getToken(s, nil); !isKeyword(tk, "partition") {
 		return nil, s.rerr(fmt.Errorf("expected `partition'"))
 	}
 
@@ -443,15 +1557,31 @@ func parsePartitionNode(s *scanner) (*PartitionNode, error) {
 		s.wsnl()
 
 		tk := getToken(s, nil)
+		if tk == nil {
+			break
+		}
 
 		switch {
 		case tk.str == "}":
 			return &node, nil
-		case tk.str == "start":
-			node.Children = append(node.Children, StartNode{})
-		case tk.str == "end":
-			node.Children = append(node.Children, EndNode{})
-		case tk.str == "floating", tk.str == "note":
+		case isKeyword(tk, "start"):
+			s.trackTokenRange(tk)
+			node.Children = append(node.Children, StartNode{BaseNode{SourceRange: s.tsr(tk)}})
+		case isKeyword(tk, "end"):
+			s.trackTokenRange(tk)
+			node.Children = append(node.Children, EndNode{BaseNode{SourceRange: s.tsr(tk)}})
+		case isKeyword(tk, "fork"):
+			s.moveTo(tk)
+
+			forkNode, err := parseForkNode(s)
+			if err != nil {
+				return nil, err
+			}
+
+			if forkNode != nil {
+				node.Children = append(node.Children, *forkNode)
+			}
+		case isKeyword(tk, "floating"), isKeyword(tk, "note"):
 			s.moveTo(tk)
 
 			noteNode, err := parseNoteNode(s)
@@ -462,7 +1592,7 @@ func parsePartitionNode(s *scanner) (*PartitionNode, error) {
 			if noteNode != nil {
 				node.Children = append(node.Children, *noteNode)
 			}
-		case tk.str == "partition":
+		case isKeyword(tk, "partition"):
 			s.moveTo(tk)
 
 			partitionNode, err := parsePartitionNode(s)
@@ -473,7 +1603,7 @@ func parsePartitionNode(s *scanner) (*PartitionNode, error) {
 			if partitionNode != nil {
 				node.Children = append(node.Children, *partitionNode)
 			}
-		case tk.str == "if":
+		case isKeyword(tk, "if"):
 			s.moveTo(tk)
 
 			ifNode, err := parseIfNode(s)
@@ -514,7 +1644,7 @@ func parseIfNode(s *scanner) (*IfNode, error) {
 	}()
 
 	ifToken := getToken(s, nil)
-	if ifToken == nil || ifToken.str != "if" {
+	if !isKeyword(ifToken, "if") {
 		return nil, s.rerr(fmt.Errorf("parseIfNode: expected `if'"))
 	}
 	s.trackTokenRange(ifToken)
@@ -530,7 +1660,7 @@ func parseIfNode(s *scanner) (*IfNode, error) {
 	s.ws()
 
 	thenToken := getToken(s, nil)
-	if thenToken == nil || thenToken.str != "then" {
+	if !isKeyword(thenToken, "then") {
 		return nil, s.rerr(fmt.Errorf("parseIfNode: expected `then'"))
 	}
 	s.trackTokenRange(thenToken)
@@ -547,12 +1677,15 @@ func parseIfNode(s *scanner) (*IfNode, error) {
 		s.wsnl()
 
 		tk := getToken(s, nil)
+		if tk == nil {
+			break
+		}
 
 		switch {
-		case tk.str == "endif":
+		case isKeyword(tk, "endif"):
 			s.trackTokenRange(tk)
 			return &node, nil
-		case tk.str == "else":
+		case isKeyword(tk, "else"):
 			s.moveTo(tk)
 
 			elseNode, err := parseElseNode(s)
@@ -560,10 +1693,10 @@ func parseIfNode(s *scanner) (*IfNode, error) {
 				return nil, err
 			}
 			node.Else = *elseNode
-		case tk.str == "end":
+		case isKeyword(tk, "end"):
 			s.trackTokenRange(tk)
-			node.Statements = append(node.Statements, EndNode{})
-		case tk.str == "floating", tk.str == "note":
+			node.Statements = append(node.Statements, EndNode{BaseNode{SourceRange: s.tsr(tk)}})
+		case isKeyword(tk, "floating"), isKeyword(tk, "note"):
 			s.moveTo(tk)
 
 			noteNode, err := parseNoteNode(s)
@@ -574,7 +1707,7 @@ func parseIfNode(s *scanner) (*IfNode, error) {
 			if noteNode != nil {
 				node.Statements = append(node.Statements, *noteNode)
 			}
-		case tk.str == "partition":
+		case isKeyword(tk, "partition"):
 			s.moveTo(tk)
 
 			partitionNode, err := parsePartitionNode(s)
@@ -585,7 +1718,7 @@ func parseIfNode(s *scanner) (*IfNode, error) {
 			if partitionNode != nil {
 				node.Statements = append(node.Statements, *partitionNode)
 			}
-		case tk.str == "if":
+		case isKeyword(tk, "if"):
 			s.moveTo(tk)
 
 			ifNode, err := parseIfNode(s)
@@ -596,7 +1729,7 @@ func parseIfNode(s *scanner) (*IfNode, error) {
 			if ifNode != nil {
 				node.Statements = append(node.Statements, *ifNode)
 			}
-		case tk.str == "fork":
+		case isKeyword(tk, "fork"):
 			s.moveTo(tk)
 
 			forkNode, err := parseForkNode(s)
@@ -637,7 +1770,7 @@ func parseElseNode(s *scanner) (*ElseNode, error) {
 	}()
 
 	elseToken := getToken(s, nil)
-	if elseToken == nil || elseToken.str != "else" {
+	if !isKeyword(elseToken, "else") {
 		return nil, s.rerr(fmt.Errorf("parseElseNode: expected `else'"))
 	}
 	s.trackTokenRange(elseToken)
@@ -645,7 +1778,7 @@ func parseElseNode(s *scanner) (*ElseNode, error) {
 	s.ws()
 
 	if tk := getToken(s, nil); tk != nil {
-		if tk.str == "if" {
+		if isKeyword(tk, "if") {
 			s.ws()
 
 			condition, err := parseParenthesisNode(s)
@@ -657,7 +1790,7 @@ func parseElseNode(s *scanner) (*ElseNode, error) {
 			s.ws()
 
 			thenToken := getToken(s, nil)
-			if thenToken == nil || thenToken.str != "then" {
+			if !isKeyword(thenToken, "then") {
 				return nil, s.rerr(fmt.Errorf("parseElseNode: expected `then'"))
 			}
 			s.trackTokenRange(thenToken)
@@ -678,12 +1811,15 @@ func parseElseNode(s *scanner) (*ElseNode, error) {
 		s.wsnl()
 
 		tk := getToken(s, nil)
+		if tk == nil {
+			break
+		}
 
 		switch {
-		case tk.str == "endif":
+		case isKeyword(tk, "endif"):
 			s.moveTo(tk)
 			return &node, nil
-		case tk.str == "else":
+		case isKeyword(tk, "else"):
 			s.moveTo(tk)
 
 			elseNode, err := parseElseNode(s)
@@ -691,9 +1827,10 @@ func parseElseNode(s *scanner) (*ElseNode, error) {
 				return nil, err
 			}
 			node.Else = *elseNode
-		case tk.str == "end":
-			node.Statements = append(node.Statements, EndNode{})
-		case tk.str == "floating", tk.str == "note":
+		case isKeyword(tk, "end"):
+			s.trackTokenRange(tk)
+			node.Statements = append(node.Statements, EndNode{BaseNode{SourceRange: s.tsr(tk)}})
+		case isKeyword(tk, "floating"), isKeyword(tk, "note"):
 			s.moveTo(tk)
 
 			noteNode, err := parseNoteNode(s)
@@ -704,7 +1841,7 @@ func parseElseNode(s *scanner) (*ElseNode, error) {
 			if noteNode != nil {
 				node.Statements = append(node.Statements, *noteNode)
 			}
-		case tk.str == "partition":
+		case isKeyword(tk, "partition"):
 			s.moveTo(tk)
 
 			partitionNode, err := parsePartitionNode(s)
@@ -715,7 +1852,7 @@ func parseElseNode(s *scanner) (*ElseNode, error) {
 			if partitionNode != nil {
 				node.Statements = append(node.Statements, *partitionNode)
 			}
-		case tk.str == "if":
+		case isKeyword(tk, "if"):
 			s.moveTo(tk)
 
 			ifNode, err := parseIfNode(s)
@@ -726,7 +1863,7 @@ func parseElseNode(s *scanner) (*ElseNode, error) {
 			if ifNode != nil {
 				node.Statements = append(node.Statements, *ifNode)
 			}
-		case tk.str == "fork":
+		case isKeyword(tk, "fork"):
 			s.moveTo(tk)
 
 			forkNode, err := parseForkNode(s)
@@ -767,12 +1904,12 @@ func parseForkNode(s *scanner) (*ForkNode, error) {
 	}()
 
 	forkToken := getToken(s, nil)
-	if forkToken == nil || (forkToken.str != "fork" && forkToken.str != "forkagain") {
+	if forkToken == nil || (!isKeyword(forkToken, "fork") && !isKeyword(forkToken, "forkagain")) {
 		return nil, s.rerr(fmt.Errorf("parseForkNode: expected `fork' or `forkagain'; got %#v", forkToken))
 	}
 	s.trackTokenRange(forkToken)
 
-	if forkToken.str == "forkagain" {
+	if isKeyword(forkToken, "forkagain") {
 		node.IsAgain = true
 	}
 
@@ -780,12 +1917,15 @@ func parseForkNode(s *scanner) (*ForkNode, error) {
 		s.wsnl()
 
 		tk := getToken(s, nil)
+		if tk == nil {
+			break
+		}
 
 		switch {
-		case tk.str == "endfork":
+		case isKeyword(tk, "endfork"):
 			s.trackTokenRange(tk)
 			return &node, nil
-		case tk.str == "forkagain":
+		case isKeyword(tk, "forkagain"):
 			s.moveTo(tk)
 
 			forkAgainNode, err := parseForkNode(s)
@@ -794,10 +1934,10 @@ func parseForkNode(s *scanner) (*ForkNode, error) {
 			}
 			node.ForkAgain = *forkAgainNode
 			return &node, nil
-		case tk.str == "end":
+		case isKeyword(tk, "end"):
 			s.trackTokenRange(tk)
-			node.Statements = append(node.Statements, EndNode{})
-		case tk.str == "partition":
+			node.Statements = append(node.Statements, EndNode{BaseNode{SourceRange: s.tsr(tk)}})
+		case isKeyword(tk, "partition"):
 			s.moveTo(tk)
 
 			partitionNode, err := parsePartitionNode(s)
@@ -808,7 +1948,7 @@ func parseForkNode(s *scanner) (*ForkNode, error) {
 			if partitionNode != nil {
 				node.Statements = append(node.Statements, *partitionNode)
 			}
-		case tk.str == "if":
+		case isKeyword(tk, "if"):
 			s.moveTo(tk)
 
 			ifNode, err := parseIfNode(s)
@@ -935,6 +2075,7 @@ func parseActionNode(s *scanner) (*ActionNode, error) {
 	}
 	s.trackRange(s.sr([2]int{p, s.pos() - 1}))
 	node.Content = content
+	node.Links = findLinks(s, content, p)
 
 	endToken := getToken(s, nil)
 	if endToken == nil || endToken.typ != tokenTypeSemi {
@@ -956,97 +2097,407 @@ func parseDocument(s *scanner) (*DocumentNode, error) {
 	s.wsnl()
 
 	startToken := getToken(s, nil)
-	if startToken == nil || startToken.str != "@startuml" {
+	kind, ok := startKind(startToken)
+	if !ok {
 		return nil, s.err(fmt.Errorf("parseDocument: first token should be @startuml"))
 	}
 	s.trackTokenRange(startToken)
 
-loop:
+	s.k = kind
+	doc.Kind = kind
+
+	nodes, ended, err := parseNodes(s, len(s.d))
+	if err != nil {
+		return nil, err
+	}
+	doc.Nodes = nodes
+
+	if !ended {
+		return nil, fmt.Errorf("parseDocument: couldn't find @end%s token", kind)
+	}
+
+	return &doc, nil
+}
+
+// startKind works out the kind of a document from the tag it starts with.
+func startKind(tk *token) (DocumentKind, bool) {
+	for k := range documentKindNames {
+		if isKeyword(tk, "@start"+DocumentKind(k).String()) {
+			return DocumentKind(k), true
+		}
+	}
+
+	return DocumentUML, false
+}
+
+// isEnd reports whether a token is the tag that ends the document.
+func isEnd(s *scanner, tk *token) bool {
+	return isKeyword(tk, "@end"+s.k.String())
+}
+
+// parseNodes parses top level nodes until it reaches the tag that ends the
+// document, like @enduml, or a token that starts at or after stop.
+func parseNodes(s *scanner, stop int) ([]Node, bool, error) {
+	var nodes []Node
+
 	for !s.eof() {
 		s.wsnl()
 
-		tk := getToken(s, nil)
+		tk := getNodeToken(s)
+		if tk == nil {
+			break
+		}
 
-		switch {
-		case tk.str == "@enduml":
-			s.trackTokenRange(tk)
-			return &doc, nil
-		case tk.str == "skinparam":
+		if tk.pos[0] >= stop {
 			s.moveTo(tk)
+			break
+		}
 
-			skinParamNode, err := parseSkinParamNode(s)
-			if err != nil {
-				return nil, err
-			}
+		if isEnd(s, tk) {
+			s.trackTokenRange(tk)
+			return nodes, true, nil
+		}
 
-			if skinParamNode != nil {
-				doc.Nodes = append(doc.Nodes, *skinParamNode)
-			}
-		case tk.str == "start":
-			s.moveTo(tk)
-			s.savePos()
-			doc.Nodes = append(doc.Nodes, StartNode{})
-		case tk.str == "end":
-			s.moveTo(tk)
-			s.savePos()
-			doc.Nodes = append(doc.Nodes, EndNode{})
-		case tk.str == "floating", tk.str == "note":
-			s.moveTo(tk)
+		node, err := parseNode(s, tk)
+		if err != nil {
+			return nil, false, err
+		}
 
-			noteNode, err := parseNoteNode(s)
-			if err != nil {
-				return nil, err
-			}
+		if node != nil {
+			nodes = append(nodes, node)
+		}
+	}
 
-			if noteNode != nil {
-				doc.Nodes = append(doc.Nodes, *noteNode)
-			}
-		case tk.str == "partition":
-			s.moveTo(tk)
+	return nodes, false, nil
+}
 
-			partitionNode, err := parsePartitionNode(s)
-			if err != nil {
-				return nil, err
-			}
+// parseNode parses the top level node that starts with tk.
+func parseNode(s *scanner, tk *token) (Node, error) {
+	switch s.k {
+	case DocumentGantt:
+		return parseGanttNode(s, tk)
+	case DocumentMindMap, DocumentWBS:
+		if node, ok, err := parseTreeNode(s, tk); ok {
+			return node, err
+		}
+	case DocumentJSON, DocumentYAML:
+		if node, ok, err := parseDataDocumentNode(s, tk); ok {
+			return node, err
+		}
+	}
 
-			if partitionNode != nil {
-				doc.Nodes = append(doc.Nodes, *partitionNode)
-			}
-		case tk.str == "if":
-			s.moveTo(tk)
+	// keywords can also be state names, as in `End --> Idle`, and the ends
+	// of edges can be written `:Actor:` or `(Use Case)`, which also declare
+	// them when they're on their own.
+	s.savePos()
+	s.moveTo(tk)
+	endpoint, kind := getEndpoint(s)
+	next := getToken(s, nil)
+	s.restorePos()
+
+	keyword := tk
+	if endpoint != nil && next != nil && next.typ == tokenTypeTerm && isArrow(next.str) {
+		keyword = nil
+	}
 
-			ifNode, err := parseIfNode(s)
-			if err != nil {
-				return nil, err
-			}
+	shorthand := kind
+	if endpoint == nil || keyword == nil || !(next == nil || next.typ == tokenTypeLineEnd || isKeyword(next, "as") || isStereotype(next.str)) {
+		shorthand = EndpointName
+	}
 
-			if ifNode != nil {
-				doc.Nodes = append(doc.Nodes, *ifNode)
-			}
-		case tk.str == "state":
-			s.moveTo(tk)
+	switch {
+	case isConstraint(tk, next):
+		s.moveTo(tk)
 
-			stateNode, err := parseStateNode(s)
-			if err != nil {
-				return nil, err
-			}
+		constraintNode, err := parseConstraintNode(s)
+		if err != nil {
+			return nil, err
+		}
 
-			if stateNode != nil {
-				doc.Nodes = append(doc.Nodes, *stateNode)
-			}
-		default:
-			s.moveTo(tk)
+		if constraintNode != nil {
+			return *constraintNode, nil
+		}
+	case isTick(tk, next):
+		s.moveTo(tk)
 
-			if edgeNode, err := parseEdgeNode(s); err == nil {
-				doc.Nodes = append(doc.Nodes, *edgeNode)
-				continue loop
-			}
+		tickNode, err := parseTickNode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if tickNode != nil {
+			return *tickNode, nil
+		}
+	case keyword != nil && isKeyword(next, "is"):
+		s.moveTo(tk)
+
+		stateChangeNode, err := parseStateChangeNode(s, "")
+		if err != nil {
+			return nil, err
+		}
+
+		if stateChangeNode != nil {
+			return *stateChangeNode, nil
+		}
+	case isTimingKind(keyword):
+		s.moveTo(tk)
+
+		participantNode, err := parseTimingParticipantNode(s, tk.str)
+		if err != nil {
+			return nil, err
+		}
+
+		if participantNode != nil {
+			return *participantNode, nil
+		}
+	case isKeyword(keyword, "highlight"):
+		s.moveTo(tk)
+
+		highlightNode, err := parseHighlightNode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if highlightNode != nil {
+			return *highlightNode, nil
+		}
+	case shorthand == EndpointActor, isKeyword(keyword, "actor"):
+		s.moveTo(tk)
+
+		actorNode, err := parseActorNode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if actorNode != nil {
+			return *actorNode, nil
+		}
+	case shorthand == EndpointUseCase, isKeyword(keyword, "usecase"):
+		s.moveTo(tk)
+
+		useCaseNode, err := parseUseCaseNode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if useCaseNode != nil {
+			return *useCaseNode, nil
+		}
+	case shorthand == EndpointComponent, isKeyword(keyword, "component"):
+		s.moveTo(tk)
+
+		componentNode, err := parseComponentNode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if componentNode != nil {
+			return *componentNode, nil
+		}
+	case shorthand == EndpointInterface, isKeyword(keyword, "interface"):
+		s.moveTo(tk)
+
+		interfaceNode, err := parseInterfaceNode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if interfaceNode != nil {
+			return *interfaceNode, nil
+		}
+	case isKeyword(keyword, "port"), isKeyword(keyword, "portin"), isKeyword(keyword, "portout"):
+		s.moveTo(tk)
+
+		portNode, err := parsePortNode(s, tk.str)
+		if err != nil {
+			return nil, err
+		}
+
+		if portNode != nil {
+			return *portNode, nil
+		}
+	case isContainerKind(keyword):
+		s.moveTo(tk)
+
+		containerNode, err := parseContainerNode(s, tk.str)
+		if err != nil {
+			return nil, err
+		}
+
+		if containerNode != nil {
+			return *containerNode, nil
+		}
+	case isKeyword(keyword, "object"):
+		s.moveTo(tk)
+
+		objectNode, err := parseObjectNode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if objectNode != nil {
+			return *objectNode, nil
+		}
+	case isKeyword(keyword, "entity"), s.k == DocumentChen && isKeyword(keyword, "relationship"):
+		s.moveTo(tk)
+
+		entityNode, err := parseEntityNode(s, tk.str)
+		if err != nil {
+			return nil, err
+		}
+
+		if entityNode != nil {
+			return *entityNode, nil
+		}
+	case isKeyword(keyword, "map"):
+		s.moveTo(tk)
+
+		mapNode, err := parseMapNode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if mapNode != nil {
+			return *mapNode, nil
+		}
+	case isKeyword(keyword, "rectangle"):
+		s.moveTo(tk)
+
+		rectangleNode, err := parseRectangleNode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if rectangleNode != nil {
+			return *rectangleNode, nil
+		}
+	case isKeyword(keyword, "left"), isKeyword(keyword, "top"):
+		s.moveTo(tk)
+
+		directionNode, err := parseDirectionNode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if directionNode != nil {
+			return *directionNode, nil
+		}
+	case isKeyword(keyword, "skinparam"):
+		s.moveTo(tk)
+
+		skinParamNode, err := parseSkinParamNode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if skinParamNode != nil {
+			return *skinParamNode, nil
+		}
+	case isKeyword(keyword, "!theme"):
+		s.moveTo(tk)
+
+		themeNode, err := parseThemeNode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if themeNode != nil {
+			return *themeNode, nil
+		}
+	case isKeyword(keyword, "<style>"):
+		s.moveTo(tk)
+
+		styleNode, err := parseStyleNode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if styleNode != nil {
+			return *styleNode, nil
+		}
+	case isKeyword(keyword, "start"):
+		s.trackTokenRange(tk)
+		return StartNode{BaseNode{SourceRange: s.tsr(tk)}}, nil
+	case isKeyword(keyword, "end"):
+		s.trackTokenRange(tk)
+		return EndNode{BaseNode{SourceRange: s.tsr(tk)}}, nil
+	case isKeyword(keyword, "fork"):
+		s.moveTo(tk)
+
+		forkNode, err := parseForkNode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if forkNode != nil {
+			return *forkNode, nil
+		}
+	case keyword != nil && (tk.typ == tokenTypeColon || tk.typ == tokenTypeHash):
+		s.moveTo(tk)
+
+		actionNode, err := parseActionNode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if actionNode != nil {
+			return *actionNode, nil
+		}
+	case isKeyword(keyword, "floating"), isKeyword(keyword, "note"):
+		s.moveTo(tk)
+
+		noteNode, err := parseNoteNode(s)
+		if err != nil {
+			return nil, err
+		}
 
-			return nil, s.err(fmt.Errorf("parseDocument: unhandled token %s", tk))
+		if noteNode != nil {
+			return *noteNode, nil
 		}
+	case isKeyword(keyword, "partition"):
+		s.moveTo(tk)
+
+		partitionNode, err := parsePartitionNode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if partitionNode != nil {
+			return *partitionNode, nil
+		}
+	case isKeyword(keyword, "if"):
+		s.moveTo(tk)
+
+		ifNode, err := parseIfNode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if ifNode != nil {
+			return *ifNode, nil
+		}
+	case isKeyword(keyword, "state"):
+		s.moveTo(tk)
+
+		stateNode, err := parseStateNode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if stateNode != nil {
+			return *stateNode, nil
+		}
+	default:
+		s.moveTo(tk)
+
+		if edgeNode, err := parseEdgeNode(s); err == nil {
+			return *edgeNode, nil
+		}
+
+		return nil, s.err(fmt.Errorf("parseDocument: unhandled token %s", tk))
 	}
 
-	return nil, fmt.Errorf("parseDocument: couldn't find @enduml token")
+	return nil, nil
 }
 
 func ParseDocument(source string) (*DocumentNode, error) {
@@ -1,7 +1,10 @@
 package parser
 
 import (
+  "bytes"
   "io/ioutil"
+  "reflect"
+  "strings"
   "testing"
 
   "github.com/stretchr/testify/assert"
@@ -52,6 +55,62 @@ func TestParserComments(t *testing.T) {
   a.Equal("", doc.GetSkinParam("Param3"))
 }
 
+func TestParserSkinParams(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := parseDocument(&scanner{d: readTestFile("skinparam-1-input.uml")})
+  a.NoError(err)
+  a.NotNil(doc)
+
+  a.Equal("Courier New", doc.GetSkinParam("defaultFontName"))
+  a.Equal("LightBlue", doc.GetSkinParam("stateBackgroundColor"))
+  a.Equal("LightBlue", doc.GetSkinParam("StateBackgroundColor"))
+  a.Equal("Orange", doc.GetSkinParam("stateBackgroundColor<<Warning>>"))
+  a.Equal("Red", doc.GetSkinParam("stateBorderColor<<Warning>>"))
+  a.Equal("", doc.GetSkinParam("stateBorderColor"))
+  a.Equal("Gray", doc.GetSkinParam("stateArrowColor"))
+  a.Equal("Times New Roman", doc.GetSkinParam("noteFontName<<Info>>"))
+  a.Equal([]string{"Orange"}, doc.GetSkinParams("stateBackgroundColor<<Warning>>"))
+
+  styleNode, ok := doc.FindNode(func(n Node) bool { _, ok := n.(StyleNode); return ok }).(StyleNode)
+  a.True(ok)
+  a.Equal(&StyleRuleNode{
+    BaseNode: BaseNode{
+      SourceRange: SourceRange{
+        Start: SourcePosition{Offset: 387, Line: 22, Column: 3},
+        End:   SourcePosition{Offset: 421, Line: 22, Column: 37},
+      },
+    },
+    Selector: ".Warning",
+    Children: []Node{
+      StylePropertyNode{
+        BaseNode: BaseNode{
+          SourceRange: SourceRange{
+            Start: SourcePosition{Offset: 398, Line: 22, Column: 14},
+            End:   SourcePosition{Offset: 419, Line: 22, Column: 35},
+          },
+        },
+        Name:  "BackgroundColor",
+        Value: "orange",
+      },
+    },
+  }, findStyleRule(styleNode.Children, "stateDiagram", ".Warning"))
+}
+
+func findStyleRule(nodes []Node, path ...string) *StyleRuleNode {
+  for _, n := range nodes {
+    if ruleNode, ok := n.(StyleRuleNode); ok && ruleNode.Selector == path[0] {
+      if len(path) == 1 {
+        return &ruleNode
+      }
+
+      return findStyleRule(ruleNode.Children, path[1:]...)
+    }
+  }
+
+  return nil
+}
+
 func BenchmarkParser(b *testing.B) {
   for i := 0; i < b.N; i++ {
     parseDocument(&scanner{d: readTestFile("simple-code-1-input.uml")})
@@ -239,3 +298,583 @@ func TestParserPositions(t *testing.T) {
     },
   }, doc)
 }
+
+func TestParserLinks(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := ParseDocument("@startuml\nstate \"Idle [[docs/a.md]]\" as Idle : see [[docs/b.md{more info} the spec]]\nIdle --> Busy : [[https://example.com go]]\nnote left\n  details in [[#top]]\nendnote\npartition P {\n  :read [[c.md]];\n}\n@enduml\n")
+  a.NoError(err)
+
+  links := FindLinks(*doc)
+  if a.Len(links, 5) {
+    a.Equal(Link{
+      SourceRange: SourceRange{
+        Start: SourcePosition{Offset: 22, Line: 2, Column: 13},
+        End:   SourcePosition{Offset: 34, Line: 2, Column: 25},
+      },
+      URL: "docs/a.md",
+    }, links[0])
+    a.Equal("docs/b.md", links[1].URL)
+    a.Equal("more info", links[1].Tooltip)
+    a.Equal("the spec", links[1].Label)
+    a.Equal("2:42-2:74", links[1].SourceRange.String())
+    a.Equal("go", links[2].Label)
+    a.Equal("5:14-5:21", links[3].SourceRange.String())
+    a.Equal("8:9-8:16", links[4].SourceRange.String())
+  }
+
+  a.Len(doc.Nodes[0].(StateNode).Links, 2)
+  a.Len(doc.Nodes[1].(EdgeNode).Links, 1)
+}
+
+func TestParserKeywords(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := ParseDocument("@startuml\nSTATE X as \"The X\"\nState \"The Y\" AS Y\nEnd --> X\nSTART\n@enduml\n")
+  if !a.NoError(err) {
+    return
+  }
+
+  if a.Len(doc.Nodes, 4) {
+    a.Equal("X", doc.Nodes[0].(StateNode).Name)
+    a.Equal("The X", doc.Nodes[0].(StateNode).Label)
+    a.Equal("Y", doc.Nodes[1].(StateNode).Name)
+    a.Equal("The Y", doc.Nodes[1].(StateNode).Label)
+    a.Equal("End", doc.Nodes[2].(EdgeNode).Left)
+    a.IsType(StartNode{}, doc.Nodes[3])
+  }
+}
+
+func TestParserArrows(t *testing.T) {
+  a := assert.New(t)
+
+  for _, e := range []struct {
+    kind  string
+    arrow string
+  }{
+    {"uml", "-->"},
+    {"uml", "-UP->"},
+    {"uml", "-Left->"},
+    {"uml", "-down[#red]->"},
+    {"uml", "-[#red]up->"},
+    {"uml", "-[#blue,dashed]->"},
+    {"uml", ".r.>"},
+    {"uml", "<|--"},
+    {"uml", "-()"},
+    {"uml", ")-"},
+    {"uml", "|o--o{"},
+    {"uml", "}|..||"},
+    {"uml", "||-LEFT-o|"},
+    {"chen", "-N-"},
+    {"chen", "=(1,N)="},
+  } {
+    src := "@start" + e.kind + "\nA " + e.arrow + " B\n@end" + e.kind + "\n"
+
+    doc, err := ParseDocument(src)
+    if a.NoError(err, src) && a.Len(doc.Nodes, 1, src) {
+      a.Equal(e.arrow, doc.Nodes[0].(EdgeNode).Direction, src)
+    }
+  }
+}
+
+func TestParserUseCase(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := ParseDocument(`@startuml
+left to right direction
+actor Guest as g
+:Main Admin: as Admin <<Human>>
+(Use the application) as (Use)
+usecase UC1 as "Eat Food"
+rectangle Restaurant {
+  (Drink)
+  g -- UC1
+}
+:Main Admin: ---> (Use)
+User <|-- Admin
+UC1 .> (Drink) : include
+UC1 <.. (Help) : <<extend>>
+UC1 ..> Guest
+@enduml
+`)
+  if !a.NoError(err) {
+    return
+  }
+
+  if !a.Len(doc.Nodes, 11) {
+    return
+  }
+
+  a.Equal(DirectionNode{Direction: "left to right"}, withoutRange(doc.Nodes[0]))
+  a.Equal(ActorNode{Name: "g", Label: "Guest"}, withoutRange(doc.Nodes[1]))
+  a.Equal(ActorNode{Name: "Admin", Label: "Main Admin", Stereotype: "<<Human>>"}, withoutRange(doc.Nodes[2]))
+  a.Equal(UseCaseNode{Name: "Use", Label: "Use the application"}, withoutRange(doc.Nodes[3]))
+  a.Equal(UseCaseNode{Name: "UC1", Label: "Eat Food"}, withoutRange(doc.Nodes[4]))
+
+  if r, ok := doc.Nodes[5].(RectangleNode); a.True(ok) {
+    a.Equal("Restaurant", r.Name)
+    if a.Len(r.Children, 2) {
+      a.Equal(UseCaseNode{Name: "Drink", Label: "Drink"}, withoutRange(r.Children[0]))
+      a.Equal(Association, r.Children[1].(EdgeNode).Relationship())
+    }
+  }
+
+  e := doc.Nodes[6].(EdgeNode)
+  a.Equal("Main Admin", e.Left)
+  a.Equal(EndpointActor, e.LeftKind)
+  a.Equal("Use", e.Right)
+  a.Equal(EndpointUseCase, e.RightKind)
+
+  a.Equal(Generalisation, doc.Nodes[7].(EdgeNode).Relationship())
+  a.Equal(Include, doc.Nodes[8].(EdgeNode).Relationship())
+  a.Equal(Extend, doc.Nodes[9].(EdgeNode).Relationship())
+  a.Equal(Dependency, doc.Nodes[10].(EdgeNode).Relationship())
+}
+
+func withoutRange(n Node) Node {
+  return mapRanges(reflect.ValueOf(&n).Elem(), func(SourceRange) SourceRange { return SourceRange{} }).Interface().(Node)
+}
+
+func TestParserComponents(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := ParseDocument(`@startuml
+node "Web Tier" as web {
+  [API] as api <<Service>> {
+    portin http
+    portout db
+  }
+  () "Public API" as pub
+  api -() pub
+}
+cloud {
+  database Postgres
+}
+pub )- [Client]
+web ..> Postgres : connects
+@enduml
+`)
+  if !a.NoError(err) {
+    return
+  }
+
+  if !a.Len(doc.Nodes, 4) {
+    return
+  }
+
+  if web, ok := doc.Nodes[0].(ContainerNode); a.True(ok) {
+    a.Equal("node", web.Kind)
+    a.Equal("web", web.Name)
+    a.Equal("Web Tier", web.Label)
+
+    if a.Len(web.Children, 3) {
+      if api, ok := web.Children[0].(ComponentNode); a.True(ok) {
+        a.Equal("api", api.Name)
+        a.Equal("API", api.Label)
+        a.Equal("<<Service>>", api.Stereotype)
+        a.Equal([]Node{
+          PortNode{Direction: "in", Name: "http", Label: "http"},
+          PortNode{Direction: "out", Name: "db", Label: "db"},
+        }, withoutRange(api).(ComponentNode).Children)
+      }
+
+      a.Equal(InterfaceNode{Name: "pub", Label: "Public API"}, withoutRange(web.Children[1]))
+    }
+  }
+
+  if cloud, ok := doc.Nodes[1].(ContainerNode); a.True(ok) {
+    a.Equal("cloud", cloud.Kind)
+    a.Equal("", cloud.Name)
+    if a.Len(cloud.Children, 1) {
+      a.Equal(ContainerNode{Kind: "database", Name: "Postgres", Label: "Postgres"}, withoutRange(cloud.Children[0]))
+    }
+  }
+
+  edges := FindEdges(*doc)
+  if a.Len(edges, 3) {
+    a.Equal(Provides, edges[0].Relationship())
+    a.Equal(Requires, edges[1].Relationship())
+    a.Equal("Client", edges[1].Right)
+    a.Equal(EndpointComponent, edges[1].RightKind)
+    a.Equal(Dependency, edges[2].Relationship())
+  }
+}
+
+func TestParserObjects(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := ParseDocument(`@startuml
+object user {
+  name = "Dummy"
+  active
+}
+map CapitalCity {
+  UK => London
+  Germany *-> Berlin
+}
+user --> CapitalCity::UK
+@enduml
+`)
+  if !a.NoError(err) {
+    return
+  }
+
+  if !a.Len(doc.Nodes, 3) {
+    return
+  }
+
+  if user, ok := doc.Nodes[0].(ObjectNode); a.True(ok) {
+    a.Equal("user", user.Name)
+    if a.Len(user.Fields, 2) {
+      a.Equal("name", user.Fields[0].Name)
+      a.Equal(`"Dummy"`, user.Fields[0].Value)
+      a.Equal("3:3-3:16", user.Fields[0].SourceRange.String())
+      a.Equal("active", user.Fields[1].Name)
+      a.Equal("", user.Fields[1].Value)
+    }
+    a.Equal("2:1-5:1", user.SourceRange.String())
+  }
+
+  if m, ok := doc.Nodes[1].(MapNode); a.True(ok) {
+    a.Equal([]MapEntryNode{
+      {Key: "UK", Value: "London"},
+      {Key: "Germany", Link: "Berlin"},
+    }, withoutRange(m).(MapNode).Entries)
+  }
+
+  name, member := SplitMember(doc.Nodes[2].(EdgeNode).Right)
+  a.Equal("CapitalCity", name)
+  a.Equal("UK", member)
+
+  var fields []string
+  a.NoError(Walk(*doc, func(n Node) error {
+    if f, ok := n.(FieldNode); ok {
+      fields = append(fields, f.Name)
+    }
+    return nil
+  }))
+  a.Equal([]string{"name", "active"}, fields)
+}
+
+func TestParserTiming(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := ParseDocument(`@startuml
+clock clk with period 50 pulse 15 offset 10
+@0
+clk is high
+@WB
++50 is Busy
+@10 <-> @20 : {10 ms}
+@enduml
+`)
+  if !a.NoError(err) {
+    return
+  }
+
+  if !a.Len(doc.Nodes, 3) {
+    return
+  }
+
+  a.Equal(TimingParticipantNode{Kind: "clock", Name: "clk", Label: "clk", Period: 50, Pulse: 15, Offset: 10}, withoutRange(doc.Nodes[0]))
+  a.Equal(TickNode{Time: "0", Children: []Node{StateChangeNode{Participant: "clk", State: "high"}}}, withoutRange(doc.Nodes[1]))
+  a.Equal(TickNode{Participant: "WB", Children: []Node{
+    StateChangeNode{Participant: "WB", Time: "+50", State: "Busy"},
+    ConstraintNode{From: "10", To: "20", Text: "10 ms"},
+  }}, withoutRange(doc.Nodes[2]))
+  a.Equal("5:1-7:21", doc.Nodes[2].(TickNode).SourceRange.String())
+}
+
+func TestParserGantt(t *testing.T) {
+  a := assert.New(t)
+
+  const src = `@startgantt
+Project starts 2020-07-01
+saturday are closed
+[Design] as [D] on {Alice:50%} {Bob} lasts 2 weeks
+then [Build] starts 3 days after [D]'s end and is 10% completed
+[Launch] happens at [Build]'s end
+@endgantt
+`
+
+  doc, err := ParseDocument(src)
+  if !a.NoError(err) {
+    return
+  }
+
+  a.Equal(DocumentGantt, doc.Kind)
+
+  if a.Len(doc.Nodes, 5) {
+    a.Equal(GanttProjectNode{Start: "2020-07-01"}, withoutRange(doc.Nodes[0]))
+    a.Equal(GanttCalendarNode{Day: "saturday", Closed: true}, withoutRange(doc.Nodes[1]))
+    a.Equal(GanttTaskNode{
+      Name:      "Design",
+      Alias:     "D",
+      Resources: []GanttResource{{Name: "Alice", Percent: 50}, {Name: "Bob"}},
+      Clauses:   []GanttClause{{Kind: GanttLasts, Amount: 2, Unit: "week"}},
+    }, withoutRange(doc.Nodes[2]))
+    a.Equal(GanttTaskNode{
+      Name: "Build",
+      Then: true,
+      Clauses: []GanttClause{
+        {Kind: GanttStarts, Task: "D", Anchor: "end", Offset: 3},
+        {Kind: GanttCompleted, Percent: 10},
+      },
+    }, withoutRange(doc.Nodes[3]))
+    a.Equal("6:1-6:33", doc.Nodes[4].(GanttTaskNode).SourceRange.String())
+  }
+
+  var streamed []Node
+  a.NoError(ParseReader(strings.NewReader(src), func(n Node) error {
+    streamed = append(streamed, n)
+    return nil
+  }))
+  a.Equal(doc.Nodes, streamed)
+
+  for _, src := range []string{
+    "@startgantt\n[Design] lasts 2 days\n@enduml\n",
+    "@startgantt\n[Design] lasts two days\n@endgantt\n",
+    "@startgantt\n[Design] starts at [Other]\n@endgantt\n",
+    "@startgantt\nfunday is closed\n@endgantt\n",
+  } {
+    _, err := ParseDocument(src)
+    a.Error(err, src)
+  }
+}
+
+func TestParserMindMap(t *testing.T) {
+  a := assert.New(t)
+
+  const src = `@startmindmap
+* Root
+** A
+***[#red]_ A1
+left side
+** B
+*** :B1
+continued;
+**> C
+@endmindmap
+`
+
+  doc, err := ParseDocument(src)
+  if !a.NoError(err) {
+    return
+  }
+
+  a.Equal(DocumentMindMap, doc.Kind)
+
+  if !a.Len(doc.Nodes, 1) {
+    return
+  }
+
+  a.Equal(BranchNode{
+    Depth:  1,
+    Marker: "*",
+    Text:   "Root",
+    Children: []Node{
+      BranchNode{Depth: 2, Marker: "*", Text: "A", Children: []Node{
+        BranchNode{Depth: 3, Marker: "*", Colour: "red", Boxless: true, Text: "A1"},
+      }},
+      SideNode{Side: "left"},
+      BranchNode{Depth: 2, Marker: "*", Side: "left", Text: "B", Children: []Node{
+        BranchNode{Depth: 3, Marker: "*", Side: "left", Multiline: true, Text: "B1\ncontinued"},
+      }},
+      BranchNode{Depth: 2, Marker: "*", Direction: ">", Side: "right", Text: "C"},
+    },
+  }, withoutRange(doc.Nodes[0]))
+
+  root := doc.Nodes[0].(BranchNode)
+  a.Equal("2:1-9:5", root.SourceRange.String())
+  a.Equal("7:1-8:10", root.Children[2].(BranchNode).Children[0].(BranchNode).SourceRange.String())
+
+  var texts []string
+  a.NoError(Walk(*doc, func(n Node) error {
+    if b, ok := n.(BranchNode); ok {
+      texts = append(texts, b.Text)
+    }
+    return nil
+  }))
+  a.Equal([]string{"Root", "A", "A1", "B", "B1\ncontinued", "C"}, texts)
+
+  var streamed []Node
+  a.NoError(ParseReader(strings.NewReader(src), func(n Node) error {
+    streamed = append(streamed, n)
+    return nil
+  }))
+  a.Equal(doc.Nodes, streamed)
+
+  doc, err = ParseDocument("@startwbs\n# Project\n## Phase\n+ Other\n@endwbs\n")
+  if a.NoError(err) && a.Len(doc.Nodes, 2) {
+    a.Equal(DocumentWBS, doc.Kind)
+    a.Len(doc.Nodes[0].(BranchNode).Children, 1)
+    a.Equal("right", doc.Nodes[1].(BranchNode).Side)
+  }
+
+  _, err = ParseDocument("@startmindmap\n* :never closed\n@endmindmap\n")
+  a.Error(err)
+}
+
+func TestParserData(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := ParseDocument(string(readTestFile("json-1-input.uml")))
+  if !a.NoError(err) {
+    return
+  }
+
+  a.Equal(DocumentJSON, doc.Kind)
+
+  if !a.Len(doc.Nodes, 5) {
+    return
+  }
+
+  a.Equal(DataHighlightNode{Path: []string{"address", "city"}, Stereotype: "h2"}, withoutRange(doc.Nodes[1]))
+  a.IsType(StyleNode{}, doc.Nodes[3])
+
+  data := doc.Nodes[4].(DataNode)
+  a.Equal("10:1-24:1", data.SourceRange.String())
+  a.True(strings.HasPrefix(data.Raw, "{\n  \"firstName\""))
+
+  v, ok := data.Lookup([]string{"age"})
+  a.True(ok)
+  a.Equal(27.0, v)
+
+  _, ok = data.Lookup([]string{"phoneNumbers", "2"})
+  a.False(ok)
+
+  highlights, err := doc.ResolveHighlights()
+  if a.NoError(err) && a.Len(highlights, 3) {
+    a.Equal("Smith", highlights[0].Value)
+    a.Equal("New York", highlights[1].Value)
+    a.Equal("212 555-1234", highlights[2].Value)
+  }
+
+  doc, err = ParseDocument(string(readTestFile("yaml-1-input.uml")))
+  if !a.NoError(err) {
+    return
+  }
+
+  a.Equal(DocumentYAML, doc.Kind)
+
+  highlights, err = doc.ResolveHighlights()
+  if a.NoError(err) && a.Len(highlights, 2) {
+    a.Equal("Banana", highlights[0].Value)
+    a.Equal(true, highlights[1].Value)
+  }
+
+  v, ok = doc.Nodes[2].(DataNode).Lookup([]string{"1"})
+  a.True(ok)
+  a.Equal("one", v)
+
+  doc, err = ParseDocument("@startjson\n#highlight \"missing\"\n{\"a\": 1}\n@endjson\n")
+  if a.NoError(err) {
+    _, err = doc.ResolveHighlights()
+    a.EqualError(err, `DocumentNode.ResolveHighlights: 2:1-2:20: "missing" doesn't match anything`)
+  }
+
+  _, err = ParseDocument("@startjson\n{\n  \"a\": 1,\n}\n@endjson\n")
+  a.EqualError(err, "error at 4:1: parseDataNode: invalid character '}' looking for beginning of object key string")
+
+  // a line starting with a quote is data in YAML, not a comment.
+  for _, src := range []string{
+    "@startyaml\n'quoted key': 1\nother: x\n@endyaml\n",
+    "@startyaml\n#highlight \"quoted key\"\n'quoted key': 1\n@endyaml\n",
+  } {
+    doc, err = ParseDocument(src)
+    if a.NoError(err, src) {
+      data := doc.Nodes[len(doc.Nodes)-1].(DataNode)
+      a.True(strings.HasPrefix(data.Raw, "'quoted key': 1"), src)
+
+      v, ok := data.Lookup([]string{"quoted key"})
+      a.True(ok, src)
+      a.Equal(1, v, src)
+
+      buf := bytes.NewBuffer(nil)
+      if a.NoError(FormatDocument(*doc, buf)) {
+        a.Contains(buf.String(), "'quoted key': 1\n", src)
+      }
+    }
+  }
+
+  for _, src := range []string{
+    "@startyaml\na: [1\n@endyaml\n",
+    "@startjson\n{\"a\": 1}\n@enduml\n",
+    "@startjson\n#highlight \"a\" \"b\"\n{\"a\": 1}\n@endjson\n",
+    "@startjson\n#highlight \"a\" /\n{\"a\": 1}\n@endjson\n",
+  } {
+    _, err := ParseDocument(src)
+    a.Error(err, src)
+  }
+}
+
+func TestParserEntities(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := ParseDocument(string(readTestFile("er-1-input.uml")))
+  if !a.NoError(err) {
+    return
+  }
+
+  if !a.Len(doc.Nodes, 7) {
+    return
+  }
+
+  a.Equal(EntityNode{
+    Kind:  "entity",
+    Name:  "u",
+    Label: "users",
+    Children: []Node{
+      ColumnNode{Name: "id", Type: "integer", Stereotype: "<<generated>>", Mandatory: true, Key: true},
+      EntitySeparatorNode{Line: "--"},
+      ColumnNode{Name: "email", Type: "varchar(255)", Mandatory: true},
+      ColumnNode{Name: "name", Type: "text"},
+    },
+  }, withoutRange(doc.Nodes[0]))
+
+  orders := doc.Nodes[1].(EntityNode)
+  a.Len(orders.Columns(), 4)
+  a.Equal(EntitySeparatorNode{Line: "-- audit --"}, withoutRange(orders.Children[4]))
+  a.Equal("9:1-16:1", orders.SourceRange.String())
+
+  a.Equal(EntityNode{Kind: "entity", Name: "audit_log", Label: "audit_log"}, withoutRange(doc.Nodes[3]))
+
+  for i, e := range []struct{ left, right Cardinality }{
+    {ExactlyOne, ZeroOrMore},
+    {ExactlyOne, OneOrMore},
+    {ZeroOrMore, ZeroOrOne},
+  } {
+    left, right := doc.Nodes[4+i].(EdgeNode).Cardinalities()
+    a.Equal(e.left, left)
+    a.Equal(e.right, right)
+  }
+
+  left, right := EdgeNode{Direction: "-->"}.Cardinalities()
+  a.Equal(Cardinality(""), left)
+  a.Equal(Cardinality(""), right)
+
+  doc, err = ParseDocument(string(readTestFile("chen-1-input.uml")))
+  if !a.NoError(err) {
+    return
+  }
+
+  a.Equal(DocumentChen, doc.Kind)
+
+  if a.Len(doc.Nodes, 5) {
+    a.Equal("relationship", doc.Nodes[2].(EntityNode).Kind)
+    a.Equal(ColumnNode{Name: "Name", Children: []ColumnNode{
+      {Name: "Fname", Type: "CHAR[20]"},
+      {Name: "Lname", Type: "CHAR[20]"},
+    }}, withoutRange(doc.Nodes[0].(EntityNode).Children[1]))
+    a.Equal("=N=", doc.Nodes[4].(EdgeNode).Direction)
+  }
+
+  for _, src := range []string{
+    "@startuml\nentity A {\n  *id : integer\n",
+    "@startuml\nentity A {\n  : integer\n}\n@enduml\n",
+    "@startchen\nentity A {\n  Name {\n    --\n  }\n}\n@endchen\n",
+  } {
+    _, err := ParseDocument(src)
+    a.Error(err, src)
+  }
+}
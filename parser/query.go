@@ -0,0 +1,540 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Selector is a compiled query, written in a small subset of CSS selector
+// syntax:
+//
+//	StateNode                     nodes by type; the Node suffix is optional
+//	*                             any node
+//	EdgeNode[Right=Done]          fields compared with =, !=, ^=, $=, *= or ~=
+//	StateNode[Text]               fields that aren't empty
+//	ActionNode:contains("retry")  nodes with any field containing some text
+//	StateNode:has(EdgeNode)       nodes with a matching descendant
+//	StateNode:has(> StateNode)    nodes with a matching child
+//	StateNode:not([Text])         nodes that don't match
+//	IfNode ActionNode             descendants
+//	StateNode > StateNode         children
+//	StartNode, EndNode            either
+//
+// ~= matches a regular expression. Values can be quoted with double quotes,
+// and need to be if they contain spaces or brackets.
+type Selector struct {
+	alternatives []complexSelector
+}
+
+type complexSelector struct {
+	// compounds is stored innermost first, along with whether each one has to
+	// be the direct parent of the one before it.
+	compounds []compoundSelector
+	child     []bool
+}
+
+type compoundSelector struct {
+	name       string
+	attributes []attributeSelector
+	pseudos    []pseudoSelector
+}
+
+type attributeSelector struct {
+	field string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+type pseudoSelector struct {
+	name     string
+	text     string
+	selector *Selector
+	// child is set for :has(> ...), which only looks at direct children.
+	child bool
+}
+
+// CompileSelector parses a selector. Selectors that come from users should
+// be compiled with this and then run with Selector.Query, so that mistakes in
+// them are errors.
+func CompileSelector(s string) (*Selector, error) {
+	p := selectorParser{s: s}
+
+	sel, err := p.selector()
+	if err != nil {
+		return nil, fmt.Errorf("CompileSelector: %w", err)
+	}
+
+	if p.skipSpace(); p.i < len(p.s) {
+		return nil, fmt.Errorf("CompileSelector: unexpected %q at offset %d", p.s[p.i], p.i)
+	}
+
+	return sel, nil
+}
+
+// MustQuery finds every node under n, including n itself, that matches the
+// selector, in document order. It panics if the selector can't be compiled,
+// so it's only meant for selectors that are fixed in the source.
+func MustQuery(n Node, selector string) []Node {
+	sel, err := CompileSelector(selector)
+	if err != nil {
+		panic(err)
+	}
+
+	return sel.Query(n)
+}
+
+// Query finds every node under n, including n itself, that matches the
+// selector, in document order.
+func (s *Selector) Query(n Node) []Node {
+	var a []Node
+
+	var ancestors []Node
+	Visit(n, func(v VisitType, depth int, n Node) error {
+		if v == Exit {
+			ancestors = ancestors[0 : len(ancestors)-1]
+			return nil
+		}
+
+		if s.matches(n, ancestors) {
+			a = append(a, n)
+		}
+
+		ancestors = append(ancestors, n)
+
+		return nil
+	})
+
+	return a
+}
+
+func (s *Selector) matches(n Node, ancestors []Node) bool {
+	for _, e := range s.alternatives {
+		if e.matches(0, n, ancestors) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c complexSelector) matches(i int, n Node, ancestors []Node) bool {
+	if !c.compounds[i].matches(n, ancestors) {
+		return false
+	}
+
+	if i == len(c.compounds)-1 {
+		return true
+	}
+
+	for j := len(ancestors) - 1; j >= 0; j-- {
+		if c.matches(i+1, ancestors[j], ancestors[0:j]) {
+			return true
+		}
+
+		if c.child[i] {
+			break
+		}
+	}
+
+	return false
+}
+
+func (c compoundSelector) matches(n Node, ancestors []Node) bool {
+	if c.name != "" && c.name != "*" && n.NodeName() != c.name && n.NodeName() != c.name+"Node" {
+		return false
+	}
+
+	for _, a := range c.attributes {
+		if !a.matches(n) {
+			return false
+		}
+	}
+
+	for _, p := range c.pseudos {
+		if !p.matches(n, ancestors) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (a attributeSelector) matches(n Node) bool {
+	v, ok := fieldValue(n, a.field)
+	if !ok {
+		return false
+	}
+
+	switch a.op {
+	case "":
+		return v != ""
+	case "=":
+		return v == a.value
+	case "!=":
+		return v != a.value
+	case "^=":
+		return strings.HasPrefix(v, a.value)
+	case "$=":
+		return strings.HasSuffix(v, a.value)
+	case "*=":
+		return strings.Contains(v, a.value)
+	case "~=":
+		return a.re.MatchString(v)
+	default:
+		return false
+	}
+}
+
+func (p pseudoSelector) matches(n Node, ancestors []Node) bool {
+	switch p.name {
+	case "contains":
+		for _, v := range fieldValues(n) {
+			if strings.Contains(v, p.text) {
+				return true
+			}
+		}
+
+		return false
+	case "not":
+		return !p.selector.matches(n, ancestors)
+	case "has":
+		return p.hasMatch(n, ancestors, 0)
+	default:
+		return false
+	}
+}
+
+// hasMatch looks for a descendant of a node that matches, checking each one
+// with its real ancestors so that child selectors inside :has work.
+func (p pseudoSelector) hasMatch(n Node, ancestors []Node, depth int) bool {
+	if depth > 0 && p.selector.matches(n, ancestors) {
+		return true
+	}
+
+	w, ok := n.(Walker)
+	if !ok || (p.child && depth > 0) {
+		return false
+	}
+
+	found := false
+
+	inner := append(append([]Node{}, ancestors...), n)
+	w.Walk(func(c Node) error {
+		if !found {
+			found = p.hasMatch(c, inner, depth+1)
+		}
+
+		return nil
+	})
+
+	return found
+}
+
+// fieldValue finds a field by name, ignoring case, and turns it into a
+// string. Nested nodes such as the condition of an IfNode are represented by
+// their content if they have any, and by their formatted source otherwise.
+func fieldValue(n Node, name string) (string, bool) {
+	v := reflect.ValueOf(n)
+	if v.Kind() != reflect.Struct {
+		return "", false
+	}
+
+	f := v.FieldByNameFunc(func(s string) bool { return strings.EqualFold(s, name) })
+	if !f.IsValid() {
+		return "", false
+	}
+
+	return stringValue(f)
+}
+
+func fieldValues(n Node) []string {
+	v := reflect.ValueOf(n)
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var a []string
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Anonymous {
+			continue
+		}
+
+		if f := v.Field(i); f.Kind() == reflect.String {
+			a = append(a, f.String())
+		}
+	}
+
+	return a
+}
+
+func stringValue(v reflect.Value) (string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true
+	case reflect.Int:
+		return strconv.Itoa(int(v.Int())), true
+	case reflect.Interface:
+		if v.IsNil() {
+			return "", true
+		}
+
+		n, ok := v.Interface().(Node)
+		if !ok {
+			return "", false
+		}
+
+		if s, ok := fieldValue(n, "Content"); ok {
+			return s, true
+		}
+
+		buf := bytes.NewBuffer(nil)
+		FormatNode(n, buf)
+
+		return strings.TrimSpace(buf.String()), true
+	default:
+		return "", false
+	}
+}
+
+type selectorParser struct {
+	s string
+	i int
+}
+
+func (p *selectorParser) skipSpace() bool {
+	start := p.i
+	for p.i < len(p.s) && unicode.IsSpace(rune(p.s[p.i])) {
+		p.i++
+	}
+
+	return p.i > start
+}
+
+func (p *selectorParser) peek() byte {
+	if p.i >= len(p.s) {
+		return 0
+	}
+
+	return p.s[p.i]
+}
+
+func (p *selectorParser) selector() (*Selector, error) {
+	var s Selector
+
+	for {
+		p.skipSpace()
+
+		c, err := p.complex()
+		if err != nil {
+			return nil, err
+		}
+
+		s.alternatives = append(s.alternatives, *c)
+
+		if p.skipSpace(); p.peek() != ',' {
+			return &s, nil
+		}
+
+		p.i++
+	}
+}
+
+func (p *selectorParser) complex() (*complexSelector, error) {
+	var compounds []compoundSelector
+	var child []bool
+
+	for {
+		c, err := p.compound()
+		if err != nil {
+			return nil, err
+		}
+
+		compounds = append([]compoundSelector{*c}, compounds...)
+
+		space := p.skipSpace()
+
+		switch b := p.peek(); {
+		case b == '>':
+			p.i++
+			p.skipSpace()
+			child = append([]bool{true}, child...)
+		case space && b != 0 && b != ',' && b != ')':
+			child = append([]bool{false}, child...)
+		default:
+			return &complexSelector{compounds: compounds, child: child}, nil
+		}
+	}
+}
+
+func (p *selectorParser) compound() (*compoundSelector, error) {
+	var c compoundSelector
+
+	if p.peek() == '*' {
+		p.i++
+		c.name = "*"
+	} else {
+		c.name = p.ident()
+	}
+
+	for {
+		switch p.peek() {
+		case '[':
+			a, err := p.attribute()
+			if err != nil {
+				return nil, err
+			}
+
+			c.attributes = append(c.attributes, *a)
+		case ':':
+			s, err := p.pseudo()
+			if err != nil {
+				return nil, err
+			}
+
+			c.pseudos = append(c.pseudos, *s)
+		default:
+			if c.name == "" && len(c.attributes) == 0 && len(c.pseudos) == 0 {
+				if p.i >= len(p.s) {
+					return nil, fmt.Errorf("expected selector at end of input")
+				}
+
+				return nil, fmt.Errorf("expected selector at offset %d, found %q", p.i, p.s[p.i])
+			}
+
+			return &c, nil
+		}
+	}
+}
+
+func (p *selectorParser) ident() string {
+	start := p.i
+	for p.i < len(p.s) && (p.s[p.i] == '_' || p.s[p.i] == '-' || unicode.IsLetter(rune(p.s[p.i])) || unicode.IsDigit(rune(p.s[p.i]))) {
+		p.i++
+	}
+
+	return p.s[start:p.i]
+}
+
+func (p *selectorParser) attribute() (*attributeSelector, error) {
+	p.i++
+	p.skipSpace()
+
+	var a attributeSelector
+
+	if a.field = p.ident(); a.field == "" {
+		return nil, fmt.Errorf("expected field name at offset %d", p.i)
+	}
+
+	p.skipSpace()
+
+	for _, op := range []string{"=", "!=", "^=", "$=", "*=", "~="} {
+		if strings.HasPrefix(p.s[p.i:], op) {
+			a.op = op
+		}
+	}
+
+	if a.op != "" {
+		p.i += len(a.op)
+		p.skipSpace()
+
+		v, err := p.value("]")
+		if err != nil {
+			return nil, err
+		}
+		a.value = v
+
+		if a.op == "~=" {
+			if a.re, err = regexp.Compile(v); err != nil {
+				return nil, fmt.Errorf("invalid regular expression for %s: %w", a.field, err)
+			}
+		}
+
+		p.skipSpace()
+	}
+
+	if p.peek() != ']' {
+		return nil, fmt.Errorf("expected ] at offset %d", p.i)
+	}
+	p.i++
+
+	return &a, nil
+}
+
+// value reads a quoted string, or anything up to whitespace or one of the
+// terminating characters.
+func (p *selectorParser) value(terminators string) (string, error) {
+	if p.peek() == '"' {
+		start := p.i
+		for p.i++; p.i < len(p.s) && p.s[p.i] != '"'; p.i++ {
+			if p.s[p.i] == '\\' {
+				p.i++
+			}
+		}
+
+		if p.i >= len(p.s) {
+			return "", fmt.Errorf("unterminated string at offset %d", start)
+		}
+		p.i++
+
+		return strconv.Unquote(p.s[start:p.i])
+	}
+
+	start := p.i
+	for p.i < len(p.s) && !unicode.IsSpace(rune(p.s[p.i])) && !strings.ContainsRune(terminators, rune(p.s[p.i])) {
+		p.i++
+	}
+
+	return p.s[start:p.i], nil
+}
+
+func (p *selectorParser) pseudo() (*pseudoSelector, error) {
+	p.i++
+
+	s := pseudoSelector{name: p.ident()}
+
+	if p.peek() != '(' {
+		return nil, fmt.Errorf("expected ( after :%s at offset %d", s.name, p.i)
+	}
+	p.i++
+	p.skipSpace()
+
+	switch s.name {
+	case "contains":
+		v, err := p.value(")")
+		if err != nil {
+			return nil, err
+		}
+		s.text = v
+	case "not", "has":
+		if s.name == "has" && p.peek() == '>' {
+			s.child = true
+			p.i++
+			p.skipSpace()
+		}
+
+		sel, err := p.selector()
+		if err != nil {
+			return nil, err
+		}
+		s.selector = sel
+	default:
+		return nil, fmt.Errorf("unknown pseudo-class :%s", s.name)
+	}
+
+	p.skipSpace()
+
+	if p.peek() != ')' {
+		return nil, fmt.Errorf("expected ) at offset %d", p.i)
+	}
+	p.i++
+
+	return &s, nil
+}
@@ -0,0 +1,79 @@
+package parser
+
+import (
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+)
+
+func queryNames(n Node, selector string) []string {
+  var a []string
+
+  for _, e := range MustQuery(n, selector) {
+    switch e := e.(type) {
+    case StateNode:
+      a = append(a, e.Name)
+    case EdgeNode:
+      a = append(a, e.Left+">"+e.Right)
+    case ActionNode:
+      a = append(a, e.Content)
+    case PartitionNode:
+      a = append(a, e.Label)
+    default:
+      a = append(a, e.NodeName())
+    }
+  }
+
+  return a
+}
+
+func TestQuery(t *testing.T) {
+  a := assert.New(t)
+
+  simple, err := parseDocument(&scanner{d: readTestFile("simple-code-1-input.uml")})
+  a.NoError(err)
+  tiny, err := parseDocument(&scanner{d: readTestFile("tiny-code.uml")})
+  a.NoError(err)
+
+  for _, e := range []struct {
+    doc      *DocumentNode
+    selector string
+    result   []string
+  }{
+    {simple, "StateNode[Name=Begin] > StateNode", []string{"Begin_E1", "Begin_X1"}},
+    {simple, "State[name=Begin] > State", []string{"Begin_E1", "Begin_X1"}},
+    {simple, "DocumentNode > StateNode", []string{"Begin", "StateB"}},
+    {simple, "EdgeNode[Right=StateB]", []string{"Begin>StateB"}},
+    {simple, "EdgeNode[Text]", []string{"Begin>StateB"}},
+    {simple, "StateNode[Label^=\"Exit Condition\"]", []string{"Begin_X1", "StateB_X1", "StateB_X2"}},
+    {simple, "StateNode[Label$=2]", []string{"StateB_X2"}},
+    {simple, "StateNode[Text~=\"^Field[AB]\"]", []string{"Begin_E1", "Begin_X1"}},
+    {simple, "StateNode[Stereotype!=\"\"]", []string{"Begin"}},
+    {simple, "StateNode:has(StateNode[Text*=FieldD])", []string{"StateB"}},
+    {simple, "StateNode:has(> SeparatorNode)", []string{"Begin"}},
+    {simple, "DocumentNode:has(> SeparatorNode)", nil},
+    {simple, "StateNode:has(SeparatorNode)", []string{"Begin"}},
+    {simple, "StateNode:not(:has(*)):not([Label*=Entry])", []string{"Begin_X1", "StateB_X1", "StateB_X2"}},
+    {simple, "SeparatorNode, EdgeNode[Left=\"[*]\"]", []string{"SeparatorNode", "[*]>Begin"}},
+    {tiny, "IfNode ActionNode", []string{"C1", "C2", "C3"}},
+    {tiny, "IfNode > ActionNode", []string{"C1"}},
+    {tiny, "ActionNode:contains(\"2\")", []string{"C2"}},
+    {tiny, "ElseNode[Condition=\"A == B2\"] ActionNode", []string{"C2", "C3"}},
+    {tiny, "PartitionNode[Label^=X] *[Colour=Red]:contains(C3)", []string{"C3"}},
+    {tiny, "NoteNode[Floating=true]", []string{"NoteNode"}},
+    {tiny, "Missing", nil},
+  } {
+    a.Equal(e.result, queryNames(*e.doc, e.selector), e.selector)
+  }
+}
+
+func TestCompileSelectorErrors(t *testing.T) {
+  a := assert.New(t)
+
+  for _, s := range []string{"", "StateNode[", "StateNode[Name=", "StateNode[Name=\"x]", "StateNode:foo(x)", "StateNode >", "A, ", "StateNode[Name~=(]", ":has(A"} {
+    _, err := CompileSelector(s)
+    a.Error(err, s)
+  }
+
+  a.Panics(func() { MustQuery(DocumentNode{}, "[") })
+}
@@ -0,0 +1,190 @@
+package parser
+
+import (
+	"bytes"
+	"reflect"
+)
+
+// TextEdit replaces the source between the offsets Start and End with Text.
+// Editors that work in lines and columns can use LineIndex.Offset to get the
+// offsets.
+type TextEdit struct {
+	Start, End int
+	Text       string
+}
+
+// ReparseDocument parses source, which should be the source of prev with edit
+// applied to it. Top level nodes that finish on a line before the edit, or
+// start on a line after it, are reused instead of being parsed again, with the
+// positions of the ones after it shifted to match the new source. Only the
+// lines in between are parsed, unless the edit changes the structure of the
+// document in a way that means everything has to be parsed again, such as
+// opening a block that isn't closed yet.
+//
+// lines should be the index of prev's source, and is updated to match the new
+// source so that it can be kept from one edit to the next. It can be nil if
+// there isn't one yet.
+func ReparseDocument(prev DocumentNode, source string, edit TextEdit, lines *LineIndex) (*DocumentNode, error) {
+	d := []byte(source)
+
+	delta := len(edit.Text) - (edit.End - edit.Start)
+	editEnd := edit.Start + len(edit.Text)
+
+	if edit.Start < 0 || edit.End < edit.Start || editEnd > len(d) {
+		if lines != nil {
+			*lines = *NewLineIndex(d)
+		}
+
+		return ParseDocument(source)
+	}
+
+	if lines == nil {
+		lines = NewLineIndex(d)
+	} else {
+		lines.Update(edit)
+	}
+
+	if prev.SourceRange.End.Offset == 0 {
+		return ParseDocument(source)
+	}
+
+	// nodes are only reused if there's a line break between them and the
+	// edit, since anything on the same line could change how they parse.
+	before := func(end int) bool {
+		return end < edit.Start && bytes.IndexByte(d[end+1:edit.Start], '\n') != -1
+	}
+	after := func(start int) bool {
+		return start >= edit.End && bytes.IndexByte(d[editEnd:start+delta], '\n') != -1
+	}
+
+	var prefix, suffix []Node
+	for _, n := range prev.Nodes {
+		if !before(nodeRange(n).End.Offset) {
+			break
+		}
+
+		prefix = append(prefix, n)
+	}
+
+	// timing ticks and the branches of mind maps don't have an end of their
+	// own, they go until the next one starts, so the last one before the edit
+	// can take in lines from it.
+	if len(prefix) > 0 {
+		switch prefix[len(prefix)-1].(type) {
+		case TickNode, BranchNode, SideNode:
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	for i := len(prev.Nodes) - 1; i >= len(prefix); i-- {
+		if !after(nodeRange(prev.Nodes[i]).Start.Offset) {
+			break
+		}
+
+		suffix = append([]Node{prev.Nodes[i]}, suffix...)
+	}
+
+	// the start tag is on a line of its own, so the middle starts straight
+	// after it if there's nothing to reuse before the edit.
+	start := prev.SourceRange.Start.Offset + len("@start"+prev.Kind.String()) - 1
+	if len(prefix) > 0 {
+		start = nodeRange(prefix[len(prefix)-1]).End.Offset
+	}
+	if !before(start) {
+		return ParseDocument(source)
+	}
+
+	stop := len(d)
+	if len(suffix) > 0 {
+		stop = nodeRange(suffix[0]).Start.Offset + delta
+	}
+
+	s := &scanner{d: d, p: start + 1, k: prev.Kind, x: lines}
+
+	middle, ended, err := parseNodes(s, stop)
+	if err != nil || ended != (len(suffix) == 0) || (len(suffix) > 0 && s.p != stop) {
+		return ParseDocument(source)
+	}
+
+	// nodes without a position of their own, like the separators in
+	// composite states, have a zero range, which stays that way.
+	shift := func(r SourceRange) SourceRange {
+		if r == (SourceRange{}) {
+			return r
+		}
+
+		return SourceRange{
+			Start: s.lines().Position(r.Start.Offset + delta),
+			End:   s.lines().Position(r.End.Offset + delta),
+		}
+	}
+
+	doc := DocumentNode{BaseNode: BaseNode{SourceRange: SourceRange{Start: prev.SourceRange.Start}}, Kind: prev.Kind}
+
+	doc.Nodes = append(doc.Nodes, prefix...)
+	doc.Nodes = append(doc.Nodes, middle...)
+	for _, n := range suffix {
+		doc.Nodes = append(doc.Nodes, mapRanges(reflect.ValueOf(&n).Elem(), shift).Interface().(Node))
+	}
+
+	if ended {
+		doc.SourceRange.End = s.sp(s.p - 1)
+	} else {
+		doc.SourceRange.End = shift(prev.SourceRange).End
+	}
+
+	return &doc, nil
+}
+
+func nodeRange(n Node) SourceRange {
+	if r, ok := n.(interface{ GetSourceRange() SourceRange }); ok {
+		return r.GetSourceRange()
+	}
+
+	return SourceRange{}
+}
+
+var sourceRangeType = reflect.TypeOf(SourceRange{})
+
+// mapRanges makes a deep copy of a value with fn applied to every SourceRange
+// in it, so that the original tree is left alone.
+func mapRanges(v reflect.Value, fn func(r SourceRange) SourceRange) reflect.Value {
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == sourceRangeType {
+			return reflect.ValueOf(fn(v.Interface().(SourceRange)))
+		}
+
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < c.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(mapRanges(v.Field(i), fn))
+			}
+		}
+
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(mapRanges(v.Index(i), fn))
+		}
+
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.New(v.Type()).Elem()
+		c.Set(mapRanges(v.Elem(), fn))
+
+		return c
+	default:
+		return v
+	}
+}
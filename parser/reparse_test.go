@@ -0,0 +1,160 @@
+package parser
+
+import (
+  "io/ioutil"
+  "strings"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+)
+
+func testReparse(t *testing.T, src, old, text string) (*DocumentNode, *DocumentNode) {
+  a := assert.New(t)
+
+  prev, err := ParseDocument(src)
+  if !a.NoError(err) {
+    return nil, nil
+  }
+
+  start := strings.Index(src, old)
+  if !a.NotEqual(-1, start) {
+    return nil, nil
+  }
+
+  edit := TextEdit{Start: start, End: start + len(old), Text: text}
+  updated := src[:edit.Start] + edit.Text + src[edit.End:]
+
+  lines := NewLineIndex([]byte(src))
+
+  got, gotErr := ReparseDocument(*prev, updated, edit, lines)
+  want, wantErr := ParseDocument(updated)
+
+  a.Equal(wantErr, gotErr)
+  a.Equal(want, got)
+  a.Equal(NewLineIndex([]byte(updated)), lines)
+
+  return prev, got
+}
+
+func TestReparseDocument(t *testing.T) {
+  a := assert.New(t)
+
+  d, err := ioutil.ReadFile("testdata/complex-code-1-input.uml")
+  if !a.NoError(err) {
+    return
+  }
+
+  src := string(d)
+  lines := strings.Split(src, "\n")
+
+  // every line replaced with something a bit longer, something a bit
+  // shorter, and nothing at all.
+  for _, l := range lines {
+    if strings.TrimSpace(l) == "" {
+      continue
+    }
+
+    testReparse(t, src, l, l+" // more")
+    testReparse(t, src, l, l[:len(l)/2])
+    testReparse(t, src, l+"\n", "")
+  }
+}
+
+func TestReparseDocumentShift(t *testing.T) {
+  a := assert.New(t)
+
+  const src = "@startuml\nA --> B : [[http://a.example]]\nB --> C\nC --> D : [[http://c.example]]\n@enduml\n"
+
+  prev, doc := testReparse(t, src, "B --> C", "B --> C : a longer label\nC --> B")
+  if doc == nil {
+    return
+  }
+
+  a.Len(doc.Nodes, 4)
+
+  // the first node is kept as it was, and the last one is a copy with its
+  // ranges moved down a line.
+  a.Equal(prev.Nodes[0], doc.Nodes[0])
+  a.Equal("4:11-4:30", prev.Nodes[2].(EdgeNode).Links[0].SourceRange.String())
+  a.Equal("5:11-5:30", doc.Nodes[3].(EdgeNode).Links[0].SourceRange.String())
+  a.Equal("6:7", doc.GetSourceRange().End.String())
+}
+
+func TestReparseDocumentSeparators(t *testing.T) {
+  a := assert.New(t)
+
+  const src = "@startuml\nA --> B\n\nstate C {\n  state D\n  ---\n  state E\n}\n@enduml\n"
+
+  _, doc := testReparse(t, src, "A --> B", "A --> B\nB --> C")
+  if doc == nil || !a.Len(doc.Nodes, 3) {
+    return
+  }
+
+  a.Equal(SourceRange{}, doc.Nodes[2].(StateNode).Children[1].(SeparatorNode).SourceRange)
+}
+
+func TestReparseDocumentStructure(t *testing.T) {
+  const src = "@startuml\nA --> B\n\nB --> C\n\nstate C {\n  state D\n}\n@enduml\n"
+
+  // opening a block swallows the lines after it.
+  testReparse(t, src, "B --> C", "state B {")
+  // closing one early leaves the rest at the top.
+  testReparse(t, src, "  state D\n", "}\n")
+  // errors come back the same as with a full parse.
+  testReparse(t, src, "B --> C", "B -->")
+  // and so does losing the end of the document.
+  testReparse(t, src, "@enduml\n", "")
+  testReparse(t, src, "@startuml\n", "")
+}
+
+func TestReparseDocumentOpenEnded(t *testing.T) {
+  const timing = "@startuml\nconcise \"User\" as U\n\n@0\nU is Idle\n\n@100\nU is Busy\n@enduml\n"
+
+  // taking out a tick moves what was under it into the one before.
+  testReparse(t, timing, "@100\n", "")
+  testReparse(t, timing, "U is Busy", "U is Waiting")
+
+  const wbs = "@startwbs\n* root\n** a\n*** b\n\n* other\n** c\n@endwbs\n"
+
+  // and taking out a branch moves its children up to the one before.
+  testReparse(t, wbs, "* other\n", "")
+  testReparse(t, wbs, "* other", "'* other")
+}
+
+func TestLineIndex(t *testing.T) {
+  a := assert.New(t)
+
+  const src = "ab\n\ncde\nf"
+
+  x := NewLineIndex([]byte(src))
+
+  a.Equal(4, x.Lines())
+
+  for i := 0; i <= len(src); i++ {
+    lc := GetLineAndColumnForOffset([]byte(src), i)
+    a.Equal(SourcePosition{Offset: i, Line: lc[0], Column: lc[1]}, x.Position(i))
+  }
+
+  a.Equal(0, x.Offset(1, 1))
+  a.Equal(3, x.Offset(2, 1))
+  a.Equal(6, x.Offset(3, 3))
+  a.Equal(8, x.Offset(4, 1))
+}
+
+func TestLineIndexUpdate(t *testing.T) {
+  a := assert.New(t)
+
+  const src = "ab\n\ncde\nf\n"
+
+  for start := 0; start <= len(src); start++ {
+    for end := start; end <= len(src); end++ {
+      for _, text := range []string{"", "x", "\n", "x\ny\n", "\n\nz"} {
+        x := NewLineIndex([]byte(src))
+        x.Update(TextEdit{Start: start, End: end, Text: text})
+
+        updated := src[:start] + text + src[end:]
+        a.Equal(NewLineIndex([]byte(updated)), x, "%q", updated)
+      }
+    }
+  }
+}
@@ -10,6 +10,17 @@ type scanner struct {
 	p int
 	h []int
 	a [][]SourceRange
+	x *LineIndex
+
+	// o holds the offset and number of lines that come before d in the whole
+	// source, and e is set once the scanner has looked past the end of d. Both are only used when
+	// parsing a stream a piece at a time.
+	o SourcePosition
+	e bool
+
+	// k is the kind of document being parsed, which decides how lines are
+	// parsed and which tag ends it.
+	k DocumentKind
 }
 
 func (s *scanner) pos() int    { return s.p }
@@ -24,7 +35,14 @@ func (s *scanner) byte() byte              { b := s.d[s.p]; s.move(1); return b
 func (s *scanner) read(n int) []byte       { d := s.d[s.p : s.p+n]; s.move(n); return d }
 func (s *scanner) readString(n int) string { return string(s.read(n)) }
 
-func (s *scanner) eof() bool { return s.p >= len(s.d) }
+func (s *scanner) eof() bool {
+	if s.p >= len(s.d) {
+		s.e = true
+		return true
+	}
+
+	return false
+}
 
 func (s *scanner) ws() {
 	for !s.eof() {
@@ -66,13 +84,28 @@ func GetLineAndColumnForOffset(d []byte, p int) [2]int {
 	return [2]int{l + 1, len(b) - i}
 }
 
+func (s *scanner) lines() *LineIndex {
+	if s.x == nil {
+		s.x = NewLineIndex(s.d)
+	}
+
+	return s.x
+}
+
 func (s *scanner) lc(p int) [2]int {
-	return GetLineAndColumnForOffset(s.d, p)
+	sp := s.sp(p)
+	return [2]int{sp.Line, sp.Column}
 }
 
 func (s *scanner) sp(p int) SourcePosition {
-	l := s.lc(p)
-	return SourcePosition{Offset: p, Line: l[0], Column: l[1]}
+	sp := s.lines().Position(p)
+
+	// d always starts at the start of a line, so only the offset and line
+	// need to be moved.
+	sp.Offset += s.o.Offset
+	sp.Line += s.o.Line
+
+	return sp
 }
 
 func (s *scanner) sr(p [2]int) SourceRange {
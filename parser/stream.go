@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// ParseReader parses a document from rd a piece at a time, calling fn with
+// each top level node as soon as it's complete. Only the text of the node
+// being parsed is kept in memory, so it works on documents that are too big
+// to parse with ParseDocument. If fn returns an error, parsing stops and that
+// error is returned.
+func ParseReader(rd io.Reader, fn func(n Node) error) error {
+	r := bufio.NewReader(rd)
+
+	var (
+		buf     []byte
+		p       int
+		o       SourcePosition
+		done    bool
+		started bool
+		kind    DocumentKind
+	)
+
+	// more reads at least as much again as is waiting to be parsed, so that
+	// a node that goes over a lot of lines isn't parsed over and over.
+	more := func() error {
+		want := len(buf) - p
+
+		for n := 0; (n == 0 || n < want) && !done; {
+			l, err := r.ReadBytes('\n')
+			if err == io.EOF {
+				done = true
+			} else if err != nil {
+				return fmt.Errorf("ParseReader: %w", err)
+			}
+
+			buf = append(buf, l...)
+			n += len(l)
+		}
+
+		return nil
+	}
+
+	for {
+		s := &scanner{d: buf, p: p, o: o, k: kind}
+
+		s.wsnl()
+
+		tk := getNodeToken(s)
+
+		var node Node
+		var err error
+
+		switch {
+		case !started:
+			var ok bool
+			if kind, ok = startKind(tk); !ok {
+				err = s.err(fmt.Errorf("parseDocument: first token should be @startuml"))
+			}
+		case tk == nil, isEnd(s, tk):
+		default:
+			node, err = parseNode(s, tk)
+		}
+
+		// anything that ran into the end of what's been read so far might
+		// turn out differently with more to go on.
+		if s.e && !done {
+			if err := more(); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case !started:
+			started = true
+		case tk == nil:
+			return fmt.Errorf("parseDocument: couldn't find @end%s token", kind)
+		case isEnd(s, tk):
+			return nil
+		case node != nil:
+			if err := fn(node); err != nil {
+				return err
+			}
+		}
+
+		// drop the lines that are finished with, keeping buf at the start of
+		// a line.
+		p = s.p
+		if i := bytes.LastIndexByte(buf[:p], '\n'); i != -1 {
+			o.Offset += i + 1
+			o.Line += bytes.Count(buf[:i+1], []byte("\n"))
+			buf = append(buf[:0], buf[i+1:]...)
+			p -= i + 1
+		}
+	}
+}
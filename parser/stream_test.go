@@ -0,0 +1,68 @@
+package parser
+
+import (
+  "errors"
+  "path/filepath"
+  "strings"
+  "testing"
+  "testing/iotest"
+
+  "github.com/stretchr/testify/assert"
+)
+
+func TestParseReader(t *testing.T) {
+  a := assert.New(t)
+
+  files, err := filepath.Glob("testdata/*.uml")
+  if !a.NoError(err) {
+    return
+  }
+
+  for _, f := range files {
+    src := string(readTestFile(filepath.Base(f)))
+
+    doc, err := ParseDocument(src)
+    if !a.NoError(err, f) {
+      continue
+    }
+
+    var nodes []Node
+    a.NoError(ParseReader(iotest.OneByteReader(strings.NewReader(src)), func(n Node) error {
+      nodes = append(nodes, n)
+      return nil
+    }), f)
+
+    a.Equal(doc.Nodes, nodes, f)
+  }
+}
+
+func TestParseReaderErrors(t *testing.T) {
+  a := assert.New(t)
+
+  for _, src := range []string{
+    "",
+    "A --> B\n",
+    "@startuml\nA --> B\n",
+    "@startuml\nA --> B\nstate C {\n  state D\n",
+    "@startuml\nA --> B\n\n\nA B C D\nB --> C\n@enduml\n",
+    "@startuml\npartition P {\n  :a;\n  :b;\n@enduml\n",
+  } {
+    _, want := ParseDocument(src)
+    got := ParseReader(strings.NewReader(src), func(n Node) error { return nil })
+
+    // the message can include a token, whose offsets are only relative to
+    // what ParseReader had read, so only the start is compared.
+    if a.Error(want, src) && a.Error(got, src) {
+      a.Equal(strings.SplitN(want.Error(), ": ", 2)[0], strings.SplitN(got.Error(), ": ", 2)[0], src)
+    }
+  }
+
+  stop := errors.New("stop")
+
+  calls := 0
+  a.Equal(stop, ParseReader(strings.NewReader("@startuml\nA --> B\nB --> C\n@enduml\n"), func(n Node) error {
+    calls++
+    return stop
+  }))
+  a.Equal(1, calls)
+}
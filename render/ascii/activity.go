@@ -0,0 +1,452 @@
+package ascii
+
+import (
+	"fknsrs.biz/p/plantuml/parser"
+	"fknsrs.biz/p/plantuml/render/internal/flow"
+)
+
+const (
+	flowGap   = 2
+	branchGap = 3
+	noteGap   = 3
+)
+
+// block is a laid out piece of an activity diagram, measured in cells. cx is
+// the column of the flow line that enters at the top and leaves at the
+// bottom.
+type block struct {
+	w, h, cx int
+	// terminal blocks (such as `end') don't have an outgoing flow.
+	terminal bool
+	// detached blocks (such as floating notes) aren't part of the flow at all.
+	detached bool
+	// open blocks (partitions) have a border that the flow runs through, so
+	// the flow entering them stops at the border without an arrow head.
+	open bool
+	// entered and exited are set before drawing, to say whether the flow
+	// actually reaches the top or leaves the bottom of the block.
+	entered, exited bool
+	draw            func(g *grid, x, y int)
+}
+
+func renderActivityDiagram(doc parser.DocumentNode, charset Charset) *grid {
+	b := layoutSequence(doc.Nodes, charset)
+
+	g := newGrid(charset, b.w, b.h)
+	b.draw(g, 0, 0)
+
+	return g
+}
+
+func layoutNode(n parser.Node, charset Charset) *block {
+	switch n := n.(type) {
+	case parser.StartNode:
+		return layoutGlyph(charset.start, false)
+	case parser.EndNode:
+		return layoutGlyph(charset.end, true)
+	case parser.ActionNode:
+		return layoutAction(n)
+	case parser.NoteNode:
+		return layoutNote(n)
+	case parser.PartitionNode:
+		return layoutPartition(n, charset)
+	case parser.IfNode:
+		return layoutIf(n, charset)
+	case parser.ForkNode:
+		return layoutFork(n, charset)
+	default:
+		return nil
+	}
+}
+
+func layoutSequence(nodes []parser.Node, charset Charset) *block {
+	var blocks []*block
+
+	for _, step := range flow.Steps(nodes) {
+		b := layoutNode(step.Node, charset)
+		if b == nil {
+			continue
+		}
+
+		for _, n := range step.Notes {
+			b = attachNote(b, layoutNote(n), n.Position == "left")
+		}
+
+		b.detached = step.Detached
+
+		blocks = append(blocks, b)
+	}
+
+	if len(blocks) == 0 {
+		s := &block{w: 1}
+		s.draw = func(g *grid, x, y int) {}
+		return s
+	}
+
+	var l, r, h int
+	for i, b := range blocks {
+		if b.cx > l {
+			l = b.cx
+		}
+		if b.w-b.cx > r {
+			r = b.w - b.cx
+		}
+		if i > 0 {
+			h += flowGap
+		}
+		h += b.h
+	}
+
+	var connected []*block
+	for _, b := range blocks {
+		if !b.detached {
+			connected = append(connected, b)
+		}
+	}
+
+	s := &block{w: l + r, h: h, cx: l}
+	if len(connected) > 0 {
+		s.open = connected[0].open
+		s.terminal = connected[len(connected)-1].terminal
+	}
+
+	s.draw = func(g *grid, x, y int) {
+		for i, b := range connected {
+			b.entered = i > 0 && !connected[i-1].terminal
+			b.exited = i < len(connected)-1 && !b.terminal
+		}
+		if len(connected) > 0 {
+			connected[0].entered = s.entered
+			connected[len(connected)-1].exited = s.exited
+		}
+
+		var previous *block
+		var previousBottom int
+
+		for _, b := range blocks {
+			b.draw(g, x+l-b.cx, y)
+
+			if !b.detached {
+				if previous != nil && !previous.terminal {
+					g.line(x+l, openEdge(previousBottom, -1, previous.open), x+l, openEdge(y-1, 1, b.open))
+					if !b.open {
+						g.arrow(x+l, y-1, down)
+					}
+				}
+
+				previous = b
+				previousBottom = y + b.h
+			}
+
+			y += b.h + flowGap
+		}
+	}
+
+	return s
+}
+
+func attachNote(b, note *block, onLeft bool) *block {
+	h := b.h
+	if note.h > h {
+		h = note.h
+	}
+
+	a := &block{w: b.w + noteGap + note.w, h: h, cx: b.cx, terminal: b.terminal, open: b.open}
+	if onLeft {
+		a.cx = note.w + noteGap + b.cx
+	}
+
+	a.draw = func(g *grid, x, y int) {
+		b.entered, b.exited = a.entered, a.exited
+
+		row := y + minInt(b.h, note.h)/2
+
+		if onLeft {
+			note.draw(g, x, y)
+			b.draw(g, x+note.w+noteGap, y)
+			g.dashed(x+note.w, row, x+note.w+noteGap-1, row)
+		} else {
+			b.draw(g, x, y)
+			note.draw(g, x+b.w+noteGap, y)
+			g.dashed(x+b.w, row, x+b.w+noteGap-1, row)
+		}
+	}
+
+	return a
+}
+
+func layoutGlyph(r rune, end bool) *block {
+	return &block{
+		w:        1,
+		h:        1,
+		terminal: end,
+		draw: func(g *grid, x, y int) {
+			g.set(x, y, r)
+		},
+	}
+}
+
+func layoutAction(n parser.ActionNode) *block {
+	content := flow.TrimIndent(n.Content)
+	tw, th := textSize(content)
+	w, h := tw+4, th+2
+
+	return &block{
+		w:  w,
+		h:  h,
+		cx: w / 2,
+		draw: func(g *grid, x, y int) {
+			g.box(x, y, w, h)
+			g.text(x+2, y+1, content)
+		},
+	}
+}
+
+func layoutNote(n parser.NoteNode) *block {
+	content := flow.TrimIndent(n.Content)
+	tw, th := textSize(content)
+	w, h := tw+4, th+2
+
+	return &block{
+		w:  w,
+		h:  h,
+		cx: w / 2,
+		draw: func(g *grid, x, y int) {
+			g.dashed(x, y, x+w-1, y)
+			g.dashed(x, y+h-1, x+w-1, y+h-1)
+			g.dashed(x, y, x, y+h-1)
+			g.dashed(x+w-1, y, x+w-1, y+h-1)
+			g.text(x+2, y+1, content)
+		},
+	}
+}
+
+func layoutPartition(n parser.PartitionNode, charset Charset) *block {
+	inner := layoutSequence(n.Children, charset)
+
+	w := inner.w + 4
+	if l := len([]rune(n.Label)) + 6; l > w {
+		w = l
+	}
+
+	offset := (w - inner.w) / 2
+
+	// the label sits in the top border, so move it out of the way if the
+	// flow line would run through it.
+	label := " " + n.Label + " "
+	labelX := 2
+	if labelX+len([]rune(label)) > offset+inner.cx {
+		labelX = offset + inner.cx + 2
+		if r := labelX + len([]rune(label)) + 2; r > w {
+			w = r
+		}
+	}
+
+	p := &block{
+		w:        w,
+		h:        inner.h + 4,
+		cx:       offset + inner.cx,
+		terminal: inner.terminal,
+		open:     true,
+	}
+
+	p.draw = func(g *grid, x, y int) {
+		g.frame(x, y, p.w, p.h)
+		g.text(x+labelX, y, label)
+
+		inner.entered, inner.exited = p.entered, p.exited
+
+		cx := x + p.cx
+		if p.entered {
+			g.line(cx, y, cx, openEdge(y+1, 1, inner.open))
+			if !inner.open {
+				g.arrow(cx, y+1, down)
+			}
+		}
+
+		inner.draw(g, x+offset, y+2)
+
+		if p.exited {
+			g.line(cx, openEdge(y+2+inner.h, -1, inner.open), cx, y+p.h-1)
+		}
+	}
+
+	return p
+}
+
+func layoutIf(n parser.IfNode, charset Charset) *block {
+	return layoutBranches("< "+flow.Content(n.Condition)+" >", flow.IfBranches(n), false, charset)
+}
+
+func layoutFork(n parser.ForkNode, charset Charset) *block {
+	return layoutBranches("", flow.ForkBranches(n), true, charset)
+}
+
+// layoutBranches places a set of branches side by side between a split and a
+// join; a decision and a junction for ifs, and bars for forks.
+func layoutBranches(head string, branches []flow.Branch, isFork bool, charset Charset) *block {
+	var blocks []*block
+	var centres []int
+
+	hasLabels := false
+	x := 0
+	for i, e := range branches {
+		b := layoutSequence(e.Statements, charset)
+		blocks = append(blocks, b)
+
+		if e.Label != "" {
+			hasLabels = true
+		}
+
+		r := b.w - b.cx - 1
+		if l := len([]rune(e.Label)) + 2; e.Label != "" && l > r {
+			r = l
+		}
+
+		if i > 0 {
+			x += branchGap
+		}
+
+		x += b.cx
+		centres = append(centres, x)
+		x += r + 1
+	}
+
+	width := x
+
+	cx := (centres[0] + centres[len(centres)-1]) / 2
+
+	headWidth := len([]rune(head))
+	if isFork {
+		headWidth = centres[len(centres)-1] - centres[0] + 3
+		if headWidth < 5 {
+			headWidth = 5
+		}
+	}
+
+	if shift := headWidth/2 - cx; shift > 0 {
+		for i := range centres {
+			centres[i] += shift
+		}
+		cx += shift
+		width += shift
+	}
+	if r := cx + headWidth - headWidth/2; r > width {
+		width = r
+	}
+
+	// rows, from the top: the head, the line splitting into branches (ifs
+	// only), labels, arrows into each branch, then the branches themselves.
+	top := 1
+	if !isFork {
+		top++
+	}
+	if hasLabels {
+		top++
+	}
+	top++
+
+	var bodyHeight int
+	terminal := true
+	for _, b := range blocks {
+		if b.h > bodyHeight {
+			bodyHeight = b.h
+		}
+		if !b.terminal {
+			terminal = false
+		}
+	}
+
+	h := top + bodyHeight
+	if !terminal {
+		h += 2
+	}
+
+	s := &block{w: width, h: h, cx: cx, terminal: terminal}
+
+	s.draw = func(g *grid, x, y int) {
+		if isFork {
+			for i := 0; i < headWidth; i++ {
+				g.set(x+cx-headWidth/2+i, y, charset.bar)
+			}
+		} else {
+			g.text(x+cx-headWidth/2, y, head)
+			g.line(x+centres[0], y+1, x+centres[len(centres)-1], y+1)
+			g.cell(x+cx, y+1).lines |= up
+		}
+
+		for i, b := range blocks {
+			bx := x + centres[i]
+
+			if !isFork {
+				g.cell(bx, y+1).lines |= down
+			}
+
+			if hasLabels && branches[i].Label != "" {
+				g.text(bx+2, y+top-2, branches[i].Label)
+			}
+
+			g.line(bx, y+1, bx, openEdge(y+top-1, 1, b.open))
+			if b.h > 0 && !b.open {
+				g.arrow(bx, y+top-1, down)
+			}
+
+			b.entered = true
+			b.exited = !terminal && !b.terminal
+			b.draw(g, bx-b.cx, y+top)
+
+			if b.exited {
+				g.line(bx, openEdge(y+top+b.h, -1, b.open), bx, y+h-1)
+			}
+		}
+
+		if terminal {
+			return
+		}
+
+		last := y + h - 1
+
+		if isFork {
+			for i := 0; i < headWidth; i++ {
+				g.set(x+cx-headWidth/2+i, last, charset.bar)
+			}
+			return
+		}
+
+		lo, hi := cx, cx
+		for i, b := range blocks {
+			if !b.terminal {
+				lo, hi = minInt(lo, centres[i]), maxInt(hi, centres[i])
+			}
+		}
+
+		g.line(x+lo, last, x+hi, last)
+		g.cell(x+cx, last).lines |= down
+	}
+
+	return s
+}
+
+// openEdge extends a line by a cell into the border of an open block, so the
+// two join up.
+func openEdge(y, d int, open bool) int {
+	if open {
+		return y + d
+	}
+
+	return y
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
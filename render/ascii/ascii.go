@@ -0,0 +1,293 @@
+package ascii
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"fknsrs.biz/p/plantuml/parser"
+	"fknsrs.biz/p/plantuml/render/internal/flow"
+)
+
+const (
+	up = 1 << iota
+	down
+	left
+	right
+)
+
+// Charset is the set of characters a diagram is drawn with.
+type Charset struct {
+	// lines is indexed by a bitmask of the directions a line leaves a cell.
+	lines   [16]rune
+	corners [4]rune
+	dashed  [2]rune
+	arrows  [4]rune
+	bar     rune
+	start   rune
+	end     rune
+}
+
+// Unicode draws diagrams with box-drawing characters.
+var Unicode = Charset{
+	lines: [16]rune{
+		' ', '│', '│', '│',
+		'─', '┘', '┐', '┤',
+		'─', '└', '┌', '├',
+		'─', '┴', '┬', '┼',
+	},
+	corners: [4]rune{'╭', '╮', '╰', '╯'},
+	dashed:  [2]rune{'┄', '┆'},
+	arrows:  [4]rune{'▲', '▼', '◀', '▶'},
+	bar:     '━',
+	start:   '●',
+	end:     '◉',
+}
+
+// Plain sticks to 7-bit ASCII, for places that mangle anything else.
+var Plain = Charset{
+	lines: [16]rune{
+		' ', '|', '|', '|',
+		'-', '+', '+', '+',
+		'-', '+', '+', '+',
+		'-', '+', '+', '+',
+	},
+	corners: [4]rune{'+', '+', '+', '+'},
+	dashed:  [2]rune{'.', ':'},
+	arrows:  [4]rune{'^', 'v', '<', '>'},
+	bar:     '=',
+	start:   '*',
+	end:     '@',
+}
+
+// Render draws a state or activity diagram as text.
+func Render(doc parser.DocumentNode, wr io.Writer, charset Charset) error {
+	var g *grid
+
+	switch {
+	case isStateDiagram(doc):
+		var err error
+		if g, err = renderStateDiagram(doc, charset); err != nil {
+			return fmt.Errorf("Render: %w", err)
+		}
+	case isActivityDiagram(doc):
+		g = renderActivityDiagram(doc, charset)
+	default:
+		return fmt.Errorf("Render: document doesn't contain a state or activity diagram")
+	}
+
+	if _, err := io.WriteString(wr, g.String()); err != nil {
+		return fmt.Errorf("Render: %w", err)
+	}
+
+	return nil
+}
+
+func isStateDiagram(doc parser.DocumentNode) bool {
+	return doc.FindNode(func(n parser.Node) bool {
+		switch n.(type) {
+		case parser.StateNode, parser.EdgeNode:
+			return true
+		default:
+			return false
+		}
+	}) != nil
+}
+
+func isActivityDiagram(doc parser.DocumentNode) bool {
+	return doc.FindNode(func(n parser.Node) bool {
+		switch n.(type) {
+		case parser.StartNode, parser.EndNode, parser.ActionNode, parser.IfNode, parser.ForkNode, parser.PartitionNode:
+			return true
+		default:
+			return false
+		}
+	}) != nil
+}
+
+type cell struct {
+	r     rune
+	lines int
+}
+
+// grid is a canvas of character cells. Cells either hold a character, or a
+// set of line directions that get turned into the right box-drawing
+// character once everything has been drawn, so lines that cross or meet join
+// up properly.
+type grid struct {
+	charset Charset
+	cells   [][]cell
+}
+
+func newGrid(charset Charset, w, h int) *grid {
+	g := &grid{charset: charset, cells: make([][]cell, h)}
+	for i := range g.cells {
+		g.cells[i] = make([]cell, w)
+	}
+
+	return g
+}
+
+func (g *grid) cell(x, y int) *cell {
+	if y < 0 || y >= len(g.cells) || x < 0 || x >= len(g.cells[y]) {
+		return nil
+	}
+
+	return &g.cells[y][x]
+}
+
+func (g *grid) set(x, y int, r rune) {
+	if c := g.cell(x, y); c != nil {
+		c.r = r
+	}
+}
+
+func (g *grid) text(x, y int, s string) {
+	for i, l := range flow.SplitLines(s) {
+		for j, r := range []rune(l) {
+			g.set(x+j, y+i, r)
+		}
+	}
+}
+
+// line joins two cells in the same row or column.
+func (g *grid) line(x1, y1, x2, y2 int) {
+	dx, dy := sign(x2-x1), sign(y2-y1)
+
+	for x, y := x1, y1; x != x2 || y != y2; x, y = x+dx, y+dy {
+		a, b := g.cell(x, y), g.cell(x+dx, y+dy)
+
+		switch {
+		case dx > 0:
+			a.lines, b.lines = a.lines|right, b.lines|left
+		case dx < 0:
+			a.lines, b.lines = a.lines|left, b.lines|right
+		case dy > 0:
+			a.lines, b.lines = a.lines|down, b.lines|up
+		case dy < 0:
+			a.lines, b.lines = a.lines|up, b.lines|down
+		}
+	}
+}
+
+// frame draws a square box out of lines, so that anything crossing it joins
+// the border.
+func (g *grid) frame(x, y, w, h int) {
+	g.line(x, y, x+w-1, y)
+	g.line(x+w-1, y, x+w-1, y+h-1)
+	g.line(x, y+h-1, x+w-1, y+h-1)
+	g.line(x, y, x, y+h-1)
+}
+
+// box draws a box with rounded corners, over the top of any lines.
+func (g *grid) box(x, y, w, h int) {
+	horizontal, vertical := g.charset.lines[left|right], g.charset.lines[up|down]
+
+	for i := x + 1; i < x+w-1; i++ {
+		g.set(i, y, horizontal)
+		g.set(i, y+h-1, horizontal)
+	}
+
+	for i := y + 1; i < y+h-1; i++ {
+		g.set(x, i, vertical)
+		g.set(x+w-1, i, vertical)
+	}
+
+	g.set(x, y, g.charset.corners[0])
+	g.set(x+w-1, y, g.charset.corners[1])
+	g.set(x, y+h-1, g.charset.corners[2])
+	g.set(x+w-1, y+h-1, g.charset.corners[3])
+
+	for i := y + 1; i < y+h-1; i++ {
+		for j := x + 1; j < x+w-1; j++ {
+			g.set(j, i, ' ')
+		}
+	}
+}
+
+// divider draws a horizontal line across a box drawn with box.
+func (g *grid) divider(x, y, w int) {
+	for i := x + 1; i < x+w-1; i++ {
+		g.set(i, y, g.charset.lines[left|right])
+	}
+
+	g.set(x, y, g.charset.lines[up|down|right])
+	g.set(x+w-1, y, g.charset.lines[up|down|left])
+}
+
+func (g *grid) dashed(x1, y1, x2, y2 int) {
+	dx, dy := sign(x2-x1), sign(y2-y1)
+
+	r := g.charset.dashed[0]
+	if dx == 0 {
+		r = g.charset.dashed[1]
+	}
+
+	for x, y := x1, y1; ; x, y = x+dx, y+dy {
+		g.set(x, y, r)
+		if x == x2 && y == y2 {
+			break
+		}
+	}
+}
+
+func (g *grid) arrow(x, y, direction int) {
+	switch direction {
+	case up:
+		g.set(x, y, g.charset.arrows[0])
+	case down:
+		g.set(x, y, g.charset.arrows[1])
+	case left:
+		g.set(x, y, g.charset.arrows[2])
+	case right:
+		g.set(x, y, g.charset.arrows[3])
+	}
+}
+
+func (g *grid) String() string {
+	var lines []string
+
+	for _, row := range g.cells {
+		var b strings.Builder
+		for _, c := range row {
+			switch {
+			case c.r != 0:
+				b.WriteRune(c.r)
+			default:
+				b.WriteRune(g.charset.lines[c.lines])
+			}
+		}
+
+		lines = append(lines, strings.TrimRight(b.String(), " "))
+	}
+
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[0 : len(lines)-1]
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func sign(i int) int {
+	switch {
+	case i < 0:
+		return -1
+	case i > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func textSize(s string) (int, int) {
+	lines := flow.SplitLines(s)
+
+	var w int
+	for _, l := range lines {
+		if n := len([]rune(l)); n > w {
+			w = n
+		}
+	}
+
+	return w, len(lines)
+}
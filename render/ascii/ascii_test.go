@@ -0,0 +1,146 @@
+package ascii
+
+import (
+  "bytes"
+  "io/ioutil"
+  "strings"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+
+  "fknsrs.biz/p/plantuml/parser"
+)
+
+func render(t *testing.T, src string, charset Charset) string {
+  doc, err := parser.ParseDocument(src)
+  if !assert.NoError(t, err) {
+    return ""
+  }
+
+  buf := bytes.NewBuffer(nil)
+  assert.NoError(t, Render(*doc, buf, charset))
+
+  return buf.String()
+}
+
+func TestRenderActivityDiagram(t *testing.T) {
+  a := assert.New(t)
+
+  out := render(t, strings.Join([]string{
+    "@startuml",
+    "start",
+    ":Hello;",
+    "if (ok?) then (yes)",
+    "  :A;",
+    "else (no)",
+    "  end",
+    "endif",
+    "fork",
+    "  :B;",
+    "forkagain",
+    "  :C;",
+    "endfork",
+    "end",
+    "@enduml",
+  }, "\n"), Plain)
+
+  a.Equal(strings.Join([]string{
+    "      *",
+    "      |",
+    "      v",
+    "  +-------+",
+    "  | Hello |",
+    "  +-------+",
+    "      |",
+    "      v",
+    "   < ok? >",
+    "  +---+----+",
+    "  | yes    | no",
+    "  v        v",
+    "+---+      @",
+    "| A |",
+    "+---+",
+    "  |",
+    "  +---+",
+    "      |",
+    "      v",
+    " ===========",
+    "  v       v",
+    "+---+   +---+",
+    "| B |   | C |",
+    "+---+   +---+",
+    "  |       |",
+    " ===========",
+    "      |",
+    "      v",
+    "      @",
+  }, "\n")+"\n", out)
+}
+
+func TestRenderActivityDiagramPartition(t *testing.T) {
+  a := assert.New(t)
+
+  out := render(t, "@startuml\nstart\npartition Shipping {\n  :Ship;\n}\nend\n@enduml\n", Unicode)
+
+  a.Contains(out, "┌──────┼─ Shipping ─┐")
+  a.Contains(out, "│  │ Ship │         │")
+  a.Contains(out, "└──────┼────────────┘")
+}
+
+func TestRenderStateDiagram(t *testing.T) {
+  a := assert.New(t)
+
+  out := render(t, "@startuml\n[*] --> A\nA --> B : go\nB -left-> C\nB --> [*]\n@enduml\n", Plain)
+
+  a.Equal(strings.Join([]string{
+    "           *",
+    "           |",
+    "           |",
+    "           |",
+    "           v",
+    "         +---+",
+    "         | A |",
+    "         +---+",
+    "           |",
+    "           |",
+    "           |  go",
+    "           |",
+    "           v",
+    "+---+    +---+",
+    "| C |<---| B |",
+    "+---+    +---+",
+    "           |",
+    "           |",
+    "           |",
+    "           v",
+    "           @",
+  }, "\n")+"\n", out)
+}
+
+func TestRenderStateDiagramComposite(t *testing.T) {
+  a := assert.New(t)
+
+  out := render(t, readTestFile("simple-code-1-input.uml"), Unicode)
+
+  for _, s := range []string{"begin", "Entry Condition 1", "│ FieldA == 0       │", "state-b", "FieldE == 0", "┄┄┄┄", "●", "▼"} {
+    a.Contains(out, s)
+  }
+}
+
+func TestRenderEmptyDocument(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := parser.ParseDocument("@startuml\nskinparam A B\n@enduml\n")
+  a.NoError(err)
+
+  a.Error(Render(*doc, ioutil.Discard, Unicode))
+}
+
+func readTestFile(name string) string {
+  d, err := ioutil.ReadFile("../../parser/testdata/" + name)
+  if err != nil {
+    panic(err)
+  }
+
+  return string(d)
+}
@@ -0,0 +1,258 @@
+package ascii
+
+import (
+	"fmt"
+	"math"
+
+	"fknsrs.biz/p/plantuml/layout"
+	"fknsrs.biz/p/plantuml/parser"
+)
+
+const clusterPadding = 2
+
+var stateOptions = layout.Options{NodeSpacing: 4, RankSpacing: 4, LoopSize: 2, LabelSpacing: 2, ParallelSpacing: 1}
+
+type sizer struct{}
+
+func (sizer) NodeSize(n parser.Node) (float64, float64) {
+	stateNode, ok := n.(parser.StateNode)
+	if !ok {
+		return 1, 1
+	}
+
+	if stateNode.Name == "[*]" {
+		return 1, 1
+	}
+
+	w, h := textSize(stateLabel(stateNode))
+	if stateNode.Text != "" {
+		tw, th := textSize(stateNode.Text)
+		w = maxInt(w, tw)
+		h += th + 1
+	}
+
+	// composite states only need the header measured; the border and
+	// padding come from the cluster.
+	if len(stateNode.Children) > 0 {
+		return float64(w), float64(h + 1)
+	}
+
+	return float64(w + 4), float64(h + 2)
+}
+
+func (sizer) TextSize(s string) (float64, float64) {
+	w, h := textSize(s)
+	return float64(w), float64(h)
+}
+
+func stateLabel(n parser.StateNode) string {
+	if n.Label != "" {
+		return n.Label
+	}
+
+	return n.Name
+}
+
+type rect struct{ x, y, w, h int }
+
+func toRect(r layout.Rect) rect {
+	return rect{int(math.Round(r.X)), int(math.Round(r.Y)), int(math.Round(r.Width)), int(math.Round(r.Height))}
+}
+
+func (r rect) centre() (int, int) {
+	return r.x + r.w/2, r.y + r.h/2
+}
+
+func renderStateDiagram(doc parser.DocumentNode, charset Charset) (*grid, error) {
+	geometry, err := layout.Layout(layout.StateGraph(doc, sizer{}, clusterPadding), stateOptions)
+	if err != nil {
+		return nil, fmt.Errorf("renderStateDiagram: %w", err)
+	}
+
+	// leave room for self loops and labels that hang off the edge.
+	g := newGrid(charset, int(math.Ceil(geometry.Width))+1, int(math.Ceil(geometry.Height))+1)
+
+	rects := make(map[string]rect)
+	for _, e := range geometry.Clusters {
+		rects[e.ID] = toRect(e.Rect)
+	}
+	for _, e := range geometry.Nodes {
+		rects[e.ID] = toRect(e.Rect)
+	}
+
+	for _, e := range geometry.Clusters {
+		r := rects[e.ID]
+
+		stateNode, ok := e.Source.(parser.StateNode)
+		if !ok {
+			drawSeparator(g, geometry, rects, e)
+			continue
+		}
+
+		g.frame(r.x, r.y, r.w, r.h)
+
+		label := stateLabel(stateNode)
+		lw, lh := textSize(label)
+		g.text(r.x+(r.w-lw)/2, r.y+1, label)
+
+		y := r.y + 1 + lh
+		if stateNode.Text != "" {
+			g.line(r.x, y, r.x+r.w-1, y)
+			g.text(r.x+2, y+1, stateNode.Text)
+			_, th := textSize(stateNode.Text)
+			y += th + 1
+		}
+
+		g.line(r.x, y, r.x+r.w-1, y)
+	}
+
+	for _, e := range geometry.Edges {
+		drawTransition(g, e, rects)
+	}
+
+	for _, e := range geometry.Nodes {
+		r := rects[e.ID]
+
+		switch e.ID {
+		case layout.InitialState:
+			g.set(r.x, r.y, charset.start)
+		case layout.FinalState:
+			g.set(r.x, r.y, charset.end)
+		default:
+			stateNode := e.Source.(parser.StateNode)
+
+			g.box(r.x, r.y, r.w, r.h)
+
+			label := stateLabel(stateNode)
+			lw, lh := textSize(label)
+			g.text(r.x+(r.w-lw)/2, r.y+1, label)
+
+			if stateNode.Text != "" {
+				g.divider(r.x, r.y+1+lh, r.w)
+				g.text(r.x+2, r.y+2+lh, stateNode.Text)
+			}
+		}
+	}
+
+	for _, e := range geometry.Edges {
+		if e.Label != "" {
+			g.text(int(math.Round(e.LabelPosition.X)), int(math.Round(e.LabelPosition.Y)), e.Label)
+		}
+	}
+
+	return g, nil
+}
+
+// drawSeparator draws the dashed line above a region of a composite state,
+// unless it's the first region.
+func drawSeparator(g *grid, geometry *layout.Geometry, rects map[string]rect, region layout.PlacedCluster) {
+	r := rects[region.ID]
+
+	previous := -1
+	for _, e := range geometry.Clusters {
+		if p := rects[e.ID]; e.Parent == region.Parent && e.Source == nil && p.y < r.y && p.y+p.h > previous {
+			previous = p.y + p.h
+		}
+	}
+
+	parent, ok := rects[region.Parent]
+	if previous == -1 || !ok {
+		return
+	}
+
+	y := (previous + r.y) / 2
+	g.dashed(parent.x+1, y, parent.x+parent.w-2, y)
+}
+
+// drawTransition routes an edge along the points the layout picked, using
+// only horizontal and vertical lines.
+func drawTransition(g *grid, e layout.PlacedEdge, rects map[string]rect) {
+	from, to := rects[e.From], rects[e.To]
+
+	if e.From == e.To {
+		x, y := from.x+from.w, from.y+from.h/2
+		g.line(x, y-1, x+2, y-1)
+		g.line(x+2, y-1, x+2, y+1)
+		g.line(x+2, y+1, x, y+1)
+		g.arrow(x, y+1, left)
+		return
+	}
+
+	var points [][2]int
+	for _, p := range e.Points[1 : len(e.Points)-1] {
+		points = append(points, [2]int{int(math.Round(p.X)), int(math.Round(p.Y))})
+	}
+
+	next, previous := [2]int{}, [2]int{}
+	if len(points) > 0 {
+		next, previous = points[0], points[len(points)-1]
+	} else {
+		x, y := to.centre()
+		next = [2]int{x, y}
+		x, y = from.centre()
+		previous = [2]int{x, y}
+	}
+
+	start, _ := port(from, next)
+	end, direction := port(to, previous)
+
+	points = append([][2]int{start}, points...)
+	points = append(points, end)
+
+	// rounding can leave the bends of a route a column out from where they
+	// should be, which would draw as a little kink, so straighten those up.
+	for i := 1; i < len(points)-1; i++ {
+		if d := points[i][0] - points[i-1][0]; d == 1 || d == -1 {
+			points[i][0] = points[i-1][0]
+		}
+	}
+	if n := len(points); n > 2 {
+		if d := points[n-1][0] - points[n-2][0]; d == 1 || d == -1 {
+			for i, x := n-2, points[n-2][0]; i > 0 && points[i][0] == x; i-- {
+				points[i][0] = points[n-1][0]
+			}
+		}
+	}
+
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+
+		switch {
+		case a[0] == b[0] || a[1] == b[1]:
+			g.line(a[0], a[1], b[0], b[1])
+		case i == len(points)-1 && (direction == left || direction == right):
+			g.line(a[0], a[1], a[0], b[1])
+			g.line(a[0], b[1], b[0], b[1])
+		default:
+			mid := (a[1] + b[1]) / 2
+			if i == len(points)-1 {
+				mid = b[1] - 1
+				if a[1] > b[1] {
+					mid = b[1] + 1
+				}
+			}
+			g.line(a[0], a[1], a[0], mid)
+			g.line(a[0], mid, b[0], mid)
+			g.line(b[0], mid, b[0], b[1])
+		}
+	}
+
+	g.arrow(end[0], end[1], direction)
+}
+
+// port picks the cell just outside a box on the side facing a point, and
+// the direction an arrow arriving there would point in.
+func port(r rect, towards [2]int) ([2]int, int) {
+	cx, cy := r.centre()
+
+	switch {
+	case towards[1] >= r.y+r.h:
+		return [2]int{cx, r.y + r.h}, up
+	case towards[1] < r.y:
+		return [2]int{cx, r.y - 1}, down
+	case towards[0] >= cx:
+		return [2]int{r.x + r.w, cy}, left
+	default:
+		return [2]int{r.x - 1, cy}, right
+	}
+}
@@ -0,0 +1,141 @@
+// Package flow has the parts of laying out activity diagrams that don't
+// depend on how they're drawn: which notes belong to which steps, what the
+// branches of ifs and forks are, and how their text is tidied up. The
+// renderers measure and draw what it gives them.
+package flow
+
+import (
+	"strings"
+
+	"fknsrs.biz/p/plantuml/parser"
+)
+
+// Step is one thing in a sequence: a node in the flow along with any notes
+// attached to it, or a floating note that isn't part of the flow at all.
+type Step struct {
+	Node  parser.Node
+	Notes []parser.NoteNode
+	// Detached is set for notes that aren't attached to anything.
+	Detached bool
+}
+
+// Steps turns a list of nodes into steps. Notes are attached to the step
+// before them unless they're floating or there's nothing to attach them to,
+// and nodes that activity diagrams don't show are left out.
+func Steps(nodes []parser.Node) []Step {
+	var steps []Step
+
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case parser.NoteNode:
+			if !n.Floating && len(steps) > 0 && !steps[len(steps)-1].Detached {
+				steps[len(steps)-1].Notes = append(steps[len(steps)-1].Notes, n)
+				continue
+			}
+
+			steps = append(steps, Step{Node: n, Detached: true})
+		case parser.StartNode, parser.EndNode, parser.ActionNode, parser.PartitionNode, parser.IfNode, parser.ForkNode:
+			steps = append(steps, Step{Node: n})
+		}
+	}
+
+	return steps
+}
+
+// Branch is one way through an if or a fork.
+type Branch struct {
+	Label      string
+	Statements []parser.Node
+}
+
+// IfBranches lists the branches of an if, including those of its elseifs.
+// Ifs without an else get an empty branch at the end for the way around.
+func IfBranches(n parser.IfNode) []Branch {
+	branches := []Branch{{Label: Content(n.Value), Statements: n.Statements}}
+
+	hasElse := false
+	for e := n.Else; e != nil; {
+		elseNode, ok := e.(parser.ElseNode)
+		if !ok {
+			break
+		}
+
+		label := Content(elseNode.Value)
+		if elseNode.Condition != nil {
+			label = Content(elseNode.Condition) + ": " + label
+		} else {
+			hasElse = true
+		}
+
+		branches = append(branches, Branch{Label: label, Statements: elseNode.Statements})
+
+		e = elseNode.Else
+	}
+
+	if !hasElse {
+		branches = append(branches, Branch{})
+	}
+
+	return branches
+}
+
+// ForkBranches lists the branches of a fork, one for it and one for each
+// fork again.
+func ForkBranches(n parser.ForkNode) []Branch {
+	branches := []Branch{{Statements: n.Statements}}
+
+	for e := n.ForkAgain; e != nil; {
+		forkNode, ok := e.(parser.ForkNode)
+		if !ok {
+			break
+		}
+
+		branches = append(branches, Branch{Statements: forkNode.Statements})
+
+		e = forkNode.ForkAgain
+	}
+
+	return branches
+}
+
+// Content is the text of a condition or a value like `(yes)`, or nothing if
+// there isn't one.
+func Content(n parser.Node) string {
+	if p, ok := n.(parser.ParenthesisNode); ok {
+		return p.Content
+	}
+
+	return ""
+}
+
+// TrimIndent removes the indentation that action and note content inherits
+// from the source file, along with any blank lines around it.
+func TrimIndent(s string) string {
+	lines := strings.Split(s, "\n")
+
+	indent := -1
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+
+		if n := len(l) - len(strings.TrimLeft(l, " \t")); indent == -1 || n < indent {
+			indent = n
+		}
+	}
+
+	for i, l := range lines {
+		if len(l) >= indent && indent > 0 {
+			lines[i] = l[indent:]
+		}
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// SplitLines splits label text on both real newlines and PlantUML's escaped
+// `\n` sequences.
+func SplitLines(s string) []string {
+	s = strings.Replace(s, "\\n", "\n", -1)
+	return strings.Split(strings.TrimRight(s, "\n"), "\n")
+}
@@ -0,0 +1,68 @@
+package flow
+
+import (
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+
+  "fknsrs.biz/p/plantuml/parser"
+)
+
+func TestSteps(t *testing.T) {
+  a := assert.New(t)
+
+  floating := parser.NoteNode{Floating: true, Content: "c"}
+  left := parser.NoteNode{Position: "left", Content: "b"}
+  first := parser.NoteNode{Content: "a"}
+
+  steps := Steps([]parser.Node{
+    first,
+    parser.StartNode{},
+    parser.ActionNode{Content: "x"},
+    left,
+    parser.SkinParamNode{},
+    floating,
+    parser.NoteNode{Content: "d"},
+    parser.EndNode{},
+  })
+
+  a.Equal([]Step{
+    {Node: first, Detached: true},
+    {Node: parser.StartNode{}},
+    {Node: parser.ActionNode{Content: "x"}, Notes: []parser.NoteNode{left}},
+    {Node: floating, Detached: true},
+    {Node: parser.NoteNode{Content: "d"}, Detached: true},
+    {Node: parser.EndNode{}},
+  }, steps)
+}
+
+func TestBranches(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := parser.ParseDocument("@startuml\nif (a) then (yes)\n  :x;\nelse if (b) then (maybe)\n  :y;\nendif\nfork\n  :z;\nforkagain\n  :w;\n  :v;\nendfork\n@enduml\n")
+  if !a.NoError(err) || !a.Len(doc.Nodes, 2) {
+    return
+  }
+
+  ifNode := doc.Nodes[0].(parser.IfNode)
+  a.Equal("a", Content(ifNode.Condition))
+
+  var labels []string
+  for _, b := range IfBranches(ifNode) {
+    labels = append(labels, b.Label)
+  }
+  a.Equal([]string{"yes", "b: maybe", ""}, labels)
+
+  branches := ForkBranches(doc.Nodes[1].(parser.ForkNode))
+  if a.Len(branches, 2) {
+    a.Len(branches[0].Statements, 1)
+    a.Len(branches[1].Statements, 2)
+  }
+}
+
+func TestTrimIndent(t *testing.T) {
+  a := assert.New(t)
+
+  a.Equal("a\n  b\nc", TrimIndent("\n    a\n      b\n    c\n  "))
+  a.Equal([]string{"a", "b", "c"}, SplitLines("a\\nb\nc\n"))
+}
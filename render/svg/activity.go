@@ -0,0 +1,389 @@
+package svg
+
+import (
+	"fknsrs.biz/p/plantuml/parser"
+	"fknsrs.biz/p/plantuml/render/internal/flow"
+	"fknsrs.biz/p/plantuml/style"
+)
+
+const (
+	activityGap  = 20
+	branchGap    = 30
+	diamondSize  = 24
+	barHeight    = 6
+	circleRadius = 10
+)
+
+// block is a laid out piece of an activity diagram. Blocks are positioned by
+// their top left corner; cx is the horizontal offset of the flow line that
+// enters at the top and leaves at the bottom.
+type block struct {
+	w, h, cx float64
+	// terminal blocks (such as `end') don't have an outgoing flow.
+	terminal bool
+	// detached blocks (such as floating notes) aren't part of the flow at all.
+	detached bool
+	draw     func(c *canvas, x, y float64)
+}
+
+func renderActivityDiagram(c *canvas, doc parser.DocumentNode) (float64, float64) {
+	b := layoutSequence(c, doc.Nodes)
+	b.draw(c, 0, 0)
+	return b.w, b.h
+}
+
+func layoutNode(c *canvas, n parser.Node) *block {
+	switch n := n.(type) {
+	case parser.StartNode:
+		return layoutCircle(c, n, false)
+	case parser.EndNode:
+		return layoutCircle(c, n, true)
+	case parser.ActionNode:
+		return layoutAction(c, n)
+	case parser.NoteNode:
+		return layoutNote(c, n)
+	case parser.PartitionNode:
+		return layoutPartition(c, n)
+	case parser.IfNode:
+		return layoutIf(c, n)
+	case parser.ForkNode:
+		return layoutFork(c, n)
+	default:
+		return nil
+	}
+}
+
+func layoutSequence(c *canvas, nodes []parser.Node) *block {
+	var blocks []*block
+
+	for _, step := range flow.Steps(nodes) {
+		b := layoutNode(c, step.Node)
+		if b == nil {
+			continue
+		}
+
+		for _, n := range step.Notes {
+			b = attachNote(b, layoutNote(c, n), n.Position == "left")
+		}
+
+		b.detached = step.Detached
+
+		blocks = append(blocks, b)
+	}
+
+	if len(blocks) == 0 {
+		return &block{w: branchGap, cx: branchGap / 2, draw: func(c *canvas, x, y float64) {}}
+	}
+
+	var left, right, h float64
+	for i, b := range blocks {
+		if b.cx > left {
+			left = b.cx
+		}
+		if b.w-b.cx > right {
+			right = b.w - b.cx
+		}
+		if i > 0 {
+			h += activityGap
+		}
+		h += b.h
+	}
+
+	last := blocks[len(blocks)-1]
+
+	return &block{
+		w:        left + right,
+		h:        h,
+		cx:       left,
+		terminal: last.terminal,
+		draw: func(c *canvas, x, y float64) {
+			st := c.style(parser.EdgeNode{})
+
+			var previous *block
+			var previousBottom float64
+
+			for _, b := range blocks {
+				bx := x + left - b.cx
+				b.draw(c, bx, y)
+
+				if !b.detached {
+					if previous != nil && !previous.terminal {
+						c.arrow([]point{{x + left, previousBottom}, {x + left, y}}, st)
+					}
+
+					previous = b
+					previousBottom = y + b.h
+				}
+
+				y += b.h + activityGap
+			}
+		},
+	}
+}
+
+func attachNote(b, note *block, left bool) *block {
+	h := b.h
+	if note.h > h {
+		h = note.h
+	}
+
+	if left {
+		return &block{
+			w:        note.w + activityGap + b.w,
+			h:        h,
+			cx:       note.w + activityGap + b.cx,
+			terminal: b.terminal,
+			draw: func(c *canvas, x, y float64) {
+				note.draw(c, x, y)
+				b.draw(c, x+note.w+activityGap, y)
+			},
+		}
+	}
+
+	return &block{
+		w:        b.w + activityGap + note.w,
+		h:        h,
+		cx:       b.cx,
+		terminal: b.terminal,
+		draw: func(c *canvas, x, y float64) {
+			b.draw(c, x, y)
+			note.draw(c, x+b.w+activityGap, y)
+		},
+	}
+}
+
+func layoutCircle(c *canvas, n parser.Node, end bool) *block {
+	st := c.style(n)
+
+	return &block{
+		w:        circleRadius * 2,
+		h:        circleRadius * 2,
+		cx:       circleRadius,
+		terminal: end,
+		draw: func(c *canvas, x, y float64) {
+			fill := st.BackgroundColour
+			if fill == style.Default.BackgroundColour {
+				fill = "#000000"
+			}
+
+			if end {
+				c.circle(x+circleRadius, y+circleRadius, circleRadius, "#FFFFFF", fill, 1.5)
+				c.circle(x+circleRadius, y+circleRadius, circleRadius-4, fill, "", 0)
+			} else {
+				c.circle(x+circleRadius, y+circleRadius, circleRadius, fill, "", 0)
+			}
+		},
+	}
+}
+
+func layoutAction(c *canvas, n parser.ActionNode) *block {
+	st := c.style(n)
+
+	content := flow.TrimIndent(n.Content)
+	tw, th := textSize(content, st)
+	w, h := tw+padding*2, th+padding
+
+	return &block{
+		w:  w,
+		h:  h,
+		cx: w / 2,
+		draw: func(c *canvas, x, y float64) {
+			r := st.RoundCorner
+			if r == 0 {
+				r = 12.5
+			}
+
+			c.rect(x, y, w, h, r, st)
+			c.text(x+padding, y+padding/2, "start", content, st)
+		},
+	}
+}
+
+func layoutNote(c *canvas, n parser.NoteNode) *block {
+	st := c.style(n)
+	if st.BackgroundColour == style.Default.BackgroundColour {
+		st.BackgroundColour = "#FBFB77"
+	}
+
+	content := flow.TrimIndent(n.Content)
+	tw, th := textSize(content, st)
+	w, h := tw+padding*2, th+padding
+
+	return &block{
+		w:  w,
+		h:  h,
+		cx: w / 2,
+		draw: func(c *canvas, x, y float64) {
+			const fold = 8
+
+			c.polygon([]point{{x, y}, {x + w - fold, y}, {x + w, y + fold}, {x + w, y + h}, {x, y + h}}, st)
+			c.text(x+padding, y+padding/2, "start", content, st)
+		},
+	}
+}
+
+func layoutPartition(c *canvas, n parser.PartitionNode) *block {
+	st := c.style(n)
+	st.BackgroundColour = ""
+
+	inner := layoutSequence(c, n.Children)
+	tw, th := textSize(n.Label, st)
+
+	w := inner.w + padding*2
+	if tw+padding*2 > w {
+		w = tw + padding*2
+	}
+
+	h := th + padding + inner.h + padding*2
+	offset := (w - inner.w) / 2
+
+	return &block{
+		w:        w,
+		h:        h,
+		cx:       offset + inner.cx,
+		terminal: inner.terminal,
+		draw: func(c *canvas, x, y float64) {
+			c.rect(x, y, w, h, 0, st)
+			c.text(x+padding, y+padding/2, "start", n.Label, st)
+			c.line(x, y+th+padding, x+tw+padding*2, y+th+padding, st.BorderColour, st.BorderThickness, "")
+			inner.draw(c, x+offset, y+th+padding*2)
+		},
+	}
+}
+
+func layoutIf(c *canvas, n parser.IfNode) *block {
+	return layoutBranches(c, n, flow.Content(n.Condition), flow.IfBranches(n), false)
+}
+
+func layoutFork(c *canvas, n parser.ForkNode) *block {
+	return layoutBranches(c, n, "", flow.ForkBranches(n), true)
+}
+
+// layoutBranches places a set of branches side by side between a split and a
+// join; diamonds for decisions and bars for forks.
+func layoutBranches(c *canvas, n parser.Node, condition string, branches []flow.Branch, isFork bool) *block {
+	st := c.style(n)
+	edgeStyle := c.style(parser.EdgeNode{})
+
+	var blocks []*block
+	var labelHeight float64
+	for _, e := range branches {
+		blocks = append(blocks, layoutSequence(c, e.Statements))
+
+		if e.Label != "" {
+			if _, lh := textSize(e.Label, edgeStyle); lh > labelHeight {
+				labelHeight = lh
+			}
+		}
+	}
+
+	var w float64
+	var offsets []float64
+	for i, b := range blocks {
+		if i > 0 {
+			w += branchGap
+		}
+
+		offsets = append(offsets, w)
+
+		slot := b.w
+		if branches[i].Label != "" {
+			if lw, _ := textSize(branches[i].Label, edgeStyle); b.cx+padding/2+lw > slot {
+				slot = b.cx + padding/2 + lw
+			}
+		}
+
+		w += slot
+	}
+
+	splitHeight := float64(diamondSize)
+	if isFork {
+		splitHeight = barHeight
+	}
+
+	var bodyHeight float64
+	for _, b := range blocks {
+		if b.h > bodyHeight {
+			bodyHeight = b.h
+		}
+	}
+
+	conditionWidth, _ := textSize(condition, st)
+
+	cx := w / 2
+	totalWidth := w
+	if cx+diamondSize/2+conditionWidth+padding > totalWidth {
+		totalWidth = cx + diamondSize/2 + conditionWidth + padding
+	}
+
+	top := splitHeight + activityGap + labelHeight
+	h := top + bodyHeight + activityGap + splitHeight
+
+	allTerminal := true
+	for _, b := range blocks {
+		if !b.terminal {
+			allTerminal = false
+		}
+	}
+
+	return &block{
+		w:        totalWidth,
+		h:        h,
+		cx:       cx,
+		terminal: allTerminal,
+		draw: func(c *canvas, x, y float64) {
+			joinY := y + top + bodyHeight + activityGap
+
+			if isFork {
+				bar := st
+				if bar.BackgroundColour == style.Default.BackgroundColour {
+					bar.BackgroundColour = "#000000"
+				}
+				bar.BorderColour = bar.BackgroundColour
+
+				c.rect(x, y, w, barHeight, 0, bar)
+				if !allTerminal {
+					c.rect(x, joinY, w, barHeight, 0, bar)
+				}
+			} else {
+				c.polygon(diamond(x+cx, y), st)
+				if condition != "" {
+					c.text(x+cx+diamondSize/2+padding/2, y-st.FontSize*0.2, "start", condition, st)
+				}
+				if !allTerminal {
+					c.polygon(diamond(x+cx, joinY), st)
+				}
+			}
+
+			for i, b := range blocks {
+				bx := x + offsets[i]
+				bcx := bx + b.cx
+				by := y + top
+
+				if isFork {
+					c.arrow([]point{{bcx, y + barHeight}, {bcx, by}}, edgeStyle)
+				} else {
+					c.arrow([]point{{x + cx, y + splitHeight}, {x + cx, y + splitHeight + activityGap/2}, {bcx, y + splitHeight + activityGap/2}, {bcx, by}}, edgeStyle)
+				}
+
+				if branches[i].Label != "" {
+					c.text(bcx+padding/2, y+splitHeight+activityGap/2, "start", branches[i].Label, edgeStyle)
+				}
+
+				b.draw(c, bx, by)
+
+				if !b.terminal && !allTerminal {
+					if isFork {
+						c.arrow([]point{{bcx, by + b.h}, {bcx, joinY}}, edgeStyle)
+					} else {
+						c.arrow([]point{{bcx, by + b.h}, {bcx, joinY - activityGap/2}, {x + cx, joinY - activityGap/2}, {x + cx, joinY}}, edgeStyle)
+					}
+				}
+			}
+		},
+	}
+}
+
+func diamond(cx, y float64) []point {
+	return []point{{cx, y}, {cx + diamondSize/2, y + diamondSize/2}, {cx, y + diamondSize}, {cx - diamondSize/2, y + diamondSize/2}}
+}
@@ -0,0 +1,183 @@
+package svg
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"fknsrs.biz/p/plantuml/layout"
+	"fknsrs.biz/p/plantuml/parser"
+	"fknsrs.biz/p/plantuml/style"
+)
+
+const (
+	layerGap = 50
+	stateGap = 40
+)
+
+// sizer measures nodes for the layout package using the same rules the
+// drawing code uses.
+type sizer struct{ c *canvas }
+
+func (s sizer) NodeSize(n parser.Node) (float64, float64) {
+	stateNode, ok := n.(parser.StateNode)
+	if !ok {
+		return textSize("", s.c.style(n))
+	}
+
+	if stateNode.Name == "[*]" {
+		return circleRadius * 2, circleRadius * 2
+	}
+
+	st := s.c.style(n)
+
+	w, h := textSize(stateLabel(stateNode), st)
+	w, h = w+padding*2, h+padding
+
+	if stateNode.Text != "" {
+		bw, bh := textSize(stateNode.Text, st)
+		w = math.Max(w, bw+padding*2)
+		h += bh + padding
+	}
+
+	return w, h
+}
+
+func (s sizer) TextSize(text string) (float64, float64) {
+	return textSize(text, s.c.style(parser.EdgeNode{}))
+}
+
+func stateLabel(n parser.StateNode) string {
+	if n.Label != "" {
+		return n.Label
+	}
+
+	return n.Name
+}
+
+func renderStateDiagram(c *canvas, doc parser.DocumentNode) (float64, float64, error) {
+	g := layout.StateGraph(doc, sizer{c}, padding)
+
+	geometry, err := layout.Layout(g, layout.Options{NodeSpacing: stateGap, RankSpacing: layerGap, LoopSize: 20, LabelSpacing: 4, ParallelSpacing: 12})
+	if err != nil {
+		return 0, 0, fmt.Errorf("renderStateDiagram: %w", err)
+	}
+
+	for _, e := range geometry.Clusters {
+		if e.Source == nil {
+			if parent := geometry.Cluster(e.Parent); parent != nil {
+				drawSeparator(c, geometry, *parent, e)
+			}
+			continue
+		}
+
+		drawState(c, e.Source.(parser.StateNode), e.Rect, true)
+	}
+
+	for _, e := range geometry.Nodes {
+		switch e.ID {
+		case layout.InitialState:
+			c.circle(e.Rect.X+circleRadius, e.Rect.Y+circleRadius, circleRadius, "#000000", "", 0)
+		case layout.FinalState:
+			c.circle(e.Rect.X+circleRadius, e.Rect.Y+circleRadius, circleRadius, "#FFFFFF", "#000000", 1.5)
+			c.circle(e.Rect.X+circleRadius, e.Rect.Y+circleRadius, circleRadius-4, "#000000", "", 0)
+		default:
+			drawState(c, e.Source.(parser.StateNode), e.Rect, false)
+		}
+	}
+
+	labelStyle := c.style(parser.EdgeNode{})
+	for _, e := range geometry.Edges {
+		drawTransition(c, geometry, e, c.style(e.Source), labelStyle)
+	}
+
+	return geometry.Width, geometry.Height, nil
+}
+
+func drawState(c *canvas, n parser.StateNode, r layout.Rect, composite bool) {
+	st := c.style(n)
+
+	corner := st.RoundCorner
+	if corner == 0 {
+		corner = 12.5
+	}
+
+	c.rect(r.X, r.Y, r.Width, r.Height, corner, st)
+
+	label := stateLabel(n)
+
+	_, th := textSize(label, st)
+	c.text(r.X+r.Width/2, r.Y+padding/2, "middle", label, st)
+
+	if n.Text != "" || composite {
+		c.line(r.X, r.Y+th+padding, r.X+r.Width, r.Y+th+padding, st.BorderColour, st.BorderThickness, "")
+	}
+
+	if n.Text != "" {
+		c.text(r.X+padding, r.Y+th+padding*1.5, "start", n.Text, st)
+	}
+}
+
+// drawSeparator draws the dashed line above a region of a composite state,
+// unless it's the first region.
+func drawSeparator(c *canvas, geometry *layout.Geometry, parent layout.PlacedCluster, region layout.PlacedCluster) {
+	var previous *layout.PlacedCluster
+	for i := range geometry.Clusters {
+		e := &geometry.Clusters[i]
+		if e.Parent == parent.ID && e.Source == nil && e.Rect.Y < region.Rect.Y && (previous == nil || e.Rect.Y > previous.Rect.Y) {
+			previous = e
+		}
+	}
+
+	if previous == nil {
+		return
+	}
+
+	st := c.style(parent.Source)
+
+	y := (previous.Rect.Y + previous.Rect.Height + region.Rect.Y) / 2
+	c.line(parent.Rect.X, y, parent.Rect.X+parent.Rect.Width, y, st.BorderColour, st.BorderThickness, "dashed")
+}
+
+func drawTransition(c *canvas, geometry *layout.Geometry, e layout.PlacedEdge, st, labelStyle style.Style) {
+	if len(e.Points) < 2 {
+		return
+	}
+
+	if edgeNode, ok := e.Source.(parser.EdgeNode); ok && strings.Contains(edgeNode.Direction, ".") {
+		st.LineStyle = "dashed"
+	}
+
+	var points []point
+	for _, p := range e.Points {
+		points = append(points, point{p.X, p.Y})
+	}
+
+	// the layout clips edges to rectangles, but pseudo-states are circles.
+	if e.From != e.To {
+		points[0] = clipCircle(geometry.Node(e.From), points[0], points[1])
+		points[len(points)-1] = clipCircle(geometry.Node(e.To), points[len(points)-1], points[len(points)-2])
+	}
+
+	c.arrow(points, st)
+
+	if e.Label != "" {
+		c.text(e.LabelPosition.X, e.LabelPosition.Y, "start", e.Label, labelStyle)
+	}
+}
+
+func clipCircle(n *layout.PlacedNode, p, towards point) point {
+	if n == nil || (n.ID != layout.InitialState && n.ID != layout.FinalState) {
+		return p
+	}
+
+	centre := n.Rect.Centre()
+
+	dx, dy := towards.x-centre.X, towards.y-centre.Y
+	l := math.Hypot(dx, dy)
+	if l == 0 {
+		return p
+	}
+
+	return point{centre.X + dx/l*circleRadius, centre.Y + dy/l*circleRadius}
+}
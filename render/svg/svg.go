@@ -0,0 +1,222 @@
+package svg
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strings"
+
+	"fknsrs.biz/p/plantuml/parser"
+	"fknsrs.biz/p/plantuml/render/internal/flow"
+	"fknsrs.biz/p/plantuml/style"
+)
+
+const (
+	margin      = 10
+	padding     = 10
+	lineSpacing = 1.3
+)
+
+// Render lays out a state or activity diagram and writes it to wr as an SVG
+// document. The kind of diagram is inferred from the nodes the document
+// contains.
+func Render(doc parser.DocumentNode, wr io.Writer) error {
+	resolver, err := style.NewResolver(doc)
+	if err != nil {
+		return fmt.Errorf("Render: %w", err)
+	}
+
+	c := newCanvas(resolver)
+
+	var w, h float64
+	switch {
+	case isStateDiagram(doc):
+		w, h, err = renderStateDiagram(c, doc)
+		if err != nil {
+			return fmt.Errorf("Render: %w", err)
+		}
+	case isActivityDiagram(doc):
+		w, h = renderActivityDiagram(c, doc)
+	default:
+		return fmt.Errorf("Render: document doesn't contain a state or activity diagram")
+	}
+
+	if err := c.writeTo(wr, doc, w+margin*2, h+margin*2); err != nil {
+		return fmt.Errorf("Render: %w", err)
+	}
+
+	return nil
+}
+
+func isStateDiagram(doc parser.DocumentNode) bool {
+	return doc.FindNode(func(n parser.Node) bool {
+		switch n.(type) {
+		case parser.StateNode, parser.EdgeNode:
+			return true
+		default:
+			return false
+		}
+	}) != nil
+}
+
+func isActivityDiagram(doc parser.DocumentNode) bool {
+	return doc.FindNode(func(n parser.Node) bool {
+		switch n.(type) {
+		case parser.StartNode, parser.EndNode, parser.ActionNode, parser.IfNode, parser.ForkNode, parser.PartitionNode:
+			return true
+		default:
+			return false
+		}
+	}) != nil
+}
+
+type canvas struct {
+	resolver *style.Resolver
+	buf      bytes.Buffer
+}
+
+func newCanvas(resolver *style.Resolver) *canvas {
+	return &canvas{resolver: resolver}
+}
+
+func (c *canvas) style(n parser.Node) style.Style {
+	return c.resolver.Resolve(n)
+}
+
+func (c *canvas) writeTo(wr io.Writer, doc parser.DocumentNode, w, h float64) error {
+	background := c.style(doc).BackgroundColour
+	if background == style.Default.BackgroundColour {
+		background = "#FFFFFF"
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(&buf, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%s\" height=\"%s\" viewBox=\"0 0 %s %s\">\n", num(w), num(h), num(w), num(h))
+	fmt.Fprintf(&buf, "<rect x=\"0\" y=\"0\" width=\"%s\" height=\"%s\" fill=\"%s\"/>\n", num(w), num(h), colour(background))
+	fmt.Fprintf(&buf, "<g transform=\"translate(%d,%d)\">\n", margin, margin)
+	buf.Write(c.buf.Bytes())
+	fmt.Fprintf(&buf, "</g>\n</svg>\n")
+
+	if _, err := buf.WriteTo(wr); err != nil {
+		return fmt.Errorf("canvas.writeTo: %w", err)
+	}
+
+	return nil
+}
+
+func (c *canvas) rect(x, y, w, h, r float64, st style.Style) {
+	fmt.Fprintf(&c.buf, "<rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" rx=\"%s\" ry=\"%s\" fill=\"%s\" stroke=\"%s\" stroke-width=\"%s\"%s/>\n", num(x), num(y), num(w), num(h), num(r), num(r), colour(st.BackgroundColour), colour(st.BorderColour), num(st.BorderThickness), dash(st.LineStyle))
+}
+
+func (c *canvas) circle(cx, cy, r float64, fill, stroke string, strokeWidth float64) {
+	fmt.Fprintf(&c.buf, "<circle cx=\"%s\" cy=\"%s\" r=\"%s\" fill=\"%s\" stroke=\"%s\" stroke-width=\"%s\"/>\n", num(cx), num(cy), num(r), colour(fill), colour(stroke), num(strokeWidth))
+}
+
+func (c *canvas) polygon(points []point, st style.Style) {
+	fmt.Fprintf(&c.buf, "<polygon points=\"%s\" fill=\"%s\" stroke=\"%s\" stroke-width=\"%s\"/>\n", pointList(points), colour(st.BackgroundColour), colour(st.BorderColour), num(st.BorderThickness))
+}
+
+func (c *canvas) line(x1, y1, x2, y2 float64, stroke string, strokeWidth float64, lineStyle string) {
+	fmt.Fprintf(&c.buf, "<line x1=\"%s\" y1=\"%s\" x2=\"%s\" y2=\"%s\" stroke=\"%s\" stroke-width=\"%s\"%s/>\n", num(x1), num(y1), num(x2), num(y2), colour(stroke), num(strokeWidth), dash(lineStyle))
+}
+
+func (c *canvas) arrow(points []point, st style.Style) {
+	if len(points) < 2 {
+		return
+	}
+
+	fmt.Fprintf(&c.buf, "<polyline points=\"%s\" fill=\"none\" stroke=\"%s\" stroke-width=\"%s\"%s/>\n", pointList(points), colour(st.LineColour), num(st.LineThickness), dash(st.LineStyle))
+
+	tip, from := points[len(points)-1], points[len(points)-2]
+
+	dx, dy := tip.x-from.x, tip.y-from.y
+	l := math.Hypot(dx, dy)
+	if l == 0 {
+		return
+	}
+	dx, dy = dx/l, dy/l
+
+	const length, width = 9, 4
+
+	head := []point{
+		tip,
+		{tip.x - dx*length - dy*width, tip.y - dy*length + dx*width},
+		{tip.x - dx*length*0.7, tip.y - dy*length*0.7},
+		{tip.x - dx*length + dy*width, tip.y - dy*length - dx*width},
+	}
+
+	fmt.Fprintf(&c.buf, "<polygon points=\"%s\" fill=\"%s\" stroke=\"%s\" stroke-width=\"%s\"/>\n", pointList(head), colour(st.LineColour), colour(st.LineColour), num(st.LineThickness))
+}
+
+func (c *canvas) text(x, y float64, anchor string, s string, st style.Style) {
+	lines := flow.SplitLines(s)
+
+	for i, l := range lines {
+		fmt.Fprintf(&c.buf, "<text x=\"%s\" y=\"%s\" text-anchor=\"%s\" font-family=\"%s\" font-size=\"%s\" fill=\"%s\"%s>%s</text>\n", num(x), num(y+st.FontSize*(lineSpacing*float64(i)+1)), anchor, html.EscapeString(st.FontName), num(st.FontSize), colour(st.FontColour), fontStyle(st.FontStyle), html.EscapeString(l))
+	}
+}
+
+type point struct{ x, y float64 }
+
+func pointList(points []point) string {
+	var a []string
+	for _, p := range points {
+		a = append(a, num(p.x)+","+num(p.y))
+	}
+
+	return strings.Join(a, " ")
+}
+
+func num(f float64) string {
+	return fmt.Sprintf("%g", math.Round(f*100)/100)
+}
+
+func colour(s string) string {
+	if s == "" {
+		return "none"
+	}
+
+	return html.EscapeString(s)
+}
+
+func dash(lineStyle string) string {
+	switch strings.ToLower(lineStyle) {
+	case "", "solid", "plain":
+		return ""
+	case "dashed":
+		return " stroke-dasharray=\"7,7\""
+	case "dotted":
+		return " stroke-dasharray=\"1,3\""
+	default:
+		return " stroke-dasharray=\"" + html.EscapeString(strings.Replace(lineStyle, "-", ",", -1)) + "\""
+	}
+}
+
+func fontStyle(s string) string {
+	switch strings.ToLower(s) {
+	case "bold":
+		return " font-weight=\"bold\""
+	case "italic":
+		return " font-style=\"italic\""
+	default:
+		return ""
+	}
+}
+
+// textSize approximates the size of a block of text; there's no font
+// metrics available so we assume an average glyph is 0.6em wide.
+func textSize(s string, st style.Style) (float64, float64) {
+	lines := flow.SplitLines(s)
+
+	var w float64
+	for _, l := range lines {
+		if lw := float64(len([]rune(l))) * st.FontSize * 0.6; lw > w {
+			w = lw
+		}
+	}
+
+	return w, st.FontSize*(lineSpacing*float64(len(lines)-1)+1) + st.FontSize*0.3
+}
@@ -0,0 +1,183 @@
+package svg
+
+import (
+  "bytes"
+  "encoding/xml"
+  "io"
+  "io/ioutil"
+  "strings"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+
+  "fknsrs.biz/p/plantuml/parser"
+)
+
+func readTestFile(name string) string {
+  d, err := ioutil.ReadFile("../../parser/testdata/" + name)
+  if err != nil {
+    panic(err)
+  }
+
+  return string(d)
+}
+
+type svgElement struct {
+  name  string
+  attrs map[string]string
+  text  string
+}
+
+func parseSVG(t *testing.T, d []byte) []svgElement {
+  var a []svgElement
+
+  dec := xml.NewDecoder(bytes.NewReader(d))
+  for {
+    tk, err := dec.Token()
+    if err == io.EOF {
+      break
+    }
+    if !assert.NoError(t, err) {
+      break
+    }
+
+    switch tk := tk.(type) {
+    case xml.StartElement:
+      e := svgElement{name: tk.Name.Local, attrs: make(map[string]string)}
+      for _, attr := range tk.Attr {
+        e.attrs[attr.Name.Local] = attr.Value
+      }
+      a = append(a, e)
+    case xml.CharData:
+      if len(a) > 0 {
+        a[len(a)-1].text += string(tk)
+      }
+    }
+  }
+
+  return a
+}
+
+func findText(elements []svgElement, text string) *svgElement {
+  for i := range elements {
+    if elements[i].name == "text" && strings.TrimSpace(elements[i].text) == text {
+      return &elements[i]
+    }
+  }
+
+  return nil
+}
+
+func count(elements []svgElement, name string) int {
+  var n int
+  for _, e := range elements {
+    if e.name == name {
+      n++
+    }
+  }
+
+  return n
+}
+
+func TestRenderStateDiagram(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := parser.ParseDocument(readTestFile("simple-code-1-input.uml"))
+  a.NoError(err)
+
+  buf := bytes.NewBuffer(nil)
+  a.NoError(Render(*doc, buf))
+
+  elements := parseSVG(t, buf.Bytes())
+  a.Equal("svg", elements[0].name)
+
+  for _, s := range []string{"begin", "state-b", "Exit Condition 2", "FieldE == 0"} {
+    a.NotNil(findText(elements, s), s)
+  }
+
+  a.Equal(1, count(elements, "circle"))
+  a.Equal(2, count(elements, "polyline"))
+}
+
+func TestRenderStateDiagramColours(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := parser.ParseDocument("@startuml\nskinparam stateBackgroundColor<<Warning>> Orange\nskinparam ArrowColor Blue\nstate A\nstate B <<Warning>>\nA --> B\nB --> A\n@enduml\n")
+  a.NoError(err)
+
+  buf := bytes.NewBuffer(nil)
+  a.NoError(Render(*doc, buf))
+
+  elements := parseSVG(t, buf.Bytes())
+
+  var fills []string
+  for _, e := range elements {
+    if e.name == "rect" && e.attrs["rx"] != "" && e.attrs["rx"] != "0" {
+      fills = append(fills, e.attrs["fill"])
+    }
+  }
+  a.Equal([]string{"#FEFECE", "#FFA500"}, fills)
+
+  for _, e := range elements {
+    if e.name == "polyline" {
+      a.Equal("#0000FF", e.attrs["stroke"])
+    }
+  }
+}
+
+func TestRenderActivityDiagram(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := parser.ParseDocument(strings.Join([]string{
+    "@startuml",
+    "start",
+    ":Receive;",
+    "if (in stock?) then (yes)",
+    "  fork",
+    "    :Pack;",
+    "  forkagain",
+    "    :Invoice;",
+    "  endfork",
+    "else (no)",
+    "  #Orange:Cancel;",
+    "  end",
+    "endif",
+    "partition \"Shipping\" {",
+    "  :Ship;",
+    "}",
+    "end",
+    "@enduml",
+  }, "\n"))
+  a.NoError(err)
+
+  buf := bytes.NewBuffer(nil)
+  a.NoError(Render(*doc, buf))
+
+  elements := parseSVG(t, buf.Bytes())
+
+  for _, s := range []string{"Receive", "in stock?", "yes", "no", "Pack", "Invoice", "Cancel", "Shipping", "Ship"} {
+    a.NotNil(findText(elements, s), s)
+  }
+
+  // decision and merge diamonds, plus an arrowhead for every flow line
+  a.Equal(2, count(elements, "polygon")-count(elements, "polyline"))
+  // start, plus two circles for each of the two ends
+  a.Equal(5, count(elements, "circle"))
+
+  var found bool
+  for _, e := range elements {
+    if e.name == "rect" && e.attrs["fill"] == "#FFA500" {
+      found = true
+    }
+  }
+  a.True(found)
+}
+
+func TestRenderEmptyDocument(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := parser.ParseDocument("@startuml\nskinparam A B\n@enduml\n")
+  a.NoError(err)
+
+  a.Error(Render(*doc, ioutil.Discard))
+}
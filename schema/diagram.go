@@ -0,0 +1,55 @@
+package schema
+
+import (
+	"fknsrs.biz/p/plantuml/parser"
+)
+
+// Diagram builds an entity relationship diagram of the schema, which can be
+// written out with parser.FormatDocument. Each table is an entity with its
+// primary key above a `--` separator, not null columns marked mandatory and
+// foreign keys marked `<<FK>>`. Each reference is a crow's foot edge with the
+// table that holds it on the left, so FromDiagram reads the diagram back as
+// the same schema.
+func (s *Schema) Diagram() parser.DocumentNode {
+	doc := parser.DocumentNode{Kind: parser.DocumentUML}
+
+	for _, t := range s.Tables {
+		entity := parser.EntityNode{Kind: "entity", Name: t.Name, Label: t.Name}
+
+		var key, rest []parser.Node
+		for _, c := range t.Columns {
+			n := parser.ColumnNode{Name: c.Name, Type: c.Type, Mandatory: c.NotNull, Key: c.PrimaryKey}
+			if c.ForeignKey {
+				n.Stereotype = "<<FK>>"
+			}
+
+			if c.PrimaryKey {
+				key = append(key, n)
+			} else {
+				rest = append(rest, n)
+			}
+		}
+
+		entity.Children = key
+		if len(key) > 0 {
+			entity.Children = append(entity.Children, parser.EntitySeparatorNode{Line: "--"})
+		}
+		entity.Children = append(entity.Children, rest...)
+
+		doc.Nodes = append(doc.Nodes, entity)
+	}
+
+	for _, r := range s.References {
+		from, to := "}o", "||"
+		if r.Unique {
+			from = "|o"
+		}
+		if r.Optional {
+			to = "o|"
+		}
+
+		doc.Nodes = append(doc.Nodes, parser.EdgeNode{Left: r.From, Right: r.To, Direction: from + "--" + to})
+	}
+
+	return doc
+}
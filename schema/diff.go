@@ -0,0 +1,188 @@
+package schema
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Kind string
+
+const (
+	Added   Kind = "added"
+	Removed Kind = "removed"
+	Changed Kind = "changed"
+)
+
+type Element string
+
+const (
+	TableElement     Element = "table"
+	ColumnElement    Element = "column"
+	ReferenceElement Element = "reference"
+)
+
+// Change is a single difference between two schemas. Name is the table, the
+// column as `table.column`, or the reference as `from -> to`, as it's written
+// in the old schema, or the new one if it was added. For changes, Field says
+// which part of the column or reference changed.
+type Change struct {
+	Kind    Kind    `json:"kind"`
+	Element Element `json:"element"`
+	Name    string  `json:"name"`
+	Field   string  `json:"field,omitempty"`
+	Old     string  `json:"old,omitempty"`
+	New     string  `json:"new,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s %s", c.Element, c.Name)
+	case Removed:
+		return fmt.Sprintf("- %s %s", c.Element, c.Name)
+	default:
+		return fmt.Sprintf("~ %s %s: %s changed from %q to %q", c.Element, c.Name, c.Field, c.Old, c.New)
+	}
+}
+
+// normaliseType makes types that are only written differently, like
+// `VARCHAR( 255 )` and `varchar(255)`, the same.
+func normaliseType(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), ""))
+}
+
+// Diff compares two schemas, ignoring the case of names and the order of
+// tables, columns and references. Columns are compared by type, and whether
+// they're primary keys, not null or foreign keys. A type is only compared if
+// both schemas have one, since diagrams often leave them out. References are
+// compared by whether they're optional or unique, which is the cardinality
+// of a crow's foot edge.
+func Diff(a, b *Schema) []Change {
+	var changes []Change
+
+	for _, at := range a.Tables {
+		bt := b.Table(at.Name)
+		if bt == nil {
+			changes = append(changes, Change{Kind: Removed, Element: TableElement, Name: at.Name})
+			continue
+		}
+
+		changes = append(changes, diffTable(at, bt)...)
+	}
+
+	for _, bt := range b.Tables {
+		if a.Table(bt.Name) == nil {
+			changes = append(changes, Change{Kind: Added, Element: TableElement, Name: bt.Name})
+		}
+	}
+
+	changes = append(changes, diffReferences(a, b)...)
+
+	return changes
+}
+
+func diffTable(a, b *Table) []Change {
+	var changes []Change
+
+	for _, ac := range a.Columns {
+		name := a.Name + "." + ac.Name
+
+		bc := b.Column(ac.Name)
+		if bc == nil {
+			changes = append(changes, Change{Kind: Removed, Element: ColumnElement, Name: name})
+			continue
+		}
+
+		if ac.Type != "" && bc.Type != "" && normaliseType(ac.Type) != normaliseType(bc.Type) {
+			changes = append(changes, Change{Kind: Changed, Element: ColumnElement, Name: name, Field: "type", Old: ac.Type, New: bc.Type})
+		}
+
+		for _, f := range []struct {
+			field    string
+			old, new bool
+		}{
+			{"primary key", ac.PrimaryKey, bc.PrimaryKey},
+			{"not null", ac.NotNull, bc.NotNull},
+			{"foreign key", ac.ForeignKey, bc.ForeignKey},
+		} {
+			if f.old != f.new {
+				changes = append(changes, Change{Kind: Changed, Element: ColumnElement, Name: name, Field: f.field, Old: strconv.FormatBool(f.old), New: strconv.FormatBool(f.new)})
+			}
+		}
+	}
+
+	for _, bc := range b.Columns {
+		if a.Column(bc.Name) == nil {
+			changes = append(changes, Change{Kind: Added, Element: ColumnElement, Name: a.Name + "." + bc.Name})
+		}
+	}
+
+	return changes
+}
+
+// diffReferences compares references by the tables at each end, then by
+// whether they're optional or unique. The same pair of tables can have more
+// than one reference between them, like when a table has two foreign keys to
+// another, so references that are exactly the same are matched up first, and
+// only the ones left over are matched by their tables alone.
+func diffReferences(a, b *Schema) []Change {
+	tables := func(r Reference) Reference {
+		return Reference{From: strings.ToLower(r.From), To: strings.ToLower(r.To)}
+	}
+
+	matched := make([]int, len(a.References))
+	used := make([]bool, len(b.References))
+
+	for pass, same := range []func(x, y Reference) bool{
+		func(x, y Reference) bool {
+			return tables(x) == tables(y) && x.Optional == y.Optional && x.Unique == y.Unique
+		},
+		func(x, y Reference) bool { return tables(x) == tables(y) },
+	} {
+		for i, r := range a.References {
+			if pass == 0 {
+				matched[i] = -1
+			} else if matched[i] != -1 {
+				continue
+			}
+
+			for j, o := range b.References {
+				if !used[j] && same(r, o) {
+					matched[i], used[j] = j, true
+					break
+				}
+			}
+		}
+	}
+
+	var changes []Change
+
+	for i, r := range a.References {
+		if matched[i] == -1 {
+			changes = append(changes, Change{Kind: Removed, Element: ReferenceElement, Name: r.String()})
+			continue
+		}
+
+		o := b.References[matched[i]]
+		for _, f := range []struct {
+			field    string
+			old, new bool
+		}{
+			{"optional", r.Optional, o.Optional},
+			{"unique", r.Unique, o.Unique},
+		} {
+			if f.old != f.new {
+				changes = append(changes, Change{Kind: Changed, Element: ReferenceElement, Name: r.String(), Field: f.field, Old: strconv.FormatBool(f.old), New: strconv.FormatBool(f.new)})
+			}
+		}
+	}
+
+	for j, r := range b.References {
+		if !used[j] {
+			changes = append(changes, Change{Kind: Added, Element: ReferenceElement, Name: r.String()})
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,252 @@
+package schema
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"fknsrs.biz/p/plantuml/parser"
+)
+
+type Column struct {
+	Name       string
+	Type       string
+	PrimaryKey bool
+	NotNull    bool
+	ForeignKey bool
+}
+
+type Table struct {
+	Name    string
+	Columns []*Column
+}
+
+// Column finds a column by name, ignoring case like SQL does, or returns nil
+// if there isn't one.
+func (t *Table) Column(name string) *Column {
+	for _, c := range t.Columns {
+		if strings.EqualFold(c.Name, name) {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// Reference is a foreign key, from the table that holds it to the table it
+// points at. Optional is set if the key can be null, and Unique if only one
+// row can point at each row of To, which makes it one to one.
+type Reference struct {
+	From     string
+	To       string
+	Optional bool
+	Unique   bool
+}
+
+func (r Reference) String() string {
+	return r.From + " -> " + r.To
+}
+
+// Schema is the tables of a database and the references between them, in a
+// form that's the same whichever way it was described.
+type Schema struct {
+	Tables     []*Table
+	References []Reference
+}
+
+// Table finds a table by name, ignoring case, or returns nil if there isn't
+// one.
+func (s *Schema) Table(name string) *Table {
+	for _, t := range s.Tables {
+		if strings.EqualFold(t.Name, name) {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// hasStereotype reports whether a stereotype like `<<PK>>` names any of
+// names, ignoring case.
+func hasStereotype(stereotype string, names ...string) bool {
+	for _, n := range names {
+		if strings.Contains(strings.ToLower(stereotype), "<<"+strings.ToLower(n)+">>") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FromDiagram reads the entities of an entity relationship diagram as
+// tables, named by their labels. A column is a primary key if it's in the
+// entity's key or has a `<<PK>>` or `<<key>>` stereotype, and a foreign key
+// if it has `<<FK>>`; it's not null if it's mandatory or a primary key. The
+// parts of Chen composite attributes are columns of their own.
+//
+// In an IE diagram, the table at the many end of a crow's foot edge holds
+// the reference, or if neither end is many, the one at the zero-or-one end,
+// or otherwise the one on the left. The reference is optional if the other
+// end is zero-or-one, and unique if the holder's end isn't many. In a Chen
+// diagram, a relationship between two entities is a reference from the many
+// side to the one side, which is optional unless the many side's edge is
+// doubled, like `=N=`; many to many relationships aren't references, since
+// they need a table of their own.
+func FromDiagram(doc parser.DocumentNode) (*Schema, error) {
+	if doc.Kind != parser.DocumentUML && doc.Kind != parser.DocumentChen {
+		return nil, fmt.Errorf("FromDiagram: expected a uml or chen document but got %s", doc.Kind)
+	}
+
+	var s Schema
+
+	tables := make(map[string]*Table)
+	relationships := make(map[string]bool)
+
+	if err := parser.Walk(doc, func(n parser.Node) error {
+		e, ok := n.(parser.EntityNode)
+		if !ok {
+			return nil
+		}
+
+		if e.Kind == "relationship" {
+			relationships[e.Name] = true
+			return nil
+		}
+
+		if s.Table(e.Label) != nil {
+			return fmt.Errorf("%s: table %q is declared more than once", e.SourceRange, e.Label)
+		}
+
+		t := &Table{Name: e.Label}
+		for _, c := range e.Columns() {
+			addColumns(t, c)
+		}
+
+		s.Tables = append(s.Tables, t)
+		tables[e.Name] = t
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("FromDiagram: %w", err)
+	}
+
+	edges := parser.FindEdges(doc)
+
+	if doc.Kind == parser.DocumentChen {
+		s.References = chenReferences(edges, tables, relationships)
+		return &s, nil
+	}
+
+	for _, e := range edges {
+		l, r := tables[e.Left], tables[e.Right]
+		if l == nil || r == nil {
+			continue
+		}
+
+		lc, rc := e.Cardinalities()
+		if lc == "" || rc == "" {
+			continue
+		}
+
+		many := func(c parser.Cardinality) bool { return c == parser.ZeroOrMore || c == parser.OneOrMore }
+
+		from, to, fc, tc := l, r, lc, rc
+		if many(rc) && !many(lc) || (!many(lc) && rc == parser.ZeroOrOne && lc != parser.ZeroOrOne) {
+			from, to, fc, tc = r, l, rc, lc
+		}
+
+		s.References = append(s.References, Reference{
+			From:     from.Name,
+			To:       to.Name,
+			Optional: tc == parser.ZeroOrOne,
+			Unique:   !many(fc),
+		})
+	}
+
+	return &s, nil
+}
+
+func addColumns(t *Table, c parser.ColumnNode) {
+	if len(c.Children) > 0 {
+		for _, e := range c.Children {
+			addColumns(t, e)
+		}
+
+		return
+	}
+
+	primary := c.Key || hasStereotype(c.Stereotype, "PK", "key")
+
+	t.Columns = append(t.Columns, &Column{
+		Name:       c.Name,
+		Type:       c.Type,
+		PrimaryKey: primary,
+		NotNull:    c.Mandatory || primary,
+		ForeignKey: hasStereotype(c.Stereotype, "FK"),
+	})
+}
+
+// chenMany reports whether the cardinality in a Chen edge, like `-N-` or
+// `=(0,N)=`, allows more than one.
+func chenMany(arrow string) bool {
+	c := strings.Trim(arrow, "-=()")
+	if i := strings.LastIndex(c, ","); i != -1 {
+		c = c[i+1:]
+	}
+
+	if n, err := strconv.Atoi(c); err == nil {
+		return n > 1
+	}
+
+	return c == "N" || c == "M"
+}
+
+func chenReferences(edges []parser.EdgeNode, tables map[string]*Table, relationships map[string]bool) []Reference {
+	type end struct {
+		table *Table
+		many  bool
+		total bool
+	}
+
+	var names []string
+	ends := make(map[string][]end)
+
+	for _, e := range edges {
+		relationship, entity := e.Left, e.Right
+		if !relationships[relationship] {
+			relationship, entity = entity, relationship
+		}
+
+		t := tables[entity]
+		if t == nil || !relationships[relationship] {
+			continue
+		}
+
+		if _, ok := ends[relationship]; !ok {
+			names = append(names, relationship)
+		}
+		ends[relationship] = append(ends[relationship], end{t, chenMany(e.Direction), strings.HasPrefix(e.Direction, "=")})
+	}
+
+	var a []Reference
+	for _, name := range names {
+		e := ends[name]
+		if len(e) != 2 || (e[0].many && e[1].many) {
+			continue
+		}
+
+		from, to := e[1], e[0]
+		if e[0].many {
+			from, to = e[0], e[1]
+		}
+
+		a = append(a, Reference{
+			From:     from.table.Name,
+			To:       to.table.Name,
+			Optional: !from.total,
+			Unique:   !from.many,
+		})
+	}
+
+	return a
+}
@@ -0,0 +1,398 @@
+package schema
+
+import (
+  "bytes"
+  "strings"
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+
+  "fknsrs.biz/p/plantuml/parser"
+)
+
+func fromDiagram(t *testing.T, src string) *Schema {
+  doc, err := parser.ParseDocument(src)
+  if !assert.NoError(t, err) {
+    return nil
+  }
+
+  s, err := FromDiagram(*doc)
+  if !assert.NoError(t, err) {
+    return nil
+  }
+
+  return s
+}
+
+const shopDiagram = `@startuml
+entity "users" as u {
+  *id : integer
+  --
+  *email : varchar(255)
+  name : text
+}
+
+entity orders {
+  *id : integer
+  --
+  *user_id : integer <<FK>>
+  placed_at : timestamp
+}
+
+entity profiles {
+  user_id : integer <<PK>> <<FK>>
+  bio : text
+}
+
+u ||--o{ orders
+profiles |o--|| u
+@enduml
+`
+
+func TestFromDiagram(t *testing.T) {
+  a := assert.New(t)
+
+  s := fromDiagram(t, shopDiagram)
+  if s == nil {
+    return
+  }
+
+  if !a.Len(s.Tables, 3) {
+    return
+  }
+
+  a.Equal(&Table{Name: "users", Columns: []*Column{
+    {Name: "id", Type: "integer", PrimaryKey: true, NotNull: true},
+    {Name: "email", Type: "varchar(255)", NotNull: true},
+    {Name: "name", Type: "text"},
+  }}, s.Tables[0])
+
+  a.Equal(&Column{Name: "user_id", Type: "integer", PrimaryKey: true, NotNull: true, ForeignKey: true}, s.Table("PROFILES").Column("User_ID"))
+  a.Nil(s.Table("missing"))
+
+  a.Equal([]Reference{{From: "orders", To: "users"}, {From: "profiles", To: "users", Unique: true}}, s.References)
+
+  _, err := FromDiagram(parser.DocumentNode{Kind: parser.DocumentGantt})
+  a.Error(err)
+
+  doc, err := parser.ParseDocument("@startuml\nentity A\nentity \"A\" as B\n@enduml\n")
+  if a.NoError(err) {
+    _, err = FromDiagram(*doc)
+    a.Error(err)
+  }
+}
+
+func TestFromDiagramChen(t *testing.T) {
+  a := assert.New(t)
+
+  s := fromDiagram(t, `@startchen
+entity Director {
+  Number : INTEGER <<key>>
+  Name {
+    Fname : CHAR[20]
+    Lname : CHAR[20]
+  }
+}
+
+entity Movie {
+  Code : INTEGER <<key>>
+}
+
+entity Actor {
+  Id : INTEGER <<key>>
+}
+
+relationship Directed {
+}
+
+relationship ActedIn {
+}
+
+Director -1- Directed
+Movie =N= Directed
+Actor -N- ActedIn
+ActedIn -(1,N)- Movie
+@endchen
+`)
+  if s == nil {
+    return
+  }
+
+  if a.Len(s.Tables, 3) {
+    var names []string
+    for _, c := range s.Tables[0].Columns {
+      names = append(names, c.Name)
+    }
+    a.Equal([]string{"Number", "Fname", "Lname"}, names)
+    a.True(s.Tables[0].Columns[0].PrimaryKey)
+  }
+
+  a.Equal([]Reference{{From: "Movie", To: "Director"}}, s.References)
+}
+
+func TestDiff(t *testing.T) {
+  a := assert.New(t)
+
+  old := fromDiagram(t, shopDiagram)
+  if old == nil {
+    return
+  }
+
+  a.Empty(Diff(old, old))
+
+  changed := &Schema{
+    Tables: []*Table{
+      {Name: "USERS", Columns: []*Column{
+        {Name: "id", Type: "INTEGER", PrimaryKey: true, NotNull: true},
+        {Name: "email", Type: "VARCHAR( 255 )"},
+        {Name: "created_at", Type: "timestamp"},
+      }},
+      {Name: "orders", Columns: []*Column{
+        {Name: "id", Type: "bigint", PrimaryKey: true, NotNull: true},
+        {Name: "user_id", Type: "integer", NotNull: true, ForeignKey: true},
+        {Name: "placed_at"},
+      }},
+      {Name: "payments"},
+    },
+    References: []Reference{{From: "Orders", To: "Users"}, {From: "payments", To: "orders"}},
+  }
+
+  var lines []string
+  for _, c := range Diff(old, changed) {
+    lines = append(lines, c.String())
+  }
+
+  a.Equal([]string{
+    `~ column users.email: not null changed from "true" to "false"`,
+    `- column users.name`,
+    `+ column users.created_at`,
+    `~ column orders.id: type changed from "integer" to "bigint"`,
+    `- table profiles`,
+    `+ table payments`,
+    `- reference profiles -> users`,
+    `+ reference payments -> orders`,
+  }, lines)
+}
+
+const migrations = `
+-- 001_create_users.sql
+CREATE TABLE IF NOT EXISTS public.users (
+  id serial PRIMARY KEY,
+  email character varying(255) NOT NULL UNIQUE,
+  name text DEFAULT 'nobody',
+  created_at timestamp with time zone NOT NULL DEFAULT now()
+);
+
+/* 002: orders, MySQL style */
+CREATE TABLE ` + "`orders`" + ` (
+  ` + "`id`" + ` int(11) unsigned NOT NULL AUTO_INCREMENT,
+  ` + "`user_id`" + ` int(11) NOT NULL,
+  ` + "`total`" + ` decimal(10, 2) CHARACTER SET utf8 DEFAULT NULL,
+  ` + "`status`" + ` enum('new','paid') NOT NULL,
+  PRIMARY KEY (` + "`id`" + `),
+  KEY ` + "`user_id`" + ` (` + "`user_id`" + `),
+  CONSTRAINT ` + "`orders_user`" + ` FOREIGN KEY (` + "`user_id`" + `) REFERENCES ` + "`users`" + ` (` + "`id`" + `) ON DELETE CASCADE
+) ENGINE=InnoDB;
+
+CREATE TABLE profiles (
+  user_id integer,
+  bio text,
+  CHECK (bio IS NOT NULL OR user_id > 0)
+);
+
+ALTER TABLE ONLY profiles
+  ADD CONSTRAINT profiles_user FOREIGN KEY (user_id) REFERENCES users (id),
+  ADD COLUMN avatar_url text;
+CREATE UNIQUE INDEX profiles_user_id ON profiles USING btree (user_id);
+CREATE UNIQUE INDEX ON users (lower(email));
+
+CREATE TABLE audit (id bigint PRIMARY KEY, order_id integer REFERENCES orders, note text);
+ALTER TABLE audit DROP COLUMN order_id;
+ALTER TABLE audit RENAME COLUMN note TO message;
+ALTER TABLE audit ALTER COLUMN message SET NOT NULL;
+
+CREATE OR REPLACE FUNCTION touch() RETURNS trigger AS $$
+BEGIN
+  NEW.updated_at = now();
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+INSERT INTO users (email) VALUES ('a;b@example.com');
+DROP TABLE IF EXISTS scratch;
+`
+
+func TestFromSQL(t *testing.T) {
+  a := assert.New(t)
+
+  s, err := FromSQL(migrations)
+  if !a.NoError(err) {
+    return
+  }
+
+  if !a.Len(s.Tables, 4) {
+    return
+  }
+
+  a.Equal(&Table{Name: "users", Columns: []*Column{
+    {Name: "id", Type: "serial", PrimaryKey: true, NotNull: true},
+    {Name: "email", Type: "character varying(255)", NotNull: true},
+    {Name: "name", Type: "text"},
+    {Name: "created_at", Type: "timestamp with time zone", NotNull: true},
+  }}, s.Tables[0])
+
+  a.Equal(&Table{Name: "orders", Columns: []*Column{
+    {Name: "id", Type: "int(11) unsigned", PrimaryKey: true, NotNull: true},
+    {Name: "user_id", Type: "int(11)", NotNull: true, ForeignKey: true},
+    {Name: "total", Type: "decimal(10, 2)"},
+    {Name: "status", Type: "enum('new', 'paid')", NotNull: true},
+  }}, s.Tables[1])
+
+  a.Equal(&Table{Name: "profiles", Columns: []*Column{
+    {Name: "user_id", Type: "integer", ForeignKey: true},
+    {Name: "bio", Type: "text"},
+    {Name: "avatar_url", Type: "text"},
+  }}, s.Tables[2])
+
+  a.Equal(&Table{Name: "audit", Columns: []*Column{
+    {Name: "id", Type: "bigint", PrimaryKey: true, NotNull: true},
+    {Name: "message", Type: "text", NotNull: true},
+  }}, s.Tables[3])
+
+  a.Equal([]Reference{
+    {From: "orders", To: "users"},
+    {From: "profiles", To: "users", Optional: true, Unique: true},
+  }, s.References)
+
+  for _, src := range []string{
+    "CREATE TABLE a (id int); CREATE TABLE a (id int);",
+    "ALTER TABLE missing ADD COLUMN id int;",
+    "CREATE TABLE a (id int, PRIMARY KEY (other));",
+    "CREATE TABLE a (id int, FOREIGN KEY (id) b (id));",
+    "CREATE TABLE a (id int /* never closed",
+    "CREATE TABLE a (name text DEFAULT 'never closed);",
+    "CREATE TABLE a (",
+    "CREATE TABLE a (id int",
+    "CREATE TABLE a (id int; CREATE TABLE b (id int);",
+    "CREATE TABLE a (id int));",
+    "CREATE TABLE a (id int); CREATE TABLE b AS SELECT * FROM a;",
+    "CREATE TABLE a (id int); CREATE TABLE b LIKE a;",
+    "CREATE TABLE a (id int); CREATE TABLE b (LIKE a INCLUDING ALL);",
+    "CREATE TABLE a (id int); ALTER TABLE a ADD COLUMN id int;",
+  } {
+    _, err := FromSQL(src)
+    a.Error(err, src)
+  }
+}
+
+func TestFromSQLIfNotExists(t *testing.T) {
+  a := assert.New(t)
+
+  s, err := FromSQL(`
+CREATE TABLE a (id int PRIMARY KEY);
+CREATE TABLE b (id int, a_id int REFERENCES a (id));
+CREATE TABLE IF NOT EXISTS a (id int, name text);
+ALTER TABLE b ADD COLUMN IF NOT EXISTS a_id int REFERENCES a (id) UNIQUE;
+ALTER TABLE b ADD COLUMN IF NOT EXISTS note text;
+`)
+  if !a.NoError(err) {
+    return
+  }
+
+  a.Equal([]*Table{
+    {Name: "a", Columns: []*Column{
+      {Name: "id", Type: "int", PrimaryKey: true, NotNull: true},
+    }},
+    {Name: "b", Columns: []*Column{
+      {Name: "id", Type: "int"},
+      {Name: "a_id", Type: "int", ForeignKey: true},
+      {Name: "note", Type: "text"},
+    }},
+  }, s.Tables)
+
+  a.Equal([]Reference{{From: "b", To: "a", Optional: true}}, s.References)
+}
+
+func TestDiagram(t *testing.T) {
+  a := assert.New(t)
+
+  s, err := FromSQL(migrations)
+  if !a.NoError(err) {
+    return
+  }
+
+  doc := s.Diagram()
+
+  buf := bytes.NewBuffer(nil)
+  if !a.NoError(parser.FormatDocument(doc, buf)) {
+    return
+  }
+
+  a.Equal(`@startuml
+
+entity users {
+  *id : serial
+  --
+  *email : character varying(255)
+  name : text
+  *created_at : timestamp with time zone
+}
+entity orders {
+  *id : int(11) unsigned
+  --
+  *user_id : int(11) <<FK>>
+  total : decimal(10, 2)
+  *status : enum('new', 'paid')
+}
+entity profiles {
+  user_id : integer <<FK>>
+  bio : text
+  avatar_url : text
+}
+entity audit {
+  *id : bigint
+  --
+  *message : text
+}
+
+orders }o--|| users
+profiles |o--o| users
+
+@enduml
+`, buf.String())
+
+  // the diagram should read back as the same schema.
+  written, err := parser.ParseDocument(buf.String())
+  if !a.NoError(err) {
+    return
+  }
+
+  read, err := FromDiagram(*written)
+  if a.NoError(err) {
+    a.Empty(Diff(s, read))
+    a.Equal(s.References, read.References)
+  }
+
+  // and getting the cardinalities wrong is a difference.
+  swapped := strings.NewReplacer("orders }o--|| users", "orders |o--o| users", "profiles |o--o| users", "profiles }o--|| users").Replace(buf.String())
+
+  written, err = parser.ParseDocument(swapped)
+  if !a.NoError(err) {
+    return
+  }
+
+  read, err = FromDiagram(*written)
+  if a.NoError(err) {
+    var lines []string
+    for _, c := range Diff(s, read) {
+      lines = append(lines, c.String())
+    }
+
+    a.Equal([]string{
+      `~ reference orders -> users: optional changed from "false" to "true"`,
+      `~ reference orders -> users: unique changed from "false" to "true"`,
+      `~ reference profiles -> users: optional changed from "true" to "false"`,
+      `~ reference profiles -> users: unique changed from "true" to "false"`,
+    }, lines)
+  }
+}
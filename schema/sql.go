@@ -0,0 +1,999 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type sqlTokenKind int
+
+const (
+	sqlWord sqlTokenKind = iota
+	sqlQuoted
+	sqlString
+	sqlSymbol
+)
+
+// sqlToken is a word, a quoted identifier, a string or a symbol. The text of
+// a quoted identifier doesn't have its quotes, but a string's does, since
+// strings only end up in things like `enum('a', 'b')` types.
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+	line int
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// tokeniseSQL splits SQL into tokens, leaving out whitespace and comments.
+// PostgreSQL's dollar quoted strings, like the bodies of functions, are read
+// as single strings so that the semicolons in them don't end the statement.
+func tokeniseSQL(src string) ([]sqlToken, error) {
+	var a []sqlToken
+
+	r := []rune(src)
+	line := 1
+
+	for i := 0; i < len(r); {
+		c := r[i]
+
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case unicode.IsSpace(c):
+			i++
+		case c == '-' && i+1 < len(r) && r[i+1] == '-', c == '#':
+			for i < len(r) && r[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(r) && r[i+1] == '*':
+			start := line
+			for i += 2; i < len(r) && !(r[i] == '*' && i+1 < len(r) && r[i+1] == '/'); i++ {
+				if r[i] == '\n' {
+					line++
+				}
+			}
+			if i >= len(r) {
+				return nil, fmt.Errorf("line %d: comment is never closed", start)
+			}
+			i += 2
+		case c == '\'' || c == '"' || c == '`':
+			start, j := line, i+1
+			for ; j < len(r); j++ {
+				if r[j] == '\n' {
+					line++
+				}
+				if r[j] == c {
+					// quotes are escaped by doubling them.
+					if j+1 < len(r) && r[j+1] == c {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(r) {
+				return nil, fmt.Errorf("line %d: %c is never closed", start, c)
+			}
+
+			if c == '\'' {
+				a = append(a, sqlToken{kind: sqlString, text: string(r[i : j+1]), line: start})
+			} else {
+				a = append(a, sqlToken{kind: sqlQuoted, text: strings.ReplaceAll(string(r[i+1:j]), string([]rune{c, c}), string(c)), line: start})
+			}
+			i = j + 1
+		case c == '$' && dollarTag(r[i:]) != "":
+			tag := dollarTag(r[i:])
+			start := line
+
+			end := strings.Index(string(r[i+len([]rune(tag)):]), tag)
+			if end == -1 {
+				return nil, fmt.Errorf("line %d: %s is never closed", start, tag)
+			}
+
+			body := tag + string(r[i+len([]rune(tag)):])[:end] + tag
+			line += strings.Count(body, "\n")
+
+			a = append(a, sqlToken{kind: sqlString, text: body, line: start})
+			i += len([]rune(body))
+		case isWordRune(c):
+			j := i
+			for j < len(r) && isWordRune(r[j]) {
+				j++
+			}
+
+			a = append(a, sqlToken{kind: sqlWord, text: string(r[i:j]), line: line})
+			i = j
+		default:
+			a = append(a, sqlToken{kind: sqlSymbol, text: string(c), line: line})
+			i++
+		}
+	}
+
+	return a, nil
+}
+
+// dollarTag finds the tag at the start of a dollar quoted string, like `$$`
+// or `$body$`.
+func dollarTag(r []rune) string {
+	for j := 1; j < len(r); j++ {
+		switch {
+		case r[j] == '$':
+			return string(r[:j+1])
+		case r[j] == '_' || unicode.IsLetter(r[j]) || (j > 1 && unicode.IsDigit(r[j])):
+		default:
+			return ""
+		}
+	}
+
+	return ""
+}
+
+// sqlWords is part of a statement being read a token at a time.
+type sqlWords struct {
+	a []sqlToken
+	i int
+}
+
+func (w *sqlWords) done() bool { return w.i >= len(w.a) }
+
+func (w *sqlWords) peek() sqlToken {
+	if w.done() {
+		return sqlToken{kind: sqlSymbol}
+	}
+
+	return w.a[w.i]
+}
+
+func (w *sqlWords) next() sqlToken {
+	t := w.peek()
+	if !w.done() {
+		w.i++
+	}
+
+	return t
+}
+
+// at reports whether the next tokens are the keywords, in order.
+func (w *sqlWords) at(keywords ...string) bool {
+	for j, k := range keywords {
+		if w.i+j >= len(w.a) {
+			return false
+		}
+
+		t := w.a[w.i+j]
+		if t.kind != sqlWord || !strings.EqualFold(t.text, k) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// is reads the next tokens if they're the keywords.
+func (w *sqlWords) is(keywords ...string) bool {
+	if !w.at(keywords...) {
+		return false
+	}
+
+	w.i += len(keywords)
+
+	return true
+}
+
+func (w *sqlWords) symbol(s string) bool {
+	if t := w.peek(); t.kind == sqlSymbol && t.text == s && !w.done() {
+		w.i++
+		return true
+	}
+
+	return false
+}
+
+func (w *sqlWords) expect(keywords ...string) error {
+	if !w.is(keywords...) {
+		return fmt.Errorf("expected `%s' but got %q", strings.Join(keywords, " "), w.peek().text)
+	}
+
+	return nil
+}
+
+// name reads a name, which can be qualified with a schema like
+// `public.users`; only the last part is kept.
+func (w *sqlWords) name() (string, error) {
+	var s string
+
+	for {
+		t := w.next()
+		if t.kind != sqlWord && t.kind != sqlQuoted {
+			return "", fmt.Errorf("expected a name but got %q", t.text)
+		}
+		s = t.text
+
+		if !w.symbol(".") {
+			return s, nil
+		}
+	}
+}
+
+// group skips over a parenthesised group, if there's one next, and returns
+// what's in it. Statements are checked by checkParentheses before they're
+// read, so the group always ends.
+func (w *sqlWords) group() []sqlToken {
+	if w.peek().kind != sqlSymbol || w.peek().text != "(" || w.done() {
+		return nil
+	}
+
+	start := w.i
+	for depth := 0; !w.done(); {
+		t := w.next()
+		if t.kind != sqlSymbol {
+			continue
+		}
+
+		switch t.text {
+		case "(":
+			depth++
+		case ")":
+			if depth--; depth == 0 {
+				return w.a[start+1 : w.i-1]
+			}
+		}
+	}
+
+	return w.a[start+1:]
+}
+
+// names reads a list of column names in parentheses. MySQL lets index
+// columns have a length, like `name(10)`, and either database lets them say
+// ASC or DESC, so those are skipped.
+func (w *sqlWords) names() ([]string, error) {
+	if w.peek().text != "(" {
+		return nil, fmt.Errorf("expected `(' but got %q", w.peek().text)
+	}
+
+	var a []string
+	for _, part := range splitSQL(w.group(), ",") {
+		p := &sqlWords{a: part}
+
+		n, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+
+		if g := p.group(); g != nil && (len(g) != 1 || strings.TrimFunc(g[0].text, unicode.IsDigit) != "") {
+			return nil, fmt.Errorf("expected a column but got an expression")
+		}
+		_ = p.is("asc") || p.is("desc")
+
+		if !p.done() {
+			return nil, fmt.Errorf("expected a column but got an expression")
+		}
+
+		a = append(a, n)
+	}
+
+	return a, nil
+}
+
+// checkParentheses makes sure that every parenthesis in a statement is
+// closed, so that truncated statements like `CREATE TABLE a (id int` aren't
+// read as if they were finished.
+func checkParentheses(a []sqlToken) error {
+	var open []sqlToken
+
+	for _, t := range a {
+		if t.kind != sqlSymbol {
+			continue
+		}
+
+		switch t.text {
+		case "(":
+			open = append(open, t)
+		case ")":
+			if len(open) == 0 {
+				return fmt.Errorf("line %d: `)' doesn't close anything", t.line)
+			}
+			open = open[:len(open)-1]
+		}
+	}
+
+	if len(open) > 0 {
+		return fmt.Errorf("line %d: `(' is never closed", open[len(open)-1].line)
+	}
+
+	return nil
+}
+
+// splitSQL splits tokens at a symbol, leaving alone any that are inside
+// parentheses.
+func splitSQL(a []sqlToken, sep string) [][]sqlToken {
+	var parts [][]sqlToken
+
+	start, depth := 0, 0
+	for i, t := range a {
+		if t.kind != sqlSymbol {
+			continue
+		}
+
+		switch t.text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, a[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	if start < len(a) {
+		parts = append(parts, a[start:])
+	}
+
+	return parts
+}
+
+// formatSQLType writes the tokens of a type back out, like `varchar(255)` or
+// `timestamp with time zone`.
+func formatSQLType(a []sqlToken) string {
+	var b strings.Builder
+
+	for i, t := range a {
+		if i > 0 && t.text != "(" && t.text != ")" && t.text != "," && t.text != "[" && t.text != "]" && a[i-1].text != "(" && a[i-1].text != "[" {
+			b.WriteString(" ")
+		}
+
+		b.WriteString(t.text)
+	}
+
+	return b.String()
+}
+
+// columnConstraints are the words that end a column's type.
+var columnConstraints = map[string]bool{
+	"constraint": true, "not": true, "null": true, "primary": true, "unique": true,
+	"references": true, "default": true, "check": true, "auto_increment": true,
+	"autoincrement": true, "generated": true, "collate": true, "comment": true,
+	"identity": true, "on": true, "key": true,
+}
+
+// tableConstraints are the words that start a definition in a table's body
+// that isn't a column.
+var tableConstraints = map[string]bool{
+	"constraint": true, "primary": true, "unique": true, "foreign": true,
+	"check": true, "key": true, "index": true, "fulltext": true,
+	"spatial": true, "exclude": true, "like": true,
+}
+
+type foreignKey struct {
+	name    string
+	from    string
+	columns []string
+	to      string
+}
+
+type sqlBuilder struct {
+	s *Schema
+	// unique holds the sets of columns of each table that can only have one
+	// row with each value, including the primary key.
+	unique map[*Table][][]string
+	fks    []foreignKey
+}
+
+// FromSQL reads the tables of a schema from `CREATE TABLE` and `ALTER TABLE`
+// statements, which can be one migration after another. It understands the
+// common parts of PostgreSQL and MySQL: columns with their types and
+// constraints, primary keys, unique constraints and indexes, and foreign
+// keys, along with adding, dropping, changing and renaming columns and
+// tables. Statements it doesn't know about, like inserts or functions, are
+// skipped, and so are ones with `IF NOT EXISTS` when the table or column is
+// already there. Tables that are made from queries or copied from others
+// are errors, since their columns can't be known.
+//
+// A reference is optional if any of its columns can be null, and unique if
+// its columns are the primary key or unique.
+func FromSQL(src string) (*Schema, error) {
+	tokens, err := tokeniseSQL(src)
+	if err != nil {
+		return nil, fmt.Errorf("FromSQL: %w", err)
+	}
+
+	b := &sqlBuilder{s: &Schema{}, unique: make(map[*Table][][]string)}
+
+	for _, stmt := range splitSQL(tokens, ";") {
+		if len(stmt) == 0 {
+			continue
+		}
+
+		if err := checkParentheses(stmt); err != nil {
+			return nil, fmt.Errorf("FromSQL: %w", err)
+		}
+
+		if err := b.statement(&sqlWords{a: stmt}); err != nil {
+			return nil, fmt.Errorf("FromSQL: line %d: %w", stmt[0].line, err)
+		}
+	}
+
+	for _, fk := range b.fks {
+		from := b.s.Table(fk.from)
+		if from == nil {
+			continue
+		}
+
+		r := Reference{From: from.Name, To: fk.to}
+		if to := b.s.Table(fk.to); to != nil {
+			r.To = to.Name
+		}
+
+		for _, n := range fk.columns {
+			if c := from.Column(n); c == nil || !c.NotNull {
+				r.Optional = true
+			}
+		}
+
+		for _, u := range b.unique[from] {
+			if sameNames(u, fk.columns) {
+				r.Unique = true
+			}
+		}
+
+		b.s.References = append(b.s.References, r)
+	}
+
+	return b.s, nil
+}
+
+// sameNames reports whether two lists have the same names in any order,
+// ignoring case.
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, x := range a {
+		found := false
+		for _, y := range b {
+			if strings.EqualFold(x, y) {
+				found = true
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (b *sqlBuilder) statement(w *sqlWords) error {
+	switch {
+	case w.is("create"):
+		w.is("or", "replace")
+		w.is("global")
+		w.is("local")
+		_ = w.is("temporary") || w.is("temp")
+		w.is("unlogged")
+
+		if w.is("unique", "index") {
+			return b.createIndex(w)
+		}
+
+		if !w.is("table") {
+			return nil
+		}
+
+		return b.createTable(w)
+	case w.is("alter", "table"):
+		return b.alterTable(w)
+	case w.is("drop", "table"):
+		w.is("if", "exists")
+
+		for {
+			n, err := w.name()
+			if err != nil {
+				return err
+			}
+
+			b.dropTable(n)
+
+			if !w.symbol(",") {
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b *sqlBuilder) table(name string) (*Table, error) {
+	t := b.s.Table(name)
+	if t == nil {
+		return nil, fmt.Errorf("table %q doesn't exist", name)
+	}
+
+	return t, nil
+}
+
+func (b *sqlBuilder) createTable(w *sqlWords) error {
+	ifNotExists := w.is("if", "not", "exists")
+
+	name, err := w.name()
+	if err != nil {
+		return err
+	}
+
+	if b.s.Table(name) != nil {
+		if ifNotExists {
+			return nil
+		}
+
+		return fmt.Errorf("table %q already exists", name)
+	}
+
+	// tables made from queries or copied from others, like `CREATE TABLE a
+	// AS SELECT ...` or `CREATE TABLE a LIKE b`, don't say what their columns
+	// are, so leaving them out would make the schema wrong.
+	if w.peek().text != "(" {
+		return fmt.Errorf("table %q: `CREATE TABLE ... %s' isn't supported", name, strings.ToUpper(w.peek().text))
+	}
+
+	t := &Table{Name: name}
+	b.s.Tables = append(b.s.Tables, t)
+
+	for _, def := range splitSQL(w.group(), ",") {
+		if err := b.definition(t, &sqlWords{a: def}); err != nil {
+			return fmt.Errorf("table %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// definition reads a column or a constraint in the body of a table.
+func (b *sqlBuilder) definition(t *Table, w *sqlWords) error {
+	if w.at("like") {
+		return fmt.Errorf("`LIKE' isn't supported")
+	}
+
+	if first := w.peek(); first.kind == sqlWord && tableConstraints[strings.ToLower(first.text)] {
+		return b.constraint(t, w)
+	}
+
+	c, err := b.column(t, w)
+	if err != nil {
+		return err
+	}
+
+	t.Columns = append(t.Columns, c)
+
+	return nil
+}
+
+func (b *sqlBuilder) column(t *Table, w *sqlWords) (*Column, error) {
+	name, err := w.name()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Column{Name: name}
+
+	start := w.i
+	for !w.done() && !w.at("character", "set") {
+		if p := w.peek(); p.kind == sqlWord && columnConstraints[strings.ToLower(p.text)] {
+			break
+		}
+
+		if w.group() == nil {
+			w.next()
+		}
+	}
+	c.Type = formatSQLType(w.a[start:w.i])
+
+	for !w.done() {
+		switch {
+		case w.is("constraint"):
+			w.next()
+		case w.is("not", "null"):
+			c.NotNull = true
+		case w.is("primary", "key"):
+			c.PrimaryKey, c.NotNull = true, true
+			b.unique[t] = append(b.unique[t], []string{name})
+		case w.is("unique"):
+			w.is("key")
+			b.unique[t] = append(b.unique[t], []string{name})
+		case w.is("references"):
+			to, err := w.name()
+			if err != nil {
+				return nil, err
+			}
+			w.group()
+
+			c.ForeignKey = true
+			b.fks = append(b.fks, foreignKey{from: t.Name, columns: []string{name}, to: to})
+		default:
+			if w.group() == nil {
+				w.next()
+			}
+		}
+	}
+
+	return c, nil
+}
+
+func (b *sqlBuilder) constraint(t *Table, w *sqlWords) error {
+	var name string
+	if w.is("constraint") {
+		n, err := w.name()
+		if err != nil {
+			return err
+		}
+		name = n
+	}
+
+	switch {
+	case w.is("primary", "key"):
+		cols, err := w.names()
+		if err != nil {
+			return err
+		}
+
+		for _, n := range cols {
+			c := t.Column(n)
+			if c == nil {
+				return fmt.Errorf("primary key column %q doesn't exist", n)
+			}
+
+			c.PrimaryKey, c.NotNull = true, true
+		}
+
+		b.unique[t] = append(b.unique[t], cols)
+	case w.is("unique"):
+		_ = w.is("key") || w.is("index")
+		if w.peek().text != "(" {
+			w.next()
+		}
+
+		cols, err := w.names()
+		if err != nil {
+			return err
+		}
+
+		b.unique[t] = append(b.unique[t], cols)
+	case w.is("foreign", "key"):
+		if w.peek().text != "(" {
+			w.next()
+		}
+
+		cols, err := w.names()
+		if err != nil {
+			return err
+		}
+
+		if err := w.expect("references"); err != nil {
+			return err
+		}
+
+		to, err := w.name()
+		if err != nil {
+			return err
+		}
+
+		for _, n := range cols {
+			c := t.Column(n)
+			if c == nil {
+				return fmt.Errorf("foreign key column %q doesn't exist", n)
+			}
+
+			c.ForeignKey = true
+		}
+
+		b.fks = append(b.fks, foreignKey{name: name, from: t.Name, columns: cols, to: to})
+	}
+
+	return nil
+}
+
+func (b *sqlBuilder) createIndex(w *sqlWords) error {
+	w.is("concurrently")
+	w.is("if", "not", "exists")
+
+	if !w.is("on") {
+		if _, err := w.name(); err != nil {
+			return err
+		}
+
+		if err := w.expect("on"); err != nil {
+			return err
+		}
+	}
+
+	w.is("only")
+
+	name, err := w.name()
+	if err != nil {
+		return err
+	}
+
+	t, err := b.table(name)
+	if err != nil {
+		return err
+	}
+
+	if w.is("using") {
+		w.next()
+	}
+
+	// indexes on expressions, like `lower(email)`, don't make any columns
+	// unique.
+	cols, err := w.names()
+	if err != nil {
+		return nil
+	}
+
+	b.unique[t] = append(b.unique[t], cols)
+
+	return nil
+}
+
+func (b *sqlBuilder) alterTable(w *sqlWords) error {
+	w.is("if", "exists")
+	w.is("only")
+
+	name, err := w.name()
+	if err != nil {
+		return err
+	}
+
+	t, err := b.table(name)
+	if err != nil {
+		return err
+	}
+
+	for _, action := range splitSQL(w.a[w.i:], ",") {
+		if err := b.alterAction(t, &sqlWords{a: action}); err != nil {
+			return fmt.Errorf("table %q: %w", t.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (b *sqlBuilder) alterAction(t *Table, w *sqlWords) error {
+	switch {
+	case w.is("add"):
+		if first := w.peek(); first.kind == sqlWord && tableConstraints[strings.ToLower(first.text)] {
+			return b.constraint(t, w)
+		}
+
+		w.is("column")
+		ifNotExists := w.is("if", "not", "exists")
+
+		// the column is looked for before it's read, since reading it adds
+		// its keys.
+		start := w.i
+		name, err := w.name()
+		if err != nil {
+			return err
+		}
+
+		if t.Column(name) != nil {
+			if ifNotExists {
+				return nil
+			}
+
+			return fmt.Errorf("column %q already exists", name)
+		}
+		w.i = start
+
+		c, err := b.column(t, w)
+		if err != nil {
+			return err
+		}
+
+		t.Columns = append(t.Columns, c)
+	case w.is("drop", "constraint"), w.is("drop", "foreign", "key"):
+		w.is("if", "exists")
+
+		name, err := w.name()
+		if err != nil {
+			return err
+		}
+
+		b.dropForeignKeys(func(fk foreignKey) bool {
+			return strings.EqualFold(fk.from, t.Name) && strings.EqualFold(fk.name, name)
+		})
+	case w.is("drop", "primary", "key"), w.is("drop", "index"), w.is("drop", "key"):
+	case w.is("drop"):
+		w.is("column")
+		w.is("if", "exists")
+
+		name, err := w.name()
+		if err != nil {
+			return err
+		}
+
+		b.dropColumn(t, name)
+	case w.is("modify"):
+		w.is("column")
+
+		c, err := b.column(t, w)
+		if err != nil {
+			return err
+		}
+
+		old := t.Column(c.Name)
+		if old == nil {
+			return fmt.Errorf("column %q doesn't exist", c.Name)
+		}
+
+		// MySQL replaces the whole column, but keys are kept.
+		c.PrimaryKey, c.ForeignKey = c.PrimaryKey || old.PrimaryKey, c.ForeignKey || old.ForeignKey
+		c.NotNull = c.NotNull || c.PrimaryKey
+		*old = *c
+	case w.is("alter"):
+		w.is("column")
+
+		name, err := w.name()
+		if err != nil {
+			return err
+		}
+
+		c := t.Column(name)
+		if c == nil {
+			return fmt.Errorf("column %q doesn't exist", name)
+		}
+
+		switch {
+		case w.is("set", "not", "null"):
+			c.NotNull = true
+		case w.is("drop", "not", "null"):
+			c.NotNull = c.PrimaryKey
+		case w.is("set", "data", "type"), w.is("type"):
+			start := w.i
+			for !w.done() && !w.is("using") && !w.is("collate") {
+				if w.group() == nil {
+					w.next()
+				}
+			}
+
+			c.Type = formatSQLType(w.a[start:w.i])
+		}
+	case w.is("rename", "column"):
+		return b.renameColumn(t, w)
+	case w.is("rename", "to"), w.is("rename", "as"):
+		name, err := w.name()
+		if err != nil {
+			return err
+		}
+
+		b.renameTable(t, name)
+	case w.is("rename"):
+		return b.renameColumn(t, w)
+	}
+
+	return nil
+}
+
+func (b *sqlBuilder) renameColumn(t *Table, w *sqlWords) error {
+	from, err := w.name()
+	if err != nil {
+		return err
+	}
+
+	if err := w.expect("to"); err != nil {
+		return err
+	}
+
+	to, err := w.name()
+	if err != nil {
+		return err
+	}
+
+	c := t.Column(from)
+	if c == nil {
+		return fmt.Errorf("column %q doesn't exist", from)
+	}
+	c.Name = to
+
+	rename := func(a []string) {
+		for i := range a {
+			if strings.EqualFold(a[i], from) {
+				a[i] = to
+			}
+		}
+	}
+
+	for _, u := range b.unique[t] {
+		rename(u)
+	}
+	for _, fk := range b.fks {
+		if strings.EqualFold(fk.from, t.Name) {
+			rename(fk.columns)
+		}
+	}
+
+	return nil
+}
+
+func (b *sqlBuilder) renameTable(t *Table, name string) {
+	for i := range b.fks {
+		if strings.EqualFold(b.fks[i].from, t.Name) {
+			b.fks[i].from = name
+		}
+		if strings.EqualFold(b.fks[i].to, t.Name) {
+			b.fks[i].to = name
+		}
+	}
+
+	t.Name = name
+}
+
+func (b *sqlBuilder) dropForeignKeys(fn func(fk foreignKey) bool) {
+	var a []foreignKey
+	for _, fk := range b.fks {
+		if !fn(fk) {
+			a = append(a, fk)
+		}
+	}
+
+	b.fks = a
+}
+
+// dropTable drops a table, along with its foreign keys and any that point
+// at it.
+func (b *sqlBuilder) dropTable(name string) {
+	var a []*Table
+	for _, t := range b.s.Tables {
+		if strings.EqualFold(t.Name, name) {
+			delete(b.unique, t)
+		} else {
+			a = append(a, t)
+		}
+	}
+	b.s.Tables = a
+
+	b.dropForeignKeys(func(fk foreignKey) bool {
+		return strings.EqualFold(fk.from, name) || strings.EqualFold(fk.to, name)
+	})
+}
+
+// dropColumn drops a column, along with the keys that use it.
+func (b *sqlBuilder) dropColumn(t *Table, name string) {
+	var a []*Column
+	for _, c := range t.Columns {
+		if !strings.EqualFold(c.Name, name) {
+			a = append(a, c)
+		}
+	}
+	t.Columns = a
+
+	has := func(names []string) bool {
+		for _, n := range names {
+			if strings.EqualFold(n, name) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	var u [][]string
+	for _, e := range b.unique[t] {
+		if !has(e) {
+			u = append(u, e)
+		}
+	}
+	b.unique[t] = u
+
+	b.dropForeignKeys(func(fk foreignKey) bool {
+		return strings.EqualFold(fk.from, t.Name) && has(fk.columns)
+	})
+}
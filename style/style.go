@@ -0,0 +1,381 @@
+package style
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"fknsrs.biz/p/plantuml/parser"
+)
+
+type Style struct {
+	BackgroundColour string
+	BorderColour     string
+	BorderThickness  float64
+	FontColour       string
+	FontName         string
+	FontSize         float64
+	FontStyle        string
+	LineColour       string
+	LineStyle        string
+	LineThickness    float64
+	RoundCorner      float64
+}
+
+var Default = Style{
+	BackgroundColour: "#FEFECE",
+	BorderColour:     "#A80036",
+	BorderThickness:  1.5,
+	FontColour:       "#000000",
+	FontName:         "SansSerif",
+	FontSize:         13,
+	LineColour:       "#A80036",
+	LineThickness:    1,
+}
+
+type setter func(st *Style, v string)
+
+func setColour(field func(st *Style) *string) setter {
+	return func(st *Style, v string) { *field(st) = NormaliseColour(v) }
+}
+
+func setString(field func(st *Style) *string) setter {
+	return func(st *Style, v string) { *field(st) = strings.TrimSpace(v) }
+}
+
+func setNumber(field func(st *Style) *float64) setter {
+	return func(st *Style, v string) {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			*field(st) = f
+		}
+	}
+}
+
+var (
+	backgroundColour = setColour(func(st *Style) *string { return &st.BackgroundColour })
+	borderColour     = setColour(func(st *Style) *string { return &st.BorderColour })
+	borderThickness  = setNumber(func(st *Style) *float64 { return &st.BorderThickness })
+	fontColour       = setColour(func(st *Style) *string { return &st.FontColour })
+	fontName         = setString(func(st *Style) *string { return &st.FontName })
+	fontSize         = setNumber(func(st *Style) *float64 { return &st.FontSize })
+	fontStyle        = setString(func(st *Style) *string { return &st.FontStyle })
+	lineColour       = setColour(func(st *Style) *string { return &st.LineColour })
+	lineStyle        = setString(func(st *Style) *string { return &st.LineStyle })
+	lineThickness    = setNumber(func(st *Style) *float64 { return &st.LineThickness })
+	roundCorner      = setNumber(func(st *Style) *float64 { return &st.RoundCorner })
+)
+
+func both(a, b setter) setter {
+	return func(st *Style, v string) { a(st, v); b(st, v) }
+}
+
+// skinParamProperties maps the property part of a skinparam name (the part
+// after the element prefix) to the field it sets.
+var skinParamProperties = map[string]setter{
+	"backgroundcolor": backgroundColour,
+	"bordercolor":     borderColour,
+	"borderthickness": borderThickness,
+	"borderstyle":     lineStyle,
+	"fontcolor":       fontColour,
+	"fontname":        fontName,
+	"fontsize":        fontSize,
+	"fontstyle":       fontStyle,
+	"linestyle":       lineStyle,
+	"thickness":       lineThickness,
+	"roundcorner":     roundCorner,
+}
+
+// styleProperties maps `<style>` property names to the field they set. Shapes
+// use LineColor and LineThickness for their border, so those set both.
+var styleProperties = map[string]setter{
+	"backgroundcolor": backgroundColour,
+	"linecolor":       both(lineColour, borderColour),
+	"linethickness":   both(lineThickness, borderThickness),
+	"linestyle":       lineStyle,
+	"fontcolor":       fontColour,
+	"fontname":        fontName,
+	"fontsize":        fontSize,
+	"fontstyle":       fontStyle,
+	"roundcorner":     roundCorner,
+}
+
+type element struct {
+	diagram  string
+	name     string
+	prefixes []string
+	colour   setter
+}
+
+func getElement(n parser.Node) element {
+	switch n.(type) {
+	case parser.StateNode:
+		return element{"stateDiagram", "state", []string{"state"}, backgroundColour}
+	case parser.EdgeNode:
+		return element{"stateDiagram", "arrow", []string{"arrow"}, lineColour}
+	case parser.ActionNode:
+		return element{"activityDiagram", "activity", []string{"activity"}, backgroundColour}
+	case parser.IfNode, parser.ElseNode:
+		return element{"activityDiagram", "diamond", []string{"activity", "activityDiamond"}, backgroundColour}
+	case parser.ForkNode:
+		return element{"activityDiagram", "bar", []string{"activityBar"}, backgroundColour}
+	case parser.StartNode:
+		return element{"activityDiagram", "start", []string{"activityStart"}, backgroundColour}
+	case parser.EndNode:
+		return element{"activityDiagram", "end", []string{"activityEnd"}, backgroundColour}
+	case parser.PartitionNode:
+		return element{"activityDiagram", "partition", []string{"partition"}, borderColour}
+	case parser.NoteNode:
+		return element{"", "note", []string{"note"}, backgroundColour}
+	case parser.DocumentNode:
+		return element{"", "", []string{""}, backgroundColour}
+	default:
+		return element{"", "", nil, backgroundColour}
+	}
+}
+
+type rule struct {
+	path       [][]string
+	properties []parser.StylePropertyNode
+}
+
+type layer struct {
+	skinParams []parser.SkinParamNode
+	rules      []rule
+}
+
+func newLayer(doc parser.DocumentNode) layer {
+	var l layer
+
+	l.skinParams = doc.GetSkinParamNodes()
+
+	for _, n := range doc.Nodes {
+		if styleNode, ok := n.(parser.StyleNode); ok {
+			l.rules = append(l.rules, collectRules(styleNode.Children, nil)...)
+		}
+	}
+
+	return l
+}
+
+func collectRules(nodes []parser.Node, path [][]string) []rule {
+	var a []rule
+
+	var properties []parser.StylePropertyNode
+	for _, n := range nodes {
+		if propertyNode, ok := n.(parser.StylePropertyNode); ok {
+			properties = append(properties, propertyNode)
+		}
+	}
+
+	if len(properties) > 0 {
+		a = append(a, rule{path: path, properties: properties})
+	}
+
+	for _, n := range nodes {
+		ruleNode, ok := n.(parser.StyleRuleNode)
+		if !ok {
+			continue
+		}
+
+		var alternatives []string
+		for _, e := range strings.Split(ruleNode.Selector, ",") {
+			if e = strings.ToLower(strings.TrimSpace(e)); e != "" {
+				alternatives = append(alternatives, e)
+			}
+		}
+
+		childPath := append(append([][]string{}, path...), alternatives)
+
+		a = append(a, collectRules(ruleNode.Children, childPath)...)
+	}
+
+	return a
+}
+
+type Resolver struct {
+	layers []layer
+}
+
+// NewResolver collects the themes, skinparams and `<style>` rules declared in
+// a document. Themes are applied first, in the order they're declared, so the
+// document's own settings take precedence over them.
+func NewResolver(doc parser.DocumentNode) (*Resolver, error) {
+	var r Resolver
+
+	for _, n := range doc.Nodes {
+		themeNode, ok := n.(parser.ThemeNode)
+		if !ok {
+			continue
+		}
+
+		if themeNode.From != "" {
+			return nil, fmt.Errorf("NewResolver: can't load theme %q from %q; only built-in themes are supported", themeNode.Name, themeNode.From)
+		}
+
+		themeDocument, err := LoadTheme(themeNode.Name)
+		if err != nil {
+			return nil, fmt.Errorf("NewResolver: %w", err)
+		}
+
+		r.layers = append(r.layers, newLayer(*themeDocument))
+	}
+
+	r.layers = append(r.layers, newLayer(doc))
+
+	return &r, nil
+}
+
+// Resolve computes the effective style of a node. Within each layer the order
+// of precedence, from lowest to highest, is `<style>` rules (ordered by
+// specificity), global skinparams, element skinparams and stereotype
+// skinparams. Inline colours override everything.
+func (r *Resolver) Resolve(n parser.Node) Style {
+	st := Default
+
+	el := getElement(n)
+
+	var stereotype string
+	if stateNode, ok := n.(parser.StateNode); ok {
+		stereotype = stateNode.Stereotype
+	}
+
+	for _, l := range r.layers {
+		l.applyRules(&st, el, stereotype)
+		l.applySkinParams(&st, el, stereotype)
+	}
+
+	if actionNode, ok := n.(parser.ActionNode); ok && actionNode.Colour != "" {
+		el.colour(&st, actionNode.Colour)
+	}
+
+	return st
+}
+
+func (l layer) applyRules(st *Style, el element, stereotype string) {
+	context := []string{"root", "element"}
+	if el.diagram != "" {
+		context = append(context, strings.ToLower(el.diagram))
+	}
+	if el.name != "" {
+		context = append(context, el.name)
+	}
+	if stereotype != "" {
+		context = append(context, "."+strings.ToLower(strings.Trim(stereotype, "<>")))
+	}
+
+	type match struct {
+		rule        rule
+		specificity int
+	}
+
+	var matches []match
+	for _, e := range l.rules {
+		if specificity, ok := matchPath(e.path, context); ok {
+			matches = append(matches, match{rule: e, specificity: specificity})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].specificity < matches[j].specificity
+	})
+
+	for _, m := range matches {
+		for _, p := range m.rule.properties {
+			if fn, ok := styleProperties[strings.ToLower(p.Name)]; ok {
+				fn(st, p.Value)
+			}
+		}
+	}
+}
+
+// matchPath checks that every component of a rule's selector path appears in
+// the element's context, in order. The specificity is the sum of the
+// positions matched, so rules naming the element or its stereotype beat rules
+// that only name the diagram.
+func matchPath(path [][]string, context []string) (int, bool) {
+	var specificity int
+
+	i := 0
+	for _, alternatives := range path {
+		found := false
+
+		for ; i < len(context) && !found; i++ {
+			for _, e := range alternatives {
+				if matchComponent(e, context, i) {
+					found = true
+					specificity += i + 1
+					break
+				}
+			}
+		}
+
+		if !found {
+			return 0, false
+		}
+	}
+
+	return specificity, true
+}
+
+// matchComponent matches a single selector component such as `state`,
+// `.warning` or `state.warning` against a position in the context.
+func matchComponent(component string, context []string, i int) bool {
+	if component == context[i] {
+		return true
+	}
+
+	j := strings.Index(component, ".")
+	if j <= 0 || context[i] != component[j:] {
+		return false
+	}
+
+	for _, e := range context[0:i] {
+		if e == component[0:j] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l layer) applySkinParams(st *Style, el element, stereotype string) {
+	apply := func(prefix, stereotype string) {
+		for _, e := range l.skinParams {
+			if e.Stereotype != stereotype || len(e.Name) < len(prefix) || !strings.EqualFold(e.Name[0:len(prefix)], prefix) {
+				continue
+			}
+
+			property := strings.ToLower(e.Name[len(prefix):])
+
+			if property == "color" {
+				el.colour(st, e.Value)
+				continue
+			}
+
+			if fn, ok := skinParamProperties[property]; ok {
+				fn(st, e.Value)
+			}
+		}
+	}
+
+	for _, e := range l.skinParams {
+		if e.Stereotype != "" || !strings.EqualFold(e.Name, "roundcorner") {
+			continue
+		}
+
+		roundCorner(st, e.Value)
+	}
+
+	apply("default", "")
+
+	for _, prefix := range el.prefixes {
+		apply(prefix, "")
+	}
+
+	if stereotype != "" {
+		for _, prefix := range el.prefixes {
+			apply(prefix, stereotype)
+		}
+	}
+}
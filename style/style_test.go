@@ -0,0 +1,140 @@
+package style
+
+import (
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+
+  "fknsrs.biz/p/plantuml/parser"
+)
+
+const testDocument = `@startuml
+
+skinparam defaultFontName Courier New
+skinparam roundCorner 10
+skinparam state {
+  BackgroundColor LightBlue
+  BackgroundColor<<Warning>> Orange
+}
+skinparam ArrowColor #333
+
+<style>
+stateDiagram {
+  state {
+    FontColor blue
+    FontSize 15
+  }
+  .Warning {
+    FontColor red
+  }
+}
+activityDiagram {
+  LineThickness 2
+}
+</style>
+
+state Idle
+state "Hot" as Hot <<Warning>>
+Idle --> Hot
+
+partition "P" {
+  #Gold:Inline;
+  :Plain;
+}
+
+@enduml
+`
+
+func findNode(doc *parser.DocumentNode, name string) []parser.Node {
+  var a []parser.Node
+
+  parser.Walk(*doc, func(n parser.Node) error {
+    if n.NodeName() == name {
+      a = append(a, n)
+    }
+
+    return nil
+  })
+
+  return a
+}
+
+func TestResolve(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := parser.ParseDocument(testDocument)
+  a.NoError(err)
+
+  r, err := NewResolver(*doc)
+  a.NoError(err)
+
+  states := findNode(doc, "StateNode")
+  a.Len(states, 2)
+
+  idle := r.Resolve(states[0])
+  a.Equal("#ADD8E6", idle.BackgroundColour)
+  a.Equal("#0000FF", idle.FontColour)
+  a.Equal(15.0, idle.FontSize)
+  a.Equal("Courier New", idle.FontName)
+  a.Equal(10.0, idle.RoundCorner)
+
+  hot := r.Resolve(states[1])
+  a.Equal("#FFA500", hot.BackgroundColour)
+  a.Equal("#FF0000", hot.FontColour)
+
+  edge := r.Resolve(findNode(doc, "EdgeNode")[0])
+  a.Equal("#333333", edge.LineColour)
+
+  actions := findNode(doc, "ActionNode")
+  a.Len(actions, 2)
+  a.Equal("#FFD700", r.Resolve(actions[0]).BackgroundColour)
+  a.Equal(Default.BackgroundColour, r.Resolve(actions[1]).BackgroundColour)
+  a.Equal(2.0, r.Resolve(actions[1]).BorderThickness)
+}
+
+func TestResolveTheme(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := parser.ParseDocument("@startuml\n!theme plain\nskinparam stateBorderColor Red\nstate A\n@enduml\n")
+  a.NoError(err)
+
+  r, err := NewResolver(*doc)
+  a.NoError(err)
+
+  st := r.Resolve(findNode(doc, "StateNode")[0])
+  a.Equal("#FFFFFF", st.BackgroundColour)
+  a.Equal("#FF0000", st.BorderColour)
+  a.Equal("Helvetica", st.FontName)
+}
+
+func TestResolveUnknownTheme(t *testing.T) {
+  a := assert.New(t)
+
+  doc, err := parser.ParseDocument("@startuml\n!theme nope\n@enduml\n")
+  a.NoError(err)
+
+  _, err = NewResolver(*doc)
+  a.Error(err)
+}
+
+func TestThemes(t *testing.T) {
+  a := assert.New(t)
+
+  a.Equal([]string{"blueprint", "mono", "plain"}, Themes())
+
+  for _, name := range Themes() {
+    _, err := LoadTheme(name)
+    a.NoError(err, name)
+  }
+}
+
+func TestNormaliseColour(t *testing.T) {
+  a := assert.New(t)
+
+  a.Equal("#FF0000", NormaliseColour("Red"))
+  a.Equal("#FF0000", NormaliseColour("#red"))
+  a.Equal("#AABBCC", NormaliseColour("#abc"))
+  a.Equal("#A80036", NormaliseColour("a80036"))
+  a.Equal("transparent", NormaliseColour("#transparent"))
+  a.Equal("", NormaliseColour(""))
+}
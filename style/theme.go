@@ -0,0 +1,44 @@
+package style
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"fknsrs.biz/p/plantuml/parser"
+)
+
+//go:embed themes/*.puml
+var themeFiles embed.FS
+
+func Themes() []string {
+	entries, err := themeFiles.ReadDir("themes")
+	if err != nil {
+		return nil
+	}
+
+	var a []string
+	for _, e := range entries {
+		a = append(a, strings.TrimSuffix(e.Name(), ".puml"))
+	}
+
+	sort.Strings(a)
+
+	return a
+}
+
+func LoadTheme(name string) (*parser.DocumentNode, error) {
+	d, err := themeFiles.ReadFile(path.Join("themes", name+".puml"))
+	if err != nil {
+		return nil, fmt.Errorf("LoadTheme: unknown theme %q", name)
+	}
+
+	doc, err := parser.ParseDocument(string(d))
+	if err != nil {
+		return nil, fmt.Errorf("LoadTheme: could not parse theme %q: %w", name, err)
+	}
+
+	return doc, nil
+}
@@ -0,0 +1,263 @@
+package timing
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"fknsrs.biz/p/plantuml/parser"
+)
+
+// Change is a participant going into a state at a point in time.
+type Change struct {
+	Time  int
+	State string
+}
+
+// Participant is one line of a timing diagram, with the changes it goes
+// through in time order. Period, Pulse and Offset are only set for clocks.
+type Participant struct {
+	Kind    string
+	Name    string
+	Label   string
+	Period  int
+	Pulse   int
+	Offset  int
+	Changes []Change
+}
+
+// States is the states a participant goes through, in order.
+func (p Participant) States() []string {
+	var a []string
+	for _, c := range p.Changes {
+		a = append(a, c.State)
+	}
+
+	return a
+}
+
+// StateAt is the state a participant is in at time t, or an empty string if
+// it hasn't been given one yet.
+func (p Participant) StateAt(t int) string {
+	var s string
+	for _, c := range p.Changes {
+		if c.Time > t {
+			break
+		}
+
+		s = c.State
+	}
+
+	return s
+}
+
+// Message is an edge between two participants, like `WU -> WB : URL`, which
+// can also be written with times, like `WU@100 -> WB@+50`.
+type Message struct {
+	From     string
+	To       string
+	FromTime int
+	ToTime   int
+	Text     string
+}
+
+type Highlight struct {
+	From   int
+	To     int
+	Colour string
+	Text   string
+}
+
+// Constraint is a time constraint. Participant is empty if it's on the time
+// axis.
+type Constraint struct {
+	Participant string
+	From        int
+	To          int
+	Text        string
+}
+
+type Diagram struct {
+	Participants []*Participant
+	Messages     []Message
+	Highlights   []Highlight
+	Constraints  []Constraint
+}
+
+// Participant finds a participant by name, or returns nil if there isn't
+// one.
+func (d *Diagram) Participant(name string) *Participant {
+	for _, p := range d.Participants {
+		if p.Name == name {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// NewDiagram builds the model of a timing diagram from a document. Times are
+// worked out the way PlantUML does it: `@+50` is relative to the tick before
+// it, and in a participant's tick like `@WB`, each state change is relative
+// to the one before it, starting from the last time tick. Only plain numbers
+// are supported as times, not dates or anchors.
+func NewDiagram(doc parser.DocumentNode) (*Diagram, error) {
+	b := builder{d: &Diagram{}}
+
+	if err := b.nodes(doc.Nodes, ""); err != nil {
+		return nil, fmt.Errorf("NewDiagram: %w", err)
+	}
+
+	for _, p := range b.d.Participants {
+		sort.SliceStable(p.Changes, func(i, j int) bool { return p.Changes[i].Time < p.Changes[j].Time })
+	}
+
+	return b.d, nil
+}
+
+type builder struct {
+	d   *Diagram
+	now int
+}
+
+// nodes adds nodes to the diagram. participant is set when they're in that
+// participant's tick, in which case local is the time of the last change.
+func (b *builder) nodes(nodes []parser.Node, participant string) error {
+	local := b.now
+
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case parser.TimingParticipantNode:
+			if b.d.Participant(n.Name) != nil {
+				return fmt.Errorf("%s: participant %q is declared twice", n.SourceRange, n.Name)
+			}
+
+			b.d.Participants = append(b.d.Participants, &Participant{
+				Kind:   n.Kind,
+				Name:   n.Name,
+				Label:  n.Label,
+				Period: n.Period,
+				Pulse:  n.Pulse,
+				Offset: n.Offset,
+			})
+		case parser.TickNode:
+			if n.Participant != "" {
+				if b.d.Participant(n.Participant) == nil {
+					return fmt.Errorf("%s: unknown participant %q", n.SourceRange, n.Participant)
+				}
+			} else {
+				t, err := resolve(n.Time, b.now)
+				if err != nil {
+					return fmt.Errorf("%s: %w", n.SourceRange, err)
+				}
+
+				b.now = t
+			}
+
+			if err := b.nodes(n.Children, n.Participant); err != nil {
+				return err
+			}
+		case parser.StateChangeNode:
+			p := b.d.Participant(n.Participant)
+			if p == nil {
+				return fmt.Errorf("%s: unknown participant %q", n.SourceRange, n.Participant)
+			}
+
+			t := b.now
+			if participant != "" {
+				var err error
+				if t, err = resolve(n.Time, local); err != nil {
+					return fmt.Errorf("%s: %w", n.SourceRange, err)
+				}
+
+				local = t
+			}
+
+			p.Changes = append(p.Changes, Change{Time: t, State: n.State})
+		case parser.EdgeNode:
+			m := Message{Text: n.Text}
+
+			var err error
+			if m.From, m.FromTime, err = b.endpoint(n.Left); err != nil {
+				return fmt.Errorf("%s: %w", n.SourceRange, err)
+			}
+			if m.To, m.ToTime, err = b.endpoint(n.Right); err != nil {
+				return fmt.Errorf("%s: %w", n.SourceRange, err)
+			}
+
+			b.d.Messages = append(b.d.Messages, m)
+		case parser.HighlightNode:
+			h := Highlight{Colour: n.Colour, Text: n.Text}
+
+			var err error
+			if h.From, err = resolve(n.From, b.now); err != nil {
+				return fmt.Errorf("%s: %w", n.SourceRange, err)
+			}
+			if h.To, err = resolve(n.To, b.now); err != nil {
+				return fmt.Errorf("%s: %w", n.SourceRange, err)
+			}
+
+			b.d.Highlights = append(b.d.Highlights, h)
+		case parser.ConstraintNode:
+			if n.Participant != "" && b.d.Participant(n.Participant) == nil {
+				return fmt.Errorf("%s: unknown participant %q", n.SourceRange, n.Participant)
+			}
+
+			c := Constraint{Participant: n.Participant, Text: n.Text}
+
+			var err error
+			if c.From, err = resolve(n.From, b.now); err != nil {
+				return fmt.Errorf("%s: %w", n.SourceRange, err)
+			}
+			if c.To, err = resolve(n.To, b.now); err != nil {
+				return fmt.Errorf("%s: %w", n.SourceRange, err)
+			}
+
+			b.d.Constraints = append(b.d.Constraints, c)
+		}
+	}
+
+	return nil
+}
+
+// endpoint splits the end of a message into the participant and the time,
+// which is the current time unless it's given with `@`.
+func (b *builder) endpoint(s string) (string, int, error) {
+	name, t := s, b.now
+
+	if i := strings.Index(s, "@"); i != -1 {
+		var err error
+		if t, err = resolve(s[i+1:], b.now); err != nil {
+			return "", 0, err
+		}
+
+		name = s[:i]
+	}
+
+	if b.d.Participant(name) == nil {
+		return "", 0, fmt.Errorf("unknown participant %q", name)
+	}
+
+	return name, t, nil
+}
+
+// resolve works out a time, which is either a number or a number relative to
+// base, like `+50`.
+func resolve(s string, base int) (int, error) {
+	if strings.HasPrefix(s, "+") {
+		n, err := strconv.Atoi(s[1:])
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+
+		return base + n, nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,96 @@
+package timing
+
+import (
+  "testing"
+
+  "github.com/stretchr/testify/assert"
+
+  "fknsrs.biz/p/plantuml/parser"
+)
+
+func build(t *testing.T, src string) *Diagram {
+  doc, err := parser.ParseDocument(src)
+  if !assert.NoError(t, err) {
+    return nil
+  }
+
+  d, err := NewDiagram(*doc)
+  if !assert.NoError(t, err) {
+    return nil
+  }
+
+  return d
+}
+
+func TestNewDiagram(t *testing.T) {
+  a := assert.New(t)
+
+  d := build(t, `@startuml
+robust "Web Browser" as WB
+concise "Web User" as WU
+clock clk with period 50
+
+WU is Idle
+WB is Idle
+
+@100
+WU -> WB : URL
+WU is Waiting
+WB is Processing
+
+@WB
++200 is Waiting
++100 is Idle
+
+@+50
+WU is Idle
+WB@0 <-> @+100 : {lag}
+highlight 200 to 300 #Gold : busy
+@enduml
+`)
+  if d == nil {
+    return
+  }
+
+  if a.Len(d.Participants, 3) {
+    a.Equal("clock", d.Participants[2].Kind)
+    a.Equal(50, d.Participants[2].Period)
+  }
+
+  wb := d.Participant("WB")
+  if a.NotNil(wb) {
+    a.Equal([]string{"Idle", "Processing", "Waiting", "Idle"}, wb.States())
+    a.Equal([]Change{{0, "Idle"}, {100, "Processing"}, {300, "Waiting"}, {400, "Idle"}}, wb.Changes)
+    a.Equal("Processing", wb.StateAt(299))
+    a.Equal("Waiting", wb.StateAt(300))
+  }
+
+  wu := d.Participant("WU")
+  if a.NotNil(wu) {
+    a.Equal([]Change{{0, "Idle"}, {100, "Waiting"}, {150, "Idle"}}, wu.Changes)
+    a.Equal("", Participant{}.StateAt(0))
+  }
+
+  a.Equal([]Message{{From: "WU", To: "WB", FromTime: 100, ToTime: 100, Text: "URL"}}, d.Messages)
+  a.Equal([]Constraint{{Participant: "WB", From: 0, To: 250, Text: "lag"}}, d.Constraints)
+  a.Equal([]Highlight{{From: 200, To: 300, Colour: "Gold", Text: "busy"}}, d.Highlights)
+}
+
+func TestNewDiagramErrors(t *testing.T) {
+  for _, src := range []string{
+    "@startuml\nWU is Idle\n@enduml\n",
+    "@startuml\nconcise WU\n@WB\n0 is Idle\n@enduml\n",
+    "@startuml\nconcise WU\n@soon\n@enduml\n",
+    "@startuml\nconcise WU\n@1x\nWU is Idle\n@enduml\n",
+    "@startuml\nconcise WU\nWU -> WB\n@enduml\n",
+    "@startuml\nconcise WU\nconcise WU\n@enduml\n",
+  } {
+    doc, err := parser.ParseDocument(src)
+    if !assert.NoError(t, err, src) {
+      continue
+    }
+
+    _, err = NewDiagram(*doc)
+    assert.Error(t, err, src)
+  }
+}